@@ -1,6 +1,8 @@
 package client
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
@@ -21,6 +23,21 @@ const (
 	// FlagCloseASAP this client option will close the connection as soon as
 	// the server replies.
 	FlagCloseASAP
+	// FlagBlocked is a client option set while the client is waiting for
+	// a key to be ready.
+	FlagBlocked
+	// FlagDenyBlocking is a client option that makes blocking commands reply
+	// immediately instead of waiting.
+	FlagDenyBlocking
+	// FlagMulti is a client option set while the client is queueing the
+	// commands of a transaction.
+	FlagMulti
+	// FlagDirtyExec is a client option set when a command could not be
+	// queued, so that the transaction is aborted by EXEC.
+	FlagDirtyExec
+	// FlagPubSub is a client option set while the client is subscribed to a
+	// channel or a pattern.
+	FlagPubSub
 )
 
 func (f Flags) String() string {
@@ -37,6 +54,15 @@ func (f Flags) String() string {
 	if f&FlagCloseASAP != 0 {
 		s += "c"
 	}
+	if f&FlagBlocked != 0 {
+		s += "B"
+	}
+	if f&FlagMulti != 0 {
+		s += "x"
+	}
+	if f&FlagPubSub != 0 {
+		s += "P"
+	}
 	return s
 }
 
@@ -46,7 +72,9 @@ type Client struct {
 	ID int64
 	// Name is the name of the client.
 	Name string
-	// Flags is a bitmask of client options.
+	// Flags is a bitmask of client options. It is accessed atomically
+	// through the methods of the client, as a blocked client is unblocked
+	// without holding its lock.
 	Flags Flags
 	// Conn is the underlying connection.
 	Conn gnet.Conn
@@ -60,21 +88,77 @@ type Client struct {
 	Argc int
 	// Argv is the arguments excluding the command.
 	Argv [][]byte
+	// Propagate, when set by the command, are the commands logged to the
+	// append-only file instead of the command itself. Used by commands that
+	// are not deterministic.
+	Propagate [][][]byte
+	// Queued are the commands of the transaction started by MULTI.
+	Queued []QueuedCommand
+	// Watched are the keys that abort the transaction if they are modified
+	// before EXEC.
+	Watched []WatchedKey
 	// CreateTime is the time when the client is created.
 	CreateTime time.Time
+
+	// mu serializes the commands of the client, which are handled by
+	// different goroutines of the pool.
+	mu sync.Mutex
+}
+
+// QueuedCommand is a command queued in a transaction, as sent by the client.
+type QueuedCommand struct {
+	// Name is the lowercase name of the command.
+	Name []byte
+	// Argv is the arguments excluding the command.
+	Argv [][]byte
+}
+
+// WatchedKey is a key watched by the client.
+type WatchedKey struct {
+	// Key is the watched key.
+	Key string
+	// Version is the version of the key when it was watched, 0 if the key
+	// did not exist.
+	Version int64
+}
+
+// Lock waits until the client is not executing any other command.
+func (c *Client) Lock() {
+	c.mu.Lock()
+}
+
+// Unlock allows the next command of the client to be executed.
+func (c *Client) Unlock() {
+	c.mu.Unlock()
+}
+
+// GetFlags returns the flags of the client.
+func (c *Client) GetFlags() Flags {
+	return Flags(atomic.LoadUint32((*uint32)(&c.Flags)))
 }
 
 // HasFlag returns true if the client has the specified flag.
 func (c *Client) HasFlag(flag Flags) bool {
-	return c.Flags&flag != 0
+	return c.GetFlags()&flag != 0
 }
 
 // AddFlag adds the specified flag to the client.
 func (c *Client) AddFlag(flag Flags) {
-	c.Flags |= flag
+	c.updateFlags(func(f Flags) Flags { return f | flag })
 }
 
 // RemoveFlag removes the specified flag from the client.
 func (c *Client) RemoveFlag(flag Flags) {
-	c.Flags &= ^flag
+	c.updateFlags(func(f Flags) Flags { return f &^ flag })
+}
+
+// updateFlags atomically replaces the flags of the client.
+func (c *Client) updateFlags(update func(Flags) Flags) {
+	addr := (*uint32)(&c.Flags)
+	for {
+		old := atomic.LoadUint32(addr)
+		if atomic.CompareAndSwapUint32(addr, old, uint32(update(Flags(old)))) {
+			return
+		}
+	}
 }
\ No newline at end of file
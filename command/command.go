@@ -2,18 +2,45 @@ package command
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 
 	"github.com/HotPotatoC/kvstore-rewrite/client"
 )
 
+// ErrInvalidKeyArguments is returned by a KeysFunc when the arguments that
+// give the positions of the keys are invalid.
+var ErrInvalidKeyArguments = errors.New("invalid arguments specified for command")
+
 // Command represents the command
 type Command struct {
 	// Name is the command name
 	Name string
 	// Description is the command description
 	Description string
+	// Group is the group the command belongs to (string, generic, server, etc)
+	Group string
 	// Type is the command type (read, write, etc)
 	Type Type
+	// Arity is the number of arguments including the command name itself.
+	// A negative arity means the command takes at least -Arity arguments.
+	Arity int
+	// FirstKey is the position of the first key in the arguments
+	// (the command name is at position 0), 0 if the command takes no keys
+	FirstKey int
+	// LastKey is the position of the last key in the arguments, a negative
+	// position is counted from the end of the arguments (-1 is the last argument)
+	LastKey int
+	// Step is the distance between two keys in the arguments
+	Step int
+	// KeysFunc extracts the keys of commands whose key positions depend on
+	// the arguments. FirstKey, LastKey and Step are only used by COMMAND INFO
+	// when it is set.
+	KeysFunc KeysFunc
+	// Flags is a bitmask of command options
+	Flags Flag
+	// Categories is a bitmask of the ACL categories of the command
+	Categories Category
 	// Proc is the command processor
 	Proc Proc
 	// SubCommands is the sub-commands
@@ -23,6 +50,10 @@ type Command struct {
 // Proc is the command processor
 type Proc func(client *client.Client)
 
+// KeysFunc returns the keys in the given arguments (including the command
+// name), or ErrInvalidKeyArguments if the keys cannot be found
+type KeysFunc func(argv [][]byte) ([][]byte, error)
+
 // Type is the command type (read, write, etc)
 type Type uint8
 
@@ -36,12 +67,234 @@ const (
 	ReadWrite Type = Read | Write
 )
 
+// Flag is a bitmask of command options
+type Flag uint32
+
+const (
+	// FlagAdmin is an administrative command
+	FlagAdmin Flag = 1 << iota
+	// FlagFast is a command that runs in constant or logarithmic time
+	FlagFast
+	// FlagDenyOOM is a command that may increase memory usage
+	FlagDenyOOM
+	// FlagNoMulti is a command that cannot be queued in a transaction
+	FlagNoMulti
+)
+
+var flagNames = []struct {
+	flag Flag
+	name string
+}{
+	{FlagAdmin, "admin"},
+	{FlagFast, "fast"},
+	{FlagDenyOOM, "denyoom"},
+	{FlagNoMulti, "no-multi"},
+}
+
+// Category is a bitmask of ACL categories
+type Category uint32
+
+const (
+	// CategoryKeyspace is for commands that operate on keys regardless of their type
+	CategoryKeyspace Category = 1 << iota
+	// CategoryRead is for commands that read data
+	CategoryRead
+	// CategoryWrite is for commands that write data
+	CategoryWrite
+	// CategoryString is for commands that operate on strings
+	CategoryString
+	// CategoryAdmin is for administrative commands
+	CategoryAdmin
+	// CategoryFast is for commands that run in constant or logarithmic time
+	CategoryFast
+	// CategorySlow is for every command that is not fast
+	CategorySlow
+	// CategoryDangerous is for potentially dangerous commands
+	CategoryDangerous
+	// CategoryConnection is for commands that affect the connection
+	CategoryConnection
+	// CategoryList is for commands that operate on lists
+	CategoryList
+	// CategoryHash is for commands that operate on hashes
+	CategoryHash
+	// CategorySet is for commands that operate on sets
+	CategorySet
+	// CategorySortedSet is for commands that operate on sorted sets
+	CategorySortedSet
+	// CategoryStream is for commands that operate on streams
+	CategoryStream
+	// CategoryBlocking is for commands that may block the connection
+	CategoryBlocking
+	// CategoryBitmap is for commands that operate on bitmaps
+	CategoryBitmap
+	// CategoryHyperLogLog is for commands that operate on HyperLogLogs
+	CategoryHyperLogLog
+	// CategoryGeo is for commands that operate on geospatial indexes
+	CategoryGeo
+	// CategoryJSON is for commands that operate on JSON documents
+	CategoryJSON
+	// CategoryBloom is for commands that operate on Bloom filters
+	CategoryBloom
+	// CategoryCuckoo is for commands that operate on cuckoo filters
+	CategoryCuckoo
+	// CategoryCMS is for commands that operate on count-min sketches
+	CategoryCMS
+	// CategoryTopK is for commands that operate on top-k sketches
+	CategoryTopK
+	// CategoryTimeSeries is for commands that operate on time series
+	CategoryTimeSeries
+	// CategoryTransaction is for commands that control transactions
+	CategoryTransaction
+	// CategoryPubSub is for commands related to publish/subscribe
+	CategoryPubSub
+)
+
+var categoryNames = []struct {
+	category Category
+	name     string
+}{
+	{CategoryKeyspace, "keyspace"},
+	{CategoryRead, "read"},
+	{CategoryWrite, "write"},
+	{CategoryString, "string"},
+	{CategoryAdmin, "admin"},
+	{CategoryFast, "fast"},
+	{CategorySlow, "slow"},
+	{CategoryDangerous, "dangerous"},
+	{CategoryConnection, "connection"},
+	{CategoryList, "list"},
+	{CategoryHash, "hash"},
+	{CategorySet, "set"},
+	{CategorySortedSet, "sortedset"},
+	{CategoryStream, "stream"},
+	{CategoryBlocking, "blocking"},
+	{CategoryBitmap, "bitmap"},
+	{CategoryHyperLogLog, "hyperloglog"},
+	{CategoryGeo, "geo"},
+	{CategoryJSON, "json"},
+	{CategoryBloom, "bloom"},
+	{CategoryCuckoo, "cuckoo"},
+	{CategoryCMS, "cms"},
+	{CategoryTopK, "topk"},
+	{CategoryTimeSeries, "timeseries"},
+	{CategoryTransaction, "transaction"},
+	{CategoryPubSub, "pubsub"},
+}
+
+// FlagNames returns the names of the command flags, including the
+// flags implied by the command type.
+func (c *Command) FlagNames() []string {
+	var names []string
+	if c.Type&Write != 0 {
+		names = append(names, "write")
+	} else if c.Type&Read != 0 {
+		names = append(names, "readonly")
+	}
+
+	for _, f := range flagNames {
+		if c.Flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+
+	if c.KeysFunc != nil {
+		names = append(names, "movablekeys")
+	}
+
+	return names
+}
+
+// AllCategories returns the ACL categories of the command including the
+// categories implied by the command type and flags.
+func (c *Command) AllCategories() Category {
+	categories := c.Categories
+
+	if c.FirstKey > 0 || c.KeysFunc != nil {
+		if c.Type&Write != 0 {
+			categories |= CategoryWrite
+		} else if c.Type&Read != 0 {
+			categories |= CategoryRead
+		}
+	}
+
+	if c.Flags&FlagAdmin != 0 {
+		categories |= CategoryAdmin | CategoryDangerous
+	}
+
+	if c.Flags&FlagFast != 0 {
+		categories |= CategoryFast
+	} else {
+		categories |= CategorySlow
+	}
+
+	return categories
+}
+
+// CategoryNames returns the names of the ACL categories of the command
+// prefixed with '@'.
+func (c *Command) CategoryNames() []string {
+	categories := c.AllCategories()
+
+	var names []string
+	for _, cat := range categoryNames {
+		if categories&cat.category != 0 {
+			names = append(names, "@"+cat.name)
+		}
+	}
+
+	return names
+}
+
+// CheckArity returns true if the given number of arguments (including
+// the command name) satisfies the arity of the command.
+func (c *Command) CheckArity(argc int) bool {
+	if c.Arity >= 0 {
+		return argc == c.Arity
+	}
+	return argc >= -c.Arity
+}
+
+// GetKeys returns the keys in the given arguments (including the command
+// name) according to the key positions of the command.
+func (c *Command) GetKeys(argv [][]byte) ([][]byte, error) {
+	if c.KeysFunc != nil {
+		return c.KeysFunc(argv)
+	}
+
+	if c.FirstKey <= 0 {
+		return nil, nil
+	}
+
+	last := c.LastKey
+	if last < 0 {
+		last = len(argv) + last
+	}
+
+	step := c.Step
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys [][]byte
+	for i := c.FirstKey; i <= last && i < len(argv); i += step {
+		keys = append(keys, argv[i])
+	}
+
+	return keys, nil
+}
+
+// FullName returns the name of the sub-command prefixed with
+// the name of its parent command (e.g. "client|kill").
+func FullName(parent, name string) string {
+	return strings.ToLower(parent) + "|" + strings.ToLower(name)
+}
+
 func WrapArgsFromQuotes(args [][]byte) [][]byte {
 	var wrappedArgs [][]byte
 	var buf bytes.Buffer
 
 	for _, arg := range args {
-		if arg[0] == '"' {
+		if len(arg) > 0 && arg[0] == '"' {
 			if buf.Len() > 0 {
 				wrappedArgs = append(wrappedArgs, buf.Bytes())
 				buf.Reset()
@@ -2,6 +2,7 @@ package command_test
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/HotPotatoC/kvstore-rewrite/command"
@@ -53,3 +54,79 @@ func TestWrapArgsFromQuotes(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckArity(t *testing.T) {
+	tc := []struct {
+		name  string
+		arity int
+		argc  int
+		exp   bool
+	}{
+		{name: "Exact", arity: 2, argc: 2, exp: true},
+		{name: "Exact too few", arity: 2, argc: 1, exp: false},
+		{name: "Exact too many", arity: 2, argc: 3, exp: false},
+		{name: "Minimum", arity: -3, argc: 3, exp: true},
+		{name: "Minimum more", arity: -3, argc: 10, exp: true},
+		{name: "Minimum too few", arity: -3, argc: 2, exp: false},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := command.Command{Arity: tt.arity}
+			if got := cmd.CheckArity(tt.argc); got != tt.exp {
+				t.Errorf("expected %v, got %v", tt.exp, got)
+			}
+		})
+	}
+}
+
+func TestGetKeys(t *testing.T) {
+	argv := [][]byte{[]byte("cmd"), []byte("a"), []byte("1"), []byte("b"), []byte("2")}
+
+	tc := []struct {
+		name string
+		cmd  command.Command
+		exp  [][]byte
+		err  error
+	}{
+		{name: "No keys", cmd: command.Command{}, exp: nil},
+		{name: "Single key", cmd: command.Command{FirstKey: 1, LastKey: 1, Step: 1}, exp: [][]byte{[]byte("a")}},
+		{name: "Every other argument", cmd: command.Command{FirstKey: 1, LastKey: -1, Step: 2}, exp: [][]byte{[]byte("a"), []byte("b")}},
+		{name: "Every argument", cmd: command.Command{FirstKey: 1, LastKey: -1, Step: 1}, exp: argv[1:]},
+		{name: "Keys function", cmd: command.Command{FirstKey: 1, LastKey: 1, Step: 1, KeysFunc: func(argv [][]byte) ([][]byte, error) {
+			return [][]byte{argv[3]}, nil
+		}}, exp: [][]byte{[]byte("b")}},
+		{name: "Keys function error", cmd: command.Command{FirstKey: 1, LastKey: 1, Step: 1, KeysFunc: func(argv [][]byte) ([][]byte, error) {
+			return nil, command.ErrInvalidKeyArguments
+		}}, exp: nil, err: command.ErrInvalidKeyArguments},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cmd.GetKeys(argv)
+			if err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if !equal(got, tt.exp) {
+				t.Errorf("expected %q, got %q", tt.exp, got)
+			}
+		})
+	}
+}
+
+func TestCategoryNames(t *testing.T) {
+	cmd := command.Command{
+		Type:       command.Write,
+		FirstKey:   1,
+		LastKey:    1,
+		Step:       1,
+		Flags:      command.FlagFast,
+		Categories: command.CategoryString,
+	}
+
+	exp := []string{"@write", "@string", "@fast"}
+	got := cmd.CategoryNames()
+	if strings.Join(got, " ") != strings.Join(exp, " ") {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"errors"
+	"math"
 )
 
 var (
@@ -35,3 +36,60 @@ func ByteToInt(b []byte) (int64, error) {
 	}
 	return n, nil
 }
+
+// ParseInt parses a base 10 integer like ByteToInt, but rejects the
+// representations that would not be formatted back the same way (empty,
+// leading zeros, "-0") and returns ErrOverflow if the number does not fit
+// in an int64.
+func ParseInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, ErrInvalidInt
+	}
+
+	if len(b) == 1 && b[0] == '0' {
+		return 0, nil
+	}
+
+	negate := false
+	if b[0] == '-' {
+		negate = true
+		b = b[1:]
+	}
+
+	if len(b) == 0 || b[0] < '1' || b[0] > '9' {
+		return 0, ErrInvalidInt
+	}
+
+	// The number is accumulated as a negative value since the range of
+	// negative numbers is larger
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidInt
+		}
+
+		d := int64(c - '0')
+		if n < (math.MinInt64+d)/10 {
+			return 0, ErrOverflow
+		}
+		n = n*10 - d
+	}
+
+	if negate {
+		return n, nil
+	}
+
+	if n == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return -n, nil
+}
+
+// AddInt returns the sum of a and b, or ErrOverflow if it does not fit in
+// an int64.
+func AddInt(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
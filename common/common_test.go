@@ -39,3 +39,69 @@ func Test_ByteToInt(t *testing.T) {
 		})
 	}
 }
+
+func Test_ParseInt(t *testing.T) {
+	tc := []struct {
+		name     string
+		b        []byte
+		expected int64
+		err      error
+	}{
+		{"zero", []byte("0"), 0, nil},
+		{"one", []byte("1"), 1, nil},
+		{"negative", []byte("-10"), -10, nil},
+		{"max int64", []byte("9223372036854775807"), math.MaxInt64, nil},
+		{"min int64", []byte("-9223372036854775808"), math.MinInt64, nil},
+		{"overflow", []byte("9223372036854775808"), 0, common.ErrOverflow},
+		{"negative overflow", []byte("-9223372036854775809"), 0, common.ErrOverflow},
+		{"large overflow", []byte("99999999999999999999"), 0, common.ErrOverflow},
+		{"empty", []byte(""), 0, common.ErrInvalidInt},
+		{"minus", []byte("-"), 0, common.ErrInvalidInt},
+		{"negative zero", []byte("-0"), 0, common.ErrInvalidInt},
+		{"leading zero", []byte("01"), 0, common.ErrInvalidInt},
+		{"plus sign", []byte("+1"), 0, common.ErrInvalidInt},
+		{"space", []byte(" 1"), 0, common.ErrInvalidInt},
+		{"letters", []byte("12a"), 0, common.ErrInvalidInt},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := common.ParseInt(tc.b)
+			if err != tc.err {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+			if i != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, i)
+			}
+		})
+	}
+}
+
+func Test_AddInt(t *testing.T) {
+	tc := []struct {
+		name     string
+		a, b     int64
+		expected int64
+		err      error
+	}{
+		{"positive", 1, 2, 3, nil},
+		{"negative", -1, -2, -3, nil},
+		{"max", math.MaxInt64 - 1, 1, math.MaxInt64, nil},
+		{"min", math.MinInt64 + 1, -1, math.MinInt64, nil},
+		{"overflow", math.MaxInt64, 1, 0, common.ErrOverflow},
+		{"underflow", math.MinInt64, -1, 0, common.ErrOverflow},
+		{"opposite signs", math.MaxInt64, math.MinInt64, -1, nil},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := common.AddInt(tc.a, tc.b)
+			if err != tc.err {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+			if i != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, i)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package common
+
+// StringMatch returns true if the string matches the glob-style pattern. The
+// pattern is matched byte by byte like Redis does: "*" matches any sequence
+// of bytes, including "/", "?" matches any byte, "[abc]" one of the bytes,
+// "[a-z]" a range of bytes, "[^abc]" any other byte and "\x" matches x
+// literally.
+//
+// A class that is not closed extends to the end of the pattern. Unlike
+// filepath.Match, no pattern is malformed.
+func StringMatch(pattern, s string) bool {
+	p, i := 0, 0
+	// star is the position in the pattern after the last star, and next the
+	// position in the string it is retried from when the rest does not match
+	star, next := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+
+				star, next = p, i
+				continue
+			}
+
+			if n, ok := matchByte(pattern[p:], s[i]); ok {
+				p += n
+				i++
+				continue
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+
+		// The last star swallows one more byte
+		next++
+		p, i = star, next
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchByte matches the byte against the first element of the pattern,
+// which is not a star. Returns the length of the element.
+func matchByte(pattern string, b byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '\\':
+		if len(pattern) >= 2 {
+			return 2, pattern[1] == b
+		}
+		// A trailing backslash matches itself
+		return 1, b == '\\'
+	case '[':
+		return matchClass(pattern, b)
+	default:
+		return 1, pattern[0] == b
+	}
+}
+
+// matchClass matches the byte against the class starting the pattern.
+// Returns the length of the class.
+func matchClass(pattern string, b byte) (int, bool) {
+	j := 1
+	negate := j < len(pattern) && pattern[j] == '^'
+	if negate {
+		j++
+	}
+
+	match := false
+	for ; j < len(pattern); j++ {
+		switch {
+		case pattern[j] == '\\' && j+1 < len(pattern):
+			j++
+			if pattern[j] == b {
+				match = true
+			}
+		case pattern[j] == ']':
+			return j + 1, match != negate
+		case j+2 < len(pattern) && pattern[j+1] == '-':
+			start, end := pattern[j], pattern[j+2]
+			if start > end {
+				start, end = end, start
+			}
+			if b >= start && b <= end {
+				match = true
+			}
+			j += 2
+		case pattern[j] == b:
+			match = true
+		}
+	}
+
+	return len(pattern), match != negate
+}
@@ -0,0 +1,66 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/common"
+)
+
+func Test_StringMatch(t *testing.T) {
+	tc := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"*", "", true},
+		{"*", "news/sport", true},
+		{"news.*", "news.sport", true},
+		{"news.*", "news", false},
+		{"news/*", "news/sport/football", true},
+		{"*sport*", "news.sport.football", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"a**b", "ab", true},
+		{"*a", "bbb", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"?", "", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[^a-c]llo", "hdllo", true},
+		{"[a-]", "]", true},
+		{"[\\]]", "]", true},
+		{"[\\-]", "-", true},
+		{"[]a", "a", false},
+		{"[]a", "]a", false},
+		{"[abc", "b", true},
+		{"[abc", "d", false},
+		{"[^", "a", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"\\?x", "?x", true},
+		{"\\[a]", "[a]", true},
+		{"a\\", "a\\", true},
+		{"*[0-9]", "channel7", true},
+		{"*[0-9]", "channel", false},
+		{"__keyspace@0__:*", "__keyspace@0__:user/1", true},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.pattern+" "+tc.s, func(t *testing.T) {
+			if match := common.StringMatch(tc.pattern, tc.s); match != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, match)
+			}
+		})
+	}
+}
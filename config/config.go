@@ -20,7 +20,16 @@ var Defaults = map[string]any{
 	"server.port":  7275,
 	"server.addrs": []string{"tcp://127.0.0.1"},
 
+	"server.notify_keyspace_events": "",
+
 	"database.path": "./dump.kvsdb",
+	"database.save": []string{"900 1", "300 10", "60 10000"},
+
+	"appendonly.enabled":                 false,
+	"appendonly.path":                    "./appendonly.aof",
+	"appendonly.fsync":                   "everysec",
+	"appendonly.auto_rewrite_percentage": 100,
+	"appendonly.auto_rewrite_min_size":   64 * 1024 * 1024,
 
 	"log.level":       0,
 	"log.file_path":   "/var/log/kvstore/kvstore-server.log",
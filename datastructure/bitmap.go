@@ -0,0 +1,258 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The functions of this file operate on strings seen as arrays of bits. The
+// bit at offset 0 is the most significant bit of the first byte.
+
+// BitOperation is a bitwise operation between strings.
+type BitOperation uint8
+
+const (
+	// BitAnd is the bitwise AND of the strings.
+	BitAnd BitOperation = iota
+	// BitOr is the bitwise OR of the strings.
+	BitOr
+	// BitXor is the bitwise XOR of the strings.
+	BitXor
+	// BitNot is the bitwise NOT of a single string.
+	BitNot
+)
+
+// BitfieldOverflow is the behavior of a bitfield operation overflowing the
+// integer type.
+type BitfieldOverflow uint8
+
+const (
+	// BitfieldWrap wraps around the integer type.
+	BitfieldWrap BitfieldOverflow = iota
+	// BitfieldSat saturates to the minimum or maximum value of the type.
+	BitfieldSat
+	// BitfieldFail fails the operation.
+	BitfieldFail
+)
+
+// BitfieldType is an integer type of a bitfield, signed integers having up
+// to 64 bits and unsigned ones up to 63 bits.
+type BitfieldType struct {
+	Signed bool
+	Bits   uint8
+}
+
+func (t BitfieldType) min() int64 {
+	if !t.Signed {
+		return 0
+	}
+	return -1 << (t.Bits - 1)
+}
+
+func (t BitfieldType) max() int64 {
+	if !t.Signed {
+		return 1<<t.Bits - 1
+	}
+	return 1<<(t.Bits-1) - 1
+}
+
+// GetBit returns the bit at the given offset, bits past the end of the
+// string being 0.
+func GetBit(b []byte, offset int64) int {
+	i := offset >> 3
+	if i >= int64(len(b)) {
+		return 0
+	}
+	return int(b[i]>>(7-offset&7)) & 1
+}
+
+// SetBit sets the bit at the given offset, growing the string with zero
+// bytes if needed. Returns the string and the previous value of the bit.
+func SetBit(b []byte, offset int64, value int) ([]byte, int) {
+	i := offset >> 3
+	if i >= int64(len(b)) {
+		b = append(b, make([]byte, i-int64(len(b))+1)...)
+	}
+
+	shift := 7 - offset&7
+	old := int(b[i]>>shift) & 1
+	if value != 0 {
+		b[i] |= 1 << shift
+	} else {
+		b[i] &^= 1 << shift
+	}
+	return b, old
+}
+
+// popCount returns the number of bits set in b.
+func popCount(b []byte) int64 {
+	var n int
+	for len(b) >= 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(b))
+		b = b[8:]
+	}
+	for _, c := range b {
+		n += bits.OnesCount8(c)
+	}
+	return int64(n)
+}
+
+// BitCount returns the number of bits set between the start and end bit
+// offsets (both inclusive). The offsets must be within the string.
+func BitCount(b []byte, start, end int64) int64 {
+	if start > end {
+		return 0
+	}
+
+	first, last := start>>3, end>>3
+	n := popCount(b[first : last+1])
+
+	// Remove the bits of the first and last bytes outside of the range
+	n -= int64(bits.OnesCount8(b[first] >> (8 - start&7)))
+	n -= int64(bits.OnesCount8(b[last] << (end&7 + 1)))
+	return n
+}
+
+// BitPos returns the offset of the first bit set to the given value between
+// the start and end bit offsets (both inclusive), or -1 if there is none.
+// The offsets must be within the string.
+func BitPos(b []byte, bit int, start, end int64) int64 {
+	var skip byte
+	if bit == 0 {
+		skip = 0xff
+	}
+
+	for offset := start; offset <= end; {
+		// Whole bytes that cannot contain the bit are skipped at once
+		if offset&7 == 0 && offset+7 <= end {
+			i := offset >> 3
+			if i+8 <= (end+1)>>3 && binary.LittleEndian.Uint64(b[i:]) == uint64(skip)*0x0101010101010101 {
+				offset += 64
+				continue
+			}
+
+			if b[i] == skip {
+				offset += 8
+				continue
+			}
+		}
+
+		if GetBit(b, offset) == bit {
+			return offset
+		}
+		offset++
+	}
+
+	return -1
+}
+
+// BitOp returns the result of the bitwise operation between the strings.
+// Shorter strings are padded with zero bytes.
+func BitOp(op BitOperation, srcs [][]byte) []byte {
+	var size int
+	for _, src := range srcs {
+		if len(src) > size {
+			size = len(src)
+		}
+	}
+
+	dst := make([]byte, size)
+	if len(srcs) == 0 {
+		return dst
+	}
+
+	if op == BitNot {
+		for i, c := range srcs[0] {
+			dst[i] = ^c
+		}
+		return dst
+	}
+
+	copy(dst, srcs[0])
+	for _, src := range srcs[1:] {
+		for i := range dst {
+			var c byte
+			if i < len(src) {
+				c = src[i]
+			}
+
+			switch op {
+			case BitAnd:
+				dst[i] &= c
+			case BitOr:
+				dst[i] |= c
+			case BitXor:
+				dst[i] ^= c
+			}
+		}
+	}
+
+	return dst
+}
+
+// GetBitfield returns the integer of the given type stored at the bit
+// offset. Bits past the end of the string are 0.
+func GetBitfield(b []byte, offset int64, t BitfieldType) int64 {
+	var v uint64
+	for i := int64(0); i < int64(t.Bits); i++ {
+		v = v<<1 | uint64(GetBit(b, offset+i))
+	}
+
+	// Sign extend negative integers
+	if t.Signed && t.Bits < 64 && v&(1<<(t.Bits-1)) != 0 {
+		v |= ^uint64(0) << t.Bits
+	}
+	return int64(v)
+}
+
+// SetBitfield stores the integer of the given type at the bit offset,
+// growing the string with zero bytes if needed. Only the lowest bits of the
+// value that fit in the type are stored.
+func SetBitfield(b []byte, offset int64, t BitfieldType, value int64) []byte {
+	v := uint64(value)
+	for i := int64(0); i < int64(t.Bits); i++ {
+		b, _ = SetBit(b, offset+i, int(v>>(int64(t.Bits)-1-i))&1)
+	}
+	return b
+}
+
+// BitfieldAdd returns the sum of the integer of the given type and incr,
+// handling overflows according to the given behavior. ok is false if the
+// sum overflows and the behavior is BitfieldFail.
+func BitfieldAdd(t BitfieldType, value, incr int64, overflow BitfieldOverflow) (sum int64, ok bool) {
+	min, max := t.min(), t.max()
+
+	var overflowed, underflowed bool
+	if t.Signed {
+		overflowed = incr > 0 && value > max-incr
+		underflowed = incr < 0 && value < min-incr
+	} else {
+		// value is within [0, max] so the difference never overflows
+		overflowed = incr > 0 && uint64(incr) > uint64(max-value)
+		underflowed = incr < 0 && uint64(-(incr+1))+1 > uint64(value)
+	}
+
+	if !overflowed && !underflowed {
+		return value + incr, true
+	}
+
+	switch overflow {
+	case BitfieldSat:
+		if overflowed {
+			return max, true
+		}
+		return min, true
+	case BitfieldFail:
+		return 0, false
+	}
+
+	// Keep the lowest bits of the sum and sign extend them
+	v := uint64(value) + uint64(incr)
+	if t.Bits < 64 {
+		v &= 1<<t.Bits - 1
+		if t.Signed && v&(1<<(t.Bits-1)) != 0 {
+			v |= ^uint64(0) << t.Bits
+		}
+	}
+	return int64(v), true
+}
@@ -0,0 +1,168 @@
+package datastructure_test
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_SetGetBit(t *testing.T) {
+	var b []byte
+	b, old := datastructure.SetBit(b, 7, 1)
+	if old != 0 || !reflect.DeepEqual(b, []byte{0x01}) {
+		t.Errorf("SetBit failed: got %08b", b)
+	}
+
+	b, _ = datastructure.SetBit(b, 17, 1)
+	if !reflect.DeepEqual(b, []byte{0x01, 0x00, 0x40}) {
+		t.Errorf("SetBit failed: got %08b", b)
+	}
+
+	if b, old = datastructure.SetBit(b, 7, 0); old != 1 || b[0] != 0 {
+		t.Errorf("SetBit failed: got %08b", b)
+	}
+
+	if datastructure.GetBit(b, 17) != 1 || datastructure.GetBit(b, 16) != 0 || datastructure.GetBit(b, 1000) != 0 {
+		t.Errorf("GetBit failed")
+	}
+}
+
+func Test_BitCount(t *testing.T) {
+	b := make([]byte, 100)
+	rand.Read(b)
+
+	expected := func(start, end int64) int64 {
+		var n int64
+		for i := start; i <= end; i++ {
+			n += int64(datastructure.GetBit(b, i))
+		}
+		return n
+	}
+
+	for _, r := range [][2]int64{{0, 799}, {3, 5}, {0, 0}, {7, 8}, {9, 700}, {64, 127}, {5, 4}} {
+		if got, want := datastructure.BitCount(b, r[0], r[1]), expected(r[0], r[1]); got != want {
+			t.Errorf("BitCount(%d, %d) failed: expected %d, got %d", r[0], r[1], want, got)
+		}
+	}
+
+	var total int
+	for _, c := range b {
+		total += bits.OnesCount8(c)
+	}
+	if got := datastructure.BitCount(b, 0, 799); got != int64(total) {
+		t.Errorf("BitCount failed: expected %d, got %d", total, got)
+	}
+}
+
+func Test_BitPos(t *testing.T) {
+	b := make([]byte, 40)
+	b, _ = datastructure.SetBit(b, 250, 1)
+
+	tc := []struct {
+		name       string
+		bit        int
+		start, end int64
+		expected   int64
+	}{
+		{"first set bit", 1, 0, 319, 250},
+		{"from the bit", 1, 250, 319, 250},
+		{"after the bit", 1, 251, 319, -1},
+		{"before the bit", 1, 0, 249, -1},
+		{"first clear bit", 0, 0, 319, 0},
+		{"clear bit after", 0, 250, 319, 251},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := datastructure.BitPos(b, tt.bit, tt.start, tt.end); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	ones := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+	if got := datastructure.BitPos(ones, 0, 0, 79); got != 79 {
+		t.Errorf("expected 79, got %d", got)
+	}
+}
+
+func Test_BitOp(t *testing.T) {
+	a, b := []byte{0xf0, 0x0f}, []byte{0xff}
+
+	tc := []struct {
+		name     string
+		op       datastructure.BitOperation
+		srcs     [][]byte
+		expected []byte
+	}{
+		{"and", datastructure.BitAnd, [][]byte{a, b}, []byte{0xf0, 0x00}},
+		{"or", datastructure.BitOr, [][]byte{a, b}, []byte{0xff, 0x0f}},
+		{"xor", datastructure.BitXor, [][]byte{a, b}, []byte{0x0f, 0x0f}},
+		{"not", datastructure.BitNot, [][]byte{a}, []byte{0x0f, 0xf0}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := datastructure.BitOp(tt.op, tt.srcs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %08b, got %08b", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_Bitfield(t *testing.T) {
+	i5 := datastructure.BitfieldType{Signed: true, Bits: 5}
+	u8 := datastructure.BitfieldType{Bits: 8}
+	i64 := datastructure.BitfieldType{Signed: true, Bits: 64}
+
+	var b []byte
+	b = datastructure.SetBitfield(b, 3, i5, -3)
+	if got := datastructure.GetBitfield(b, 3, i5); got != -3 {
+		t.Errorf("GetBitfield failed: expected -3, got %d", got)
+	}
+
+	if got := datastructure.GetBitfield(b, 3, datastructure.BitfieldType{Bits: 5}); got != 29 {
+		t.Errorf("GetBitfield failed: expected 29, got %d", got)
+	}
+
+	b = datastructure.SetBitfield(b, 100, i64, math.MinInt64)
+	if got := datastructure.GetBitfield(b, 100, i64); got != math.MinInt64 {
+		t.Errorf("GetBitfield failed: expected %d, got %d", int64(math.MinInt64), got)
+	}
+
+	tc := []struct {
+		name        string
+		typ         datastructure.BitfieldType
+		value, incr int64
+		overflow    datastructure.BitfieldOverflow
+		expected    int64
+		ok          bool
+	}{
+		{"no overflow", u8, 10, 5, datastructure.BitfieldWrap, 15, true},
+		{"unsigned wrap", u8, 250, 10, datastructure.BitfieldWrap, 4, true},
+		{"unsigned wrap below zero", u8, 2, -3, datastructure.BitfieldWrap, 255, true},
+		{"unsigned sat", u8, 250, 10, datastructure.BitfieldSat, 255, true},
+		{"unsigned sat below zero", u8, 2, -3, datastructure.BitfieldSat, 0, true},
+		{"unsigned fail", u8, 250, 10, datastructure.BitfieldFail, 0, false},
+		{"signed wrap", i5, 15, 1, datastructure.BitfieldWrap, -16, true},
+		{"signed wrap below min", i5, -16, -1, datastructure.BitfieldWrap, 15, true},
+		{"signed sat", i5, 10, 100, datastructure.BitfieldSat, 15, true},
+		{"signed sat below min", i5, -10, -100, datastructure.BitfieldSat, -16, true},
+		{"signed fail", i5, -16, -1, datastructure.BitfieldFail, 0, false},
+		{"i64 wrap", i64, math.MaxInt64, 1, datastructure.BitfieldWrap, math.MinInt64, true},
+		{"i64 sat", i64, math.MinInt64, math.MinInt64, datastructure.BitfieldSat, math.MinInt64, true},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := datastructure.BitfieldAdd(tt.typ, tt.value, tt.incr, tt.overflow)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("expected %d (%v), got %d (%v)", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	// ErrFilterFull is returned when adding an item to a full filter that
+	// cannot grow.
+	ErrFilterFull = errors.New("filter is full")
+	// ErrInvalidFilter is returned when decoding malformed filter bytes.
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+const (
+	// bloomTighteningRatio is the ratio of the error rate of a layer of a
+	// scalable Bloom filter to the error rate of the previous layer.
+	bloomTighteningRatio = 0.5
+	// bloomSeed is the seed of the first hash of an item.
+	bloomSeed = 0xc6a4a7935bd1e995
+	// bloomMaxBits is the maximum number of bits of a layer.
+	bloomMaxBits = 1 << 40
+)
+
+// bloomHashes returns the two hashes of the item from which the bits of
+// the item are derived.
+func bloomHashes(item []byte) (uint64, uint64) {
+	h1 := murmurHash64A(item, bloomSeed)
+	return h1, murmurHash64A(item, h1)
+}
+
+// bloomLayer is a fixed size Bloom filter.
+type bloomLayer struct {
+	bits     []byte
+	nbits    uint64
+	hashes   uint32
+	capacity uint64
+	count    uint64
+}
+
+func newBloomLayer(errorRate float64, capacity uint64) *bloomLayer {
+	nbits := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	if nbits < 64 {
+		nbits = 64
+	}
+	if nbits > bloomMaxBits {
+		nbits = bloomMaxBits
+	}
+
+	return &bloomLayer{
+		bits:     make([]byte, (nbits+7)/8),
+		nbits:    nbits,
+		hashes:   uint32(math.Ceil(-math.Log2(errorRate))),
+		capacity: capacity,
+	}
+}
+
+func (l *bloomLayer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		bit := (h1 + i*h2) % l.nbits
+		if l.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) set(h1, h2 uint64) {
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		bit := (h1 + i*h2) % l.nbits
+		l.bits[bit/8] |= 1 << (bit % 8)
+	}
+	l.count++
+}
+
+// BloomFilter is a scalable Bloom filter, a set which may report items that
+// were never added with a configurable error rate. Once full, a new layer
+// larger by the expansion factor and with a tighter error rate is added so
+// that the overall error rate is kept.
+// It is not safe for concurrent use.
+type BloomFilter struct {
+	layers    []*bloomLayer
+	errorRate float64
+	expansion uint32
+}
+
+// NewBloomFilter returns a new Bloom filter holding capacity items with the
+// given error rate. A zero expansion makes the filter non scaling.
+func NewBloomFilter(errorRate float64, capacity uint64, expansion uint32) *BloomFilter {
+	return &BloomFilter{
+		layers:    []*bloomLayer{newBloomLayer(errorRate*bloomTighteningRatio, capacity)},
+		errorRate: errorRate,
+		expansion: expansion,
+	}
+}
+
+// Capacity returns the number of items the filter can hold before growing.
+func (b *BloomFilter) Capacity() uint64 {
+	var n uint64
+	for _, l := range b.layers {
+		n += l.capacity
+	}
+	return n
+}
+
+// Count returns the number of items added to the filter.
+func (b *BloomFilter) Count() uint64 {
+	var n uint64
+	for _, l := range b.layers {
+		n += l.count
+	}
+	return n
+}
+
+// Size returns the estimated amount of bytes used by the filter.
+func (b *BloomFilter) Size() int {
+	var n int
+	for _, l := range b.layers {
+		n += len(l.bits)
+	}
+	return n
+}
+
+// Exists returns true if the item may have been added to the filter.
+func (b *BloomFilter) Exists(item []byte) bool {
+	h1, h2 := bloomHashes(item)
+	for _, l := range b.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the item to the filter. Returns false if the item may already
+// exist, or ErrFilterFull if the filter is full and non scaling.
+func (b *BloomFilter) Add(item []byte) (bool, error) {
+	h1, h2 := bloomHashes(item)
+	for _, l := range b.layers {
+		if l.test(h1, h2) {
+			return false, nil
+		}
+	}
+
+	last := b.layers[len(b.layers)-1]
+	if last.count >= last.capacity {
+		if b.expansion == 0 {
+			return false, ErrFilterFull
+		}
+
+		errorRate := b.errorRate * math.Pow(bloomTighteningRatio, float64(len(b.layers)+1))
+		last = newBloomLayer(errorRate, last.capacity*uint64(b.expansion))
+		b.layers = append(b.layers, last)
+	}
+
+	last.set(h1, h2)
+	return true, nil
+}
+
+// Bytes returns the error rate and expansion of the filter followed by
+// every layer.
+func (b *BloomFilter) Bytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, b.errorRate)
+	binary.Write(&buf, binary.BigEndian, b.expansion)
+	binary.Write(&buf, binary.BigEndian, uint32(len(b.layers)))
+
+	for _, l := range b.layers {
+		binary.Write(&buf, binary.BigEndian, l.nbits)
+		binary.Write(&buf, binary.BigEndian, l.hashes)
+		binary.Write(&buf, binary.BigEndian, l.capacity)
+		binary.Write(&buf, binary.BigEndian, l.count)
+		buf.Write(l.bits)
+	}
+
+	return buf.Bytes()
+}
+
+// NewBloomFilterFromBytes returns the Bloom filter encoded by Bytes.
+func NewBloomFilterFromBytes(data []byte) (*BloomFilter, error) {
+	r := bytes.NewReader(data)
+	b := &BloomFilter{}
+
+	var n uint32
+	if err := readBinary(r, &b.errorRate, &b.expansion, &n); err != nil || n == 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	for i := uint32(0); i < n; i++ {
+		l := &bloomLayer{}
+		if err := readBinary(r, &l.nbits, &l.hashes, &l.capacity, &l.count); err != nil {
+			return nil, ErrInvalidFilter
+		}
+
+		if l.nbits == 0 || l.nbits > bloomMaxBits || (l.nbits+7)/8 > uint64(r.Len()) {
+			return nil, ErrInvalidFilter
+		}
+
+		l.bits = make([]byte, (l.nbits+7)/8)
+		r.Read(l.bits)
+		b.layers = append(b.layers, l)
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrInvalidFilter
+	}
+	return b, nil
+}
+
+// readBinary reads the big endian fixed size values.
+func readBinary(r *bytes.Reader, values ...any) error {
+	for _, v := range values {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
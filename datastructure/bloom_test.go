@@ -0,0 +1,81 @@
+package datastructure_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_BloomFilter(t *testing.T) {
+	b := datastructure.NewBloomFilter(0.01, 1000, 2)
+	for i := 0; i < 5000; i++ {
+		if _, err := b.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5000; i++ {
+		if !b.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("expected %d to exist", i)
+		}
+	}
+
+	var falsePositives int
+	for i := 5000; i < 15000; i++ {
+		if b.Exists([]byte(strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+
+	if rate := float64(falsePositives) / 10000; rate > 0.01 {
+		t.Errorf("expected an error rate below 1%%, got %.2f%%", rate*100)
+	}
+
+	if b.Capacity() < 5000 || b.Count() > 5000 {
+		t.Errorf("unexpected capacity %d and count %d", b.Capacity(), b.Count())
+	}
+
+	if added, _ := b.Add([]byte("1")); added {
+		t.Errorf("expected an existing item not to be added")
+	}
+}
+
+func Test_BloomFilterNonScaling(t *testing.T) {
+	b := datastructure.NewBloomFilter(0.01, 10, 0)
+
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = b.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if err != datastructure.ErrFilterFull {
+		t.Errorf("expected ErrFilterFull, got %v", err)
+	}
+}
+
+func Test_BloomFilterBytes(t *testing.T) {
+	b := datastructure.NewBloomFilter(0.001, 100, 4)
+	for i := 0; i < 500; i++ {
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+
+	got, err := datastructure.NewBloomFilterFromBytes(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		if !got.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("expected %d to exist", i)
+		}
+	}
+
+	if got.Count() != b.Count() || got.Capacity() != b.Capacity() {
+		t.Errorf("expected %d/%d, got %d/%d", b.Count(), b.Capacity(), got.Count(), got.Capacity())
+	}
+
+	if _, err := datastructure.NewBloomFilterFromBytes(b.Bytes()[:100]); err != datastructure.ErrInvalidFilter {
+		t.Errorf("expected ErrInvalidFilter, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	// ErrSketchDimensions is returned when merging sketches of different
+	// dimensions.
+	ErrSketchDimensions = errors.New("sketches have different dimensions")
+	// ErrInvalidSketch is returned when decoding malformed sketch bytes.
+	ErrInvalidSketch = errors.New("invalid sketch")
+)
+
+// CountMinSketch estimates the number of occurrences of items using a fixed
+// amount of memory. Every item increments a counter in each of depth rows
+// of width counters, its count being the minimum of its counters, which may
+// overestimate but never underestimate it.
+// It is not safe for concurrent use.
+type CountMinSketch struct {
+	width, depth uint32
+	counters     []uint64
+	count        uint64
+}
+
+// NewCountMinSketch returns a new sketch of the given dimensions.
+func NewCountMinSketch(width, depth uint32) *CountMinSketch {
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]uint64, uint64(width)*uint64(depth)),
+	}
+}
+
+// NewCountMinSketchByProb returns a new sketch whose estimates exceed the
+// counts by at most errorRate times the total count with the probability
+// 1 - probability.
+func NewCountMinSketchByProb(errorRate, probability float64) *CountMinSketch {
+	width := uint32(math.Ceil(2 / errorRate))
+	depth := uint32(math.Ceil(math.Log10(probability) / math.Log10(0.5)))
+	if depth == 0 {
+		depth = 1
+	}
+	return NewCountMinSketch(width, depth)
+}
+
+// Width returns the number of counters of each row.
+func (s *CountMinSketch) Width() uint32 {
+	return s.width
+}
+
+// Depth returns the number of rows.
+func (s *CountMinSketch) Depth() uint32 {
+	return s.depth
+}
+
+// Count returns the total of the increments.
+func (s *CountMinSketch) Count() uint64 {
+	return s.count
+}
+
+// Size returns the estimated amount of bytes used by the sketch.
+func (s *CountMinSketch) Size() int {
+	return len(s.counters) * 8
+}
+
+// counter returns the index of the counter of the item in the row.
+func (s *CountMinSketch) counter(item []byte, row uint32) uint64 {
+	return uint64(row)*uint64(s.width) + murmurHash64A(item, uint64(row))%uint64(s.width)
+}
+
+// IncrBy increments the count of the item and returns its new estimate.
+// Counters saturate instead of overflowing.
+func (s *CountMinSketch) IncrBy(item []byte, incr uint64) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for row := uint32(0); row < s.depth; row++ {
+		i := s.counter(item, row)
+		s.counters[i] = saturatingAdd(s.counters[i], incr)
+		if s.counters[i] < estimate {
+			estimate = s.counters[i]
+		}
+	}
+
+	s.count = saturatingAdd(s.count, incr)
+	return estimate
+}
+
+// Query returns the estimated count of the item.
+func (s *CountMinSketch) Query(item []byte) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for row := uint32(0); row < s.depth; row++ {
+		if c := s.counters[s.counter(item, row)]; c < estimate {
+			estimate = c
+		}
+	}
+	return estimate
+}
+
+// Merge replaces the counters of the sketch with the weighted sums of the
+// counters of the sources, which must have the same dimensions.
+func (s *CountMinSketch) Merge(srcs []*CountMinSketch, weights []uint64) error {
+	for _, src := range srcs {
+		if src.width != s.width || src.depth != s.depth {
+			return ErrSketchDimensions
+		}
+	}
+
+	counters := make([]uint64, len(s.counters))
+	var count uint64
+	for j, src := range srcs {
+		for i, c := range src.counters {
+			counters[i] = saturatingAdd(counters[i], saturatingMul(c, weights[j]))
+		}
+		count = saturatingAdd(count, saturatingMul(src.count, weights[j]))
+	}
+
+	s.counters, s.count = counters, count
+	return nil
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func saturatingMul(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
+
+// Bytes returns the dimensions and total count of the sketch followed by
+// its counters.
+func (s *CountMinSketch) Bytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, s.width)
+	binary.Write(&buf, binary.BigEndian, s.depth)
+	binary.Write(&buf, binary.BigEndian, s.count)
+	binary.Write(&buf, binary.BigEndian, s.counters)
+	return buf.Bytes()
+}
+
+// NewCountMinSketchFromBytes returns the sketch encoded by Bytes.
+func NewCountMinSketchFromBytes(data []byte) (*CountMinSketch, error) {
+	r := bytes.NewReader(data)
+	s := &CountMinSketch{}
+
+	if err := readBinary(r, &s.width, &s.depth, &s.count); err != nil {
+		return nil, ErrInvalidSketch
+	}
+
+	n := uint64(s.width) * uint64(s.depth)
+	if n == 0 || n*8 != uint64(r.Len()) {
+		return nil, ErrInvalidSketch
+	}
+
+	s.counters = make([]uint64, n)
+	if err := readBinary(r, s.counters); err != nil {
+		return nil, ErrInvalidSketch
+	}
+	return s, nil
+}
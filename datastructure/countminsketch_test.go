@@ -0,0 +1,72 @@
+package datastructure_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_CountMinSketch(t *testing.T) {
+	s := datastructure.NewCountMinSketchByProb(0.001, 0.01)
+	if s.Width() != 2000 || s.Depth() != 7 {
+		t.Errorf("unexpected dimensions %dx%d", s.Width(), s.Depth())
+	}
+
+	for i := 0; i < 1000; i++ {
+		s.IncrBy([]byte(strconv.Itoa(i)), uint64(i%10+1))
+	}
+
+	if got := s.IncrBy([]byte("x"), 5); got != 5 {
+		t.Errorf("expected 5, got %d", got)
+	}
+
+	for i := 0; i < 1000; i++ {
+		// Estimates never underestimate the counts
+		if got := s.Query([]byte(strconv.Itoa(i))); got < uint64(i%10+1) || got > uint64(i%10+1)+s.Count()/1000 {
+			t.Errorf("%d: unexpected estimate %d", i, got)
+		}
+	}
+
+	if got := s.Query([]byte("missing")); got > s.Count()/1000 {
+		t.Errorf("unexpected estimate %d", got)
+	}
+}
+
+func Test_CountMinSketchMerge(t *testing.T) {
+	a, b := datastructure.NewCountMinSketch(100, 5), datastructure.NewCountMinSketch(100, 5)
+	a.IncrBy([]byte("x"), 3)
+	b.IncrBy([]byte("x"), 4)
+
+	dst := datastructure.NewCountMinSketch(100, 5)
+	if err := dst.Merge([]*datastructure.CountMinSketch{a, b}, []uint64{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dst.Query([]byte("x")); got != 11 || dst.Count() != 11 {
+		t.Errorf("expected 11, got %d (count %d)", got, dst.Count())
+	}
+
+	other := datastructure.NewCountMinSketch(10, 5)
+	if err := dst.Merge([]*datastructure.CountMinSketch{other}, []uint64{1}); err != datastructure.ErrSketchDimensions {
+		t.Errorf("expected ErrSketchDimensions, got %v", err)
+	}
+}
+
+func Test_CountMinSketchBytes(t *testing.T) {
+	s := datastructure.NewCountMinSketch(50, 3)
+	s.IncrBy([]byte("a"), 42)
+
+	got, err := datastructure.NewCountMinSketchFromBytes(s.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Query([]byte("a")) != 42 || got.Count() != 42 || got.Width() != 50 || got.Depth() != 3 {
+		t.Errorf("unexpected sketch")
+	}
+
+	if _, err := datastructure.NewCountMinSketchFromBytes(s.Bytes()[:20]); err != datastructure.ErrInvalidSketch {
+		t.Errorf("expected ErrInvalidSketch, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	// cuckooSeed is the seed of the hash of an item.
+	cuckooSeed = 0x5bd1e995
+	// cuckooMaxBuckets is the maximum number of buckets of a layer.
+	cuckooMaxBuckets = 1 << 32
+)
+
+// cuckooFingerprint returns the non-zero fingerprint of the item and the
+// hash from which its buckets are derived.
+func cuckooFingerprint(item []byte) (fp uint8, hash uint64) {
+	hash = murmurHash64A(item, cuckooSeed)
+	fp = uint8(hash >> 56)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, hash
+}
+
+// cuckooLayer is a fixed size cuckoo filter of buckets of fingerprints, 0
+// being an empty slot.
+type cuckooLayer struct {
+	slots      []uint8
+	numBuckets uint64
+}
+
+// buckets returns the two buckets where the fingerprint may be stored. The
+// number of buckets being a power of 2, each bucket is the alternate bucket
+// of the other.
+func (l *cuckooLayer) buckets(fp uint8, hash uint64) (uint64, uint64) {
+	i1 := hash & (l.numBuckets - 1)
+	return i1, l.altBucket(fp, i1)
+}
+
+func (l *cuckooLayer) altBucket(fp uint8, i uint64) uint64 {
+	return (i ^ uint64(fp)*cuckooSeed) & (l.numBuckets - 1)
+}
+
+// CuckooFilter is a scalable cuckoo filter, a set which may report items
+// that were never added but unlike a Bloom filter supports deleting items.
+// Every item is stored as a fingerprint in one of two buckets, moving other
+// fingerprints to their alternate bucket to make room. Once full, a new
+// layer larger by the expansion factor is added.
+// It is not safe for concurrent use.
+type CuckooFilter struct {
+	layers        []*cuckooLayer
+	bucketSize    uint8
+	maxIterations uint16
+	expansion     uint16
+	count         uint64
+	deleted       uint64
+	// rng is the state of the generator choosing the fingerprints to move,
+	// so that adding items is deterministic
+	rng uint64
+}
+
+// NewCuckooFilter returns a new cuckoo filter holding at least capacity
+// items in buckets of bucketSize fingerprints. maxIterations is the number
+// of fingerprints moved before the filter is considered full. A zero
+// expansion makes the filter non scaling.
+func NewCuckooFilter(capacity uint64, bucketSize uint8, maxIterations, expansion uint16) *CuckooFilter {
+	f := &CuckooFilter{
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+		rng:           cuckooSeed,
+	}
+	f.addLayer(capacity / uint64(bucketSize))
+	return f
+}
+
+func (f *CuckooFilter) addLayer(numBuckets uint64) *cuckooLayer {
+	// Round up to a power of 2
+	n := uint64(1)
+	for n < numBuckets && n < cuckooMaxBuckets {
+		n <<= 1
+	}
+
+	l := &cuckooLayer{slots: make([]uint8, n*uint64(f.bucketSize)), numBuckets: n}
+	f.layers = append(f.layers, l)
+	return l
+}
+
+// Capacity returns the number of fingerprints the filter can hold before
+// growing.
+func (f *CuckooFilter) Capacity() uint64 {
+	var n uint64
+	for _, l := range f.layers {
+		n += uint64(len(l.slots))
+	}
+	return n
+}
+
+// Count returns the number of items in the filter.
+func (f *CuckooFilter) Count() uint64 {
+	return f.count
+}
+
+// Size returns the estimated amount of bytes used by the filter.
+func (f *CuckooFilter) Size() int {
+	return int(f.Capacity())
+}
+
+func (f *CuckooFilter) bucket(l *cuckooLayer, i uint64) []uint8 {
+	return l.slots[i*uint64(f.bucketSize) : (i+1)*uint64(f.bucketSize)]
+}
+
+// CountItem returns the number of times the fingerprint of the item is
+// stored in the filter, which may be more than the times the item was added.
+func (f *CuckooFilter) CountItem(item []byte) uint64 {
+	fp, hash := cuckooFingerprint(item)
+
+	var n uint64
+	for _, l := range f.layers {
+		i1, i2 := l.buckets(fp, hash)
+		for _, i := range []uint64{i1, i2} {
+			for _, slot := range f.bucket(l, i) {
+				if slot == fp {
+					n++
+				}
+			}
+			if i1 == i2 {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Exists returns true if the item may be in the filter.
+func (f *CuckooFilter) Exists(item []byte) bool {
+	fp, hash := cuckooFingerprint(item)
+	for _, l := range f.layers {
+		i1, i2 := l.buckets(fp, hash)
+		if bytes.IndexByte(f.bucket(l, i1), fp) >= 0 || bytes.IndexByte(f.bucket(l, i2), fp) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete deletes one occurrence of the item from the filter. Returns false
+// if the item is not in the filter.
+func (f *CuckooFilter) Delete(item []byte) bool {
+	fp, hash := cuckooFingerprint(item)
+
+	// The newest layers are searched first
+	for j := len(f.layers) - 1; j >= 0; j-- {
+		l := f.layers[j]
+		i1, i2 := l.buckets(fp, hash)
+		for _, i := range []uint64{i1, i2} {
+			b := f.bucket(l, i)
+			if k := bytes.IndexByte(b, fp); k >= 0 {
+				b[k] = 0
+				f.count--
+				f.deleted++
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextRandom returns the next number of the xorshift generator.
+func (f *CuckooFilter) nextRandom() uint64 {
+	f.rng ^= f.rng << 13
+	f.rng ^= f.rng >> 7
+	f.rng ^= f.rng << 17
+	return f.rng
+}
+
+// insert inserts the fingerprint in the layer, moving other fingerprints to
+// their alternate bucket if needed. If no room is found, the moves are
+// undone and false is returned.
+func (f *CuckooFilter) insert(l *cuckooLayer, fp uint8, hash uint64) bool {
+	i1, i2 := l.buckets(fp, hash)
+	for _, i := range []uint64{i1, i2} {
+		b := f.bucket(l, i)
+		if k := bytes.IndexByte(b, 0); k >= 0 {
+			b[k] = fp
+			return true
+		}
+	}
+
+	type move struct {
+		bucket uint64
+		slot   int
+		fp     uint8
+	}
+	var moves []move
+
+	i := i1
+	if f.nextRandom()&1 == 1 {
+		i = i2
+	}
+
+	for n := uint16(0); n < f.maxIterations; n++ {
+		b := f.bucket(l, i)
+		k := int(f.nextRandom() % uint64(f.bucketSize))
+
+		moves = append(moves, move{i, k, b[k]})
+		fp, b[k] = b[k], fp
+
+		i = l.altBucket(fp, i)
+		b = f.bucket(l, i)
+		if k := bytes.IndexByte(b, 0); k >= 0 {
+			b[k] = fp
+			return true
+		}
+	}
+
+	for j := len(moves) - 1; j >= 0; j-- {
+		f.bucket(l, moves[j].bucket)[moves[j].slot] = moves[j].fp
+	}
+	return false
+}
+
+// Add adds the item to the filter, even if it may already exist. Returns
+// ErrFilterFull if the filter is full and non scaling.
+func (f *CuckooFilter) Add(item []byte) error {
+	fp, hash := cuckooFingerprint(item)
+
+	for _, l := range f.layers {
+		if f.insert(l, fp, hash) {
+			f.count++
+			return nil
+		}
+	}
+
+	if f.expansion == 0 {
+		return ErrFilterFull
+	}
+
+	last := f.layers[len(f.layers)-1]
+	if !f.insert(f.addLayer(last.numBuckets*uint64(f.expansion)), fp, hash) {
+		return ErrFilterFull
+	}
+
+	f.count++
+	return nil
+}
+
+// Bytes returns the parameters and counters of the filter followed by
+// every layer.
+func (f *CuckooFilter) Bytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, f.bucketSize)
+	binary.Write(&buf, binary.BigEndian, f.maxIterations)
+	binary.Write(&buf, binary.BigEndian, f.expansion)
+	binary.Write(&buf, binary.BigEndian, f.count)
+	binary.Write(&buf, binary.BigEndian, f.deleted)
+	binary.Write(&buf, binary.BigEndian, f.rng)
+	binary.Write(&buf, binary.BigEndian, uint32(len(f.layers)))
+
+	for _, l := range f.layers {
+		binary.Write(&buf, binary.BigEndian, l.numBuckets)
+		buf.Write(l.slots)
+	}
+
+	return buf.Bytes()
+}
+
+// NewCuckooFilterFromBytes returns the cuckoo filter encoded by Bytes.
+func NewCuckooFilterFromBytes(data []byte) (*CuckooFilter, error) {
+	r := bytes.NewReader(data)
+	f := &CuckooFilter{}
+
+	var n uint32
+	if err := readBinary(r, &f.bucketSize, &f.maxIterations, &f.expansion, &f.count, &f.deleted, &f.rng, &n); err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	if n == 0 || f.bucketSize == 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	for i := uint32(0); i < n; i++ {
+		l := &cuckooLayer{}
+		if err := readBinary(r, &l.numBuckets); err != nil {
+			return nil, ErrInvalidFilter
+		}
+
+		size := l.numBuckets * uint64(f.bucketSize)
+		if l.numBuckets == 0 || l.numBuckets > cuckooMaxBuckets || l.numBuckets&(l.numBuckets-1) != 0 || size > uint64(r.Len()) {
+			return nil, ErrInvalidFilter
+		}
+
+		l.slots = make([]uint8, size)
+		r.Read(l.slots)
+		f.layers = append(f.layers, l)
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrInvalidFilter
+	}
+	return f, nil
+}
@@ -0,0 +1,102 @@
+package datastructure_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_CuckooFilter(t *testing.T) {
+	f := datastructure.NewCuckooFilter(1000, 2, 20, 1)
+	for i := 0; i < 3000; i++ {
+		if err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3000; i++ {
+		if !f.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("expected %d to exist", i)
+		}
+	}
+
+	if f.Count() != 3000 || f.Capacity() < 3000 {
+		t.Errorf("unexpected count %d and capacity %d", f.Count(), f.Capacity())
+	}
+
+	for i := 0; i < 3000; i += 2 {
+		if !f.Delete([]byte(strconv.Itoa(i))) {
+			t.Fatalf("expected %d to be deleted", i)
+		}
+	}
+
+	// Odd items remain, most even ones are gone
+	var remaining int
+	for i := 0; i < 3000; i++ {
+		exists := f.Exists([]byte(strconv.Itoa(i)))
+		if i%2 == 1 && !exists {
+			t.Fatalf("expected %d to exist", i)
+		}
+		if i%2 == 0 && exists {
+			remaining++
+		}
+	}
+
+	if remaining > 150 {
+		t.Errorf("expected most deleted items not to exist, %d still exist", remaining)
+	}
+
+	if f.Delete([]byte("missing")) && f.Count() != 1499 {
+		t.Errorf("unexpected count %d", f.Count())
+	}
+}
+
+func Test_CuckooFilterCount(t *testing.T) {
+	f := datastructure.NewCuckooFilter(100, 4, 20, 0)
+	for i := 0; i < 3; i++ {
+		f.Add([]byte("a"))
+	}
+
+	if n := f.CountItem([]byte("a")); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if err != datastructure.ErrFilterFull {
+		t.Errorf("expected ErrFilterFull, got %v", err)
+	}
+}
+
+func Test_CuckooFilterBytes(t *testing.T) {
+	f := datastructure.NewCuckooFilter(64, 2, 20, 2)
+	for i := 0; i < 500; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	got, err := datastructure.NewCuckooFilterFromBytes(f.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		if !got.Exists([]byte(strconv.Itoa(i))) {
+			t.Fatalf("expected %d to exist", i)
+		}
+	}
+
+	// The restored filter keeps adding items the same way
+	f.Add([]byte("next"))
+	got.Add([]byte("next"))
+	if string(got.Bytes()) != string(f.Bytes()) {
+		t.Errorf("expected the filters to be identical")
+	}
+
+	if _, err := datastructure.NewCuckooFilterFromBytes(f.Bytes()[:10]); err != datastructure.ErrInvalidFilter {
+		t.Errorf("expected ErrInvalidFilter, got %v", err)
+	}
+}
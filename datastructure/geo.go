@@ -0,0 +1,264 @@
+package datastructure
+
+import "math"
+
+// The functions of this file map coordinates to geohashes, 52 bits integers
+// interleaving the bits of the longitude and latitude, so that locations are
+// stored in sorted sets with their geohash as score and nearby locations
+// have close scores.
+
+const (
+	// GeoStep is the number of bits of the longitude and latitude of a
+	// geohash.
+	GeoStep = 26
+
+	// GeoLonMin is the minimum longitude.
+	GeoLonMin = -180.0
+	// GeoLonMax is the maximum longitude.
+	GeoLonMax = 180.0
+	// GeoLatMin is the minimum latitude, limited to the Web Mercator
+	// projection.
+	GeoLatMin = -85.05112878
+	// GeoLatMax is the maximum latitude, limited to the Web Mercator
+	// projection.
+	GeoLatMax = 85.05112878
+
+	// earthRadius is the radius of the Earth in meters.
+	earthRadius = 6372797.560856
+	// mercatorMax is half the circumference of the Earth in meters.
+	mercatorMax = 20037726.37
+)
+
+// geoBase32 is the alphabet of the geohash strings.
+const geoBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeoShape is the area of a geospatial search, either a circle or a box
+// centered on a location.
+type GeoShape struct {
+	Lon, Lat float64
+	// Box is true if the shape is a box rather than a circle
+	Box bool
+	// Radius is the radius of a circle in meters
+	Radius float64
+	// Width and Height are the dimensions of a box in meters
+	Width, Height float64
+}
+
+// GeoScoreRange is a range of geohash scores, the maximum being exclusive.
+type GeoScoreRange struct {
+	Min, Max float64
+}
+
+// spread spreads the lowest 32 bits of v to the even bits of the result.
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squash squashes the even bits of v to the lowest 32 bits of the result.
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+// interleave returns the geohash of the cell at the given column and row,
+// the longitude bits being on the odd positions.
+func interleave(x, y uint64) uint64 {
+	return spread(y) | spread(x)<<1
+}
+
+// geoCell returns the column and row of the cell containing the location in
+// a grid of 2^step by 2^step cells covering the given latitude range.
+func geoCell(lon, lat, latMin, latMax float64, step uint) (x, y uint64) {
+	n := float64(uint64(1) << step)
+	fx := (lon - GeoLonMin) / (GeoLonMax - GeoLonMin) * n
+	fy := (lat - latMin) / (latMax - latMin) * n
+
+	// The maximum longitude and latitude belong to the last cell
+	x, y = uint64(math.Max(fx, 0)), uint64(math.Max(fy, 0))
+	if x >= uint64(n) {
+		x = uint64(n) - 1
+	}
+	if y >= uint64(n) {
+		y = uint64(n) - 1
+	}
+	return x, y
+}
+
+// ValidGeoCoordinates returns true if the location can be indexed.
+func ValidGeoCoordinates(lon, lat float64) bool {
+	return lon >= GeoLonMin && lon <= GeoLonMax && lat >= GeoLatMin && lat <= GeoLatMax
+}
+
+// GeoEncode returns the 52 bits geohash of the location.
+func GeoEncode(lon, lat float64) uint64 {
+	return interleave(geoCell(lon, lat, GeoLatMin, GeoLatMax, GeoStep))
+}
+
+// GeoDecode returns the location at the center of the cell of the geohash.
+func GeoDecode(hash uint64) (lon, lat float64) {
+	x, y := squash(hash>>1), squash(hash)
+	n := float64(uint64(1) << GeoStep)
+
+	lon = GeoLonMin + (float64(x)+0.5)*(GeoLonMax-GeoLonMin)/n
+	lat = GeoLatMin + (float64(y)+0.5)*(GeoLatMax-GeoLatMin)/n
+	return math.Max(GeoLonMin, math.Min(lon, GeoLonMax)), math.Max(GeoLatMin, math.Min(lat, GeoLatMax))
+}
+
+// GeoHashString returns the standard 11 characters geohash of the location,
+// which unlike GeoEncode covers the latitudes from -90 to 90.
+func GeoHashString(lon, lat float64) string {
+	hash := interleave(geoCell(lon, lat, -90, 90, GeoStep))
+
+	b := make([]byte, 11)
+	for i := range b {
+		// The hash lacks bits for the last character, which is always 0
+		shift := 2*GeoStep - 5*(i+1)
+		if shift < 0 {
+			b[i] = '0'
+			continue
+		}
+		b[i] = geoBase32[hash>>uint(shift)&0x1f]
+	}
+	return string(b)
+}
+
+// GeoDistance returns the distance in meters between two locations.
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// Contains returns true if the location is within the shape, and its
+// distance to the center of the shape.
+func (s *GeoShape) Contains(lon, lat float64) (float64, bool) {
+	if !s.Box {
+		d := GeoDistance(s.Lon, s.Lat, lon, lat)
+		return d, d <= s.Radius
+	}
+
+	// The box is measured along the meridian and parallel of the location
+	if earthRadius*math.Abs(lat-s.Lat)*math.Pi/180 > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(s.Lon, lat, lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Lon, s.Lat, lon, lat), true
+}
+
+// boundingBox returns the longitude and latitude ranges containing the
+// shape. The longitudes may exceed [-180, 180].
+func (s *GeoShape) boundingBox() (lonMin, lonMax, latMin, latMax float64) {
+	width, height := s.Radius, s.Radius
+	if s.Box {
+		width, height = s.Width/2, s.Height/2
+	}
+
+	dLat := height / earthRadius * 180 / math.Pi
+	dLon := 180.0
+	if cos := math.Cos((math.Abs(s.Lat) + dLat) * math.Pi / 180); cos > 0 {
+		dLon = math.Min(width/earthRadius/cos*180/math.Pi, 180)
+	}
+	return s.Lon - dLon, s.Lon + dLon, s.Lat - dLat, s.Lat + dLat
+}
+
+// geoEstimateStep returns the greatest step whose cells are larger than the
+// given distance in meters at the latitude.
+func geoEstimateStep(distance, lat float64) uint {
+	if distance == 0 {
+		return GeoStep
+	}
+
+	step := 1
+	for ; distance < mercatorMax; step++ {
+		distance *= 2
+	}
+	step -= 2
+
+	// Cells get narrower towards the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+
+	if step < 1 {
+		return 1
+	}
+	if step > GeoStep {
+		return GeoStep
+	}
+	return uint(step)
+}
+
+// SearchRanges returns the ranges of geohash scores of the cell of the
+// center of the shape and of its neighbors, which together contain the
+// shape. The members of these ranges must still be tested with Contains.
+func (s *GeoShape) SearchRanges() []GeoScoreRange {
+	size := s.Radius
+	if s.Box {
+		size = math.Max(s.Width, s.Height) / 2
+	}
+
+	lonMin, lonMax, latMin, latMax := s.boundingBox()
+	step := geoEstimateStep(size, s.Lat)
+
+	// Use larger cells until the center cell and its neighbors cover the
+	// bounding box
+	var x, y uint64
+	for ; ; step-- {
+		x, y = geoCell(s.Lon, s.Lat, GeoLatMin, GeoLatMax, step)
+		cellWidth := (GeoLonMax - GeoLonMin) / float64(uint64(1)<<step)
+		cellHeight := (GeoLatMax - GeoLatMin) / float64(uint64(1)<<step)
+
+		west := GeoLonMin + float64(x)*cellWidth
+		south := GeoLatMin + float64(y)*cellHeight
+		if step == 1 || (lonMin >= west-cellWidth && lonMax <= west+2*cellWidth &&
+			(latMin >= south-cellHeight || y == 0) && (latMax <= south+2*cellHeight || y == 1<<step-1)) {
+			break
+		}
+	}
+
+	n := int64(1) << step
+	shift := 2 * (GeoStep - step)
+	seen := make(map[uint64]bool, 9)
+
+	var ranges []GeoScoreRange
+	for dy := int64(-1); dy <= 1; dy++ {
+		row := int64(y) + dy
+		if row < 0 || row >= n {
+			continue
+		}
+
+		for dx := int64(-1); dx <= 1; dx++ {
+			// Longitudes wrap around the antimeridian
+			col := (int64(x) + dx + n) % n
+			hash := interleave(uint64(col), uint64(row))
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+
+			ranges = append(ranges, GeoScoreRange{
+				Min: float64(hash << shift),
+				Max: float64((hash + 1) << shift),
+			})
+		}
+	}
+
+	return ranges
+}
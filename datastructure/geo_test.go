@@ -0,0 +1,81 @@
+package datastructure_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_GeoEncodeDecode(t *testing.T) {
+	for _, loc := range [][2]float64{{13.361389, 38.115556}, {-122.27652, 37.805186}, {180, 85.05112878}, {-180, -85.05112878}, {0, 0}} {
+		lon, lat := datastructure.GeoDecode(datastructure.GeoEncode(loc[0], loc[1]))
+		if math.Abs(lon-loc[0]) > 1e-5 || math.Abs(lat-loc[1]) > 1e-5 {
+			t.Errorf("expected %v, got %v, %v", loc, lon, lat)
+		}
+	}
+
+	if hash := datastructure.GeoEncode(13.361389, 38.115556); hash != 3479099956230698 {
+		t.Errorf("expected 3479099956230698, got %d", hash)
+	}
+}
+
+func Test_GeoHashString(t *testing.T) {
+	if got := datastructure.GeoHashString(13.361389, 38.115556); got != "sqc8b49rny0" {
+		t.Errorf("expected sqc8b49rny0, got %s", got)
+	}
+	if got := datastructure.GeoHashString(15.087269, 37.502669); got != "sqdtr74hyu0" {
+		t.Errorf("expected sqdtr74hyu0, got %s", got)
+	}
+}
+
+func Test_GeoDistance(t *testing.T) {
+	// Palermo to Catania, as stored in their geohash
+	lon1, lat1 := datastructure.GeoDecode(datastructure.GeoEncode(13.361389, 38.115556))
+	lon2, lat2 := datastructure.GeoDecode(datastructure.GeoEncode(15.087269, 37.502669))
+	if d := datastructure.GeoDistance(lon1, lat1, lon2, lat2); math.Abs(d-166274.1516) > 0.0001 {
+		t.Errorf("expected 166274.1516, got %.4f", d)
+	}
+}
+
+func Test_GeoSearchRanges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	shapes := []datastructure.GeoShape{
+		{Lon: 13.4, Lat: 38.1, Radius: 200000},
+		{Lon: 179.99, Lat: 10, Radius: 50000},
+		{Lon: -70, Lat: 84, Radius: 300000},
+		{Lon: 2.35, Lat: 48.85, Radius: 10},
+		{Lon: 2.35, Lat: 48.85, Box: true, Width: 400000, Height: 100000},
+	}
+
+	for _, shape := range shapes {
+		ranges := shape.SearchRanges()
+		for i := 0; i < 20000; i++ {
+			// Locations are sampled around the center of the shape
+			lon := shape.Lon + (rng.Float64()*2-1)*10
+			lat := math.Max(math.Min(shape.Lat+(rng.Float64()*2-1)*5, datastructure.GeoLatMax), datastructure.GeoLatMin)
+			if lon > 180 {
+				lon -= 360
+			}
+
+			if _, ok := shape.Contains(lon, lat); !ok {
+				continue
+			}
+
+			score := float64(datastructure.GeoEncode(lon, lat))
+			var found bool
+			for _, r := range ranges {
+				if score >= r.Min && score < r.Max {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				t.Fatalf("%+v: location %v, %v is not within the search ranges", shape, lon, lat)
+			}
+		}
+	}
+}
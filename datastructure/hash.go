@@ -0,0 +1,166 @@
+package datastructure
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"sort"
+)
+
+// hashEntryOverhead is the estimated amount of bytes used by the
+// map bucket of a single field.
+const hashEntryOverhead = 48
+
+// Hash is a map of fields to values that keeps track of its memory usage.
+// It is not safe for concurrent use.
+type Hash struct {
+	fields map[string][]byte
+	size   int
+}
+
+// NewHash returns a new Hash.
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string][]byte)}
+}
+
+// Len returns the number of fields in the hash.
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Size returns the estimated amount of bytes used by the fields and values.
+func (h *Hash) Size() int {
+	return h.size
+}
+
+// Get returns the value of the field.
+func (h *Hash) Get(field string) ([]byte, bool) {
+	v, ok := h.fields[field]
+	return v, ok
+}
+
+// Exists returns true if the field exists.
+func (h *Hash) Exists(field string) bool {
+	_, ok := h.fields[field]
+	return ok
+}
+
+// Set sets the value of the field. Returns true if the field is new.
+func (h *Hash) Set(field string, value []byte) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.size += len(value) - len(old)
+	} else {
+		h.size += hashEntryOverhead + len(field) + len(value)
+	}
+
+	h.fields[field] = value
+	return !exists
+}
+
+// Delete deletes the field. Returns true if the field existed.
+func (h *Hash) Delete(field string) bool {
+	v, ok := h.fields[field]
+	if !ok {
+		return false
+	}
+
+	h.size -= hashEntryOverhead + len(field) + len(v)
+	delete(h.fields, field)
+	return true
+}
+
+// Range calls fn for every field and value until fn returns false.
+func (h *Hash) Range(fn func(field string, value []byte) bool) {
+	for f, v := range h.fields {
+		if !fn(f, v) {
+			return
+		}
+	}
+}
+
+// Keys returns the fields of the hash.
+func (h *Hash) Keys() []string {
+	keys := make([]string, 0, len(h.fields))
+	for f := range h.fields {
+		keys = append(keys, f)
+	}
+	return keys
+}
+
+// Values returns the values of the hash.
+func (h *Hash) Values() [][]byte {
+	values := make([][]byte, 0, len(h.fields))
+	for _, v := range h.fields {
+		values = append(values, v)
+	}
+	return values
+}
+
+// Scan iterates over the fields incrementally. It returns up to count fields
+// matching the pattern starting at the given cursor, and the cursor to use in
+// the next call, which is 0 once the iteration is complete.
+//
+// Fields are visited in the order of their hash, so every field that is
+// present during the whole iteration is returned at least once even if
+// the hash is modified between calls.
+func (h *Hash) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	return scanStrings(h.Keys(), cursor, count, pattern)
+}
+
+// scanStrings implements a stateless cursor based iteration over the given
+// strings, ordered by their hash.
+func scanStrings(ss []string, cursor uint64, count int, pattern string) ([]string, uint64) {
+	type entry struct {
+		hash uint64
+		s    string
+	}
+
+	entries := make([]entry, 0, len(ss))
+	for _, s := range ss {
+		if hash := hashString(s); hash >= cursor {
+			entries = append(entries, entry{hash, s})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hash == entries[j].hash {
+			return entries[i].s < entries[j].s
+		}
+		return entries[i].hash < entries[j].hash
+	})
+
+	if count < 1 {
+		count = 1
+	}
+
+	// Never split entries sharing the same hash across two calls
+	n := count
+	for n < len(entries) && entries[n].hash == entries[n-1].hash {
+		n++
+	}
+
+	var next uint64
+	if n < len(entries) {
+		next = entries[n].hash
+	} else {
+		n = len(entries)
+	}
+
+	var result []string
+	for _, e := range entries[:n] {
+		if pattern != "" {
+			if match, _ := filepath.Match(pattern, e.s); !match {
+				continue
+			}
+		}
+		result = append(result, e.s)
+	}
+
+	return result, next
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
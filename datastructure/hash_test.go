@@ -0,0 +1,96 @@
+package datastructure_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_HashSetGet(t *testing.T) {
+	hash := datastructure.NewHash()
+
+	if !hash.Set("field", []byte("value")) {
+		t.Errorf("Set failed: expected a new field")
+	}
+
+	if hash.Set("field", []byte("value2")) {
+		t.Errorf("Set failed: expected an existing field")
+	}
+
+	if v, ok := hash.Get("field"); !ok || string(v) != "value2" {
+		t.Errorf("Get failed: expected value2, got %s", v)
+	}
+
+	if _, ok := hash.Get("missing"); ok {
+		t.Errorf("Get failed: expected missing field")
+	}
+
+	if hash.Len() != 1 {
+		t.Errorf("Len failed: expected 1, got %d", hash.Len())
+	}
+}
+
+func Test_HashDelete(t *testing.T) {
+	hash := datastructure.NewHash()
+	hash.Set("field", []byte("value"))
+
+	if !hash.Delete("field") {
+		t.Errorf("Delete failed: expected the field to be deleted")
+	}
+
+	if hash.Delete("field") {
+		t.Errorf("Delete failed: expected the field to be missing")
+	}
+
+	if hash.Len() != 0 || hash.Size() != 0 {
+		t.Errorf("Delete failed: expected an empty hash, got len %d size %d", hash.Len(), hash.Size())
+	}
+}
+
+func Test_HashSize(t *testing.T) {
+	hash := datastructure.NewHash()
+	hash.Set("a", []byte("12345"))
+	size := hash.Size()
+
+	hash.Set("a", []byte("1234567890"))
+	if hash.Size() != size+5 {
+		t.Errorf("Size failed: expected %d, got %d", size+5, hash.Size())
+	}
+
+	hash.Set("b", []byte("1"))
+	hash.Delete("b")
+	if hash.Size() != size+5 {
+		t.Errorf("Size failed: expected %d, got %d", size+5, hash.Size())
+	}
+}
+
+func Test_HashScan(t *testing.T) {
+	hash := datastructure.NewHash()
+	for i := 0; i < 100; i++ {
+		hash.Set(fmt.Sprintf("field:%d", i), []byte("value"))
+	}
+
+	seen := make(map[string]bool)
+	var cursor uint64
+	for {
+		var fields []string
+		fields, cursor = hash.Scan(cursor, 7, "")
+		for _, f := range fields {
+			seen[f] = true
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != 100 {
+		t.Errorf("Scan failed: expected 100 fields, got %d", len(seen))
+	}
+
+	fields, cursor := hash.Scan(0, 1000, "field:1?")
+	if len(fields) != 10 || cursor != 0 {
+		t.Errorf("Scan failed: expected 10 fields and cursor 0, got %d and %d", len(fields), cursor)
+	}
+}
@@ -0,0 +1,341 @@
+package datastructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// hllPrecision is the number of bits of the hash used to select a register.
+	hllPrecision = 14
+	// hllRegisters is the number of registers.
+	hllRegisters = 1 << hllPrecision
+	// hllRegisterBits is the number of bits of a dense register.
+	hllRegisterBits = 6
+	// hllRegisterMax is the greatest value of a register.
+	hllRegisterMax = 1<<hllRegisterBits - 1
+	// hllDenseSize is the number of bytes of the dense registers. The extra
+	// byte allows reading the last register as two bytes.
+	hllDenseSize = hllRegisters*hllRegisterBits/8 + 1
+	// hllQ is the number of bits of the hash used to count the zeros.
+	hllQ = 64 - hllPrecision
+	// hllAlphaInf is the bias correction constant of the estimator.
+	hllAlphaInf = 0.721347520444481703680
+	// hllSeed is the seed of the hash function.
+	hllSeed = 0xadc83b19
+)
+
+// HyperLogLogSparseMaxEntries is the maximum number of non-zero registers of
+// a sparse HyperLogLog before it is converted to the dense encoding.
+var HyperLogLogSparseMaxEntries = 750
+
+// ErrInvalidHyperLogLog is returned when decoding malformed HyperLogLog bytes.
+var ErrInvalidHyperLogLog = errors.New("invalid HyperLogLog")
+
+// HyperLogLogEncoding is the encoding of the registers of a HyperLogLog.
+type HyperLogLogEncoding uint8
+
+const (
+	// HyperLogLogSparse stores the non-zero registers only.
+	HyperLogLogSparse HyperLogLogEncoding = iota
+	// HyperLogLogDense stores every register in 6 bits.
+	HyperLogLogDense
+)
+
+func (e HyperLogLogEncoding) String() string {
+	if e == HyperLogLogSparse {
+		return "sparse"
+	}
+	return "dense"
+}
+
+// HyperLogLog estimates the number of distinct elements added to it using a
+// fixed amount of memory, with a standard error of 0.81%. It starts with a
+// sparse encoding, efficient while few registers are set, and switches to
+// the dense encoding once it grows.
+// It is not safe for concurrent use.
+type HyperLogLog struct {
+	encoding HyperLogLogEncoding
+	// sparse are the non-zero registers ordered by index, each one stored as
+	// its index followed by its 6 bits value
+	sparse []uint32
+	dense  []byte
+}
+
+// NewHyperLogLog returns a new empty HyperLogLog.
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// Encoding returns the encoding of the registers.
+func (h *HyperLogLog) Encoding() HyperLogLogEncoding {
+	return h.encoding
+}
+
+// Size returns the estimated amount of bytes used by the registers.
+func (h *HyperLogLog) Size() int {
+	if h.encoding == HyperLogLogDense {
+		return len(h.dense)
+	}
+	return len(h.sparse) * 4
+}
+
+// murmurHash64A is the 64 bits MurmurHash2 of the data.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ uint64(len(data))*m
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPosition returns the register of the element and the length of the run
+// of zeros of its hash plus one.
+func hllPosition(element []byte) (index int, count uint8) {
+	hash := murmurHash64A(element, hllSeed)
+	index = int(hash & (hllRegisters - 1))
+
+	// The extra bit stops the run once the hash bits are exhausted
+	hash >>= hllPrecision
+	hash |= 1 << hllQ
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+func (h *HyperLogLog) denseGet(index int) uint8 {
+	bit := index * hllRegisterBits
+	b, shift := bit/8, uint(bit&7)
+	return (h.dense[b]>>shift | h.dense[b+1]<<(8-shift)) & hllRegisterMax
+}
+
+func (h *HyperLogLog) denseSet(index int, value uint8) {
+	bit := index * hllRegisterBits
+	b, shift := bit/8, uint(bit&7)
+	h.dense[b] &^= hllRegisterMax << shift
+	h.dense[b] |= value << shift
+	h.dense[b+1] &^= hllRegisterMax >> (8 - shift)
+	h.dense[b+1] |= value >> (8 - shift)
+}
+
+// sparseSearch returns the position of the register in the sparse registers
+// and whether it is set.
+func (h *HyperLogLog) sparseSearch(index int) (int, bool) {
+	i := sort.Search(len(h.sparse), func(i int) bool { return int(h.sparse[i]>>hllRegisterBits) >= index })
+	return i, i < len(h.sparse) && int(h.sparse[i]>>hllRegisterBits) == index
+}
+
+// setMax sets the register to the value if it is greater than its current
+// value. Returns true if the register was updated.
+func (h *HyperLogLog) setMax(index int, value uint8) bool {
+	if h.encoding == HyperLogLogDense {
+		if h.denseGet(index) >= value {
+			return false
+		}
+		h.denseSet(index, value)
+		return true
+	}
+
+	entry := uint32(index)<<hllRegisterBits | uint32(value)
+	i, ok := h.sparseSearch(index)
+	if ok {
+		if uint8(h.sparse[i]&hllRegisterMax) >= value {
+			return false
+		}
+		h.sparse[i] = entry
+		return true
+	}
+
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = entry
+
+	if len(h.sparse) > HyperLogLogSparseMaxEntries {
+		h.toDense()
+	}
+	return true
+}
+
+// toDense converts the registers to the dense encoding.
+func (h *HyperLogLog) toDense() {
+	if h.encoding == HyperLogLogDense {
+		return
+	}
+
+	sparse := h.sparse
+	h.encoding = HyperLogLogDense
+	h.dense = make([]byte, hllDenseSize)
+	h.sparse = nil
+
+	for _, entry := range sparse {
+		h.denseSet(int(entry>>hllRegisterBits), uint8(entry&hllRegisterMax))
+	}
+}
+
+// Add adds the element. Returns true if the estimated cardinality may have
+// changed.
+func (h *HyperLogLog) Add(element []byte) bool {
+	index, count := hllPosition(element)
+	return h.setMax(index, count)
+}
+
+// Merge merges the registers of o, so that the HyperLogLog estimates the
+// cardinality of the union of both sets.
+func (h *HyperLogLog) Merge(o *HyperLogLog) {
+	if o.encoding == HyperLogLogSparse {
+		for _, entry := range o.sparse {
+			h.setMax(int(entry>>hllRegisterBits), uint8(entry&hllRegisterMax))
+		}
+		return
+	}
+
+	h.toDense()
+	for i := 0; i < hllRegisters; i++ {
+		if v := o.denseGet(i); v > h.denseGet(i) {
+			h.denseSet(i, v)
+		}
+	}
+}
+
+// histogram returns the number of registers of each value.
+func (h *HyperLogLog) histogram() [hllQ + 2]int {
+	var histo [hllQ + 2]int
+	if h.encoding == HyperLogLogDense {
+		for i := 0; i < hllRegisters; i++ {
+			histo[h.denseGet(i)]++
+		}
+		return histo
+	}
+
+	histo[0] = hllRegisters - len(h.sparse)
+	for _, entry := range h.sparse {
+		histo[entry&hllRegisterMax]++
+	}
+	return histo
+}
+
+// hllSigma is the sigma function of the improved estimator by Otmar Ertl.
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+// hllTau is the tau function of the improved estimator by Otmar Ertl.
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// Count returns the estimated number of distinct elements.
+func (h *HyperLogLog) Count() int64 {
+	histo := h.histogram()
+	m := float64(hllRegisters)
+
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+
+	return int64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// Bytes returns the encoding followed by the registers: the dense registers
+// as is, or every sparse register as its 2 bytes index and 1 byte value.
+func (h *HyperLogLog) Bytes() []byte {
+	if h.encoding == HyperLogLogDense {
+		return append([]byte{byte(HyperLogLogDense)}, h.dense...)
+	}
+
+	b := make([]byte, 1, 1+len(h.sparse)*3)
+	b[0] = byte(HyperLogLogSparse)
+	for _, entry := range h.sparse {
+		index := entry >> hllRegisterBits
+		b = append(b, byte(index>>8), byte(index), byte(entry&hllRegisterMax))
+	}
+	return b
+}
+
+// NewHyperLogLogFromBytes returns the HyperLogLog encoded by Bytes.
+func NewHyperLogLogFromBytes(b []byte) (*HyperLogLog, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidHyperLogLog
+	}
+
+	h := NewHyperLogLog()
+	switch HyperLogLogEncoding(b[0]) {
+	case HyperLogLogDense:
+		if len(b)-1 != hllDenseSize {
+			return nil, ErrInvalidHyperLogLog
+		}
+		h.encoding = HyperLogLogDense
+		h.dense = append([]byte(nil), b[1:]...)
+	case HyperLogLogSparse:
+		b = b[1:]
+		if len(b)%3 != 0 {
+			return nil, ErrInvalidHyperLogLog
+		}
+
+		prev := -1
+		h.sparse = make([]uint32, 0, len(b)/3)
+		for ; len(b) > 0; b = b[3:] {
+			index, value := int(binary.BigEndian.Uint16(b)), b[2]
+			if index <= prev || index >= hllRegisters || value == 0 || value > hllRegisterMax {
+				return nil, ErrInvalidHyperLogLog
+			}
+			h.sparse = append(h.sparse, uint32(index)<<hllRegisterBits|uint32(value))
+			prev = index
+		}
+	default:
+		return nil, ErrInvalidHyperLogLog
+	}
+
+	return h, nil
+}
@@ -0,0 +1,109 @@
+package datastructure_test
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_HyperLogLogCount(t *testing.T) {
+	h := datastructure.NewHyperLogLog()
+	if got := h.Count(); got != 0 {
+		t.Errorf("expected empty HyperLogLog to count 0, got %d", got)
+	}
+
+	if !h.Add([]byte("a")) {
+		t.Errorf("expected Add to update a register")
+	}
+	if h.Add([]byte("a")) {
+		t.Errorf("expected adding the same element twice to update nothing")
+	}
+
+	for _, n := range []int{10, 100, 1000, 10000, 100000} {
+		h := datastructure.NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add([]byte("element:" + strconv.Itoa(i)))
+		}
+
+		got := h.Count()
+		if e := math.Abs(float64(got-int64(n))) / float64(n); e > 0.03 {
+			t.Errorf("expected %d, got %d (error %.2f%%)", n, got, e*100)
+		}
+	}
+}
+
+func Test_HyperLogLogEncoding(t *testing.T) {
+	h := datastructure.NewHyperLogLog()
+	for i := 0; i < datastructure.HyperLogLogSparseMaxEntries/2; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if h.Encoding() != datastructure.HyperLogLogSparse {
+		t.Fatalf("expected sparse encoding")
+	}
+	count := h.Count()
+
+	for i := 0; i < datastructure.HyperLogLogSparseMaxEntries*2; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if h.Encoding() != datastructure.HyperLogLogDense {
+		t.Fatalf("expected dense encoding")
+	}
+
+	// The registers must be preserved by the conversion
+	sparse := datastructure.NewHyperLogLog()
+	for i := 0; i < datastructure.HyperLogLogSparseMaxEntries/2; i++ {
+		sparse.Add([]byte(strconv.Itoa(i)))
+	}
+	sparse.Merge(h)
+	if sparse.Count() != h.Count() || count > h.Count() {
+		t.Errorf("expected %d, got %d", h.Count(), sparse.Count())
+	}
+}
+
+func Test_HyperLogLogMerge(t *testing.T) {
+	a, b := datastructure.NewHyperLogLog(), datastructure.NewHyperLogLog()
+	for i := 0; i < 3000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+
+	union := datastructure.NewHyperLogLog()
+	for i := 0; i < 5000; i++ {
+		union.Add([]byte(strconv.Itoa(i)))
+	}
+
+	a.Merge(b)
+	if a.Count() != union.Count() {
+		t.Errorf("expected %d, got %d", union.Count(), a.Count())
+	}
+}
+
+func Test_HyperLogLogBytes(t *testing.T) {
+	for _, n := range []int{0, 10, 5000} {
+		h := datastructure.NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add([]byte(strconv.Itoa(i)))
+		}
+
+		got, err := datastructure.NewHyperLogLogFromBytes(h.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Encoding() != h.Encoding() || got.Count() != h.Count() {
+			t.Errorf("expected %d, got %d", h.Count(), got.Count())
+		}
+	}
+
+	for _, b := range [][]byte{nil, {9}, {0, 0, 1}, {0, 0xff, 0xff, 1}, {1, 0}} {
+		if _, err := datastructure.NewHyperLogLogFromBytes(b); err != datastructure.ErrInvalidHyperLogLog {
+			t.Errorf("expected ErrInvalidHyperLogLog for %v, got %v", b, err)
+		}
+	}
+}
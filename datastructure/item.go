@@ -30,6 +30,9 @@ type Item struct {
 	ExpiresAt time.Time
 	// CreatedAt is the time when the item is created.
 	CreatedAt time.Time
+	// Version is the value of the dirty counter of the map when the item was
+	// last modified. It is never 0 once the item is stored.
+	Version int64
 }
 
 // NewItem creates a new item.
@@ -51,6 +54,28 @@ func NewItem(key string, data any, ttl time.Duration) *Item {
 	return item
 }
 
+// Sizer is implemented by the values that keep track of their memory usage.
+type Sizer interface {
+	// Size returns the estimated amount of bytes used by the value.
+	Size() int
+}
+
+// MemoryUsage returns the estimated amount of bytes used by the item.
+func (i *Item) MemoryUsage() int {
+	n := int(unsafe.Sizeof(*i)) + len(i.Key)
+
+	switch v := i.Data.(type) {
+	case string:
+		n += len(v)
+	case []byte:
+		n += len(v)
+	case Sizer:
+		n += v.Size()
+	}
+
+	return n
+}
+
 // HasFlag returns true if the item has the given flag.
 func (i *Item) HasFlag(flag ItemFlag) bool {
 	return i.Flag&flag != 0
@@ -0,0 +1,387 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidJSON is returned when parsing malformed JSON.
+var ErrInvalidJSON = errors.New("invalid JSON")
+
+// jsonValueOverhead is the estimated amount of bytes used by a JSON value
+// besides its content.
+const jsonValueOverhead = 16
+
+// JSONObject is a JSON object keeping the insertion order of its keys.
+// It is not safe for concurrent use.
+type JSONObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewJSONObject returns a new empty JSONObject.
+func NewJSONObject() *JSONObject {
+	return &JSONObject{values: make(map[string]any)}
+}
+
+// Len returns the number of keys of the object.
+func (o *JSONObject) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns the keys of the object in insertion order. The returned slice
+// must not be modified.
+func (o *JSONObject) Keys() []string {
+	return o.keys
+}
+
+// Get returns the value of the key.
+func (o *JSONObject) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets the value of the key, appending the key if it is new.
+func (o *JSONObject) Set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Delete deletes the key. Returns true if the key existed.
+func (o *JSONObject) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// JSONArray is a JSON array.
+type JSONArray struct {
+	Values []any
+}
+
+// JSON is a JSON document. Its values are nil, bool, int64, float64, string,
+// *JSONArray and *JSONObject.
+// It is not safe for concurrent use.
+type JSON struct {
+	Root any
+}
+
+// NewJSON returns a new JSON document with the given root value.
+func NewJSON(root any) *JSON {
+	return &JSON{Root: root}
+}
+
+// Size returns the estimated amount of bytes used by the document.
+func (j *JSON) Size() int {
+	return jsonSize(j.Root)
+}
+
+func jsonSize(v any) int {
+	n := jsonValueOverhead
+	switch v := v.(type) {
+	case string:
+		n += len(v)
+	case *JSONArray:
+		for _, e := range v.Values {
+			n += jsonSize(e)
+		}
+	case *JSONObject:
+		for _, k := range v.keys {
+			n += len(k) + jsonSize(v.values[k])
+		}
+	}
+	return n
+}
+
+// JSONTypeName returns the JSON type name of the value.
+func JSONTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *JSONArray:
+		return "array"
+	case *JSONObject:
+		return "object"
+	}
+	return "unknown"
+}
+
+// ParseJSON parses a single JSON value.
+func ParseJSON(b []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	v, err := parseJSONValue(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing characters", ErrInvalidJSON)
+	}
+	return v, nil
+}
+
+func parseJSONValue(decoder *json.Decoder) (any, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			obj := NewJSONObject()
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				v, err := parseJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(key.(string), v)
+			}
+			_, err = decoder.Token()
+			return obj, err
+		case '[':
+			arr := &JSONArray{}
+			for decoder.More() {
+				v, err := parseJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				arr.Values = append(arr.Values, v)
+			}
+			_, err = decoder.Token()
+			return arr, err
+		}
+		return nil, fmt.Errorf("unexpected %v", tok)
+	case json.Number:
+		return parseJSONNumber(string(tok))
+	}
+
+	// nil, bool and string
+	return tok, nil
+}
+
+// parseJSONNumber parses a number as an integer if it has no fraction nor
+// exponent and fits in 64 bits, or as a float otherwise.
+func parseJSONNumber(s string) (any, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// JSONFormat is the formatting of serialized JSON.
+type JSONFormat struct {
+	// Indent is the indentation of every nesting level
+	Indent string
+	// Newline is written after every array element and object key
+	Newline string
+	// Space is written between an object key and its value
+	Space string
+}
+
+// MarshalJSON serializes the value.
+func MarshalJSON(v any, format JSONFormat) []byte {
+	return appendJSON(nil, v, &format, 0)
+}
+
+func appendJSONNewline(b []byte, format *JSONFormat, depth int) []byte {
+	b = append(b, format.Newline...)
+	for i := 0; i < depth; i++ {
+		b = append(b, format.Indent...)
+	}
+	return b
+}
+
+func appendJSON(b []byte, v any, format *JSONFormat, depth int) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case float64:
+		return appendJSONFloat(b, v)
+	case string:
+		return appendJSONString(b, v)
+	case *JSONArray:
+		if len(v.Values) == 0 {
+			return append(b, "[]"...)
+		}
+
+		b = append(b, '[')
+		for i, e := range v.Values {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONNewline(b, format, depth+1)
+			b = appendJSON(b, e, format, depth+1)
+		}
+		b = appendJSONNewline(b, format, depth)
+		return append(b, ']')
+	case *JSONObject:
+		if v.Len() == 0 {
+			return append(b, "{}"...)
+		}
+
+		b = append(b, '{')
+		for i, k := range v.keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONNewline(b, format, depth+1)
+			b = appendJSONString(b, k)
+			b = append(b, ':')
+			b = append(b, format.Space...)
+			b = appendJSON(b, v.values[k], format, depth+1)
+		}
+		b = appendJSONNewline(b, format, depth)
+		return append(b, '}')
+	}
+
+	return b
+}
+
+// appendJSONFloat appends the float, always with a fraction or an exponent
+// so that it is parsed back as a float.
+func appendJSONFloat(b []byte, f float64) []byte {
+	start := len(b)
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		b = strconv.AppendFloat(b, f, 'e', -1, 64)
+	} else {
+		b = strconv.AppendFloat(b, f, 'f', -1, 64)
+	}
+
+	if !bytes.ContainsAny(b[start:], ".e") {
+		b = append(b, ".0"...)
+	}
+	return b
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			b = append(b, c)
+			i++
+			continue
+		}
+
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, "\ufffd"...)
+			} else {
+				b = append(b, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		}
+		i++
+	}
+	return append(b, '"')
+}
+
+// CopyJSON returns a deep copy of the value.
+func CopyJSON(v any) any {
+	switch v := v.(type) {
+	case *JSONArray:
+		arr := &JSONArray{Values: make([]any, len(v.Values))}
+		for i, e := range v.Values {
+			arr.Values[i] = CopyJSON(e)
+		}
+		return arr
+	case *JSONObject:
+		obj := NewJSONObject()
+		for _, k := range v.keys {
+			obj.Set(k, CopyJSON(v.values[k]))
+		}
+		return obj
+	}
+	return v
+}
+
+// MergeJSON applies the merge patch to the target as described by RFC 7386
+// and returns the result: the keys of a patch object are merged
+// recursively, null values deleting the keys, and any other patch replaces
+// the target.
+func MergeJSON(target, patch any) any {
+	p, ok := patch.(*JSONObject)
+	if !ok {
+		return CopyJSON(patch)
+	}
+
+	obj, ok := target.(*JSONObject)
+	if !ok {
+		obj = NewJSONObject()
+	}
+
+	for _, k := range p.keys {
+		v := p.values[k]
+		if v == nil {
+			obj.Delete(k)
+			continue
+		}
+
+		cur, _ := obj.Get(k)
+		obj.Set(k, MergeJSON(cur, v))
+	}
+	return obj
+}
@@ -0,0 +1,148 @@
+package datastructure_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func mustParseJSON(t *testing.T, s string) any {
+	t.Helper()
+	v, err := datastructure.ParseJSON([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func marshal(v any) string {
+	return string(datastructure.MarshalJSON(v, datastructure.JSONFormat{}))
+}
+
+func Test_ParseMarshalJSON(t *testing.T) {
+	tc := []struct {
+		in, out string
+	}{
+		{`{"b": 1, "a": [true, null, "x\n\"y\""], "c": {}}`, `{"b":1,"a":[true,null,"x\n\"y\""],"c":{}}`},
+		{`1.50`, `1.5`},
+		{`2.0`, `2.0`},
+		{`1e30`, `1e+30`},
+		{`-9223372036854775808`, `-9223372036854775808`},
+		{`18446744073709551616`, `18446744073709552000.0`},
+		{`"é\u0001"`, `"é\u0001"`},
+	}
+
+	for _, tt := range tc {
+		if got := marshal(mustParseJSON(t, tt.in)); got != tt.out {
+			t.Errorf("expected %s, got %s", tt.out, got)
+		}
+	}
+
+	for _, in := range []string{``, `{`, `[1,]`, `{"a" 1}`, `1 2`, `nul`} {
+		if _, err := datastructure.ParseJSON([]byte(in)); !errors.Is(err, datastructure.ErrInvalidJSON) {
+			t.Errorf("expected ErrInvalidJSON for %q, got %v", in, err)
+		}
+	}
+
+	format := datastructure.JSONFormat{Indent: "\t", Newline: "\n", Space: " "}
+	got := string(datastructure.MarshalJSON(mustParseJSON(t, `{"a":[1,2]}`), format))
+	if want := "{\n\t\"a\": [\n\t\t1,\n\t\t2\n\t]\n}"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func Test_JSONPathFind(t *testing.T) {
+	doc := datastructure.NewJSON(mustParseJSON(t, `{"a":{"b":[1,2,3,4]},"c":{"b":"x"},"d e":true}`))
+
+	tc := []struct {
+		path, expected string
+	}{
+		{"$", `[{"a":{"b":[1,2,3,4]},"c":{"b":"x"},"d e":true}]`},
+		{"$.a.b", `[[1,2,3,4]]`},
+		{"$.a.b[0]", `[1]`},
+		{"$.a.b[-1]", `[4]`},
+		{"$.a.b[0,2]", `[1,3]`},
+		{"$.a.b[1:3]", `[2,3]`},
+		{"$.a.b[::2]", `[1,3]`},
+		{"$.a.b[-2:]", `[3,4]`},
+		{"$.a.b[*]", `[1,2,3,4]`},
+		{"$..b", `[[1,2,3,4],"x"]`},
+		{"$.*.b", `[[1,2,3,4],"x"]`},
+		{"$['d e']", `[true]`},
+		{`$["a","c"].b`, `[[1,2,3,4],"x"]`},
+		{"$.missing", `[]`},
+		{".a.b", `[[1,2,3,4]]`},
+		{"a.b[1]", `[2]`},
+		{"..b", `[[1,2,3,4]]`},
+	}
+
+	for _, tt := range tc {
+		p, err := datastructure.ParseJSONPath(tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+
+		values := &datastructure.JSONArray{}
+		for _, m := range doc.Find(p) {
+			values.Values = append(values.Values, m.Value)
+		}
+
+		if got := marshal(values); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.path, tt.expected, got)
+		}
+	}
+
+	for _, path := range []string{"$.", "$[", "$[1", "$['a]", "$[a]", "$[1:2:0]", "$x"} {
+		if _, err := datastructure.ParseJSONPath(path); err != datastructure.ErrInvalidJSONPath {
+			t.Errorf("expected ErrInvalidJSONPath for %s, got %v", path, err)
+		}
+	}
+}
+
+func Test_JSONSetDelete(t *testing.T) {
+	doc := datastructure.NewJSON(mustParseJSON(t, `{"a":[1,2,3],"b":{"c":1}}`))
+	path := func(s string) *datastructure.JSONPath {
+		p, err := datastructure.ParseJSONPath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if n := doc.Set(path("$.a[*]"), int64(0)); n != 3 {
+		t.Errorf("expected 3 values set, got %d", n)
+	}
+	if n := doc.Set(path("$.b.d"), "new"); n != 1 {
+		t.Errorf("expected the key to be added, got %d", n)
+	}
+	if n := doc.Set(path("$.x.y"), "new"); n != 0 {
+		t.Errorf("expected nothing to be set, got %d", n)
+	}
+	if got := marshal(doc.Root); got != `{"a":[0,0,0],"b":{"c":1,"d":"new"}}` {
+		t.Errorf("unexpected document %s", got)
+	}
+
+	if n := doc.Delete(path("$.a[0,2]")); n != 2 {
+		t.Errorf("expected 2 values deleted, got %d", n)
+	}
+	if n := doc.Delete(path("$..c")); n != 1 {
+		t.Errorf("expected 1 value deleted, got %d", n)
+	}
+	if got := marshal(doc.Root); got != `{"a":[0],"b":{"d":"new"}}` {
+		t.Errorf("unexpected document %s", got)
+	}
+}
+
+func Test_MergeJSON(t *testing.T) {
+	target := mustParseJSON(t, `{"a":"b","c":{"d":"e","f":"g"}}`)
+	patch := mustParseJSON(t, `{"a":"z","c":{"f":null},"n":[1]}`)
+
+	if got := marshal(datastructure.MergeJSON(target, patch)); got != `{"a":"z","c":{"d":"e"},"n":[1]}` {
+		t.Errorf("unexpected merge %s", got)
+	}
+
+	if got := marshal(datastructure.MergeJSON(target, int64(1))); got != `1` {
+		t.Errorf("unexpected merge %s", got)
+	}
+}
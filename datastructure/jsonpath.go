@@ -0,0 +1,409 @@
+package datastructure
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidJSONPath is returned when parsing a malformed JSONPath.
+var ErrInvalidJSONPath = errors.New("invalid JSONPath")
+
+// jsonPathSegment is a step of a JSONPath selecting children of a value.
+type jsonPathSegment struct {
+	// recursive selects the children of the value and of all its descendants
+	recursive bool
+	wildcard  bool
+	keys      []string
+	indices   []int
+
+	slice            bool
+	start, end, step int
+	hasStart, hasEnd bool
+}
+
+// JSONPath is a parsed JSONPath expression supporting the root ($), child
+// keys (.key and ['key']), array indices ([0] and [-1]), unions ([0,1] and
+// ['a','b']), slices ([start:end:step]), wildcards (.* and [*]) and
+// recursive descent (..key). Paths not starting with $ are legacy paths,
+// which select a single value, the root being a single dot.
+type JSONPath struct {
+	segments []jsonPathSegment
+	legacy   bool
+}
+
+// ParseJSONPath parses a JSONPath expression.
+func ParseJSONPath(path string) (*JSONPath, error) {
+	p := &JSONPath{}
+
+	switch {
+	case strings.HasPrefix(path, "$"):
+		path = path[1:]
+	case path == ".":
+		p.legacy = true
+		return p, nil
+	default:
+		p.legacy = true
+		if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+			path = "." + path
+		}
+	}
+
+	for len(path) > 0 {
+		var seg jsonPathSegment
+		var err error
+
+		switch {
+		case strings.HasPrefix(path, ".."):
+			seg.recursive = true
+			path = path[2:]
+			if strings.HasPrefix(path, "[") {
+				path, err = parseJSONPathBracket(path, &seg)
+			} else {
+				path, err = parseJSONPathName(path, &seg)
+			}
+		case path[0] == '.':
+			path, err = parseJSONPathName(path[1:], &seg)
+		case path[0] == '[':
+			path, err = parseJSONPathBracket(path, &seg)
+		default:
+			err = ErrInvalidJSONPath
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		p.segments = append(p.segments, seg)
+	}
+
+	return p, nil
+}
+
+// parseJSONPathName parses a dot notation key or wildcard.
+func parseJSONPathName(path string, seg *jsonPathSegment) (string, error) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+
+	if end == 0 {
+		return "", ErrInvalidJSONPath
+	}
+
+	if name := path[:end]; name == "*" {
+		seg.wildcard = true
+	} else {
+		seg.keys = []string{name}
+	}
+	return path[end:], nil
+}
+
+// parseJSONPathBracket parses a bracket notation selector.
+func parseJSONPathBracket(path string, seg *jsonPathSegment) (string, error) {
+	path = path[1:]
+
+	if strings.HasPrefix(path, "*]") {
+		seg.wildcard = true
+		return path[2:], nil
+	}
+
+	// Quoted keys may contain any character but their quote
+	if len(path) > 0 && (path[0] == '\'' || path[0] == '"') {
+		for {
+			quote := path[0]
+			end := strings.IndexByte(path[1:], quote)
+			if end < 0 {
+				return "", ErrInvalidJSONPath
+			}
+			seg.keys = append(seg.keys, path[1:end+1])
+			path = strings.TrimLeft(path[end+2:], " ")
+
+			if strings.HasPrefix(path, "]") {
+				return path[1:], nil
+			}
+			if !strings.HasPrefix(path, ",") {
+				return "", ErrInvalidJSONPath
+			}
+
+			path = strings.TrimLeft(path[1:], " ")
+			if len(path) == 0 || (path[0] != '\'' && path[0] != '"') {
+				return "", ErrInvalidJSONPath
+			}
+		}
+	}
+
+	end := strings.IndexByte(path, ']')
+	if end < 0 {
+		return "", ErrInvalidJSONPath
+	}
+	selector, rest := path[:end], path[end+1:]
+
+	if strings.Contains(selector, ":") {
+		parts := strings.Split(selector, ":")
+		if len(parts) > 3 {
+			return "", ErrInvalidJSONPath
+		}
+
+		seg.slice, seg.step = true, 1
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return "", ErrInvalidJSONPath
+			}
+
+			switch i {
+			case 0:
+				seg.start, seg.hasStart = n, true
+			case 1:
+				seg.end, seg.hasEnd = n, true
+			case 2:
+				if n <= 0 {
+					return "", ErrInvalidJSONPath
+				}
+				seg.step = n
+			}
+		}
+		return rest, nil
+	}
+
+	for _, part := range strings.Split(selector, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return "", ErrInvalidJSONPath
+		}
+		seg.indices = append(seg.indices, n)
+	}
+	return rest, nil
+}
+
+// Legacy returns true if the path is a legacy path.
+func (p *JSONPath) Legacy() bool {
+	return p.legacy
+}
+
+// IsRoot returns true if the path selects the root only.
+func (p *JSONPath) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// JSONMatch is a value selected by a JSONPath.
+type JSONMatch struct {
+	Value any
+
+	// parent is the object or array containing the value, nil for the root
+	parent any
+	key    string
+	index  int
+}
+
+// children returns the matches of the children of the value selected by the
+// segment, ignoring the recursive flag.
+func (seg *jsonPathSegment) children(v any) []JSONMatch {
+	var matches []JSONMatch
+
+	switch v := v.(type) {
+	case *JSONObject:
+		if seg.wildcard {
+			for _, k := range v.keys {
+				matches = append(matches, JSONMatch{Value: v.values[k], parent: v, key: k})
+			}
+			break
+		}
+
+		for _, k := range seg.keys {
+			if value, ok := v.values[k]; ok {
+				matches = append(matches, JSONMatch{Value: value, parent: v, key: k})
+			}
+		}
+	case *JSONArray:
+		n := len(v.Values)
+		add := func(i int) {
+			matches = append(matches, JSONMatch{Value: v.Values[i], parent: v, index: i})
+		}
+
+		switch {
+		case seg.wildcard:
+			for i := range v.Values {
+				add(i)
+			}
+		case seg.slice:
+			start, end := 0, n
+			if seg.hasStart {
+				start = normalizeJSONIndex(seg.start, n)
+			}
+			if seg.hasEnd {
+				end = normalizeJSONIndex(seg.end, n)
+			}
+
+			for i := start; i < end; i += seg.step {
+				add(i)
+			}
+		default:
+			for _, i := range seg.indices {
+				if i < 0 {
+					i += n
+				}
+				if i >= 0 && i < n {
+					add(i)
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+// normalizeJSONIndex returns the slice bound within [0, n], negative bounds
+// being counted from the end.
+func normalizeJSONIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// descendants appends the match and all its descendants in pre-order.
+func descendants(matches []JSONMatch, m JSONMatch) []JSONMatch {
+	matches = append(matches, m)
+
+	switch v := m.Value.(type) {
+	case *JSONObject:
+		for _, k := range v.keys {
+			matches = descendants(matches, JSONMatch{Value: v.values[k], parent: v, key: k})
+		}
+	case *JSONArray:
+		for i, e := range v.Values {
+			matches = descendants(matches, JSONMatch{Value: e, parent: v, index: i})
+		}
+	}
+
+	return matches
+}
+
+func (p *JSONPath) find(root any, segments []jsonPathSegment) []JSONMatch {
+	matches := []JSONMatch{{Value: root}}
+
+	for i := range segments {
+		seg := &segments[i]
+
+		nodes := matches
+		if seg.recursive {
+			nodes = nil
+			for _, m := range matches {
+				nodes = descendants(nodes, m)
+			}
+		}
+
+		matches = nil
+		for _, m := range nodes {
+			matches = append(matches, seg.children(m.Value)...)
+		}
+	}
+
+	return matches
+}
+
+// Find returns the values of the document selected by the path. A legacy
+// path selects its first match only.
+func (j *JSON) Find(p *JSONPath) []JSONMatch {
+	matches := p.find(j.Root, p.segments)
+	if p.legacy && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	return matches
+}
+
+// Replace replaces the matched value.
+func (j *JSON) Replace(m JSONMatch, value any) {
+	switch parent := m.parent.(type) {
+	case nil:
+		j.Root = value
+	case *JSONObject:
+		parent.Set(m.key, value)
+	case *JSONArray:
+		parent.Values[m.index] = value
+	}
+}
+
+// Set sets the values selected by the path to copies of the value. If the
+// path selects nothing and its last segment is a single key, the key is
+// added to the objects selected by the rest of the path. Returns the number
+// of values set.
+func (j *JSON) Set(p *JSONPath, value any) int {
+	matches := j.Find(p)
+	if len(matches) > 0 {
+		for _, m := range matches {
+			j.Replace(m, CopyJSON(value))
+		}
+		return len(matches)
+	}
+
+	if p.IsRoot() {
+		return 0
+	}
+
+	last := &p.segments[len(p.segments)-1]
+	if last.recursive || last.wildcard || len(last.keys) != 1 {
+		return 0
+	}
+
+	var n int
+	for _, m := range p.find(j.Root, p.segments[:len(p.segments)-1]) {
+		if obj, ok := m.Value.(*JSONObject); ok {
+			obj.Set(last.keys[0], CopyJSON(value))
+			n++
+			if p.legacy {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Delete deletes the values selected by the path, except the root. Returns
+// the number of values deleted.
+func (j *JSON) Delete(p *JSONPath) int {
+	matches := j.Find(p)
+
+	// Array elements are deleted from the last one so that the indices of
+	// the others remain valid
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].index > matches[b].index
+	})
+
+	var n int
+	deleted := make(map[*JSONArray]map[int]bool)
+	for _, m := range matches {
+		switch parent := m.parent.(type) {
+		case *JSONObject:
+			if parent.Delete(m.key) {
+				n++
+			}
+		case *JSONArray:
+			if deleted[parent] == nil {
+				deleted[parent] = make(map[int]bool)
+			}
+			if deleted[parent][m.index] {
+				continue
+			}
+			deleted[parent][m.index] = true
+
+			parent.Values = append(parent.Values[:m.index], parent.Values[m.index+1:]...)
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,217 @@
+package datastructure
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// List is a double-ended list of byte strings backed by a ring buffer.
+// It is not safe for concurrent use.
+type List struct {
+	buf  [][]byte
+	head int
+	n    int
+}
+
+// NewList returns a new List.
+func NewList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements in the list.
+func (l *List) Len() int {
+	return l.n
+}
+
+// Size returns the estimated amount of bytes used by the list.
+func (l *List) Size() int {
+	n := cap(l.buf) * int(unsafe.Sizeof([]byte(nil)))
+	for i := 0; i < l.n; i++ {
+		n += len(l.buf[l.pos(i)])
+	}
+	return n
+}
+
+// grow doubles the capacity of the ring buffer when it is full.
+func (l *List) grow() {
+	if l.n < len(l.buf) {
+		return
+	}
+
+	size := len(l.buf) * 2
+	if size == 0 {
+		size = 8
+	}
+
+	buf := make([][]byte, size)
+	for i := 0; i < l.n; i++ {
+		buf[i] = l.buf[(l.head+i)%len(l.buf)]
+	}
+
+	l.buf = buf
+	l.head = 0
+}
+
+// pos returns the position in the ring buffer of the i-th element.
+func (l *List) pos(i int) int {
+	return (l.head + i) % len(l.buf)
+}
+
+// PushFront inserts a new element at the head of the list.
+func (l *List) PushFront(v []byte) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.buf)) % len(l.buf)
+	l.buf[l.head] = v
+	l.n++
+}
+
+// PushBack inserts a new element at the tail of the list.
+func (l *List) PushBack(v []byte) {
+	l.grow()
+	l.buf[l.pos(l.n)] = v
+	l.n++
+}
+
+// PopFront removes and returns the element at the head of the list.
+func (l *List) PopFront() ([]byte, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+
+	v := l.buf[l.head]
+	l.buf[l.head] = nil
+	l.head = l.pos(1)
+	l.n--
+	return v, true
+}
+
+// PopBack removes and returns the element at the tail of the list.
+func (l *List) PopBack() ([]byte, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+
+	p := l.pos(l.n - 1)
+	v := l.buf[p]
+	l.buf[p] = nil
+	l.n--
+	return v, true
+}
+
+// index converts a possibly negative index into a position from the head.
+func (l *List) index(i int) (int, bool) {
+	if i < 0 {
+		i += l.n
+	}
+	return i, i >= 0 && i < l.n
+}
+
+// Index returns the element at the given index. Negative indexes
+// are counted from the tail of the list (-1 is the last element).
+func (l *List) Index(i int) ([]byte, bool) {
+	i, ok := l.index(i)
+	if !ok {
+		return nil, false
+	}
+	return l.buf[l.pos(i)], true
+}
+
+// Set replaces the element at the given index.
+func (l *List) Set(i int, v []byte) bool {
+	i, ok := l.index(i)
+	if !ok {
+		return false
+	}
+	l.buf[l.pos(i)] = v
+	return true
+}
+
+// normalizeRange converts an inclusive range with possibly negative indexes
+// into a valid [start, stop] range. ok is false if the range is empty.
+func (l *List) normalizeRange(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.n
+	}
+	if stop < 0 {
+		stop += l.n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= l.n {
+		stop = l.n - 1
+	}
+	if start > stop || start >= l.n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// Range returns the elements between start and stop (both inclusive).
+func (l *List) Range(start, stop int) [][]byte {
+	start, stop, ok := l.normalizeRange(start, stop)
+	if !ok {
+		return nil
+	}
+
+	values := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		values = append(values, l.buf[l.pos(i)])
+	}
+	return values
+}
+
+// Values returns every element of the list.
+func (l *List) Values() [][]byte {
+	return l.Range(0, -1)
+}
+
+// Trim keeps only the elements between start and stop (both inclusive).
+func (l *List) Trim(start, stop int) {
+	values := l.Range(start, stop)
+	l.buf, l.head, l.n = nil, 0, 0
+	for _, v := range values {
+		l.PushBack(v)
+	}
+}
+
+// Remove removes the first count occurrences of v. If count is negative,
+// the occurrences are removed from the tail to the head. If count is 0,
+// every occurrence is removed. Returns the number of removed elements.
+func (l *List) Remove(count int, v []byte) int {
+	values := l.Values()
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	removed := 0
+	keep := make([]bool, len(values))
+	for k := range values {
+		i := k
+		if count < 0 {
+			i = len(values) - 1 - k
+		}
+
+		if (limit == 0 || removed < limit) && bytes.Equal(values[i], v) {
+			removed++
+			continue
+		}
+
+		keep[i] = true
+	}
+
+	if removed == 0 {
+		return 0
+	}
+
+	l.buf, l.head, l.n = nil, 0, 0
+	for i, v := range values {
+		if keep[i] {
+			l.PushBack(v)
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,140 @@
+package datastructure_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func newList(values ...string) *datastructure.List {
+	list := datastructure.NewList()
+	for _, v := range values {
+		list.PushBack([]byte(v))
+	}
+	return list
+}
+
+func listStrings(values [][]byte) []string {
+	ss := make([]string, len(values))
+	for i, v := range values {
+		ss[i] = string(v)
+	}
+	return ss
+}
+
+func Test_ListPushPop(t *testing.T) {
+	list := datastructure.NewList()
+	for i := 0; i < 20; i++ {
+		list.PushBack([]byte{byte('a' + i)})
+		list.PushFront([]byte{byte('A' + i)})
+	}
+
+	if list.Len() != 40 {
+		t.Errorf("Len failed: expected 40, got %d", list.Len())
+	}
+
+	if v, _ := list.PopFront(); string(v) != "T" {
+		t.Errorf("PopFront failed: expected T, got %s", v)
+	}
+
+	if v, _ := list.PopBack(); string(v) != "t" {
+		t.Errorf("PopBack failed: expected t, got %s", v)
+	}
+
+	for list.Len() > 0 {
+		list.PopFront()
+	}
+
+	if _, ok := list.PopBack(); ok {
+		t.Errorf("PopBack failed: expected an empty list")
+	}
+}
+
+func Test_ListIndex(t *testing.T) {
+	list := newList("a", "b", "c")
+
+	tc := []struct {
+		index int
+		exp   string
+		ok    bool
+	}{
+		{0, "a", true},
+		{2, "c", true},
+		{-1, "c", true},
+		{-3, "a", true},
+		{3, "", false},
+		{-4, "", false},
+	}
+
+	for _, tt := range tc {
+		v, ok := list.Index(tt.index)
+		if ok != tt.ok || string(v) != tt.exp {
+			t.Errorf("Index(%d) failed: expected %q, got %q", tt.index, tt.exp, v)
+		}
+	}
+}
+
+func Test_ListRange(t *testing.T) {
+	list := newList("a", "b", "c", "d", "e")
+
+	tc := []struct {
+		start, stop int
+		exp         []string
+	}{
+		{0, -1, []string{"a", "b", "c", "d", "e"}},
+		{1, 2, []string{"b", "c"}},
+		{-2, 100, []string{"d", "e"}},
+		{-100, 0, []string{"a"}},
+		{3, 1, []string{}},
+		{5, 10, []string{}},
+	}
+
+	for _, tt := range tc {
+		got := listStrings(list.Range(tt.start, tt.stop))
+		if !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("Range(%d, %d) failed: expected %v, got %v", tt.start, tt.stop, tt.exp, got)
+		}
+	}
+}
+
+func Test_ListRemove(t *testing.T) {
+	tc := []struct {
+		name  string
+		count int
+		n     int
+		exp   []string
+	}{
+		{"From head", 2, 2, []string{"b", "a", "c", "a"}},
+		{"From tail", -2, 2, []string{"a", "b", "a", "c"}},
+		{"All", 0, 4, []string{"b", "c"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			list := newList("a", "b", "a", "a", "c", "a")
+			if n := list.Remove(tt.count, []byte("a")); n != tt.n {
+				t.Errorf("expected %d removed, got %d", tt.n, n)
+			}
+
+			if got := listStrings(list.Values()); !reflect.DeepEqual(got, tt.exp) {
+				t.Errorf("expected %v, got %v", tt.exp, got)
+			}
+		})
+	}
+}
+
+func Test_ListTrim(t *testing.T) {
+	list := newList("a", "b", "c", "d", "e")
+	list.Trim(1, -2)
+
+	exp := []string{"b", "c", "d"}
+	if got := listStrings(list.Values()); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	list.Trim(5, 10)
+	if list.Len() != 0 {
+		t.Errorf("expected an empty list, got %d elements", list.Len())
+	}
+}
@@ -11,6 +11,30 @@ import (
 type Map struct {
 	items sync.Map
 	nSize int64
+	// dirty is the number of changes made to the map.
+	dirty int64
+	// expired is the number of keys removed because they expired.
+	expired int64
+	// hits is the number of successful key lookups.
+	hits int64
+	// misses is the number of failed key lookups.
+	misses int64
+	// removeHook holds the RemoveHook called when a key is removed.
+	removeHook atomic.Value
+}
+
+// RemoveHook is called with the key every time a key is deleted or removed
+// because it expired.
+type RemoveHook func(key string, expired bool)
+
+// MapStats is the statistics of a map.
+type MapStats struct {
+	// Expired is the number of keys removed because they expired.
+	Expired int64
+	// Hits is the number of successful key lookups.
+	Hits int64
+	// Misses is the number of failed key lookups.
+	Misses int64
 }
 
 // NewMap returns a new Map.
@@ -22,10 +46,29 @@ func NewMap() *Map {
 	return m
 }
 
+// SetRemoveHook sets the function called every time a key is deleted or
+// removed because it expired, either when it is looked up or by the janitor.
+// Keys removed by Clear are not reported.
+func (m *Map) SetRemoveHook(hook RemoveHook) {
+	m.removeHook.Store(hook)
+}
+
+// removed calls the remove hook, if any.
+func (m *Map) removed(k string, expired bool) {
+	if hook, ok := m.removeHook.Load().(RemoveHook); ok {
+		hook(k, expired)
+	}
+}
+
 // Store stores a new key-value pair.
 func (m *Map) Store(v *Item) {
-	m.items.Store(v.Key, v)
-	atomic.AddInt64(&m.nSize, 1)
+	v.Version = atomic.AddInt64(&m.dirty, 1)
+	if _, loaded := m.items.LoadOrStore(v.Key, v); loaded {
+		// Overwrite the existing key
+		m.items.Store(v.Key, v)
+	} else {
+		atomic.AddInt64(&m.nSize, 1)
+	}
 }
 
 // Expire sets the expiration time of the key.
@@ -43,20 +86,51 @@ func (m *Map) Expire(k string, ttl time.Duration) int64 {
 
 	item.AddFlag(ItemFlagExpireXX)
 	item.ExpiresAt = time.Now().Add(ttl)
+	item.Version = atomic.AddInt64(&m.dirty, 1)
 
 	return atomic.LoadInt64(&m.nSize)
 }
 
+// Persist removes the expiration time of the key. Returns false if the key
+// does not exist or has no expiration time.
+func (m *Map) Persist(k string) bool {
+	item, ok := m.get(k)
+	if !ok || !item.HasFlag(ItemFlagExpireXX) {
+		return false
+	}
+
+	item.RemoveFlag(ItemFlagExpireXX)
+	item.AddFlag(ItemFlagExpireNX)
+	item.Version = atomic.AddInt64(&m.dirty, 1)
+
+	return true
+}
+
 // Get returns the value of the key.
 func (m *Map) Get(k string) (*Item, bool) {
+	item, ok := m.get(k)
+	if !ok {
+		atomic.AddInt64(&m.misses, 1)
+		return nil, false
+	}
+
+	atomic.AddInt64(&m.hits, 1)
+	return item, true
+}
+
+// Peek returns the value of the key without updating the hit and miss counters.
+func (m *Map) Peek(k string) (*Item, bool) {
+	return m.get(k)
+}
+
+func (m *Map) get(k string) (*Item, bool) {
 	v, ok := m.items.Load(k)
 	if !ok {
 		return nil, false
 	}
 
 	if v.(*Item).HasFlag(ItemFlagExpireXX) && time.Now().After(v.(*Item).ExpiresAt) {
-		m.delete(k)
-		atomic.AddInt64(&m.nSize, -1)
+		m.expire(k)
 		return nil, false
 	}
 
@@ -68,19 +142,31 @@ func (m *Map) Delete(k string) int64 {
 	prevNSize := atomic.LoadInt64(&m.nSize)
 	deletedN := m.delete(k)
 	atomic.AddInt64(&m.nSize, -deletedN)
+	atomic.AddInt64(&m.dirty, deletedN)
 
 	// return the deleted amount
 	return prevNSize - atomic.LoadInt64(&m.nSize)
 }
 
+// expire removes an expired key.
+func (m *Map) expire(k string) {
+	if _, loaded := m.items.LoadAndDelete(k); loaded {
+		atomic.AddInt64(&m.nSize, -1)
+		atomic.AddInt64(&m.expired, 1)
+		m.removed(k, true)
+	}
+}
+
 func (m *Map) delete(k string) int64 {
 	deletedN := int64(0)
 
 	// Delete all keys if '*' pattern is provided
 	if k == "*" {
 		m.items.Range(func(key, value any) bool {
-			m.items.Delete(key)
-			deletedN++
+			if _, loaded := m.items.LoadAndDelete(key); loaded {
+				deletedN++
+				m.removed(key.(string), false)
+			}
 			return true
 		})
 
@@ -115,11 +201,13 @@ func (m *Map) delete(k string) int64 {
 			if match, _ := filepath.Match(k, key.(string)); match {
 				m.items.Delete(key)
 				deletedN++
+				m.removed(key.(string), false)
 			}
 			return true
 		})
 	} else {
 		deletedN++
+		m.removed(k, false)
 	}
 
 	return deletedN
@@ -168,6 +256,51 @@ func (m *Map) KeysWithPattern(pattern string) []string {
 	return keys
 }
 
+// Expires returns the number of keys that have an expire time set.
+func (m *Map) Expires() int64 {
+	var n int64
+	m.items.Range(func(k, v any) bool {
+		if v.(*Item).HasFlag(ItemFlagExpireXX) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Stats returns the statistics of the map.
+func (m *Map) Stats() MapStats {
+	return MapStats{
+		Expired: atomic.LoadInt64(&m.expired),
+		Hits:    atomic.LoadInt64(&m.hits),
+		Misses:  atomic.LoadInt64(&m.misses),
+	}
+}
+
+// Touch marks the key as modified. It must be called whenever a value
+// stored in the map is modified in place.
+func (m *Map) Touch(k string) {
+	version := atomic.AddInt64(&m.dirty, 1)
+	if v, ok := m.items.Load(k); ok {
+		v.(*Item).Version = version
+	}
+}
+
+// Version returns the version of the key, or 0 if the key does not exist or
+// has expired.
+func (m *Map) Version(k string) int64 {
+	item, ok := m.get(k)
+	if !ok {
+		return 0
+	}
+	return item.Version
+}
+
+// Dirty returns the number of changes made to the map since it was created.
+func (m *Map) Dirty() int64 {
+	return atomic.LoadInt64(&m.dirty)
+}
+
 // Exists checks if the key exists in the map.
 func (m *Map) Exists(k string) bool {
 	_, ok := m.items.Load(k)
@@ -184,6 +317,7 @@ func (m *Map) Clear() int64 {
 		delNum++
 		return true
 	})
+	atomic.AddInt64(&m.dirty, delNum)
 	return prevNSize - atomic.LoadInt64(&m.nSize)
 }
 
@@ -195,8 +329,7 @@ func (m *Map) janitor() {
 		m.items.Range(func(k, v any) bool {
 			item := v.(*Item)
 			if item.HasFlag(ItemFlagExpireXX) && time.Now().After(item.ExpiresAt) {
-				m.items.Delete(k)
-				atomic.AddInt64(&m.nSize, -1)
+				m.expire(k.(string))
 			}
 			return true
 		})
@@ -195,6 +195,24 @@ func Test_SetExpireItem(t *testing.T) {
 	}
 }
 
+func Test_Persist(t *testing.T) {
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("key", []byte("value"), time.Hour))
+	hmap.Store(datastructure.NewItem("persistent", []byte("value"), 0))
+
+	if !hmap.Persist("key") {
+		t.Errorf("Persist failed")
+	}
+
+	if v, ok := hmap.Get("key"); !ok || v.HasFlag(datastructure.ItemFlagExpireXX) {
+		t.Errorf("Persist failed: expected no expire time")
+	}
+
+	if hmap.Persist("persistent") || hmap.Persist("missing") {
+		t.Errorf("Persist failed: expected keys without expire time to be left untouched")
+	}
+}
+
 func Test_GetExpired(t *testing.T) {
 	t.Parallel()
 	hmap := datastructure.NewMap()
@@ -211,3 +229,140 @@ func Test_GetExpired(t *testing.T) {
 		t.Errorf("Item should have expired")
 	}
 }
+
+func Test_StoreOverwrite(t *testing.T) {
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("key", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("key", []byte("value2"), 0))
+
+	if hmap.Len() != 1 {
+		t.Errorf("Len failed: expected 1, got %d", hmap.Len())
+	}
+}
+
+func Test_Version(t *testing.T) {
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("key", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("other", []byte("value"), 0))
+
+	version := hmap.Version("key")
+	if version == 0 {
+		t.Fatalf("expected a version")
+	}
+
+	hmap.Touch("other")
+	hmap.Get("key")
+	if v := hmap.Version("key"); v != version {
+		t.Errorf("expected the version to be kept, got %d", v)
+	}
+
+	for _, modify := range []func(){
+		func() { hmap.Touch("key") },
+		func() { hmap.Expire("key", time.Hour) },
+		func() { hmap.Persist("key") },
+		func() { hmap.Store(datastructure.NewItem("key", []byte("value"), 0)) },
+	} {
+		modify()
+		if v := hmap.Version("key"); v <= version {
+			t.Errorf("expected the version to increase, got %d", v)
+		}
+		version = hmap.Version("key")
+	}
+
+	hmap.Delete("key")
+	if v := hmap.Version("key"); v != 0 {
+		t.Errorf("expected 0 for a deleted key, got %d", v)
+	}
+
+	hmap.Store(datastructure.NewItem("expired", []byte("value"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	if v := hmap.Version("expired"); v != 0 {
+		t.Errorf("expected 0 for an expired key, got %d", v)
+	}
+}
+
+func Test_Stats(t *testing.T) {
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("key", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("expired", []byte("value"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	hmap.Get("key")
+	hmap.Get("key2")
+	hmap.Get("expired")
+	hmap.Peek("key")
+
+	stats := hmap.Stats()
+	if stats.Hits != 1 {
+		t.Errorf("Hits failed: expected 1, got %d", stats.Hits)
+	}
+
+	if stats.Misses != 2 {
+		t.Errorf("Misses failed: expected 2, got %d", stats.Misses)
+	}
+
+	if stats.Expired != 1 {
+		t.Errorf("Expired failed: expected 1, got %d", stats.Expired)
+	}
+
+	if hmap.Len() != 1 {
+		t.Errorf("Len failed: expected 1, got %d", hmap.Len())
+	}
+}
+
+func Test_RemoveHook(t *testing.T) {
+	hmap := datastructure.NewMap()
+
+	var removed []string
+	hmap.SetRemoveHook(func(key string, expired bool) {
+		if expired {
+			key += " expired"
+		}
+		removed = append(removed, key)
+	})
+
+	hmap.Store(datastructure.NewItem("key", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("a1", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("a2", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("expired", []byte("value"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	hmap.Delete("key")
+	hmap.Delete("missing")
+	hmap.Delete("a*")
+	hmap.Get("expired")
+	hmap.Get("expired")
+
+	sort.Strings(removed)
+	expected := []string{"a1", "a2", "expired expired", "key"}
+	if len(removed) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, removed)
+	}
+	for i := range expected {
+		if removed[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, removed)
+			break
+		}
+	}
+}
+
+func Test_RemoveHookDeleteAll(t *testing.T) {
+	hmap := datastructure.NewMap()
+
+	var removed []string
+	hmap.SetRemoveHook(func(key string, expired bool) {
+		removed = append(removed, key)
+	})
+
+	hmap.Store(datastructure.NewItem("a", []byte("value"), 0))
+	hmap.Store(datastructure.NewItem("b", []byte("value"), 0))
+
+	if n := hmap.Delete("*"); n != 2 {
+		t.Errorf("expected 2 deleted keys, got %d", n)
+	}
+
+	sort.Strings(removed)
+	if len(removed) != 2 || removed[0] != "a" || removed[1] != "b" {
+		t.Errorf("expected [a b], got %v", removed)
+	}
+}
@@ -0,0 +1,312 @@
+package datastructure
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// SetMaxIntsetEntries is the maximum number of members of a set using
+// the compact integer encoding.
+const SetMaxIntsetEntries = 512
+
+// setEntryOverhead is the estimated amount of bytes used by the map bucket
+// of a single member.
+const setEntryOverhead = 32
+
+// SetEncoding is the internal representation of a set.
+type SetEncoding uint8
+
+const (
+	// SetEncodingIntset stores the members as a sorted slice of integers
+	SetEncodingIntset SetEncoding = iota
+	// SetEncodingHashtable stores the members in a map
+	SetEncodingHashtable
+)
+
+func (e SetEncoding) String() string {
+	if e == SetEncodingIntset {
+		return "intset"
+	}
+	return "hashtable"
+}
+
+// Set is an unordered collection of unique strings. Small sets made only of
+// integers are stored as a sorted slice of integers, and converted to a map
+// as soon as a non integer member is added or the set grows too large.
+// It is not safe for concurrent use.
+type Set struct {
+	ints []int64
+	// members maps every member to its position in keys, so that random
+	// members can be picked without copying the set
+	members map[string]int
+	keys    []string
+	size    int
+}
+
+// NewSet returns a new Set.
+func NewSet() *Set {
+	return &Set{}
+}
+
+// Encoding returns the internal representation of the set.
+func (s *Set) Encoding() SetEncoding {
+	if s.members != nil {
+		return SetEncodingHashtable
+	}
+	return SetEncodingIntset
+}
+
+// Len returns the number of members in the set.
+func (s *Set) Len() int {
+	if s.members != nil {
+		return len(s.members)
+	}
+	return len(s.ints)
+}
+
+// Size returns the estimated amount of bytes used by the members.
+func (s *Set) Size() int {
+	if s.members != nil {
+		return s.size
+	}
+	return cap(s.ints) * 8
+}
+
+// parseSetInt returns the integer value of the member if it is the canonical
+// representation of a 64 bit integer.
+func parseSetInt(member string) (int64, bool) {
+	n, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != member {
+		return 0, false
+	}
+	return n, true
+}
+
+// intsetSearch returns the position of n in the intset and whether it exists.
+func (s *Set) intsetSearch(n int64) (int, bool) {
+	i := sort.Search(len(s.ints), func(i int) bool { return s.ints[i] >= n })
+	return i, i < len(s.ints) && s.ints[i] == n
+}
+
+// convert switches the set to the map representation.
+func (s *Set) convert() {
+	s.members = make(map[string]int, len(s.ints))
+	s.keys = make([]string, 0, len(s.ints))
+	s.size = 0
+	for _, n := range s.ints {
+		member := strconv.FormatInt(n, 10)
+		s.members[member] = len(s.keys)
+		s.keys = append(s.keys, member)
+		s.size += setEntryOverhead + len(member)
+	}
+	s.ints = nil
+}
+
+// Add adds the member to the set. Returns true if the member is new.
+func (s *Set) Add(member string) bool {
+	if s.members == nil {
+		n, ok := parseSetInt(member)
+		if ok {
+			i, exists := s.intsetSearch(n)
+			if exists {
+				return false
+			}
+
+			if len(s.ints) < SetMaxIntsetEntries {
+				s.ints = append(s.ints, 0)
+				copy(s.ints[i+1:], s.ints[i:])
+				s.ints[i] = n
+				return true
+			}
+		}
+
+		s.convert()
+	}
+
+	if _, exists := s.members[member]; exists {
+		return false
+	}
+
+	s.members[member] = len(s.keys)
+	s.keys = append(s.keys, member)
+	s.size += setEntryOverhead + len(member)
+	return true
+}
+
+// Remove removes the member from the set. Returns true if the member existed.
+func (s *Set) Remove(member string) bool {
+	if s.members == nil {
+		n, ok := parseSetInt(member)
+		if !ok {
+			return false
+		}
+
+		i, exists := s.intsetSearch(n)
+		if !exists {
+			return false
+		}
+
+		s.ints = append(s.ints[:i], s.ints[i+1:]...)
+		return true
+	}
+
+	i, exists := s.members[member]
+	if !exists {
+		return false
+	}
+
+	// Move the last member to the position of the removed one
+	last := s.keys[len(s.keys)-1]
+	s.keys[i] = last
+	s.members[last] = i
+	s.keys[len(s.keys)-1] = ""
+	s.keys = s.keys[:len(s.keys)-1]
+
+	delete(s.members, member)
+	s.size -= setEntryOverhead + len(member)
+	return true
+}
+
+// Has returns true if the member is in the set.
+func (s *Set) Has(member string) bool {
+	if s.members == nil {
+		n, ok := parseSetInt(member)
+		if !ok {
+			return false
+		}
+
+		_, exists := s.intsetSearch(n)
+		return exists
+	}
+
+	_, exists := s.members[member]
+	return exists
+}
+
+// Members returns the members of the set.
+func (s *Set) Members() []string {
+	if s.members == nil {
+		members := make([]string, len(s.ints))
+		for i, n := range s.ints {
+			members[i] = strconv.FormatInt(n, 10)
+		}
+		return members
+	}
+
+	return append([]string(nil), s.keys...)
+}
+
+// member returns the member at the given position.
+func (s *Set) member(i int) string {
+	if s.members == nil {
+		return strconv.FormatInt(s.ints[i], 10)
+	}
+	return s.keys[i]
+}
+
+// Random returns random members of the set. With a positive count, up to
+// count distinct members are returned. With a negative count, exactly -count
+// members are returned and the same member may appear more than once, so
+// the caller must bound it. The set is not copied.
+func (s *Set) Random(count int) []string {
+	n := s.Len()
+	if n == 0 {
+		return nil
+	}
+
+	if count < 0 {
+		result := make([]string, -count)
+		for i := range result {
+			result[i] = s.member(rand.Intn(n))
+		}
+		return result
+	}
+
+	if count >= n {
+		return s.Members()
+	}
+
+	// Floyd's algorithm picks count distinct positions in O(count)
+	picked := make(map[int]struct{}, count)
+	result := make([]string, 0, count)
+	for j := n - count; j < n; j++ {
+		i := rand.Intn(j + 1)
+		if _, exists := picked[i]; exists {
+			i = j
+		}
+		picked[i] = struct{}{}
+		result = append(result, s.member(i))
+	}
+
+	return result
+}
+
+// Pop removes and returns up to count random members of the set.
+func (s *Set) Pop(count int) []string {
+	members := s.Random(count)
+	for _, m := range members {
+		s.Remove(m)
+	}
+	return members
+}
+
+// SetUnion returns a new set with the members of all the given sets.
+func SetUnion(sets ...*Set) *Set {
+	result := NewSet()
+	for _, set := range sets {
+		for _, m := range set.Members() {
+			result.Add(m)
+		}
+	}
+	return result
+}
+
+// SetInter returns a new set with the members present in every given set.
+func SetInter(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+
+	// Iterate over the smallest set to test as few members as possible
+	smallest := sets[0]
+	for _, set := range sets[1:] {
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+
+next:
+	for _, m := range smallest.Members() {
+		for _, set := range sets {
+			if set != smallest && !set.Has(m) {
+				continue next
+			}
+		}
+		result.Add(m)
+	}
+
+	return result
+}
+
+// SetDiff returns a new set with the members of the first set that are not
+// present in any of the other sets.
+func SetDiff(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+
+next:
+	for _, m := range sets[0].Members() {
+		for _, set := range sets[1:] {
+			if set.Has(m) {
+				continue next
+			}
+		}
+		result.Add(m)
+	}
+
+	return result
+}
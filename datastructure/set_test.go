@@ -0,0 +1,202 @@
+package datastructure_test
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func newSet(members ...string) *datastructure.Set {
+	set := datastructure.NewSet()
+	for _, m := range members {
+		set.Add(m)
+	}
+	return set
+}
+
+func sortedMembers(set *datastructure.Set) []string {
+	members := set.Members()
+	sort.Strings(members)
+	return members
+}
+
+func Test_SetAddRemove(t *testing.T) {
+	set := datastructure.NewSet()
+
+	if !set.Add("a") || set.Add("a") {
+		t.Errorf("Add failed")
+	}
+
+	if !set.Has("a") || set.Has("b") {
+		t.Errorf("Has failed")
+	}
+
+	if !set.Remove("a") || set.Remove("a") {
+		t.Errorf("Remove failed")
+	}
+
+	if set.Len() != 0 || set.Size() != 0 {
+		t.Errorf("Remove failed: expected an empty set, got len %d size %d", set.Len(), set.Size())
+	}
+}
+
+func Test_SetIntsetEncoding(t *testing.T) {
+	set := newSet("3", "1", "-2", "1")
+
+	if set.Encoding() != datastructure.SetEncodingIntset {
+		t.Errorf("expected intset encoding, got %s", set.Encoding())
+	}
+
+	if got := set.Members(); !reflect.DeepEqual(got, []string{"-2", "1", "3"}) {
+		t.Errorf("Members failed: got %v", got)
+	}
+
+	// Non canonical integers must not match the integer members
+	if set.Has("01") || set.Has("+1") || set.Remove("01") {
+		t.Errorf("expected non canonical integers not to match")
+	}
+
+	set.Add("01")
+	if set.Encoding() != datastructure.SetEncodingHashtable {
+		t.Errorf("expected hashtable encoding, got %s", set.Encoding())
+	}
+
+	if got := sortedMembers(set); !reflect.DeepEqual(got, []string{"-2", "01", "1", "3"}) {
+		t.Errorf("Members failed: got %v", got)
+	}
+}
+
+func Test_SetIntsetConversion(t *testing.T) {
+	set := datastructure.NewSet()
+	for i := 0; i < datastructure.SetMaxIntsetEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+
+	if set.Encoding() != datastructure.SetEncodingIntset {
+		t.Errorf("expected intset encoding, got %s", set.Encoding())
+	}
+
+	set.Add(strconv.Itoa(datastructure.SetMaxIntsetEntries))
+	if set.Encoding() != datastructure.SetEncodingHashtable {
+		t.Errorf("expected hashtable encoding, got %s", set.Encoding())
+	}
+
+	if set.Len() != datastructure.SetMaxIntsetEntries+1 || !set.Has("0") {
+		t.Errorf("conversion lost members: len %d", set.Len())
+	}
+}
+
+func Test_SetOperations(t *testing.T) {
+	a := newSet("a", "b", "c", "1")
+	b := newSet("b", "c", "d")
+	c := newSet("c", "1")
+
+	tc := []struct {
+		name     string
+		got      *datastructure.Set
+		expected []string
+	}{
+		{"union", datastructure.SetUnion(a, b, c), []string{"1", "a", "b", "c", "d"}},
+		{"inter", datastructure.SetInter(a, b, c), []string{"c"}},
+		{"inter empty", datastructure.SetInter(a, datastructure.NewSet()), []string{}},
+		{"diff", datastructure.SetDiff(a, b), []string{"1", "a"}},
+		{"diff many", datastructure.SetDiff(a, b, c), []string{"a"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortedMembers(tt.got); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_SetRandomPop(t *testing.T) {
+	set := newSet("a", "b", "c")
+
+	if got := set.Random(10); len(got) != 3 {
+		t.Errorf("Random failed: expected 3 distinct members, got %v", got)
+	}
+
+	if got := set.Random(-10); len(got) != 10 {
+		t.Errorf("Random failed: expected 10 members, got %v", got)
+	}
+
+	popped := set.Pop(2)
+	if len(popped) != 2 || set.Len() != 1 {
+		t.Errorf("Pop failed: popped %v, %d left", popped, set.Len())
+	}
+
+	for _, m := range popped {
+		if set.Has(m) {
+			t.Errorf("Pop failed: %s is still in the set", m)
+		}
+	}
+}
+
+func Test_SetRandomCounts(t *testing.T) {
+	ints := newSet()
+	strs := newSet()
+	for i := 0; i < 100; i++ {
+		ints.Add(strconv.Itoa(i))
+		strs.Add("m" + strconv.Itoa(i))
+	}
+
+	for _, set := range []*datastructure.Set{ints, strs} {
+		tc := []struct {
+			name     string
+			count    int
+			expected int
+		}{
+			{"zero", 0, 0},
+			{"some", 10, 10},
+			{"all", 100, 100},
+			{"more than the set", math.MaxInt, 100},
+			{"negative", -1, 1},
+			{"negative more than the set", -250, 250},
+		}
+
+		for _, tt := range tc {
+			t.Run(set.Encoding().String()+" "+tt.name, func(t *testing.T) {
+				got := set.Random(tt.count)
+				if len(got) != tt.expected {
+					t.Fatalf("expected %d members, got %d", tt.expected, len(got))
+				}
+
+				seen := make(map[string]bool)
+				for _, m := range got {
+					if !set.Has(m) {
+						t.Errorf("%s is not a member", m)
+					}
+					if tt.count > 0 && seen[m] {
+						t.Errorf("%s returned twice", m)
+					}
+					seen[m] = true
+				}
+			})
+		}
+	}
+}
+
+func Test_SetRandomAfterRemove(t *testing.T) {
+	set := newSet("a", "b", "c", "d")
+	set.Remove("a")
+	set.Remove("c")
+
+	for i := 0; i < 100; i++ {
+		for _, m := range set.Random(-4) {
+			if m != "b" && m != "d" {
+				t.Fatalf("expected b or d, got %s", m)
+			}
+		}
+	}
+
+	if got := sortedMembers(set); !reflect.DeepEqual(got, []string{"b", "d"}) {
+		t.Errorf("expected [b d], got %v", got)
+	}
+}
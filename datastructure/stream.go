@@ -0,0 +1,377 @@
+package datastructure
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// streamChunkSize is the maximum number of entries stored in a single chunk
+// of the stream log.
+const streamChunkSize = 128
+
+// streamEntryOverhead is the estimated amount of bytes used by a single
+// entry besides its fields.
+const streamEntryOverhead = 48
+
+var (
+	// ErrInvalidStreamID is returned when parsing a malformed stream ID.
+	ErrInvalidStreamID = errors.New("invalid stream ID")
+	// ErrStreamIDTooSmall is returned when adding an entry with an ID equal
+	// or smaller than the last ID of the stream.
+	ErrStreamIDTooSmall = errors.New("stream ID is equal or smaller than the last ID")
+)
+
+// StreamID is the ID of a stream entry, made of a millisecond timestamp and
+// a sequence number for the entries added during the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinStreamID is the smallest possible stream ID.
+	MinStreamID = StreamID{}
+	// MaxStreamID is the greatest possible stream ID.
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+)
+
+// ParseStreamID parses an ID in the "<ms>-<seq>" form. The sequence number
+// may be omitted, in which case it is set to defaultSeq.
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	if !hasSeq {
+		return StreamID{ms, defaultSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	return StreamID{ms, seq}, nil
+}
+
+// String returns the ID in the "<ms>-<seq>" form.
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 if the ID is smaller, equal or greater than o.
+func (id StreamID) Compare(o StreamID) int {
+	switch {
+	case id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq):
+		return -1
+	case id == o:
+		return 0
+	}
+	return 1
+}
+
+// Less returns true if the ID is smaller than o.
+func (id StreamID) Less(o StreamID) bool {
+	return id.Compare(o) < 0
+}
+
+// Next returns the smallest ID greater than this one. ok is false if the ID
+// is already the greatest possible ID.
+func (id StreamID) Next() (next StreamID, ok bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID smaller than this one. ok is false if the ID
+// is already the smallest possible ID.
+func (id StreamID) Prev() (prev StreamID, ok bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// StreamEntry is an entry of a stream.
+type StreamEntry struct {
+	ID StreamID
+	// Fields are the field names and values of the entry, one after the other
+	Fields [][]byte
+}
+
+func (e *StreamEntry) size() int {
+	n := streamEntryOverhead
+	for _, f := range e.Fields {
+		n += len(f)
+	}
+	return n
+}
+
+// streamChunk is a block of consecutive entries of the stream log.
+type streamChunk struct {
+	entries []StreamEntry
+}
+
+func (c *streamChunk) first() StreamID {
+	return c.entries[0].ID
+}
+
+func (c *streamChunk) last() StreamID {
+	return c.entries[len(c.entries)-1].ID
+}
+
+// Stream is an append-only log of entries ordered by their ID, stored as a
+// list of fixed size chunks so that the oldest entries can be trimmed
+// cheaply. A stream also keeps track of its consumer groups.
+// It is not safe for concurrent use.
+type Stream struct {
+	chunks []*streamChunk
+	length int
+	lastID StreamID
+	groups map[string]*ConsumerGroup
+	size   int
+}
+
+// NewStream returns a new Stream.
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*ConsumerGroup)}
+}
+
+// Len returns the number of entries in the stream.
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// Size returns the estimated amount of bytes used by the entries.
+func (s *Stream) Size() int {
+	return s.size
+}
+
+// LastID returns the ID of the last entry ever added to the stream, even if
+// it has been trimmed since.
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// SetLastID sets the last ID of the stream. It must not be smaller than the
+// ID of the last entry.
+func (s *Stream) SetLastID(id StreamID) {
+	s.lastID = id
+}
+
+// NextID returns the ID of an entry added at the given unix time in
+// milliseconds, so that it is greater than the last ID of the stream.
+func (s *Stream) NextID(ms uint64) (StreamID, error) {
+	if ms > s.lastID.Ms {
+		return StreamID{ms, 0}, nil
+	}
+
+	id, ok := s.lastID.Next()
+	if !ok {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// Add appends an entry to the stream. The ID must be greater than the last
+// ID of the stream.
+func (s *Stream) Add(id StreamID, fields [][]byte) error {
+	if !s.lastID.Less(id) {
+		return ErrStreamIDTooSmall
+	}
+
+	if len(s.chunks) == 0 || len(s.chunks[len(s.chunks)-1].entries) >= streamChunkSize {
+		s.chunks = append(s.chunks, &streamChunk{entries: make([]StreamEntry, 0, streamChunkSize)})
+	}
+
+	chunk := s.chunks[len(s.chunks)-1]
+	chunk.entries = append(chunk.entries, StreamEntry{id, fields})
+	s.size += chunk.entries[len(chunk.entries)-1].size()
+	s.length++
+	s.lastID = id
+	return nil
+}
+
+// trimFront removes the n oldest entries of the stream.
+func (s *Stream) trimFront(n int) {
+	for n > 0 && len(s.chunks) > 0 {
+		chunk := s.chunks[0]
+		if n >= len(chunk.entries) {
+			for i := range chunk.entries {
+				s.size -= chunk.entries[i].size()
+			}
+
+			n -= len(chunk.entries)
+			s.length -= len(chunk.entries)
+			s.chunks[0] = nil
+			s.chunks = s.chunks[1:]
+			continue
+		}
+
+		for i := range chunk.entries[:n] {
+			s.size -= chunk.entries[i].size()
+		}
+
+		// Copy the remaining entries so the trimmed ones can be released
+		chunk.entries = append([]StreamEntry(nil), chunk.entries[n:]...)
+		s.length -= n
+		n = 0
+	}
+}
+
+// TrimMaxLen removes the oldest entries until the stream has at most maxLen
+// entries. Returns the number of removed entries.
+func (s *Stream) TrimMaxLen(maxLen int) int {
+	if s.length <= maxLen {
+		return 0
+	}
+
+	n := s.length - maxLen
+	s.trimFront(n)
+	return n
+}
+
+// TrimMinID removes the entries with an ID smaller than minID. Returns the
+// number of removed entries.
+func (s *Stream) TrimMinID(minID StreamID) int {
+	n := 0
+	for _, chunk := range s.chunks {
+		if !chunk.last().Less(minID) {
+			n += sort.Search(len(chunk.entries), func(i int) bool {
+				return !chunk.entries[i].ID.Less(minID)
+			})
+			break
+		}
+		n += len(chunk.entries)
+	}
+
+	s.trimFront(n)
+	return n
+}
+
+// Range returns up to count entries (every entry if count is negative) with
+// an ID between start and end (both inclusive), ordered from the oldest
+// entry, or from the newest one if reverse is true.
+func (s *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	if count == 0 || end.Less(start) {
+		return nil
+	}
+
+	var entries []StreamEntry
+	if reverse {
+		// Last chunk starting before end, and last entry of the chunk not
+		// greater than end
+		c := sort.Search(len(s.chunks), func(i int) bool { return end.Less(s.chunks[i].first()) }) - 1
+		if c < 0 {
+			return nil
+		}
+
+		chunk := s.chunks[c]
+		i := sort.Search(len(chunk.entries), func(i int) bool { return end.Less(chunk.entries[i].ID) }) - 1
+		for ; c >= 0; c-- {
+			chunk = s.chunks[c]
+			if i < 0 {
+				i = len(chunk.entries) - 1
+			}
+
+			for ; i >= 0; i-- {
+				if chunk.entries[i].ID.Less(start) || len(entries) == count {
+					return entries
+				}
+				entries = append(entries, chunk.entries[i])
+			}
+		}
+		return entries
+	}
+
+	// First chunk ending after start, and first entry of the chunk not
+	// smaller than start
+	c := sort.Search(len(s.chunks), func(i int) bool { return !s.chunks[i].last().Less(start) })
+	if c == len(s.chunks) {
+		return nil
+	}
+
+	chunk := s.chunks[c]
+	i := sort.Search(len(chunk.entries), func(i int) bool { return !chunk.entries[i].ID.Less(start) })
+	for ; c < len(s.chunks); c++ {
+		chunk = s.chunks[c]
+		for ; i < len(chunk.entries); i++ {
+			if end.Less(chunk.entries[i].ID) || len(entries) == count {
+				return entries
+			}
+			entries = append(entries, chunk.entries[i])
+		}
+		i = 0
+	}
+	return entries
+}
+
+// After returns up to count entries with an ID greater than id.
+func (s *Stream) After(id StreamID, count int) []StreamEntry {
+	start, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(start, MaxStreamID, count, false)
+}
+
+// Get returns the entry with the given ID.
+func (s *Stream) Get(id StreamID) (StreamEntry, bool) {
+	entries := s.Range(id, id, 1, false)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// CreateGroup creates a consumer group which will deliver the entries added
+// after lastID. Returns false if the group already exists.
+func (s *Stream) CreateGroup(name string, lastID StreamID) (*ConsumerGroup, bool) {
+	if _, exists := s.groups[name]; exists {
+		return nil, false
+	}
+
+	group := newConsumerGroup(name, lastID)
+	s.groups[name] = group
+	return group, true
+}
+
+// Group returns the consumer group with the given name.
+func (s *Stream) Group(name string) (*ConsumerGroup, bool) {
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+// DestroyGroup deletes the consumer group. Returns false if it does not exist.
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, exists := s.groups[name]; !exists {
+		return false
+	}
+
+	delete(s.groups, name)
+	return true
+}
+
+// Groups returns the consumer groups of the stream ordered by name.
+func (s *Stream) Groups() []*ConsumerGroup {
+	groups := make([]*ConsumerGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
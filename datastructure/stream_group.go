@@ -0,0 +1,179 @@
+package datastructure
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingEntry is an entry delivered to a consumer that has not been
+// acknowledged yet.
+type PendingEntry struct {
+	ID StreamID
+	// Consumer is the consumer owning the entry
+	Consumer *Consumer
+	// DeliveryTime is the last time the entry was delivered
+	DeliveryTime time.Time
+	// DeliveryCount is the number of times the entry was delivered
+	DeliveryCount int64
+}
+
+// Consumer is a member of a consumer group.
+type Consumer struct {
+	Name string
+	// SeenTime is the last time the consumer read from the group
+	SeenTime time.Time
+	pending  map[StreamID]*PendingEntry
+}
+
+// PendingLen returns the number of entries pending for the consumer.
+func (c *Consumer) PendingLen() int {
+	return len(c.pending)
+}
+
+// Pending returns up to count entries pending for the consumer (every entry
+// if count is negative) with an ID greater than after, ordered by ID.
+func (c *Consumer) Pending(after StreamID, count int) []*PendingEntry {
+	return sortedPending(c.pending, func(p *PendingEntry) bool { return after.Less(p.ID) }, count)
+}
+
+// ConsumerGroup delivers the entries of a stream to its consumers and keeps
+// track of the entries that were delivered but not acknowledged yet.
+type ConsumerGroup struct {
+	Name string
+	// LastID is the ID of the last entry delivered to the group
+	LastID    StreamID
+	pending   map[StreamID]*PendingEntry
+	consumers map[string]*Consumer
+}
+
+func newConsumerGroup(name string, lastID StreamID) *ConsumerGroup {
+	return &ConsumerGroup{
+		Name:      name,
+		LastID:    lastID,
+		pending:   make(map[StreamID]*PendingEntry),
+		consumers: make(map[string]*Consumer),
+	}
+}
+
+// Consumer returns the consumer with the given name.
+func (g *ConsumerGroup) Consumer(name string) (*Consumer, bool) {
+	c, ok := g.consumers[name]
+	return c, ok
+}
+
+// CreateConsumer creates the consumer if it does not exist yet. Returns
+// the consumer and whether it was created.
+func (g *ConsumerGroup) CreateConsumer(name string, now time.Time) (*Consumer, bool) {
+	if c, exists := g.consumers[name]; exists {
+		return c, false
+	}
+
+	c := &Consumer{Name: name, SeenTime: now, pending: make(map[StreamID]*PendingEntry)}
+	g.consumers[name] = c
+	return c, true
+}
+
+// DeleteConsumer deletes the consumer and its pending entries. Returns the
+// number of pending entries the consumer had, and false if it does not exist.
+func (g *ConsumerGroup) DeleteConsumer(name string) (int, bool) {
+	c, exists := g.consumers[name]
+	if !exists {
+		return 0, false
+	}
+
+	for id := range c.pending {
+		delete(g.pending, id)
+	}
+
+	delete(g.consumers, name)
+	return len(c.pending), true
+}
+
+// Consumers returns the consumers of the group ordered by name.
+func (g *ConsumerGroup) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+// Deliver records the delivery of the entry to the consumer. An entry that is
+// already pending is transferred to the consumer and its delivery count
+// incremented.
+func (g *ConsumerGroup) Deliver(id StreamID, c *Consumer, now time.Time) *PendingEntry {
+	count := int64(1)
+	if p, exists := g.pending[id]; exists {
+		count = p.DeliveryCount + 1
+	}
+
+	return g.Claim(id, c, now, count)
+}
+
+// Claim transfers the pending entry to the consumer, creating it if it is
+// not pending yet, and sets its delivery time and count.
+func (g *ConsumerGroup) Claim(id StreamID, c *Consumer, deliveryTime time.Time, deliveryCount int64) *PendingEntry {
+	p, exists := g.pending[id]
+	if !exists {
+		p = &PendingEntry{ID: id}
+		g.pending[id] = p
+	} else {
+		delete(p.Consumer.pending, id)
+	}
+
+	p.Consumer = c
+	p.DeliveryTime = deliveryTime
+	p.DeliveryCount = deliveryCount
+	c.pending[id] = p
+	return p
+}
+
+// Ack acknowledges the entry, removing it from the pending entries.
+// Returns false if the entry was not pending.
+func (g *ConsumerGroup) Ack(id StreamID) bool {
+	p, exists := g.pending[id]
+	if !exists {
+		return false
+	}
+
+	delete(p.Consumer.pending, id)
+	delete(g.pending, id)
+	return true
+}
+
+// PendingEntry returns the pending entry with the given ID.
+func (g *ConsumerGroup) PendingEntry(id StreamID) (*PendingEntry, bool) {
+	p, ok := g.pending[id]
+	return p, ok
+}
+
+// PendingLen returns the number of pending entries of the group.
+func (g *ConsumerGroup) PendingLen() int {
+	return len(g.pending)
+}
+
+// Pending returns up to count pending entries (every entry if count is
+// negative) with an ID between start and end, ordered by ID.
+func (g *ConsumerGroup) Pending(start, end StreamID, count int) []*PendingEntry {
+	return sortedPending(g.pending, func(p *PendingEntry) bool {
+		return !p.ID.Less(start) && !end.Less(p.ID)
+	}, count)
+}
+
+func sortedPending(pending map[StreamID]*PendingEntry, keep func(*PendingEntry) bool, count int) []*PendingEntry {
+	var entries []*PendingEntry
+	for _, p := range pending {
+		if keep(p) {
+			entries = append(entries, p)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID.Less(entries[j].ID) })
+
+	if count >= 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries
+}
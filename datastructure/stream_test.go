@@ -0,0 +1,185 @@
+package datastructure_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func newStream(t *testing.T, n int) *datastructure.Stream {
+	stream := datastructure.NewStream()
+	for i := 1; i <= n; i++ {
+		if err := stream.Add(datastructure.StreamID{Ms: uint64(i)}, [][]byte{[]byte("f"), []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stream
+}
+
+func streamIDs(entries []datastructure.StreamEntry) []uint64 {
+	ids := make([]uint64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.Ms
+	}
+	return ids
+}
+
+func Test_ParseStreamID(t *testing.T) {
+	tc := []struct {
+		s        string
+		expected datastructure.StreamID
+		err      error
+	}{
+		{"1-2", datastructure.StreamID{Ms: 1, Seq: 2}, nil},
+		{"5", datastructure.StreamID{Ms: 5, Seq: 7}, nil},
+		{"18446744073709551615-18446744073709551615", datastructure.MaxStreamID, nil},
+		{"a-1", datastructure.StreamID{}, datastructure.ErrInvalidStreamID},
+		{"1-", datastructure.StreamID{}, datastructure.ErrInvalidStreamID},
+		{"-1", datastructure.StreamID{}, datastructure.ErrInvalidStreamID},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.s, func(t *testing.T) {
+			id, err := datastructure.ParseStreamID(tt.s, 7)
+			if err != tt.err || id != tt.expected {
+				t.Errorf("expected %v %v, got %v %v", tt.expected, tt.err, id, err)
+			}
+		})
+	}
+}
+
+func Test_StreamAdd(t *testing.T) {
+	stream := newStream(t, 3)
+
+	if err := stream.Add(datastructure.StreamID{Ms: 3}, nil); err != datastructure.ErrStreamIDTooSmall {
+		t.Errorf("expected ErrStreamIDTooSmall, got %v", err)
+	}
+
+	id, _ := stream.NextID(2)
+	if id != (datastructure.StreamID{Ms: 3, Seq: 1}) {
+		t.Errorf("NextID failed: got %v", id)
+	}
+
+	id, _ = stream.NextID(10)
+	if id != (datastructure.StreamID{Ms: 10}) {
+		t.Errorf("NextID failed: got %v", id)
+	}
+
+	if stream.Len() != 3 || stream.LastID() != (datastructure.StreamID{Ms: 3}) {
+		t.Errorf("expected 3 entries up to 3-0, got %d up to %v", stream.Len(), stream.LastID())
+	}
+}
+
+func Test_StreamRange(t *testing.T) {
+	// Spans multiple chunks
+	stream := newStream(t, 300)
+
+	tc := []struct {
+		name       string
+		start, end uint64
+		count      int
+		reverse    bool
+		expected   []uint64
+	}{
+		{"within chunk", 3, 5, -1, false, []uint64{3, 4, 5}},
+		{"across chunks", 127, 130, -1, false, []uint64{127, 128, 129, 130}},
+		{"count", 100, 300, 2, false, []uint64{100, 101}},
+		{"reverse", 127, 130, -1, true, []uint64{130, 129, 128, 127}},
+		{"reverse count", 1, 300, 3, true, []uint64{300, 299, 298}},
+		{"out of range", 301, 400, -1, false, nil},
+		{"reverse out of range", 0, 0, -1, true, nil},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := streamIDs(stream.Range(datastructure.StreamID{Ms: tt.start}, datastructure.StreamID{Ms: tt.end}, tt.count, tt.reverse))
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if got := streamIDs(stream.After(datastructure.StreamID{Ms: 298}, -1)); !reflect.DeepEqual(got, []uint64{299, 300}) {
+		t.Errorf("After failed: got %v", got)
+	}
+}
+
+func Test_StreamTrim(t *testing.T) {
+	stream := newStream(t, 300)
+	size := stream.Size()
+
+	if n := stream.TrimMaxLen(150); n != 150 || stream.Len() != 150 {
+		t.Errorf("TrimMaxLen failed: removed %d, %d left", n, stream.Len())
+	}
+
+	if stream.Size() != size/2 {
+		t.Errorf("expected size %d, got %d", size/2, stream.Size())
+	}
+
+	if n := stream.TrimMinID(datastructure.StreamID{Ms: 200}); n != 49 {
+		t.Errorf("TrimMinID failed: removed %d", n)
+	}
+
+	if got := streamIDs(stream.Range(datastructure.MinStreamID, datastructure.MaxStreamID, 1, false)); !reflect.DeepEqual(got, []uint64{200}) {
+		t.Errorf("expected the first entry to be 200, got %v", got)
+	}
+
+	stream.TrimMaxLen(0)
+	if stream.Len() != 0 || stream.Size() != 0 || stream.LastID() != (datastructure.StreamID{Ms: 300}) {
+		t.Errorf("expected an empty stream keeping its last ID")
+	}
+}
+
+func Test_ConsumerGroup(t *testing.T) {
+	stream := newStream(t, 5)
+	now := time.Now()
+
+	group, ok := stream.CreateGroup("group", datastructure.MinStreamID)
+	if !ok {
+		t.Fatal("CreateGroup failed")
+	}
+
+	if _, ok := stream.CreateGroup("group", datastructure.MinStreamID); ok {
+		t.Errorf("CreateGroup failed: expected the group to exist")
+	}
+
+	alice, _ := group.CreateConsumer("alice", now)
+	bob, _ := group.CreateConsumer("bob", now)
+
+	for _, e := range stream.After(group.LastID, 3) {
+		group.Deliver(e.ID, alice, now)
+		group.LastID = e.ID
+	}
+
+	if group.PendingLen() != 3 || alice.PendingLen() != 3 {
+		t.Errorf("expected 3 pending entries, got %d", group.PendingLen())
+	}
+
+	// Redelivering transfers the ownership and counts the delivery
+	p := group.Deliver(datastructure.StreamID{Ms: 2}, bob, now)
+	if p.DeliveryCount != 2 || alice.PendingLen() != 2 || bob.PendingLen() != 1 {
+		t.Errorf("Deliver failed: count %d, alice %d, bob %d", p.DeliveryCount, alice.PendingLen(), bob.PendingLen())
+	}
+
+	if !group.Ack(datastructure.StreamID{Ms: 1}) || group.Ack(datastructure.StreamID{Ms: 1}) {
+		t.Errorf("Ack failed")
+	}
+
+	pending := group.Pending(datastructure.MinStreamID, datastructure.MaxStreamID, -1)
+	if len(pending) != 2 || pending[0].ID.Ms != 2 || pending[1].ID.Ms != 3 {
+		t.Errorf("Pending failed: got %v", pending)
+	}
+
+	if n, ok := group.DeleteConsumer("bob"); !ok || n != 1 || group.PendingLen() != 1 {
+		t.Errorf("DeleteConsumer failed: %d pending", group.PendingLen())
+	}
+
+	if !stream.DestroyGroup("group") || len(stream.Groups()) != 0 {
+		t.Errorf("DestroyGroup failed")
+	}
+}
@@ -0,0 +1,550 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrDuplicateSample is returned when adding a sample at the timestamp
+	// of an existing sample with the block duplicate policy.
+	ErrDuplicateSample = errors.New("duplicate sample")
+	// ErrSampleTooOld is returned when adding a sample older than the
+	// retention period.
+	ErrSampleTooOld = errors.New("sample is older than the retention period")
+	// ErrInvalidTimeSeries is returned when decoding malformed time series
+	// bytes.
+	ErrInvalidTimeSeries = errors.New("invalid time series")
+)
+
+// TimeSeriesSample is a value at a timestamp in milliseconds.
+type TimeSeriesSample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// TimeSeriesLabel is a name and value pair describing a time series.
+type TimeSeriesLabel struct {
+	Name  string
+	Value string
+}
+
+// TimeSeriesDuplicatePolicy decides the value kept when adding a sample at
+// the timestamp of an existing sample.
+type TimeSeriesDuplicatePolicy uint8
+
+const (
+	// TimeSeriesDuplicateBlock rejects the new sample
+	TimeSeriesDuplicateBlock TimeSeriesDuplicatePolicy = iota
+	// TimeSeriesDuplicateFirst keeps the existing value
+	TimeSeriesDuplicateFirst
+	// TimeSeriesDuplicateLast keeps the new value
+	TimeSeriesDuplicateLast
+	// TimeSeriesDuplicateMin keeps the lowest value
+	TimeSeriesDuplicateMin
+	// TimeSeriesDuplicateMax keeps the highest value
+	TimeSeriesDuplicateMax
+	// TimeSeriesDuplicateSum keeps the sum of the values
+	TimeSeriesDuplicateSum
+)
+
+var timeSeriesDuplicatePolicyNames = []string{"block", "first", "last", "min", "max", "sum"}
+
+func (p TimeSeriesDuplicatePolicy) String() string {
+	if int(p) < len(timeSeriesDuplicatePolicyNames) {
+		return timeSeriesDuplicatePolicyNames[p]
+	}
+	return "unknown"
+}
+
+// ParseTimeSeriesDuplicatePolicy returns the duplicate policy of the given
+// case insensitive name.
+func ParseTimeSeriesDuplicatePolicy(name string) (TimeSeriesDuplicatePolicy, bool) {
+	for i, n := range timeSeriesDuplicatePolicyNames {
+		if strings.EqualFold(name, n) {
+			return TimeSeriesDuplicatePolicy(i), true
+		}
+	}
+	return 0, false
+}
+
+// merge returns the value kept by the policy.
+func (p TimeSeriesDuplicatePolicy) merge(old, new float64) (float64, error) {
+	switch p {
+	case TimeSeriesDuplicateFirst:
+		return old, nil
+	case TimeSeriesDuplicateLast:
+		return new, nil
+	case TimeSeriesDuplicateMin:
+		return math.Min(old, new), nil
+	case TimeSeriesDuplicateMax:
+		return math.Max(old, new), nil
+	case TimeSeriesDuplicateSum:
+		return old + new, nil
+	}
+	return 0, ErrDuplicateSample
+}
+
+// TimeSeriesAggregation is a function reducing the samples of a time bucket
+// to a single value.
+type TimeSeriesAggregation uint8
+
+const (
+	// TimeSeriesAvg is the average of the values
+	TimeSeriesAvg TimeSeriesAggregation = iota
+	// TimeSeriesMin is the lowest value
+	TimeSeriesMin
+	// TimeSeriesMax is the highest value
+	TimeSeriesMax
+	// TimeSeriesSum is the sum of the values
+	TimeSeriesSum
+	// TimeSeriesCount is the number of values
+	TimeSeriesCount
+)
+
+var timeSeriesAggregationNames = []string{"avg", "min", "max", "sum", "count"}
+
+func (a TimeSeriesAggregation) String() string {
+	if int(a) < len(timeSeriesAggregationNames) {
+		return timeSeriesAggregationNames[a]
+	}
+	return "unknown"
+}
+
+// ParseTimeSeriesAggregation returns the aggregation of the given case
+// insensitive name.
+func ParseTimeSeriesAggregation(name string) (TimeSeriesAggregation, bool) {
+	for i, n := range timeSeriesAggregationNames {
+		if strings.EqualFold(name, n) {
+			return TimeSeriesAggregation(i), true
+		}
+	}
+	return 0, false
+}
+
+// reduce returns the aggregated value of the non-empty values.
+func (a TimeSeriesAggregation) reduce(samples []TimeSeriesSample) float64 {
+	var v float64
+	switch a {
+	case TimeSeriesMin:
+		v = math.Inf(1)
+		for _, s := range samples {
+			v = math.Min(v, s.Value)
+		}
+	case TimeSeriesMax:
+		v = math.Inf(-1)
+		for _, s := range samples {
+			v = math.Max(v, s.Value)
+		}
+	case TimeSeriesCount:
+		v = float64(len(samples))
+	default:
+		for _, s := range samples {
+			v += s.Value
+		}
+		if a == TimeSeriesAvg {
+			v /= float64(len(samples))
+		}
+	}
+	return v
+}
+
+// timeSeriesBucket returns the start of the time bucket of the timestamp,
+// buckets being aligned to the epoch.
+func timeSeriesBucket(timestamp, duration int64) int64 {
+	start := timestamp - timestamp%duration
+	if timestamp < 0 && start != timestamp {
+		start -= duration
+	}
+	return start
+}
+
+// AggregateTimeSeries reduces the ordered samples of each time bucket of the
+// given duration to a sample at the start of the bucket.
+func AggregateTimeSeries(samples []TimeSeriesSample, aggregation TimeSeriesAggregation, duration int64) []TimeSeriesSample {
+	var result []TimeSeriesSample
+	for i := 0; i < len(samples); {
+		start := timeSeriesBucket(samples[i].Timestamp, duration)
+
+		j := i + 1
+		for j < len(samples) && samples[j].Timestamp < start+duration {
+			j++
+		}
+
+		result = append(result, TimeSeriesSample{start, aggregation.reduce(samples[i:j])})
+		i = j
+	}
+	return result
+}
+
+// TimeSeriesRule is a compaction rule downsampling a time series into the
+// time series stored at DestKey.
+type TimeSeriesRule struct {
+	DestKey        string
+	Aggregation    TimeSeriesAggregation
+	BucketDuration int64
+
+	// bucketStart is the start of the latest bucket, which is compacted
+	// once a sample is added to a later bucket
+	bucketStart int64
+	open        bool
+}
+
+// TimeSeriesCompaction is a sample to store in the destination of a
+// compaction rule.
+type TimeSeriesCompaction struct {
+	DestKey string
+	Sample  TimeSeriesSample
+}
+
+// TimeSeries is a sequence of samples ordered by timestamp, stored in
+// compressed chunks.
+// It is not safe for concurrent use.
+type TimeSeries struct {
+	// Retention is the maximum age in milliseconds of the samples relative
+	// to the latest sample, 0 keeping every sample
+	Retention int64
+	// Labels describe the time series
+	Labels []TimeSeriesLabel
+	// DuplicatePolicy is the policy used when a sample is added at the
+	// timestamp of an existing sample
+	DuplicatePolicy TimeSeriesDuplicatePolicy
+	// SourceKey is the key of the time series compacted into this one, if any
+	SourceKey string
+	// Rules are the compaction rules of the time series
+	Rules []*TimeSeriesRule
+
+	chunks []*tsChunk
+	count  int
+}
+
+// NewTimeSeries returns a new empty time series.
+func NewTimeSeries() *TimeSeries {
+	return &TimeSeries{}
+}
+
+// Len returns the number of samples.
+func (ts *TimeSeries) Len() int {
+	return ts.count
+}
+
+// Size returns the estimated amount of bytes used by the samples.
+func (ts *TimeSeries) Size() int {
+	var n int
+	for _, ch := range ts.chunks {
+		n += len(ch.w.data)
+	}
+	return n
+}
+
+// Label returns the value of the label.
+func (ts *TimeSeries) Label(name string) (string, bool) {
+	for _, l := range ts.Labels {
+		if l.Name == name {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// First returns the oldest sample.
+func (ts *TimeSeries) First() (TimeSeriesSample, bool) {
+	if ts.count == 0 {
+		return TimeSeriesSample{}, false
+	}
+	s, _ := ts.chunks[0].iterator().next()
+	return s, true
+}
+
+// Last returns the latest sample.
+func (ts *TimeSeries) Last() (TimeSeriesSample, bool) {
+	if ts.count == 0 {
+		return TimeSeriesSample{}, false
+	}
+	last := ts.chunks[len(ts.chunks)-1]
+	return TimeSeriesSample{last.lastTimestamp, math.Float64frombits(last.lastValue)}, true
+}
+
+// cutoff returns the timestamp before which samples are past the retention
+// period.
+func (ts *TimeSeries) cutoff() int64 {
+	if ts.Retention == 0 || ts.count == 0 {
+		return math.MinInt64
+	}
+	return ts.chunks[len(ts.chunks)-1].lastTimestamp - ts.Retention
+}
+
+// Add adds the sample, merging it with the sample at the same timestamp if
+// any according to the duplicate policy. Returns ErrSampleTooOld if the
+// sample is past the retention period.
+func (ts *TimeSeries) Add(sample TimeSeriesSample, policy TimeSeriesDuplicatePolicy) error {
+	if sample.Timestamp < ts.cutoff() {
+		return ErrSampleTooOld
+	}
+
+	if ts.count == 0 || sample.Timestamp > ts.chunks[len(ts.chunks)-1].lastTimestamp {
+		if ts.count == 0 || ts.chunks[len(ts.chunks)-1].full() {
+			ts.chunks = append(ts.chunks, newTSChunk())
+		}
+		ts.chunks[len(ts.chunks)-1].append(sample)
+		ts.count++
+		ts.trim()
+		return nil
+	}
+
+	// The sample goes into the first chunk ending at or after it, which is
+	// encoded again
+	i := sort.Search(len(ts.chunks), func(i int) bool {
+		return ts.chunks[i].lastTimestamp >= sample.Timestamp
+	})
+
+	samples := ts.chunks[i].samples()
+	j := sort.Search(len(samples), func(j int) bool {
+		return samples[j].Timestamp >= sample.Timestamp
+	})
+
+	if j < len(samples) && samples[j].Timestamp == sample.Timestamp {
+		v, err := policy.merge(samples[j].Value, sample.Value)
+		if err != nil {
+			return err
+		}
+		samples[j].Value = v
+	} else {
+		samples = append(samples, TimeSeriesSample{})
+		copy(samples[j+1:], samples[j:])
+		samples[j] = sample
+		ts.count++
+	}
+
+	ch := newTSChunk()
+	for _, s := range samples {
+		ch.append(s)
+	}
+	ts.chunks[i] = ch
+	return nil
+}
+
+// trim deletes the chunks whose samples are all past the retention period.
+func (ts *TimeSeries) trim() {
+	cutoff := ts.cutoff()
+
+	var n int
+	for n < len(ts.chunks)-1 && ts.chunks[n].lastTimestamp < cutoff {
+		ts.count -= ts.chunks[n].count
+		n++
+	}
+
+	if n > 0 {
+		ts.chunks = append(ts.chunks[:0:0], ts.chunks[n:]...)
+	}
+}
+
+// Range returns the samples between from and to inclusive, up to count
+// samples if count is positive.
+func (ts *TimeSeries) Range(from, to int64, count int) []TimeSeriesSample {
+	if cutoff := ts.cutoff(); from < cutoff {
+		from = cutoff
+	}
+
+	var samples []TimeSeriesSample
+	for _, ch := range ts.chunks {
+		if ch.lastTimestamp < from {
+			continue
+		}
+		if ch.firstTimestamp > to {
+			break
+		}
+
+		it := ch.iterator()
+		for s, ok := it.next(); ok && s.Timestamp <= to; s, ok = it.next() {
+			if s.Timestamp < from {
+				continue
+			}
+
+			samples = append(samples, s)
+			if count > 0 && len(samples) == count {
+				return samples
+			}
+		}
+	}
+	return samples
+}
+
+// Rule returns the compaction rule into the destination key.
+func (ts *TimeSeries) Rule(destKey string) (*TimeSeriesRule, bool) {
+	for _, r := range ts.Rules {
+		if r.DestKey == destKey {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// DeleteRule deletes the compaction rule into the destination key.
+func (ts *TimeSeries) DeleteRule(destKey string) bool {
+	for i, r := range ts.Rules {
+		if r.DestKey == destKey {
+			ts.Rules = append(ts.Rules[:i], ts.Rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Compact returns the samples to store in the destinations of the
+// compaction rules after adding a sample at the timestamp. A bucket is
+// compacted once a sample is added to a later bucket, or again when a
+// sample is added to a past bucket.
+func (ts *TimeSeries) Compact(timestamp int64) []TimeSeriesCompaction {
+	var compactions []TimeSeriesCompaction
+	for _, r := range ts.Rules {
+		start := timeSeriesBucket(timestamp, r.BucketDuration)
+
+		compacted := start
+		switch {
+		case !r.open:
+			r.open, r.bucketStart = true, start
+			continue
+		case start == r.bucketStart:
+			continue
+		case start > r.bucketStart:
+			compacted, r.bucketStart = r.bucketStart, start
+		}
+
+		samples := ts.Range(compacted, compacted+r.BucketDuration-1, 0)
+		if len(samples) == 0 {
+			continue
+		}
+
+		compactions = append(compactions, TimeSeriesCompaction{
+			DestKey: r.DestKey,
+			Sample:  TimeSeriesSample{compacted, r.Aggregation.reduce(samples)},
+		})
+	}
+	return compactions
+}
+
+// Bytes returns the options, labels and compaction rules of the time series
+// followed by its chunks.
+func (ts *TimeSeries) Bytes() []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+
+	binary.Write(&buf, binary.BigEndian, ts.Retention)
+	binary.Write(&buf, binary.BigEndian, ts.DuplicatePolicy)
+	writeString(ts.SourceKey)
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(ts.Labels)))
+	for _, l := range ts.Labels {
+		writeString(l.Name)
+		writeString(l.Value)
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(ts.Rules)))
+	for _, r := range ts.Rules {
+		writeString(r.DestKey)
+		binary.Write(&buf, binary.BigEndian, r.Aggregation)
+		binary.Write(&buf, binary.BigEndian, r.BucketDuration)
+		binary.Write(&buf, binary.BigEndian, r.bucketStart)
+		binary.Write(&buf, binary.BigEndian, r.open)
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(ts.chunks)))
+	for _, ch := range ts.chunks {
+		binary.Write(&buf, binary.BigEndian, uint32(ch.count))
+		binary.Write(&buf, binary.BigEndian, ch.w.nbits)
+		buf.Write(ch.w.data)
+	}
+
+	return buf.Bytes()
+}
+
+// NewTimeSeriesFromBytes returns the time series encoded by Bytes.
+func NewTimeSeriesFromBytes(data []byte) (*TimeSeries, error) {
+	r := bytes.NewReader(data)
+	ts := &TimeSeries{}
+
+	readString := func(s *string) error {
+		var n uint32
+		if err := readBinary(r, &n); err != nil || uint64(n) > uint64(r.Len()) {
+			return ErrInvalidTimeSeries
+		}
+
+		b := make([]byte, n)
+		r.Read(b)
+		*s = string(b)
+		return nil
+	}
+
+	var n uint32
+	if err := readBinary(r, &ts.Retention, &ts.DuplicatePolicy); err != nil || ts.Retention < 0 {
+		return nil, ErrInvalidTimeSeries
+	}
+
+	if err := readString(&ts.SourceKey); err != nil {
+		return nil, err
+	}
+
+	if err := readBinary(r, &n); err != nil {
+		return nil, ErrInvalidTimeSeries
+	}
+
+	for i := uint32(0); i < n; i++ {
+		var l TimeSeriesLabel
+		if readString(&l.Name) != nil || readString(&l.Value) != nil {
+			return nil, ErrInvalidTimeSeries
+		}
+		ts.Labels = append(ts.Labels, l)
+	}
+
+	if err := readBinary(r, &n); err != nil {
+		return nil, ErrInvalidTimeSeries
+	}
+
+	for i := uint32(0); i < n; i++ {
+		rule := &TimeSeriesRule{}
+		if err := readString(&rule.DestKey); err != nil {
+			return nil, err
+		}
+
+		if err := readBinary(r, &rule.Aggregation, &rule.BucketDuration, &rule.bucketStart, &rule.open); err != nil || rule.BucketDuration <= 0 {
+			return nil, ErrInvalidTimeSeries
+		}
+		ts.Rules = append(ts.Rules, rule)
+	}
+
+	if err := readBinary(r, &n); err != nil {
+		return nil, ErrInvalidTimeSeries
+	}
+
+	for i := uint32(0); i < n; i++ {
+		var count uint32
+		ch := newTSChunk()
+		if err := readBinary(r, &count, &ch.w.nbits); err != nil || count == 0 || (ch.w.nbits+7)/8 > uint64(r.Len()) {
+			return nil, ErrInvalidTimeSeries
+		}
+
+		ch.count = int(count)
+		ch.w.data = make([]byte, (ch.w.nbits+7)/8)
+		r.Read(ch.w.data)
+
+		if !ch.restore() || (i > 0 && ch.firstTimestamp <= ts.chunks[i-1].lastTimestamp) {
+			return nil, ErrInvalidTimeSeries
+		}
+
+		ts.chunks = append(ts.chunks, ch)
+		ts.count += ch.count
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrInvalidTimeSeries
+	}
+	return ts, nil
+}
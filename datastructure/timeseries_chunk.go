@@ -0,0 +1,342 @@
+package datastructure
+
+import (
+	"math"
+	"math/bits"
+)
+
+// TimeSeriesChunkSize is the number of bytes after which a new chunk is
+// started when appending samples to a time series.
+const TimeSeriesChunkSize = 4096
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	data  []byte
+	nbits uint64
+}
+
+// write appends the n least significant bits of v.
+func (w *bitWriter) write(v uint64, n int) {
+	for n > 0 {
+		if w.nbits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+
+		free := 8 - int(w.nbits%8)
+		take := free
+		if n < take {
+			take = n
+		}
+
+		chunk := (v >> uint(n-take)) & (1<<uint(take) - 1)
+		w.data[len(w.data)-1] |= byte(chunk << uint(free-take))
+		w.nbits += uint64(take)
+		n -= take
+	}
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if bit {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+}
+
+// bitReader reads the bits written by a bitWriter.
+type bitReader struct {
+	data  []byte
+	nbits uint64
+	pos   uint64
+}
+
+// read reads n bits. Returns false if there are not enough bits left.
+func (r *bitReader) read(n int) (uint64, bool) {
+	if r.pos+uint64(n) > r.nbits {
+		return 0, false
+	}
+
+	var v uint64
+	for n > 0 {
+		offset := int(r.pos % 8)
+		take := 8 - offset
+		if n < take {
+			take = n
+		}
+
+		b := uint64(r.data[r.pos/8]>>uint(8-offset-take)) & (1<<uint(take) - 1)
+		v = v<<uint(take) | b
+		r.pos += uint64(take)
+		n -= take
+	}
+	return v, true
+}
+
+func (r *bitReader) readBit() (bool, bool) {
+	v, ok := r.read(1)
+	return v == 1, ok
+}
+
+// Encodings of a delta-of-delta: the number of bits of its prefix of ones
+// followed by a zero, and the number of bits of the value.
+var tsDeltaEncodings = []struct {
+	prefix int
+	bits   int
+}{
+	{2, 7},
+	{3, 9},
+	{4, 12},
+}
+
+// tsChunk is a compressed run of samples using the Gorilla encoding: the
+// first sample is stored as is, then each timestamp is stored as the
+// difference between its delta and the previous delta, and each value as
+// its XOR with the previous value, omitting the leading and trailing zeros.
+type tsChunk struct {
+	w     bitWriter
+	count int
+
+	firstTimestamp int64
+	lastTimestamp  int64
+	lastDelta      int64
+	lastValue      uint64
+	// leading and trailing are the number of leading and trailing zeros of
+	// the previous XOR, leading being 0xFF when there is none
+	leading, trailing uint8
+}
+
+func newTSChunk() *tsChunk {
+	return &tsChunk{leading: 0xFF}
+}
+
+// full returns true if samples should be appended to a new chunk.
+func (ch *tsChunk) full() bool {
+	return len(ch.w.data) >= TimeSeriesChunkSize
+}
+
+// append appends a sample whose timestamp is greater than the timestamps
+// of the chunk.
+func (ch *tsChunk) append(s TimeSeriesSample) {
+	value := math.Float64bits(s.Value)
+
+	if ch.count == 0 {
+		ch.w.write(uint64(s.Timestamp), 64)
+		ch.w.write(value, 64)
+		ch.firstTimestamp, ch.lastTimestamp, ch.lastValue = s.Timestamp, s.Timestamp, value
+		ch.count++
+		return
+	}
+
+	delta := s.Timestamp - ch.lastTimestamp
+	ch.appendDeltaOfDelta(delta - ch.lastDelta)
+	ch.appendXOR(value ^ ch.lastValue)
+
+	ch.lastTimestamp, ch.lastDelta, ch.lastValue = s.Timestamp, delta, value
+	ch.count++
+}
+
+func (ch *tsChunk) appendDeltaOfDelta(dod int64) {
+	if dod == 0 {
+		ch.w.writeBit(false)
+		return
+	}
+
+	for _, enc := range tsDeltaEncodings {
+		limit := int64(1) << uint(enc.bits-1)
+		if dod >= -limit+1 && dod <= limit {
+			ch.w.write(1<<uint(enc.prefix)-2, enc.prefix)
+			ch.w.write(uint64(dod), enc.bits)
+			return
+		}
+	}
+
+	ch.w.write(0xF, 4)
+	ch.w.write(uint64(dod), 64)
+}
+
+func (ch *tsChunk) appendXOR(xor uint64) {
+	if xor == 0 {
+		ch.w.writeBit(false)
+		return
+	}
+	ch.w.writeBit(true)
+
+	leading, trailing := uint8(bits.LeadingZeros64(xor)), uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+
+	// The meaningful bits fit in the window of the previous XOR
+	if ch.leading != 0xFF && leading >= ch.leading && trailing >= ch.trailing {
+		ch.w.writeBit(false)
+		ch.w.write(xor>>ch.trailing, int(64-ch.leading-ch.trailing))
+		return
+	}
+
+	significant := 64 - leading - trailing
+	ch.w.writeBit(true)
+	ch.w.write(uint64(leading), 5)
+	// 64 significant bits are written as 0
+	ch.w.write(uint64(significant)&0x3F, 6)
+	ch.w.write(xor>>trailing, int(significant))
+	ch.leading, ch.trailing = leading, trailing
+}
+
+// samples returns the samples of the chunk.
+func (ch *tsChunk) samples() []TimeSeriesSample {
+	samples := make([]TimeSeriesSample, 0, ch.count)
+	it := ch.iterator()
+	for s, ok := it.next(); ok; s, ok = it.next() {
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+func (ch *tsChunk) iterator() *tsChunkIterator {
+	return &tsChunkIterator{
+		r:       bitReader{data: ch.w.data, nbits: ch.w.nbits},
+		count:   ch.count,
+		leading: 0xFF,
+	}
+}
+
+// tsChunkIterator decodes the samples of a chunk in order.
+type tsChunkIterator struct {
+	r     bitReader
+	count int
+	i     int
+
+	timestamp int64
+	delta     int64
+	value     uint64
+
+	leading, trailing uint8
+}
+
+// next returns the next sample. Returns false once every sample was read or
+// if the chunk is malformed.
+func (it *tsChunkIterator) next() (TimeSeriesSample, bool) {
+	if it.i >= it.count {
+		return TimeSeriesSample{}, false
+	}
+
+	if it.i == 0 {
+		timestamp, ok1 := it.r.read(64)
+		value, ok2 := it.r.read(64)
+		if !ok1 || !ok2 {
+			return TimeSeriesSample{}, false
+		}
+		it.timestamp, it.value = int64(timestamp), value
+	} else {
+		dod, ok := it.readDeltaOfDelta()
+		if !ok || !it.readXOR() {
+			return TimeSeriesSample{}, false
+		}
+		it.delta += dod
+		it.timestamp += it.delta
+	}
+
+	it.i++
+	return TimeSeriesSample{it.timestamp, math.Float64frombits(it.value)}, true
+}
+
+func (it *tsChunkIterator) readDeltaOfDelta() (int64, bool) {
+	// Count the ones of the prefix
+	var ones int
+	for ones < 4 {
+		bit, ok := it.r.readBit()
+		if !ok {
+			return 0, false
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+
+	if ones == 0 {
+		return 0, true
+	}
+
+	if ones == 4 {
+		v, ok := it.r.read(64)
+		return int64(v), ok
+	}
+
+	n := tsDeltaEncodings[ones-1].bits
+	v, ok := it.r.read(n)
+	if !ok {
+		return 0, false
+	}
+
+	// Sign extend values above the upper limit
+	if v > 1<<uint(n-1) {
+		return int64(v) - 1<<uint(n), true
+	}
+	return int64(v), true
+}
+
+func (it *tsChunkIterator) readXOR() bool {
+	nonZero, ok := it.r.readBit()
+	if !ok {
+		return false
+	}
+
+	if !nonZero {
+		return true
+	}
+
+	newWindow, ok := it.r.readBit()
+	if !ok || (!newWindow && it.leading == 0xFF) {
+		return false
+	}
+
+	if newWindow {
+		leading, ok1 := it.r.read(5)
+		significant, ok2 := it.r.read(6)
+		if !ok1 || !ok2 {
+			return false
+		}
+
+		if significant == 0 {
+			significant = 64
+		}
+		if leading+significant > 64 {
+			return false
+		}
+		it.leading, it.trailing = uint8(leading), uint8(64-leading-significant)
+	}
+
+	xor, ok := it.r.read(int(64 - it.leading - it.trailing))
+	if !ok {
+		return false
+	}
+
+	it.value ^= xor << it.trailing
+	return true
+}
+
+// restore restores the state used to append samples from the encoded
+// samples. Returns false if the chunk is malformed.
+func (ch *tsChunk) restore() bool {
+	it := ch.iterator()
+
+	var n int
+	for s, ok := it.next(); ok; s, ok = it.next() {
+		if n == 0 {
+			ch.firstTimestamp = s.Timestamp
+		} else if s.Timestamp <= ch.lastTimestamp {
+			return false
+		}
+		ch.lastTimestamp = s.Timestamp
+		n++
+	}
+
+	if n != ch.count || it.r.pos != ch.w.nbits {
+		return false
+	}
+
+	ch.lastDelta, ch.lastValue = it.delta, it.value
+	ch.leading, ch.trailing = it.leading, it.trailing
+	return true
+}
@@ -0,0 +1,188 @@
+package datastructure_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_TimeSeriesAdd(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+
+	// Irregular intervals and values exercise every encoding
+	var expected []datastructure.TimeSeriesSample
+	timestamp := int64(1_600_000_000_000)
+	for i := 0; i < 5000; i++ {
+		timestamp += int64(1000 + (i%7)*(i%13)*37 + (i%101)*100000)
+		value := float64(i%50) * 1.5
+		if i%17 == 0 {
+			value = math.Sin(float64(i)) * 1e6
+		}
+		expected = append(expected, datastructure.TimeSeriesSample{Timestamp: timestamp, Value: value})
+
+		if err := ts.Add(expected[i], datastructure.TimeSeriesDuplicateBlock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ts.Len() != 5000 {
+		t.Errorf("expected 5000 samples, got %d", ts.Len())
+	}
+
+	if got := ts.Range(math.MinInt64, math.MaxInt64, 0); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the samples to be decoded")
+	}
+
+	if got := ts.Range(expected[10].Timestamp, expected[19].Timestamp, 5); !reflect.DeepEqual(got, expected[10:15]) {
+		t.Errorf("expected %v, got %v", expected[10:15], got)
+	}
+}
+
+func Test_TimeSeriesCompression(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	for i := int64(0); i < 10000; i++ {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: 1_600_000_000_000 + i*1000, Value: float64(20 + i%5)}, datastructure.TimeSeriesDuplicateBlock)
+	}
+
+	// Regular samples take a few bits instead of 16 bytes
+	if ts.Size() > 10000*2 {
+		t.Errorf("expected the samples to be compressed, got %d bytes", ts.Size())
+	}
+}
+
+func Test_TimeSeriesDuplicates(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	for _, timestamp := range []int64{10, 30, 20} {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: timestamp, Value: 1}, datastructure.TimeSeriesDuplicateBlock)
+	}
+
+	if err := ts.Add(datastructure.TimeSeriesSample{Timestamp: 20, Value: 5}, datastructure.TimeSeriesDuplicateBlock); err != datastructure.ErrDuplicateSample {
+		t.Errorf("expected ErrDuplicateSample, got %v", err)
+	}
+
+	ts.Add(datastructure.TimeSeriesSample{Timestamp: 20, Value: 5}, datastructure.TimeSeriesDuplicateSum)
+	ts.Add(datastructure.TimeSeriesSample{Timestamp: 30, Value: 0}, datastructure.TimeSeriesDuplicateMin)
+
+	expected := []datastructure.TimeSeriesSample{{Timestamp: 10, Value: 1}, {Timestamp: 20, Value: 6}, {Timestamp: 30, Value: 0}}
+	if got := ts.Range(0, 100, 0); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func Test_TimeSeriesRetention(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	ts.Retention = 100
+	for i := int64(0); i < 10000; i++ {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: i, Value: float64(i)}, datastructure.TimeSeriesDuplicateBlock)
+	}
+
+	if got := ts.Range(0, math.MaxInt64, 0); len(got) != 101 || got[0].Timestamp != 9899 {
+		t.Errorf("expected the samples of the retention period, got %d", len(got))
+	}
+
+	if ts.Len() >= 10000 {
+		t.Errorf("expected old chunks to be deleted")
+	}
+
+	if err := ts.Add(datastructure.TimeSeriesSample{Timestamp: 5000}, datastructure.TimeSeriesDuplicateLast); err != datastructure.ErrSampleTooOld {
+		t.Errorf("expected ErrSampleTooOld, got %v", err)
+	}
+}
+
+func Test_AggregateTimeSeries(t *testing.T) {
+	samples := []datastructure.TimeSeriesSample{{Timestamp: 0, Value: 1}, {Timestamp: 5, Value: 3}, {Timestamp: 12, Value: 4}, {Timestamp: 35, Value: 2}}
+
+	tc := []struct {
+		aggregation string
+		expected    []float64
+	}{
+		{"avg", []float64{2, 4, 2}},
+		{"min", []float64{1, 4, 2}},
+		{"max", []float64{3, 4, 2}},
+		{"sum", []float64{4, 4, 2}},
+		{"count", []float64{2, 1, 1}},
+	}
+
+	for _, tt := range tc {
+		aggregation, ok := datastructure.ParseTimeSeriesAggregation(tt.aggregation)
+		if !ok {
+			t.Fatalf("expected %s to be valid", tt.aggregation)
+		}
+
+		got := datastructure.AggregateTimeSeries(samples, aggregation, 10)
+		var values []float64
+		for i, s := range got {
+			if s.Timestamp != []int64{0, 10, 30}[i] {
+				t.Errorf("%s: unexpected bucket %d", tt.aggregation, s.Timestamp)
+			}
+			values = append(values, s.Value)
+		}
+
+		if !reflect.DeepEqual(values, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.aggregation, tt.expected, values)
+		}
+	}
+}
+
+func Test_TimeSeriesCompact(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	ts.Rules = append(ts.Rules, &datastructure.TimeSeriesRule{DestKey: "dst", Aggregation: datastructure.TimeSeriesSum, BucketDuration: 10})
+
+	add := func(timestamp int64, value float64) []datastructure.TimeSeriesCompaction {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: timestamp, Value: value}, datastructure.TimeSeriesDuplicateBlock)
+		return ts.Compact(timestamp)
+	}
+
+	if got := add(1, 1); got != nil {
+		t.Errorf("expected no compaction, got %v", got)
+	}
+	if got := add(5, 2); got != nil {
+		t.Errorf("expected no compaction, got %v", got)
+	}
+
+	expected := []datastructure.TimeSeriesCompaction{{DestKey: "dst", Sample: datastructure.TimeSeriesSample{Timestamp: 0, Value: 3}}}
+	if got := add(25, 1); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// A past bucket is compacted again
+	expected[0].Sample.Value = 7
+	if got := add(7, 4); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func Test_TimeSeriesBytes(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	ts.Retention = 1000000
+	ts.DuplicatePolicy = datastructure.TimeSeriesDuplicateLast
+	ts.Labels = []datastructure.TimeSeriesLabel{{Name: "sensor", Value: "1"}, {Name: "area", Value: "north"}}
+	ts.SourceKey = "raw"
+	ts.Rules = []*datastructure.TimeSeriesRule{{DestKey: "avg", Aggregation: datastructure.TimeSeriesAvg, BucketDuration: 60000}}
+	for i := int64(0); i < 3000; i++ {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: i * 1000, Value: float64(i % 10)}, datastructure.TimeSeriesDuplicateBlock)
+		ts.Compact(i * 1000)
+	}
+
+	got, err := datastructure.NewTimeSeriesFromBytes(ts.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, ts) {
+		t.Errorf("expected the time series to be restored")
+	}
+
+	// The restored time series keeps appending samples the same way
+	ts.Add(datastructure.TimeSeriesSample{Timestamp: 5000000, Value: 0.1}, datastructure.TimeSeriesDuplicateBlock)
+	got.Add(datastructure.TimeSeriesSample{Timestamp: 5000000, Value: 0.1}, datastructure.TimeSeriesDuplicateBlock)
+	if string(got.Bytes()) != string(ts.Bytes()) {
+		t.Errorf("expected the time series to be identical")
+	}
+
+	if _, err := datastructure.NewTimeSeriesFromBytes(ts.Bytes()[:100]); err != datastructure.ErrInvalidTimeSeries {
+		t.Errorf("expected ErrInvalidTimeSeries, got %v", err)
+	}
+}
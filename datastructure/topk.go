@@ -0,0 +1,258 @@
+package datastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// topkSeed is the seed of the fingerprint of an item.
+const topkSeed = 0x9747b28c
+
+// topkBucket is a counter of a HeavyKeeper row owned by a fingerprint.
+type topkBucket struct {
+	fp    uint32
+	count uint32
+}
+
+// TopKItem is an item tracked by a TopK and its estimated count.
+type TopKItem struct {
+	Item  string
+	Count uint64
+}
+
+// TopK tracks the k most frequent items using the HeavyKeeper algorithm:
+// every item is counted in one bucket of each of depth rows of width
+// buckets, a bucket owned by another item being decayed with a probability
+// decreasing exponentially with its count, so that frequent items keep
+// their buckets while infrequent ones are evicted.
+// It is not safe for concurrent use.
+type TopK struct {
+	k, width, depth uint32
+	decay           float64
+	buckets         []topkBucket
+	// heap is a min-heap of the top items by count
+	heap []TopKItem
+	// rng is the state of the generator deciding the decays, so that adding
+	// items is deterministic
+	rng uint64
+}
+
+// NewTopK returns a new TopK tracking the k most frequent items.
+func NewTopK(k, width, depth uint32, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]topkBucket, uint64(width)*uint64(depth)),
+		rng:     topkSeed,
+	}
+}
+
+// K returns the number of items tracked.
+func (t *TopK) K() uint32 {
+	return t.k
+}
+
+// Size returns the estimated amount of bytes used by the TopK.
+func (t *TopK) Size() int {
+	n := len(t.buckets) * 8
+	for _, item := range t.heap {
+		n += len(item.Item) + 24
+	}
+	return n
+}
+
+// nextRandom returns the next number of the xorshift generator as a float
+// within [0, 1).
+func (t *TopK) nextRandom() float64 {
+	t.rng ^= t.rng << 13
+	t.rng ^= t.rng >> 7
+	t.rng ^= t.rng << 17
+	return float64(t.rng>>11) / (1 << 53)
+}
+
+// find returns the position of the item in the heap, or -1.
+func (t *TopK) find(item string) int {
+	for i := range t.heap {
+		if t.heap[i].Item == item {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *TopK) less(i, j int) bool {
+	return t.heap[i].Count < t.heap[j].Count
+}
+
+func (t *TopK) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !t.less(i, parent) {
+			break
+		}
+		t.heap[i], t.heap[parent] = t.heap[parent], t.heap[i]
+		i = parent
+	}
+}
+
+func (t *TopK) down(i int) {
+	for {
+		smallest := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(t.heap) && t.less(child, smallest) {
+				smallest = child
+			}
+		}
+
+		if smallest == i {
+			return
+		}
+		t.heap[i], t.heap[smallest] = t.heap[smallest], t.heap[i]
+		i = smallest
+	}
+}
+
+// Add counts the item. Returns the item expelled from the top items to make
+// room for the added one, if any.
+func (t *TopK) Add(item []byte) (expelled string, ok bool) {
+	fp := uint32(murmurHash64A(item, topkSeed))
+
+	var count uint32
+	for row := uint32(0); row < t.depth; row++ {
+		b := &t.buckets[uint64(row)*uint64(t.width)+murmurHash64A(item, uint64(row))%uint64(t.width)]
+
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, 1
+		case b.fp == fp:
+			if b.count < math.MaxUint32 {
+				b.count++
+			}
+		case t.nextRandom() < math.Pow(t.decay, float64(b.count)):
+			b.count--
+			if b.count == 0 {
+				b.fp, b.count = fp, 1
+			}
+		}
+
+		if b.fp == fp && b.count > count {
+			count = b.count
+		}
+	}
+
+	// The item owns no bucket when it only decayed the buckets of others
+	if count == 0 {
+		return "", false
+	}
+
+	if i := t.find(string(item)); i >= 0 {
+		if uint64(count) > t.heap[i].Count {
+			t.heap[i].Count = uint64(count)
+			t.down(i)
+		}
+		return "", false
+	}
+
+	if uint32(len(t.heap)) < t.k {
+		t.heap = append(t.heap, TopKItem{string(item), uint64(count)})
+		t.up(len(t.heap) - 1)
+		return "", false
+	}
+
+	if len(t.heap) == 0 || uint64(count) <= t.heap[0].Count {
+		return "", false
+	}
+
+	expelled = t.heap[0].Item
+	t.heap[0] = TopKItem{string(item), uint64(count)}
+	t.down(0)
+	return expelled, true
+}
+
+// List returns the top items from the most to the least frequent.
+func (t *TopK) List() []TopKItem {
+	items := append([]TopKItem(nil), t.heap...)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	return items
+}
+
+// Bytes returns the parameters of the TopK followed by its buckets and top
+// items.
+func (t *TopK) Bytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, t.k)
+	binary.Write(&buf, binary.BigEndian, t.width)
+	binary.Write(&buf, binary.BigEndian, t.depth)
+	binary.Write(&buf, binary.BigEndian, t.decay)
+	binary.Write(&buf, binary.BigEndian, t.rng)
+
+	for _, b := range t.buckets {
+		binary.Write(&buf, binary.BigEndian, b.fp)
+		binary.Write(&buf, binary.BigEndian, b.count)
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(t.heap)))
+	for _, item := range t.heap {
+		binary.Write(&buf, binary.BigEndian, item.Count)
+		binary.Write(&buf, binary.BigEndian, uint32(len(item.Item)))
+		buf.WriteString(item.Item)
+	}
+
+	return buf.Bytes()
+}
+
+// NewTopKFromBytes returns the TopK encoded by Bytes.
+func NewTopKFromBytes(data []byte) (*TopK, error) {
+	r := bytes.NewReader(data)
+	t := &TopK{}
+
+	if err := readBinary(r, &t.k, &t.width, &t.depth, &t.decay, &t.rng); err != nil {
+		return nil, ErrInvalidSketch
+	}
+
+	n := uint64(t.width) * uint64(t.depth)
+	if n == 0 || n*8 > uint64(r.Len()) {
+		return nil, ErrInvalidSketch
+	}
+
+	t.buckets = make([]topkBucket, n)
+	for i := range t.buckets {
+		if err := readBinary(r, &t.buckets[i].fp, &t.buckets[i].count); err != nil {
+			return nil, ErrInvalidSketch
+		}
+	}
+
+	var items uint32
+	if err := readBinary(r, &items); err != nil || items > t.k {
+		return nil, ErrInvalidSketch
+	}
+
+	for i := uint32(0); i < items; i++ {
+		var (
+			item   TopKItem
+			length uint32
+		)
+		if err := readBinary(r, &item.Count, &length); err != nil || uint64(length) > uint64(r.Len()) {
+			return nil, ErrInvalidSketch
+		}
+
+		b := make([]byte, length)
+		r.Read(b)
+		item.Item = string(b)
+		t.heap = append(t.heap, item)
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrInvalidSketch
+	}
+	return t, nil
+}
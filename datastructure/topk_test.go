@@ -0,0 +1,63 @@
+package datastructure_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func Test_TopK(t *testing.T) {
+	topk := datastructure.NewTopK(3, 50, 4, 0.9)
+
+	// Item i is added i times among many infrequent items
+	for round := 0; round < 100; round++ {
+		for i := 1; i <= 10; i++ {
+			if round < i*10 {
+				topk.Add([]byte("item" + strconv.Itoa(i)))
+			}
+		}
+		topk.Add([]byte("noise" + strconv.Itoa(round)))
+	}
+
+	var got []string
+	for _, item := range topk.List() {
+		got = append(got, item.Item)
+	}
+
+	if expected := []string{"item10", "item9", "item8"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func Test_TopKExpelled(t *testing.T) {
+	topk := datastructure.NewTopK(1, 8, 7, 0.9)
+	topk.Add([]byte("a"))
+
+	topk.Add([]byte("b"))
+	expelled, ok := topk.Add([]byte("b"))
+	if !ok || expelled != "a" {
+		t.Errorf("expected a to be expelled, got %q (%v)", expelled, ok)
+	}
+}
+
+func Test_TopKBytes(t *testing.T) {
+	topk := datastructure.NewTopK(5, 20, 3, 0.9)
+	for i := 0; i < 100; i++ {
+		topk.Add([]byte(strconv.Itoa(i % 7)))
+	}
+
+	got, err := datastructure.NewTopKFromBytes(topk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got.List(), topk.List()) {
+		t.Errorf("expected %v, got %v", topk.List(), got.List())
+	}
+
+	if _, err := datastructure.NewTopKFromBytes(topk.Bytes()[:30]); err != datastructure.ErrInvalidSketch {
+		t.Errorf("expected ErrInvalidSketch, got %v", err)
+	}
+}
@@ -0,0 +1,450 @@
+package datastructure
+
+import "math/rand"
+
+const (
+	// zskiplistMaxLevel is the maximum level of a skiplist node, enough
+	// for 2^64 elements with zskiplistP = 1/4
+	zskiplistMaxLevel = 32
+	// zskiplistP is the probability of a node to be promoted to the next level
+	zskiplistP = 0.25
+)
+
+// zsetEntryOverhead is the estimated amount of bytes used by the skiplist
+// node and the map bucket of a single member.
+const zsetEntryOverhead = 96
+
+// ZSetEntry is a member of a sorted set and its score.
+type ZSetEntry struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange is a range of scores. Either side may be exclusive.
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r *ScoreRange) gteMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r *ScoreRange) lteMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// LexBound is a bound of a lexicographical range.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	// Infinite is -1 for the smallest possible string ("-"),
+	// 1 for the greatest possible string ("+") and 0 otherwise.
+	Infinite int
+}
+
+// LexRange is a lexicographical range of members.
+type LexRange struct {
+	Min, Max LexBound
+}
+
+func (r *LexRange) gteMin(member string) bool {
+	switch {
+	case r.Min.Infinite < 0:
+		return true
+	case r.Min.Infinite > 0:
+		return false
+	case r.Min.Exclusive:
+		return member > r.Min.Value
+	}
+	return member >= r.Min.Value
+}
+
+func (r *LexRange) lteMax(member string) bool {
+	switch {
+	case r.Max.Infinite > 0:
+		return true
+	case r.Max.Infinite < 0:
+		return false
+	case r.Max.Exclusive:
+		return member < r.Max.Value
+	}
+	return member <= r.Max.Value
+}
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// span is the number of nodes between this node and the forward one
+	span int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+// less returns true if the node is ordered before the given score and member.
+func (n *zskiplistNode) less(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// zskiplist is a skiplist ordered by score then member, where every level
+// keeps track of its span so elements can be accessed by rank.
+type zskiplist struct {
+	header, tail *zskiplistNode
+	length       int
+	level        int
+}
+
+func newZSkiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, zskiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func zskiplistRandomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level++
+	}
+	return level
+}
+
+func (zsl *zskiplist) insert(score float64, member string) {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	var rank [zskiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zskiplistRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	// The levels above the new node now span one more node
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+
+	zsl.length++
+}
+
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [zskiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.less(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+
+	zsl.length--
+	return true
+}
+
+// rank returns the 1-based rank of the element, 0 if it does not exist.
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.less(score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// byRank returns the node at the given 1-based rank.
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// first returns the first node for which before returns false.
+func (zsl *zskiplist) first(before func(*zskiplistNode) bool) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && before(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	return x.level[0].forward
+}
+
+// last returns the last node for which within returns true.
+func (zsl *zskiplist) last(within func(*zskiplistNode) bool) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && within(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header {
+		return nil
+	}
+	return x
+}
+
+// ZSet is a sorted set of unique strings ordered by their score, backed by a
+// skiplist for ordered access and a map for direct access to the scores.
+// It is not safe for concurrent use.
+type ZSet struct {
+	dict map[string]float64
+	zsl  *zskiplist
+	size int
+}
+
+// NewZSet returns a new ZSet.
+func NewZSet() *ZSet {
+	return &ZSet{dict: make(map[string]float64), zsl: newZSkiplist()}
+}
+
+// Len returns the number of members in the sorted set.
+func (z *ZSet) Len() int {
+	return len(z.dict)
+}
+
+// Size returns the estimated amount of bytes used by the members.
+func (z *ZSet) Size() int {
+	return z.size
+}
+
+// Score returns the score of the member.
+func (z *ZSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add adds the member with the given score or updates its score.
+// Returns true if the member is new.
+func (z *ZSet) Add(member string, score float64) bool {
+	old, exists := z.dict[member]
+	if exists {
+		if old != score {
+			z.zsl.delete(old, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	z.size += zsetEntryOverhead + len(member)
+	return true
+}
+
+// Remove removes the member. Returns true if the member existed.
+func (z *ZSet) Remove(member string) bool {
+	score, exists := z.dict[member]
+	if !exists {
+		return false
+	}
+
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	z.size -= zsetEntryOverhead + len(member)
+	return true
+}
+
+// Pop removes and returns the member with the lowest score, or the one with
+// the highest score if reverse is true. Returns false if the set is empty.
+func (z *ZSet) Pop(reverse bool) (ZSetEntry, bool) {
+	entries := z.Range(0, 0, reverse)
+	if len(entries) == 0 {
+		return ZSetEntry{}, false
+	}
+
+	z.Remove(entries[0].Member)
+	return entries[0], true
+}
+
+// Rank returns the 0-based rank of the member, ordered from the lowest to
+// the highest score or the other way around if reverse is true.
+func (z *ZSet) Rank(member string, reverse bool) (int, bool) {
+	score, exists := z.dict[member]
+	if !exists {
+		return 0, false
+	}
+
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.zsl.length - rank, true
+	}
+	return rank - 1, true
+}
+
+// collect walks the skiplist from x, skipping offset nodes then collecting
+// up to count nodes (every node if count is negative) while within is true.
+func collect(x *zskiplistNode, reverse bool, offset, count int, within func(*zskiplistNode) bool) []ZSetEntry {
+	next := func(n *zskiplistNode) *zskiplistNode {
+		if reverse {
+			return n.backward
+		}
+		return n.level[0].forward
+	}
+
+	for ; x != nil && offset > 0; offset-- {
+		x = next(x)
+	}
+
+	var entries []ZSetEntry
+	for ; x != nil && count != 0 && within(x); x = next(x) {
+		entries = append(entries, ZSetEntry{x.member, x.score})
+		count--
+	}
+
+	return entries
+}
+
+// Range returns the members between the start and stop ranks (both
+// inclusive). Negative ranks are counted from the end of the set.
+func (z *ZSet) Range(start, stop int, reverse bool) []ZSetEntry {
+	n := z.zsl.length
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= n {
+		return nil
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	rank := start + 1
+	if reverse {
+		rank = n - start
+	}
+
+	all := func(*zskiplistNode) bool { return true }
+	return collect(z.zsl.byRank(rank), reverse, 0, stop-start+1, all)
+}
+
+// RangeByScore returns the members with a score within the range. offset
+// members are skipped and up to count members are returned, or every member
+// if count is negative.
+func (z *ZSet) RangeByScore(r ScoreRange, reverse bool, offset, count int) []ZSetEntry {
+	if reverse {
+		x := z.zsl.last(func(n *zskiplistNode) bool { return r.lteMax(n.score) })
+		return collect(x, true, offset, count, func(n *zskiplistNode) bool { return r.gteMin(n.score) })
+	}
+
+	x := z.zsl.first(func(n *zskiplistNode) bool { return !r.gteMin(n.score) })
+	return collect(x, false, offset, count, func(n *zskiplistNode) bool { return r.lteMax(n.score) })
+}
+
+// RangeByLex returns the members within the lexicographical range. It is
+// only meaningful when every member has the same score.
+func (z *ZSet) RangeByLex(r LexRange, reverse bool, offset, count int) []ZSetEntry {
+	if reverse {
+		x := z.zsl.last(func(n *zskiplistNode) bool { return r.lteMax(n.member) })
+		return collect(x, true, offset, count, func(n *zskiplistNode) bool { return r.gteMin(n.member) })
+	}
+
+	x := z.zsl.first(func(n *zskiplistNode) bool { return !r.gteMin(n.member) })
+	return collect(x, false, offset, count, func(n *zskiplistNode) bool { return r.lteMax(n.member) })
+}
+
+// Entries returns every member ordered from the lowest to the highest score.
+func (z *ZSet) Entries() []ZSetEntry {
+	return z.Range(0, -1, false)
+}
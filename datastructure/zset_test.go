@@ -0,0 +1,230 @@
+package datastructure_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+)
+
+func newZSet(pairs ...any) *datastructure.ZSet {
+	zset := datastructure.NewZSet()
+	for i := 0; i < len(pairs); i += 2 {
+		zset.Add(pairs[i].(string), float64(pairs[i+1].(int)))
+	}
+	return zset
+}
+
+func zsetMembers(entries []datastructure.ZSetEntry) []string {
+	members := make([]string, len(entries))
+	for i, e := range entries {
+		members[i] = e.Member
+	}
+	return members
+}
+
+func Test_ZSetAddRemove(t *testing.T) {
+	zset := newZSet("a", 3, "b", 1, "c", 2)
+
+	if zset.Add("a", 0) {
+		t.Errorf("Add failed: expected an existing member")
+	}
+
+	if got := zsetMembers(zset.Entries()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Entries failed: got %v", got)
+	}
+
+	if score, ok := zset.Score("a"); !ok || score != 0 {
+		t.Errorf("Score failed: expected 0, got %v", score)
+	}
+
+	if !zset.Remove("b") || zset.Remove("b") {
+		t.Errorf("Remove failed")
+	}
+
+	if got := zsetMembers(zset.Entries()); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("Entries failed: got %v", got)
+	}
+
+	zset.Remove("a")
+	zset.Remove("c")
+	if zset.Len() != 0 || zset.Size() != 0 {
+		t.Errorf("expected an empty set, got len %d size %d", zset.Len(), zset.Size())
+	}
+}
+
+func Test_ZSetPop(t *testing.T) {
+	zset := newZSet("a", 3, "b", 1, "c", 2)
+
+	if e, ok := zset.Pop(false); !ok || e.Member != "b" || e.Score != 1 {
+		t.Errorf("Pop failed: expected b 1, got %v", e)
+	}
+
+	if e, ok := zset.Pop(true); !ok || e.Member != "a" || e.Score != 3 {
+		t.Errorf("Pop failed: expected a 3, got %v", e)
+	}
+
+	if e, ok := zset.Pop(true); !ok || e.Member != "c" {
+		t.Errorf("Pop failed: expected c, got %v", e)
+	}
+
+	if _, ok := zset.Pop(false); ok || zset.Len() != 0 {
+		t.Errorf("Pop failed: expected an empty set")
+	}
+}
+
+func Test_ZSetRank(t *testing.T) {
+	zset := datastructure.NewZSet()
+	for _, i := range rand.Perm(1000) {
+		zset.Add(fmt.Sprintf("m%04d", i), float64(i))
+	}
+
+	for _, i := range []int{0, 1, 500, 998, 999} {
+		member := fmt.Sprintf("m%04d", i)
+
+		if rank, ok := zset.Rank(member, false); !ok || rank != i {
+			t.Errorf("Rank failed: expected %d, got %d", i, rank)
+		}
+
+		if rank, ok := zset.Rank(member, true); !ok || rank != 999-i {
+			t.Errorf("Rank failed: expected %d, got %d", 999-i, rank)
+		}
+	}
+
+	if _, ok := zset.Rank("missing", false); ok {
+		t.Errorf("Rank failed: expected missing member")
+	}
+}
+
+func Test_ZSetRange(t *testing.T) {
+	zset := newZSet("a", 1, "b", 2, "c", 3, "d", 4)
+
+	tc := []struct {
+		name        string
+		start, stop int
+		reverse     bool
+		expected    []string
+	}{
+		{"all", 0, -1, false, []string{"a", "b", "c", "d"}},
+		{"middle", 1, 2, false, []string{"b", "c"}},
+		{"negative", -2, -1, false, []string{"c", "d"}},
+		{"out of range", 5, 10, false, nil},
+		{"stop too large", 2, 100, false, []string{"c", "d"}},
+		{"reverse", 0, 1, true, []string{"d", "c"}},
+		{"reverse all", 0, -1, true, []string{"d", "c", "b", "a"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := zsetMembers(zset.Range(tt.start, tt.stop, tt.reverse))
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_ZSetRangeByScore(t *testing.T) {
+	zset := newZSet("a", 1, "b", 2, "c", 2, "d", 3, "e", 5)
+	inf := math.Inf(1)
+
+	tc := []struct {
+		name          string
+		r             datastructure.ScoreRange
+		reverse       bool
+		offset, count int
+		expected      []string
+	}{
+		{"inclusive", datastructure.ScoreRange{Min: 2, Max: 3}, false, 0, -1, []string{"b", "c", "d"}},
+		{"exclusive", datastructure.ScoreRange{Min: 1, Max: 3, MinExclusive: true, MaxExclusive: true}, false, 0, -1, []string{"b", "c"}},
+		{"infinite", datastructure.ScoreRange{Min: -inf, Max: inf}, false, 0, -1, []string{"a", "b", "c", "d", "e"}},
+		{"limit", datastructure.ScoreRange{Min: -inf, Max: inf}, false, 1, 2, []string{"b", "c"}},
+		{"reverse", datastructure.ScoreRange{Min: 2, Max: 4}, true, 0, -1, []string{"d", "c", "b"}},
+		{"reverse limit", datastructure.ScoreRange{Min: -inf, Max: inf}, true, 1, 1, []string{"d"}},
+		{"empty", datastructure.ScoreRange{Min: 4, Max: 4}, false, 0, -1, nil},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := zsetMembers(zset.RangeByScore(tt.r, tt.reverse, tt.offset, tt.count))
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_ZSetRangeByLex(t *testing.T) {
+	zset := newZSet("a", 0, "b", 0, "c", 0, "d", 0)
+
+	tc := []struct {
+		name     string
+		r        datastructure.LexRange
+		reverse  bool
+		expected []string
+	}{
+		{"all", datastructure.LexRange{Min: datastructure.LexBound{Infinite: -1}, Max: datastructure.LexBound{Infinite: 1}}, false, []string{"a", "b", "c", "d"}},
+		{"inclusive", datastructure.LexRange{Min: datastructure.LexBound{Value: "b"}, Max: datastructure.LexBound{Value: "c"}}, false, []string{"b", "c"}},
+		{"exclusive", datastructure.LexRange{Min: datastructure.LexBound{Value: "a", Exclusive: true}, Max: datastructure.LexBound{Value: "c", Exclusive: true}}, false, []string{"b"}},
+		{"reverse", datastructure.LexRange{Min: datastructure.LexBound{Value: "b"}, Max: datastructure.LexBound{Infinite: 1}}, true, []string{"d", "c", "b"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			got := zsetMembers(zset.RangeByLex(tt.r, tt.reverse, 0, -1))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_ZSetRandomized(t *testing.T) {
+	zset := datastructure.NewZSet()
+	scores := make(map[string]float64)
+
+	for i := 0; i < 5000; i++ {
+		member := fmt.Sprintf("m%d", rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			zset.Remove(member)
+			delete(scores, member)
+			continue
+		}
+
+		score := float64(rand.Intn(100))
+		zset.Add(member, score)
+		scores[member] = score
+	}
+
+	expected := make([]datastructure.ZSetEntry, 0, len(scores))
+	for m, s := range scores {
+		expected = append(expected, datastructure.ZSetEntry{Member: m, Score: s})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score == expected[j].Score {
+			return expected[i].Member < expected[j].Member
+		}
+		return expected[i].Score < expected[j].Score
+	})
+
+	got := zset.Entries()
+	if len(got) != len(expected) || (len(got) > 0 && !reflect.DeepEqual(got, expected)) {
+		t.Fatalf("Entries failed: expected %d entries, got %d", len(expected), len(got))
+	}
+
+	for i, e := range expected {
+		if rank, _ := zset.Rank(e.Member, false); rank != i {
+			t.Fatalf("Rank failed: expected %d, got %d", i, rank)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// FsyncPolicy decides how often the append-only file is flushed to disk.
+type FsyncPolicy uint8
+
+const (
+	// FsyncAlways flushes the file after every appended command.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncEverySec flushes the file once every second in the background.
+	FsyncEverySec
+	// FsyncNo leaves flushing up to the operating system.
+	FsyncNo
+)
+
+var (
+	// ErrInvalidFsyncPolicy is returned when the fsync policy is unknown.
+	ErrInvalidFsyncPolicy = errors.New("invalid fsync policy")
+	// ErrRewriteInProgress is returned when a rewrite is requested while
+	// another one is still running.
+	ErrRewriteInProgress = errors.New("background append only file rewriting already in progress")
+	// ErrNoRewriteInProgress is returned when a rewrite is finished without
+	// being started.
+	ErrNoRewriteInProgress = errors.New("no append only file rewriting in progress")
+)
+
+// ParseFsyncPolicy parses the fsync policy from its config name.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySec, nil
+	case "no":
+		return FsyncNo, nil
+	}
+
+	return 0, ErrInvalidFsyncPolicy
+}
+
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncAlways:
+		return "always"
+	case FsyncEverySec:
+		return "everysec"
+	case FsyncNo:
+		return "no"
+	}
+	return "unknown"
+}
+
+// AOF is the append-only file, a log of every write command
+// executed by the server in the RESP format. After a rewrite, the file
+// starts with a snapshot of the dataset in the kvsDB format, followed
+// by the commands executed since then.
+type AOF struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+
+	policy FsyncPolicy
+	// unsynced is true if there is data written since the last fsync.
+	unsynced bool
+
+	// size is the current size of the file in bytes.
+	size int64
+	// baseSize is the size of the file right after the last rewrite.
+	baseSize int64
+
+	// rewriting is true while a background rewrite is running. Commands
+	// appended during the rewrite are also kept in rewriteBuf so they can be
+	// added to the end of the rewritten file.
+	rewriting  bool
+	rewriteBuf []byte
+
+	done chan struct{}
+}
+
+// OpenAOF opens the append-only file at the given path.
+func OpenAOF(path string, policy FsyncPolicy) (*AOF, error) {
+	p, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	aof := &AOF{
+		path:     p,
+		file:     file,
+		policy:   policy,
+		size:     info.Size(),
+		baseSize: info.Size(),
+		done:     make(chan struct{}),
+	}
+
+	if policy == FsyncEverySec {
+		go aof.syncEverySecond()
+	}
+
+	return aof, nil
+}
+
+// Append appends the given command to the file.
+func (a *AOF) Append(argv ...[]byte) error {
+	buf := encodeCommand(argv)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, buf...)
+	}
+
+	n, err := a.file.Write(buf)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if a.policy == FsyncAlways {
+		return a.file.Sync()
+	}
+
+	a.unsynced = true
+	return nil
+}
+
+// Load loads the snapshot at the start of the file into data, then reads
+// every command stored in the file and passes it to fn.
+// The commands of a transaction, logged between MULTI and EXEC, are only
+// passed to fn once the whole transaction has been read.
+// If the file ends with an incomplete command or transaction (e.g. the
+// server crashed in the middle of a write), the file is truncated to the
+// last complete command and the number of discarded bytes is returned.
+func (a *AOF) Load(data *datastructure.Map, fn func(argv [][]byte) error) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	cr := &countingReader{r: a.file}
+	br := bufio.NewReader(cr)
+	reader := protocol.NewReader(br)
+
+	if hasMagic(br) {
+		if _, err := DecodeSnapshot(br, data); err != nil {
+			return 0, err
+		}
+	}
+
+	valid := cr.n - int64(br.Buffered())
+	// pending are the commands read but not passed to fn yet, which are the
+	// commands of the transaction being read
+	var pending [][][]byte
+	inTransaction := false
+	for {
+		obj, err := reader.ReadObject()
+		if err != nil {
+			if err == io.EOF && cr.n-int64(br.Buffered()) == valid {
+				return 0, nil
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return 0, err
+		}
+
+		argv, ok := decodeCommand(obj)
+		if !ok {
+			return 0, protocol.ErrInvalidSyntax
+		}
+
+		switch {
+		case len(argv) == 1 && bytes.EqualFold(argv[0], []byte("multi")):
+			inTransaction = true
+			continue
+		case inTransaction && len(argv) == 1 && bytes.EqualFold(argv[0], []byte("exec")):
+			inTransaction = false
+		case inTransaction:
+			pending = append(pending, argv)
+			continue
+		default:
+			pending = append(pending, argv)
+		}
+
+		for _, argv := range pending {
+			if err := fn(argv); err != nil {
+				return 0, err
+			}
+		}
+		pending = nil
+
+		valid = cr.n - int64(br.Buffered())
+	}
+
+	// Truncated tail, drop the partial command.
+	truncated := a.size - valid
+	if err := a.file.Truncate(valid); err != nil {
+		return 0, err
+	}
+	a.size = valid
+	a.baseSize = valid
+
+	return truncated, nil
+}
+
+// Rewriting returns true if a background rewrite is running.
+func (a *AOF) Rewriting() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriting
+}
+
+// StartRewrite marks the beginning of a rewrite. From now on, every
+// appended command is also buffered until FinishRewrite is called.
+// It must be called at the same point in time the rewrite snapshot is taken.
+func (a *AOF) StartRewrite() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriting {
+		return ErrRewriteInProgress
+	}
+
+	a.rewriting = true
+	a.rewriteBuf = nil
+	return nil
+}
+
+// FinishRewrite writes the snapshot into a temporary file, appends the commands received since StartRewrite and atomically
+// replaces the current file with it.
+func (a *AOF) FinishRewrite(snapshot []byte) error {
+	tmpPath := a.path + ".rewrite.tmp"
+
+	err := a.finishRewrite(tmpPath, snapshot)
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+
+	return err
+}
+
+func (a *AOF) finishRewrite(tmpPath string, snapshot []byte) error {
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		a.abortRewrite()
+		return err
+	}
+
+	// Write the bulk of the data without holding the lock
+	if _, err := tmp.Write(snapshot); err != nil {
+		tmp.Close()
+		a.abortRewrite()
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.rewriting {
+		tmp.Close()
+		return ErrNoRewriteInProgress
+	}
+
+	a.rewriting = false
+	diff := a.rewriteBuf
+	a.rewriteBuf = nil
+
+	if _, err := tmp.Write(diff); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := os.Rename(tmpPath, a.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// Keep appending to the rewritten file
+	a.file.Close()
+	a.file = tmp
+	a.unsynced = false
+	a.size = int64(len(snapshot) + len(diff))
+	a.baseSize = a.size
+
+	return nil
+}
+
+func (a *AOF) abortRewrite() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewriting = false
+	a.rewriteBuf = nil
+}
+
+// Size returns the current size of the file in bytes.
+func (a *AOF) Size() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
+
+// BaseSize returns the size of the file right after the last rewrite.
+func (a *AOF) BaseSize() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.baseSize
+}
+
+// Sync flushes the file to disk.
+func (a *AOF) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.unsynced = false
+	return a.file.Sync()
+}
+
+// Close flushes and closes the file.
+func (a *AOF) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		// Already closed
+		return nil
+	default:
+		close(a.done)
+	}
+
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+
+	return a.file.Close()
+}
+
+// syncEverySecond flushes the file once every second if there
+// is any unsynced data.
+func (a *AOF) syncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			if a.unsynced {
+				a.file.Sync()
+				a.unsynced = false
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// EncodeCommand encodes the given command into the RESP format used
+// by the append-only file.
+func EncodeCommand(argv ...[]byte) []byte {
+	return encodeCommand(argv)
+}
+
+func encodeCommand(argv [][]byte) []byte {
+	args := make([][]byte, len(argv))
+	for i, arg := range argv {
+		args[i] = protocol.MakeBulkString(string(arg))
+	}
+
+	return protocol.MakeArray(args...)
+}
+
+func decodeCommand(obj any) ([][]byte, bool) {
+	rawArgv, ok := obj.([]any)
+	if !ok || len(rawArgv) == 0 {
+		return nil, false
+	}
+
+	argv := make([][]byte, len(rawArgv))
+	for i, v := range rawArgv {
+		arg, ok := v.([]byte)
+		if !ok {
+			return nil, false
+		}
+		argv[i] = arg
+	}
+
+	return argv, true
+}
+
+// countingReader counts the amount of bytes read from the
+// underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,198 @@
+package disk_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/disk"
+)
+
+func loadAll(t *testing.T, aof *disk.AOF) ([][][]byte, int64) {
+	var cmds [][][]byte
+	truncated, err := aof.Load(datastructure.NewMap(), func(argv [][]byte) error {
+		cmds = append(cmds, argv)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	return cmds, truncated
+}
+
+func Test_AOFAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	aof, err := disk.OpenAOF(path, disk.FsyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	exp := [][][]byte{
+		{[]byte("set"), []byte("key"), []byte("value")},
+		{[]byte("del"), []byte("key")},
+	}
+
+	for _, argv := range exp {
+		if err := aof.Append(argv...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmds, truncated := loadAll(t, aof)
+	if truncated != 0 {
+		t.Errorf("expected no truncated bytes, got %d", truncated)
+	}
+
+	if !reflect.DeepEqual(cmds, exp) {
+		t.Errorf("expected %q, got %q", exp, cmds)
+	}
+}
+
+func Test_AOFLoadTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	complete := disk.EncodeCommand([]byte("set"), []byte("key"), []byte("value"))
+	partial := []byte("*3\r\n$3\r\nset\r\n$1\r\nk")
+	if err := os.WriteFile(path, append(complete, partial...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	aof, err := disk.OpenAOF(path, disk.FsyncNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	cmds, truncated := loadAll(t, aof)
+	if len(cmds) != 1 {
+		t.Errorf("expected 1 command, got %d", len(cmds))
+	}
+
+	if truncated != int64(len(partial)) {
+		t.Errorf("expected %d truncated bytes, got %d", len(partial), truncated)
+	}
+
+	if aof.Size() != int64(len(complete)) {
+		t.Errorf("expected size %d, got %d", len(complete), aof.Size())
+	}
+}
+
+func Test_AOFLoadTransaction(t *testing.T) {
+	before := disk.EncodeCommand([]byte("set"), []byte("a"), []byte("1"))
+	transaction := append(disk.EncodeCommand([]byte("multi")), disk.EncodeCommand([]byte("set"), []byte("b"), []byte("2"))...)
+	transaction = append(transaction, disk.EncodeCommand([]byte("incr"), []byte("b"))...)
+	exec := disk.EncodeCommand([]byte("exec"))
+
+	tc := []struct {
+		name      string
+		data      []byte
+		cmds      int
+		truncated int
+	}{
+		{"complete", concat(before, transaction, exec), 3, 0},
+		{"without exec", concat(before, transaction), 1, len(transaction)},
+		{"partial exec", concat(before, transaction, exec[:len(exec)-2]), 1, len(transaction) + len(exec) - 2},
+		{"partial command", concat(before, transaction[:len(transaction)-3]), 1, len(transaction) - 3},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "appendonly.aof")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			aof, err := disk.OpenAOF(path, disk.FsyncNo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer aof.Close()
+
+			cmds, truncated := loadAll(t, aof)
+			if len(cmds) != tt.cmds {
+				t.Errorf("expected %d commands, got %q", tt.cmds, cmds)
+			}
+
+			for _, argv := range cmds {
+				if name := string(argv[0]); name == "multi" || name == "exec" {
+					t.Errorf("expected %s not to be replayed", name)
+				}
+			}
+
+			if truncated != int64(tt.truncated) {
+				t.Errorf("expected %d truncated bytes, got %d", tt.truncated, truncated)
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func Test_AOFRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	aof, err := disk.OpenAOF(path, disk.FsyncEverySec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	for i := 0; i < 10; i++ {
+		aof.Append([]byte("set"), []byte("key"), []byte("value"))
+	}
+
+	if err := aof.StartRewrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aof.StartRewrite(); err != disk.ErrRewriteInProgress {
+		t.Errorf("expected %v, got %v", disk.ErrRewriteInProgress, err)
+	}
+
+	// Appended while the rewrite is running
+	aof.Append([]byte("del"), []byte("key"))
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("key", []byte("value"), 0))
+
+	snapshot, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aof.FinishRewrite(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := datastructure.NewMap()
+	var cmds [][][]byte
+	if _, err := aof.Load(loaded, func(argv [][]byte) error {
+		cmds = append(cmds, argv)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := loaded.Get("key"); !ok || string(v.Data.([]byte)) != "value" {
+		t.Errorf("expected the snapshot to be loaded")
+	}
+
+	exp := [][][]byte{
+		{[]byte("del"), []byte("key")},
+	}
+
+	if !reflect.DeepEqual(cmds, exp) {
+		t.Errorf("expected %q, got %q", exp, cmds)
+	}
+}
@@ -0,0 +1,904 @@
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/build"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// The kvsDB file format
+//
+//	+-------+---------+---------+-----+---------+-----+
+//	| magic | version | section | ... | section | EOF |
+//	+-------+---------+---------+-----+---------+-----+
+//
+//	magic:   the "KVSDB" string (5 bytes)
+//	version: the format version (uint16, big endian)
+//	section: type (1 byte) | length (uint32, big endian) | payload | CRC-32 (uint32, big endian)
+//	EOF:     0xFF | CRC-32 of every byte before it (uint32, big endian)
+//
+// The CRC-32 (IEEE) of a section covers its type, length and payload.
+//
+// Sections
+//
+//	0x01 metadata: msgpack map with the kvstore version and the creation time
+//	0x02 keys:     msgpack stream of up to keysPerSection records
+//
+// Each record is encoded as:
+//
+//	value type (uint8) | key | flags | expires at | created at | value
+//
+// Versions
+//
+//	0: headerless msgpack stream of datastructure.Item (legacy)
+//	1: the format described above
+//
+// Values
+//
+//	string: msgpack string, integers are stored in their decimal form
+//	list:   msgpack array of the elements from head to tail
+//	hash:   msgpack map of the fields to their values
+//	set:    msgpack array of the members
+//	zset:   msgpack array length followed by every member and its score
+//	stream: last ID | entries | consumer groups, where
+//	        an ID is its milliseconds and sequence number,
+//	        entries is the array length followed by every ID and array of fields,
+//	        consumer groups is the array length followed by every group name,
+//	        last delivered ID, consumers (array length followed by every name
+//	        and seen time) and pending entries (array length followed by every
+//	        ID, consumer name, delivery time and delivery count)
+//	hyperloglog: msgpack binary of the registers (see HyperLogLog.Bytes)
+//	json:   the document as msgpack values, objects being maps keeping the
+//	        order of their keys
+//	bloomfilter, cuckoofilter, countminsketch, topk: msgpack binary of the
+//	        probabilistic structure (see their Bytes method)
+//	timeseries: msgpack binary of the options, compaction rules and
+//	        compressed chunks (see TimeSeries.Bytes)
+const (
+	// FormatVersion is the current version of the kvsDB file format.
+	FormatVersion uint16 = 1
+
+	sectionMetadata byte = 0x01
+	sectionKeys     byte = 0x02
+	sectionEOF      byte = 0xFF
+
+	// keysPerSection is the maximum number of records in a keys section.
+	keysPerSection = 1024
+)
+
+// Value types of a record
+const (
+	valueString uint8 = iota
+	valueList
+	valueHash
+	valueSet
+	valueZSet
+	valueStream
+	valueHyperLogLog
+	valueJSON
+	valueBloomFilter
+	valueCuckooFilter
+	valueCountMinSketch
+	valueTopK
+	valueTimeSeries
+)
+
+var magic = []byte("KVSDB")
+
+var (
+	// ErrUnsupportedVersion is returned when the file was written by a newer
+	// version of the format.
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	// ErrChecksumMismatch is returned when the checksum of a section or of
+	// the whole file does not match its content.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrUnexpectedEOF is returned when the file ends before the EOF marker.
+	ErrUnexpectedEOF = errors.New("unexpected end of file, missing EOF marker")
+	// ErrUnknownSection is returned when a section has an unknown type.
+	ErrUnknownSection = errors.New("unknown section type")
+	// ErrUnknownValueType is returned when a record has an unknown value type.
+	ErrUnknownValueType = errors.New("unknown value type")
+)
+
+// CorruptedError is returned when the file cannot be loaded because
+// it is corrupted.
+type CorruptedError struct {
+	// Offset is the position in the file where the corruption was detected.
+	Offset int64
+	// Section is the type of the section being read.
+	Section byte
+	// Err is the reason of the corruption.
+	Err error
+}
+
+func (e *CorruptedError) Error() string {
+	if e.Section == 0 {
+		return fmt.Sprintf("corrupted kvsdb file at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("corrupted kvsdb file in section 0x%02x at offset %d: %v", e.Section, e.Offset, e.Err)
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeSnapshot encodes the given map into the kvsDB format.
+func EncodeSnapshot(data *datastructure.Map) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	binary.Write(&buf, binary.BigEndian, FormatVersion)
+
+	metadata, err := msgpack.Marshal(map[string]any{
+		"kvstore-version": build.Version,
+		"ctime":           time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	writeSection(&buf, sectionMetadata, metadata)
+
+	var section bytes.Buffer
+	encoder := msgpack.NewEncoder(&section)
+	n := 0
+	for _, item := range data.List() {
+		if item.HasFlag(datastructure.ItemFlagExpireXX) && time.Now().After(item.ExpiresAt) {
+			continue
+		}
+
+		if err := encodeRecord(encoder, item); err != nil {
+			return nil, err
+		}
+
+		n++
+		if n == keysPerSection {
+			writeSection(&buf, sectionKeys, section.Bytes())
+			section.Reset()
+			n = 0
+		}
+	}
+
+	if n > 0 {
+		writeSection(&buf, sectionKeys, section.Bytes())
+	}
+
+	buf.WriteByte(sectionEOF)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	return buf.Bytes(), nil
+}
+
+func writeSection(buf *bytes.Buffer, typ byte, payload []byte) {
+	start := buf.Len()
+	buf.WriteByte(typ)
+	binary.Write(buf, binary.BigEndian, uint32(len(payload)))
+	buf.Write(payload)
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()[start:]))
+}
+
+func encodeRecord(encoder *msgpack.Encoder, item *datastructure.Item) error {
+	var typ uint8
+
+	switch v := item.Data.(type) {
+	case string, []byte, int64:
+		typ = valueString
+	case *datastructure.List:
+		typ = valueList
+	case *datastructure.Hash:
+		typ = valueHash
+	case *datastructure.Set:
+		typ = valueSet
+	case *datastructure.ZSet:
+		typ = valueZSet
+	case *datastructure.Stream:
+		typ = valueStream
+	case *datastructure.HyperLogLog:
+		typ = valueHyperLogLog
+	case *datastructure.JSON:
+		typ = valueJSON
+	case *datastructure.BloomFilter:
+		typ = valueBloomFilter
+	case *datastructure.CuckooFilter:
+		typ = valueCuckooFilter
+	case *datastructure.CountMinSketch:
+		typ = valueCountMinSketch
+	case *datastructure.TopK:
+		typ = valueTopK
+	case *datastructure.TimeSeries:
+		typ = valueTimeSeries
+	default:
+		return fmt.Errorf("%w: %T", ErrUnknownValueType, v)
+	}
+
+	if err := encoder.EncodeMulti(
+		typ,
+		item.Key,
+		uint32(item.Flag),
+		item.ExpiresAt.UnixNano(),
+		item.CreatedAt.UnixNano(),
+	); err != nil {
+		return err
+	}
+
+	switch v := item.Data.(type) {
+	case string:
+		return encoder.EncodeString(v)
+	case []byte:
+		return encoder.EncodeString(string(v))
+	case int64:
+		return encoder.EncodeString(strconv.FormatInt(v, 10))
+	case *datastructure.List:
+		return encodeList(encoder, v)
+	case *datastructure.Hash:
+		return encodeHash(encoder, v)
+	case *datastructure.Set:
+		return encodeSet(encoder, v)
+	case *datastructure.ZSet:
+		return encodeZSet(encoder, v)
+	case *datastructure.Stream:
+		return encodeStream(encoder, v)
+	case *datastructure.HyperLogLog:
+		return encoder.EncodeBytes(v.Bytes())
+	case *datastructure.JSON:
+		return encodeJSON(encoder, v.Root)
+	case *datastructure.BloomFilter:
+		return encoder.EncodeBytes(v.Bytes())
+	case *datastructure.CuckooFilter:
+		return encoder.EncodeBytes(v.Bytes())
+	case *datastructure.CountMinSketch:
+		return encoder.EncodeBytes(v.Bytes())
+	case *datastructure.TopK:
+		return encoder.EncodeBytes(v.Bytes())
+	case *datastructure.TimeSeries:
+		return encoder.EncodeBytes(v.Bytes())
+	}
+
+	return nil
+}
+
+func encodeList(encoder *msgpack.Encoder, list *datastructure.List) error {
+	if err := encoder.EncodeArrayLen(list.Len()); err != nil {
+		return err
+	}
+
+	for _, v := range list.Values() {
+		if err := encoder.EncodeBytes(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeHash(encoder *msgpack.Encoder, hash *datastructure.Hash) error {
+	if err := encoder.EncodeMapLen(hash.Len()); err != nil {
+		return err
+	}
+
+	var err error
+	hash.Range(func(field string, value []byte) bool {
+		if err = encoder.EncodeString(field); err != nil {
+			return false
+		}
+		err = encoder.EncodeBytes(value)
+		return err == nil
+	})
+
+	return err
+}
+
+func encodeSet(encoder *msgpack.Encoder, set *datastructure.Set) error {
+	members := set.Members()
+	if err := encoder.EncodeArrayLen(len(members)); err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if err := encoder.EncodeString(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeZSet(encoder *msgpack.Encoder, zset *datastructure.ZSet) error {
+	entries := zset.Entries()
+	if err := encoder.EncodeArrayLen(len(entries)); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := encoder.EncodeString(e.Member); err != nil {
+			return err
+		}
+
+		if err := encoder.EncodeFloat64(e.Score); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeStream(encoder *msgpack.Encoder, stream *datastructure.Stream) error {
+	lastID := stream.LastID()
+	if err := encoder.EncodeMulti(lastID.Ms, lastID.Seq); err != nil {
+		return err
+	}
+
+	entries := stream.Range(datastructure.MinStreamID, datastructure.MaxStreamID, -1, false)
+	if err := encoder.EncodeArrayLen(len(entries)); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := encoder.EncodeMulti(e.ID.Ms, e.ID.Seq); err != nil {
+			return err
+		}
+
+		if err := encoder.EncodeArrayLen(len(e.Fields)); err != nil {
+			return err
+		}
+
+		for _, f := range e.Fields {
+			if err := encoder.EncodeBytes(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	groups := stream.Groups()
+	if err := encoder.EncodeArrayLen(len(groups)); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		if err := encoder.EncodeMulti(g.Name, g.LastID.Ms, g.LastID.Seq); err != nil {
+			return err
+		}
+
+		consumers := g.Consumers()
+		if err := encoder.EncodeArrayLen(len(consumers)); err != nil {
+			return err
+		}
+
+		for _, c := range consumers {
+			if err := encoder.EncodeMulti(c.Name, c.SeenTime.UnixNano()); err != nil {
+				return err
+			}
+		}
+
+		pending := g.Pending(datastructure.MinStreamID, datastructure.MaxStreamID, -1)
+		if err := encoder.EncodeArrayLen(len(pending)); err != nil {
+			return err
+		}
+
+		for _, p := range pending {
+			if err := encoder.EncodeMulti(
+				p.ID.Ms,
+				p.ID.Seq,
+				p.Consumer.Name,
+				p.DeliveryTime.UnixNano(),
+				p.DeliveryCount,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func decodeRecord(decoder *msgpack.Decoder) (*datastructure.Item, error) {
+	var (
+		typ       uint8
+		key       string
+		flag      uint32
+		expiresAt int64
+		createdAt int64
+	)
+
+	if err := decoder.DecodeMulti(&typ, &key, &flag, &expiresAt, &createdAt); err != nil {
+		return nil, err
+	}
+
+	item := &datastructure.Item{
+		Key:       key,
+		Flag:      datastructure.ItemFlag(flag),
+		ExpiresAt: time.Unix(0, expiresAt),
+		CreatedAt: time.Unix(0, createdAt),
+	}
+
+	var err error
+	switch typ {
+	case valueString:
+		item.Data, err = decoder.DecodeBytes()
+	case valueList:
+		item.Data, err = decodeList(decoder)
+	case valueHash:
+		item.Data, err = decodeHash(decoder)
+	case valueSet:
+		item.Data, err = decodeSet(decoder)
+	case valueZSet:
+		item.Data, err = decodeZSet(decoder)
+	case valueStream:
+		item.Data, err = decodeStream(decoder)
+	case valueHyperLogLog:
+		item.Data, err = decodeHyperLogLog(decoder)
+	case valueJSON:
+		var root any
+		if root, err = decodeJSON(decoder); err == nil {
+			item.Data = datastructure.NewJSON(root)
+		}
+	case valueBloomFilter:
+		item.Data, err = decodeBytesValue(decoder, datastructure.NewBloomFilterFromBytes)
+	case valueCuckooFilter:
+		item.Data, err = decodeBytesValue(decoder, datastructure.NewCuckooFilterFromBytes)
+	case valueCountMinSketch:
+		item.Data, err = decodeBytesValue(decoder, datastructure.NewCountMinSketchFromBytes)
+	case valueTopK:
+		item.Data, err = decodeBytesValue(decoder, datastructure.NewTopKFromBytes)
+	case valueTimeSeries:
+		item.Data, err = decodeBytesValue(decoder, datastructure.NewTimeSeriesFromBytes)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownValueType, typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func decodeList(decoder *msgpack.Decoder) (*datastructure.List, error) {
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	list := datastructure.NewList()
+	for i := 0; i < n; i++ {
+		v, err := decoder.DecodeBytes()
+		if err != nil {
+			return nil, err
+		}
+		list.PushBack(v)
+	}
+
+	return list, nil
+}
+
+// hasMagic returns true if the reader starts with the kvsDB magic string.
+func hasMagic(br *bufio.Reader) bool {
+	b, err := br.Peek(len(magic))
+	return err == nil && bytes.Equal(b, magic)
+}
+
+// DecodeSnapshot decodes a kvsDB snapshot from the reader into data. The
+// reader is consumed up to the end of the snapshot. Snapshots written in the
+// legacy headerless format are migrated on the fly, and the returned version
+// tells the caller which version the data was read from.
+func DecodeSnapshot(br *bufio.Reader, data *datastructure.Map) (uint16, error) {
+	if !hasMagic(br) {
+		return 0, decodeLegacySnapshot(br, data)
+	}
+
+	d := &snapshotDecoder{br: br, crc: crc32.NewIEEE()}
+	return d.decode(data)
+}
+
+// decodeLegacySnapshot decodes the version 0 format.
+func decodeLegacySnapshot(r io.Reader, data *datastructure.Map) error {
+	decoder := msgpack.NewDecoder(r)
+	for {
+		var item datastructure.Item
+		if err := decoder.Decode(&item); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return &CorruptedError{Err: err}
+		}
+		data.Store(&item)
+	}
+}
+
+// snapshotDecoder reads a snapshot while keeping track of the offset
+// and the checksum of the whole file.
+type snapshotDecoder struct {
+	br     *bufio.Reader
+	crc    hash.Hash32
+	offset int64
+}
+
+// read reads exactly len(p) bytes.
+func (d *snapshotDecoder) read(p []byte) error {
+	n, err := io.ReadFull(d.br, p)
+	d.crc.Write(p[:n])
+	d.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *snapshotDecoder) corrupted(section byte, err error) error {
+	return &CorruptedError{Offset: d.offset, Section: section, Err: err}
+}
+
+func (d *snapshotDecoder) decode(data *datastructure.Map) (uint16, error) {
+	header := make([]byte, len(magic)+2)
+	if err := d.read(header); err != nil {
+		return 0, d.corrupted(0, err)
+	}
+
+	version := binary.BigEndian.Uint16(header[len(magic):])
+	if version > FormatVersion {
+		return version, d.corrupted(0, fmt.Errorf("%w %d", ErrUnsupportedVersion, version))
+	}
+
+	for {
+		start := d.offset
+
+		var typ [1]byte
+		if err := d.read(typ[:]); err != nil {
+			return version, d.corrupted(0, err)
+		}
+
+		if typ[0] == sectionEOF {
+			expected := d.crc.Sum32()
+
+			var sum [4]byte
+			if err := d.read(sum[:]); err != nil {
+				return version, d.corrupted(sectionEOF, err)
+			}
+
+			if binary.BigEndian.Uint32(sum[:]) != expected {
+				return version, &CorruptedError{Offset: start, Section: sectionEOF, Err: ErrChecksumMismatch}
+			}
+
+			return version, nil
+		}
+
+		var length [4]byte
+		if err := d.read(length[:]); err != nil {
+			return version, d.corrupted(typ[0], err)
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if err := d.read(payload); err != nil {
+			return version, d.corrupted(typ[0], err)
+		}
+
+		var sum [4]byte
+		if err := d.read(sum[:]); err != nil {
+			return version, d.corrupted(typ[0], err)
+		}
+
+		crc := crc32.NewIEEE()
+		crc.Write(typ[:])
+		crc.Write(length[:])
+		crc.Write(payload)
+		if binary.BigEndian.Uint32(sum[:]) != crc.Sum32() {
+			return version, &CorruptedError{Offset: start, Section: typ[0], Err: ErrChecksumMismatch}
+		}
+
+		switch typ[0] {
+		case sectionMetadata:
+			// Informational only
+		case sectionKeys:
+			if err := decodeKeysSection(payload, data); err != nil {
+				return version, &CorruptedError{Offset: start, Section: typ[0], Err: err}
+			}
+		default:
+			return version, &CorruptedError{Offset: start, Section: typ[0], Err: ErrUnknownSection}
+		}
+	}
+}
+
+func decodeKeysSection(payload []byte, data *datastructure.Map) error {
+	r := bytes.NewReader(payload)
+	decoder := msgpack.NewDecoder(r)
+	for r.Len() > 0 {
+		item, err := decodeRecord(decoder)
+		if err != nil {
+			return err
+		}
+		data.Store(item)
+	}
+	return nil
+}
+
+func decodeHash(decoder *msgpack.Decoder) (*datastructure.Hash, error) {
+	n, err := decoder.DecodeMapLen()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := datastructure.NewHash()
+	for i := 0; i < n; i++ {
+		field, err := decoder.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decoder.DecodeBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Set(field, value)
+	}
+
+	return hash, nil
+}
+
+func decodeSet(decoder *msgpack.Decoder) (*datastructure.Set, error) {
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	set := datastructure.NewSet()
+	for i := 0; i < n; i++ {
+		member, err := decoder.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		set.Add(member)
+	}
+
+	return set, nil
+}
+
+func decodeZSet(decoder *msgpack.Decoder) (*datastructure.ZSet, error) {
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	zset := datastructure.NewZSet()
+	for i := 0; i < n; i++ {
+		member, err := decoder.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		score, err := decoder.DecodeFloat64()
+		if err != nil {
+			return nil, err
+		}
+
+		zset.Add(member, score)
+	}
+
+	return zset, nil
+}
+
+func decodeStream(decoder *msgpack.Decoder) (*datastructure.Stream, error) {
+	var lastID datastructure.StreamID
+	if err := decoder.DecodeMulti(&lastID.Ms, &lastID.Seq); err != nil {
+		return nil, err
+	}
+
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	stream := datastructure.NewStream()
+	for i := 0; i < n; i++ {
+		var id datastructure.StreamID
+		if err := decoder.DecodeMulti(&id.Ms, &id.Seq); err != nil {
+			return nil, err
+		}
+
+		nFields, err := decoder.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make([][]byte, nFields)
+		for j := range fields {
+			if fields[j], err = decoder.DecodeBytes(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := stream.Add(id, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	stream.SetLastID(lastID)
+
+	nGroups, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < nGroups; i++ {
+		var (
+			name   string
+			lastID datastructure.StreamID
+		)
+
+		if err := decoder.DecodeMulti(&name, &lastID.Ms, &lastID.Seq); err != nil {
+			return nil, err
+		}
+
+		group, _ := stream.CreateGroup(name, lastID)
+
+		nConsumers, err := decoder.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < nConsumers; j++ {
+			var (
+				name     string
+				seenTime int64
+			)
+
+			if err := decoder.DecodeMulti(&name, &seenTime); err != nil {
+				return nil, err
+			}
+
+			group.CreateConsumer(name, time.Unix(0, seenTime))
+		}
+
+		nPending, err := decoder.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < nPending; j++ {
+			var (
+				id            datastructure.StreamID
+				consumer      string
+				deliveryTime  int64
+				deliveryCount int64
+			)
+
+			if err := decoder.DecodeMulti(&id.Ms, &id.Seq, &consumer, &deliveryTime, &deliveryCount); err != nil {
+				return nil, err
+			}
+
+			c, _ := group.CreateConsumer(consumer, time.Unix(0, deliveryTime))
+			group.Claim(id, c, time.Unix(0, deliveryTime), deliveryCount)
+		}
+	}
+
+	return stream, nil
+}
+
+func decodeHyperLogLog(decoder *msgpack.Decoder) (*datastructure.HyperLogLog, error) {
+	b, err := decoder.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return datastructure.NewHyperLogLogFromBytes(b)
+}
+
+// decodeBytesValue decodes a value stored as the msgpack binary of its
+// Bytes method.
+func decodeBytesValue[T any](decoder *msgpack.Decoder, fromBytes func([]byte) (T, error)) (any, error) {
+	b, err := decoder.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return fromBytes(b)
+}
+
+func encodeJSON(encoder *msgpack.Encoder, v any) error {
+	switch v := v.(type) {
+	case nil:
+		return encoder.EncodeNil()
+	case bool:
+		return encoder.EncodeBool(v)
+	case int64:
+		return encoder.EncodeInt(v)
+	case float64:
+		return encoder.EncodeFloat64(v)
+	case string:
+		return encoder.EncodeString(v)
+	case *datastructure.JSONArray:
+		if err := encoder.EncodeArrayLen(len(v.Values)); err != nil {
+			return err
+		}
+
+		for _, e := range v.Values {
+			if err := encodeJSON(encoder, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *datastructure.JSONObject:
+		if err := encoder.EncodeMapLen(v.Len()); err != nil {
+			return err
+		}
+
+		for _, k := range v.Keys() {
+			value, _ := v.Get(k)
+			if err := encoder.EncodeString(k); err != nil {
+				return err
+			}
+			if err := encodeJSON(encoder, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %T", ErrUnknownValueType, v)
+}
+
+func decodeJSON(decoder *msgpack.Decoder) (any, error) {
+	code, err := decoder.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code == msgpcode.Nil:
+		return nil, decoder.DecodeNil()
+	case code == msgpcode.False || code == msgpcode.True:
+		return decoder.DecodeBool()
+	case code == msgpcode.Float || code == msgpcode.Double:
+		return decoder.DecodeFloat64()
+	case msgpcode.IsString(code):
+		return decoder.DecodeString()
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		n, err := decoder.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+
+		arr := &datastructure.JSONArray{Values: make([]any, n)}
+		for i := range arr.Values {
+			if arr.Values[i], err = decodeJSON(decoder); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		n, err := decoder.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+
+		obj := datastructure.NewJSONObject()
+		for i := 0; i < n; i++ {
+			key, err := decoder.DecodeString()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, value)
+		}
+		return obj, nil
+	}
+
+	// Any other code is an integer
+	return decoder.DecodeInt64()
+}
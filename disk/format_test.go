@@ -0,0 +1,515 @@
+package disk_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/disk"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func testSnapshot(t *testing.T, n int) []byte {
+	hmap := datastructure.NewMap()
+	for i := 0; i < n; i++ {
+		hmap.Store(datastructure.NewItem("key"+strconv.Itoa(i), "value"+strconv.Itoa(i), 0))
+	}
+	hmap.Store(datastructure.NewItem("expiring", "value", time.Hour))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func decode(b []byte) (*datastructure.Map, error) {
+	hmap := datastructure.NewMap()
+	_, err := disk.DecodeSnapshot(bufio.NewReader(bytes.NewReader(b)), hmap)
+	return hmap, err
+}
+
+func Test_SnapshotRoundTrip(t *testing.T) {
+	hmap, err := decode(testSnapshot(t, 3000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hmap.Len() != 3001 {
+		t.Errorf("expected 3001 keys, got %d", hmap.Len())
+	}
+
+	v, ok := hmap.Get("key42")
+	if !ok || string(v.Data.([]byte)) != "value42" {
+		t.Errorf("expected key42 to be value42")
+	}
+
+	v, ok = hmap.Get("expiring")
+	if !ok || !v.HasFlag(datastructure.ItemFlagExpireXX) || time.Until(v.ExpiresAt) < 59*time.Minute {
+		t.Errorf("expected the expire time to be kept")
+	}
+}
+
+func Test_SnapshotInteger(t *testing.T) {
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("counter", int64(-42), 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err = decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := hmap.Get("counter")
+	if !ok || string(v.Data.([]byte)) != "-42" {
+		t.Errorf("expected counter to be -42, got %v", v)
+	}
+}
+
+func Test_SnapshotHyperLogLog(t *testing.T) {
+	sparse, dense := datastructure.NewHyperLogLog(), datastructure.NewHyperLogLog()
+	sparse.Add([]byte("a"))
+	for i := 0; i < 5000; i++ {
+		dense.Add([]byte(strconv.Itoa(i)))
+	}
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("sparse", sparse, 0))
+	hmap.Store(datastructure.NewItem("dense", dense, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err = decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []*datastructure.HyperLogLog{sparse, dense} {
+		key := h.Encoding().String()
+		v, ok := hmap.Get(key)
+		if !ok {
+			t.Fatalf("expected %s to exist", key)
+		}
+
+		got := v.Data.(*datastructure.HyperLogLog)
+		if got.Encoding() != h.Encoding() || got.Count() != h.Count() {
+			t.Errorf("expected %s to count %d, got %d", key, h.Count(), got.Count())
+		}
+	}
+}
+
+func Test_SnapshotJSON(t *testing.T) {
+	doc := `{"z":1,"a":[true,null,1.5,-300,"x"],"m":{"k":{}}}`
+	root, err := datastructure.ParseJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("doc", datastructure.NewJSON(root), 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err = decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := hmap.Get("doc")
+	if !ok {
+		t.Fatal("expected doc to exist")
+	}
+
+	got := datastructure.MarshalJSON(v.Data.(*datastructure.JSON).Root, datastructure.JSONFormat{})
+	if string(got) != doc {
+		t.Errorf("expected %s, got %s", doc, got)
+	}
+}
+
+func Test_SnapshotProbabilistic(t *testing.T) {
+	bloom := datastructure.NewBloomFilter(0.01, 100, 2)
+	cuckoo := datastructure.NewCuckooFilter(100, 2, 20, 1)
+	cms := datastructure.NewCountMinSketch(100, 5)
+	topk := datastructure.NewTopK(3, 8, 7, 0.9)
+	for i := 0; i < 300; i++ {
+		item := []byte(strconv.Itoa(i % 50))
+		bloom.Add(item)
+		cuckoo.Add(item)
+		cms.IncrBy(item, 1)
+		topk.Add(item)
+	}
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("bloom", bloom, 0))
+	hmap.Store(datastructure.NewItem("cuckoo", cuckoo, 0))
+	hmap.Store(datastructure.NewItem("cms", cms, 0))
+	hmap.Store(datastructure.NewItem("topk", topk, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err = decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		key   string
+		bytes func(any) []byte
+	}{
+		{"bloom", func(v any) []byte { return v.(*datastructure.BloomFilter).Bytes() }},
+		{"cuckoo", func(v any) []byte { return v.(*datastructure.CuckooFilter).Bytes() }},
+		{"cms", func(v any) []byte { return v.(*datastructure.CountMinSketch).Bytes() }},
+		{"topk", func(v any) []byte { return v.(*datastructure.TopK).Bytes() }},
+	}
+
+	expected := map[string]any{"bloom": bloom, "cuckoo": cuckoo, "cms": cms, "topk": topk}
+	for _, tt := range tc {
+		v, ok := hmap.Get(tt.key)
+		if !ok {
+			t.Fatalf("expected %s to exist", tt.key)
+		}
+
+		if !bytes.Equal(tt.bytes(v.Data), tt.bytes(expected[tt.key])) {
+			t.Errorf("expected %s to be restored", tt.key)
+		}
+	}
+}
+
+func Test_SnapshotTimeSeries(t *testing.T) {
+	ts := datastructure.NewTimeSeries()
+	ts.Labels = []datastructure.TimeSeriesLabel{{Name: "sensor", Value: "1"}}
+	for i := int64(0); i < 1000; i++ {
+		ts.Add(datastructure.TimeSeriesSample{Timestamp: i * 1000, Value: float64(i) / 4}, datastructure.TimeSeriesDuplicateBlock)
+	}
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("ts", ts, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err = decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := hmap.Get("ts")
+	if !ok {
+		t.Fatal("expected ts to exist")
+	}
+
+	got := v.Data.(*datastructure.TimeSeries)
+	if !reflect.DeepEqual(got.Range(0, math.MaxInt64, 0), ts.Range(0, math.MaxInt64, 0)) || !reflect.DeepEqual(got.Labels, ts.Labels) {
+		t.Errorf("expected the time series to be restored")
+	}
+}
+
+func Test_SnapshotCorrupted(t *testing.T) {
+	b := testSnapshot(t, 10)
+
+	tc := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"Flipped byte", func() []byte {
+			c := append([]byte{}, b...)
+			c[len(c)/2] ^= 0xFF
+			return c
+		}(), disk.ErrChecksumMismatch},
+		{"Truncated", b[:len(b)-10], disk.ErrUnexpectedEOF},
+		{"Missing EOF", b[:len(b)-5], disk.ErrUnexpectedEOF},
+		{"Bad file checksum", func() []byte {
+			c := append([]byte{}, b...)
+			c[len(c)-1] ^= 0xFF
+			return c
+		}(), disk.ErrChecksumMismatch},
+		{"Newer version", func() []byte {
+			c := append([]byte{}, b...)
+			c[5], c[6] = 0xFF, 0xFF
+			return c
+		}(), disk.ErrUnsupportedVersion},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+
+			var corrupted *disk.CorruptedError
+			if !errors.As(err, &corrupted) {
+				t.Errorf("expected a CorruptedError, got %T", err)
+			}
+		})
+	}
+}
+
+func Test_SnapshotMigrateLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.kvsdb")
+
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.Encode(datastructure.NewItem("hello", "world", 0))
+	encoder.Encode(datastructure.NewItem("foo", "bar", 0))
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := disk.OpenKVSDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmap, err := db.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := hmap.Get("hello"); !ok || v.Data != "world" {
+		t.Errorf("expected hello to be world")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(b, []byte("KVSDB")) {
+		t.Errorf("expected the file to be migrated to the current format")
+	}
+
+	if _, err := decode(b); err != nil {
+		t.Errorf("expected the migrated file to be valid, got %v", err)
+	}
+}
+
+func Test_SnapshotList(t *testing.T) {
+	list := datastructure.NewList()
+	list.PushBack([]byte("a"))
+	list.PushBack([]byte("b"))
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("list", list, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := loaded.Get("list")
+	if !ok {
+		t.Fatal("expected the list to be loaded")
+	}
+
+	got, ok := v.Data.(*datastructure.List)
+	if !ok || got.Len() != 2 {
+		t.Fatalf("expected a list of 2 elements, got %#v", v.Data)
+	}
+
+	if e, _ := got.Index(1); string(e) != "b" {
+		t.Errorf("expected b, got %s", e)
+	}
+}
+
+func Test_SnapshotHash(t *testing.T) {
+	hash := datastructure.NewHash()
+	hash.Set("field", []byte("value"))
+	hash.Set("empty", []byte(""))
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("hash", hash, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := loaded.Get("hash")
+	if !ok {
+		t.Fatal("expected the hash to be loaded")
+	}
+
+	got, ok := v.Data.(*datastructure.Hash)
+	if !ok || got.Len() != 2 {
+		t.Fatalf("expected a hash of 2 fields, got %#v", v.Data)
+	}
+
+	if e, _ := got.Get("field"); string(e) != "value" {
+		t.Errorf("expected value, got %s", e)
+	}
+
+	if got.Size() != hash.Size() {
+		t.Errorf("expected size %d, got %d", hash.Size(), got.Size())
+	}
+}
+
+func Test_SnapshotSet(t *testing.T) {
+	ints := datastructure.NewSet()
+	ints.Add("1")
+	ints.Add("2")
+
+	strs := datastructure.NewSet()
+	strs.Add("a")
+	strs.Add("1")
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("ints", ints, 0))
+	hmap.Store(datastructure.NewItem("strs", strs, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]*datastructure.Set{"ints": ints, "strs": strs} {
+		v, ok := loaded.Get(key)
+		if !ok {
+			t.Fatalf("expected %s to be loaded", key)
+		}
+
+		got, ok := v.Data.(*datastructure.Set)
+		if !ok || got.Len() != 2 {
+			t.Fatalf("expected a set of 2 members, got %#v", v.Data)
+		}
+
+		if got.Encoding() != expected.Encoding() {
+			t.Errorf("expected %s encoding, got %s", expected.Encoding(), got.Encoding())
+		}
+
+		if !got.Has("1") {
+			t.Errorf("expected 1 to be a member of %s", key)
+		}
+	}
+}
+
+func Test_SnapshotZSet(t *testing.T) {
+	zset := datastructure.NewZSet()
+	zset.Add("a", 2.5)
+	zset.Add("b", -1)
+	zset.Add("c", math.Inf(1))
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("zset", zset, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := loaded.Get("zset")
+	if !ok {
+		t.Fatal("expected the sorted set to be loaded")
+	}
+
+	got, ok := v.Data.(*datastructure.ZSet)
+	if !ok {
+		t.Fatalf("expected a sorted set, got %#v", v.Data)
+	}
+
+	if !reflect.DeepEqual(got.Entries(), zset.Entries()) {
+		t.Errorf("expected %v, got %v", zset.Entries(), got.Entries())
+	}
+}
+
+func Test_SnapshotStream(t *testing.T) {
+	stream := datastructure.NewStream()
+	for i := uint64(1); i <= 3; i++ {
+		if err := stream.Add(datastructure.StreamID{Ms: i, Seq: i}, [][]byte{[]byte("field"), []byte("value")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.TrimMaxLen(2)
+
+	now := time.Unix(0, time.Now().UnixNano())
+	group, _ := stream.CreateGroup("group", datastructure.StreamID{Ms: 3, Seq: 3})
+	consumer, _ := group.CreateConsumer("consumer", now)
+	group.CreateConsumer("idle", now)
+	group.Claim(datastructure.StreamID{Ms: 2, Seq: 2}, consumer, now, 3)
+
+	hmap := datastructure.NewMap()
+	hmap.Store(datastructure.NewItem("stream", stream, 0))
+
+	b, err := disk.EncodeSnapshot(hmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := loaded.Get("stream")
+	if !ok {
+		t.Fatal("expected the stream to be loaded")
+	}
+
+	got, ok := v.Data.(*datastructure.Stream)
+	if !ok {
+		t.Fatalf("expected a stream, got %#v", v.Data)
+	}
+
+	all := func(s *datastructure.Stream) []datastructure.StreamEntry {
+		return s.Range(datastructure.MinStreamID, datastructure.MaxStreamID, -1, false)
+	}
+
+	if !reflect.DeepEqual(all(got), all(stream)) || got.LastID() != stream.LastID() {
+		t.Errorf("expected %v up to %v, got %v up to %v", all(stream), stream.LastID(), all(got), got.LastID())
+	}
+
+	g, ok := got.Group("group")
+	if !ok || g.LastID != group.LastID || len(g.Consumers()) != 2 {
+		t.Fatalf("expected the consumer group to be loaded")
+	}
+
+	p, ok := g.PendingEntry(datastructure.StreamID{Ms: 2, Seq: 2})
+	if !ok || p.Consumer.Name != "consumer" || p.DeliveryCount != 3 || !p.DeliveryTime.Equal(now) {
+		t.Errorf("expected the pending entry to be loaded, got %+v", p)
+	}
+}
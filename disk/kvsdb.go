@@ -1,17 +1,16 @@
 package disk
 
 import (
-	"io"
+	"bufio"
 	"os"
 	"path/filepath"
 
 	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // KVSDB is for persisting data to disk.
 type KVSDB struct {
-	file *os.File
+	path string
 }
 
 // OpenKVSDB opens a kvsDB at the given path.
@@ -35,52 +34,138 @@ func OpenKVSDB(path ...string) (*KVSDB, error) {
 		pathToFile = p
 	}
 
-	file, err := os.OpenFile(pathToFile, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	// Make sure the file can be created
+	file, err := os.OpenFile(pathToFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
 	return &KVSDB{
-		file: file,
+		path: pathToFile,
 	}, nil
 }
 
+// Path returns the path of the kvsDB file.
+func (db *KVSDB) Path() string {
+	return db.path
+}
+
 // Write writes the given data to the kvsDB.
 func (db *KVSDB) Write(data *datastructure.Map) error {
-	db.file.Seek(0, 0)
-	db.file.Truncate(0)
-	encoder := msgpack.NewEncoder(db.file)
-	for _, item := range data.List() {
-		if err := encoder.Encode(item); err != nil {
-			return err
-		}
+	b, err := db.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	return db.WriteEncoded(b)
+}
+
+// Encode encodes the given data into the kvsDB format without writing it.
+func (db *KVSDB) Encode(data *datastructure.Map) ([]byte, error) {
+	return EncodeSnapshot(data)
+}
+
+// WriteEncoded writes the data returned by Encode to the kvsDB.
+// The data is written to a temporary file first, which then atomically
+// replaces the kvsDB file, so a crash in the middle of a write never
+// leaves a partially written file behind.
+func (db *KVSDB) WriteEncoded(b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), "temp-*.kvsdb")
+	if err != nil {
+		return err
 	}
+
+	if err := db.writeTemp(tmp, b); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
 	return nil
 }
 
+func (db *KVSDB) writeTemp(tmp *os.File, b []byte) error {
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+
+	// The rename is only durable once the directory holding the file is
+	// synced as well
+	return syncDir(filepath.Dir(db.path))
+}
+
+// syncDir flushes the entries of the directory to disk.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+
+	return dir.Close()
+}
+
 // Read reads the given data from the kvsDB.
+// Files written with an older version of the format are
+// migrated to the current version once they are loaded.
 func (db *KVSDB) Read() (*datastructure.Map, error) {
-	var data datastructure.Map
-	decoder := msgpack.NewDecoder(db.file)
-	for {
-		var item datastructure.Item
-		if err := decoder.Decode(&item); err != nil {
-			if err == io.EOF {
-				break
-			}
+	file, err := os.Open(db.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data := datastructure.NewMap()
+	if info.Size() == 0 {
+		return data, nil
+	}
+
+	version, err := DecodeSnapshot(bufio.NewReader(file), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if version < FormatVersion {
+		if err := db.Write(data); err != nil {
 			return nil, err
 		}
-		data.Store(&item)
 	}
-	return &data, nil
+
+	return data, nil
 }
 
 // Clear clears the kvsDB.
 func (db *KVSDB) Clear() error {
-	return db.file.Truncate(0)
-}
-
-// Close closes the kvsDB.
-func (db *KVSDB) Close() error {
-	return db.file.Close()
+	return db.WriteEncoded(nil)
 }
@@ -4,6 +4,20 @@ import (
 	"bufio"
 	"errors"
 	"io"
+	"math"
+)
+
+const (
+	// MaxBulkLength is the maximum length of a bulk string.
+	MaxBulkLength = 512 * 1024 * 1024
+	// MaxArrayLength is the maximum number of elements of an array.
+	MaxArrayLength = math.MaxInt32
+
+	// maxPrealloc is the maximum size allocated for a bulk string, or the
+	// maximum number of elements allocated for an array, before the data is
+	// received. Larger objects grow as they are read so that a length alone
+	// never makes the reader allocate much memory.
+	maxPrealloc = 64 * 1024
 )
 
 var (
@@ -13,6 +27,12 @@ var (
 	// ErrMalformedLength is returned when the reader encounters a malformed
 	// length.
 	ErrMalformedLength = errors.New("malformed length")
+	// ErrInvalidBulkLength is returned when the length of a bulk string
+	// exceeds MaxBulkLength.
+	ErrInvalidBulkLength = errors.New("invalid bulk length")
+	// ErrInvalidArrayLength is returned when the length of an array exceeds
+	// MaxArrayLength.
+	ErrInvalidArrayLength = errors.New("invalid multibulk length")
 )
 
 // Reader is a protocol reader.
@@ -47,12 +67,11 @@ func (r *Reader) ReadObject() (any, error) {
 	case Integer:
 		return r.parseInt(line[1:])
 	case BulkString:
-		n, err := r.parseLen(line[1:])
+		n, err := r.parseLen(line[1:], MaxBulkLength, ErrInvalidBulkLength)
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		p := make([]byte, n)
-		_, err = io.ReadFull(r.br, p)
+		p, err := r.readBulk(n)
 		if err != nil {
 			return nil, err
 		}
@@ -64,7 +83,7 @@ func (r *Reader) ReadObject() (any, error) {
 
 		return p, nil
 	case Array:
-		len, err := r.parseLen(line[1:])
+		len, err := r.parseLen(line[1:], MaxArrayLength, ErrInvalidArrayLength)
 		if err != nil {
 			return nil, err
 		}
@@ -73,12 +92,18 @@ func (r *Reader) ReadObject() (any, error) {
 			return nil, nil
 		}
 
-		result := make([]any, len)
+		capacity := len
+		if capacity > maxPrealloc {
+			capacity = maxPrealloc
+		}
+
+		result := make([]any, 0, capacity)
 		for i := 0; i < len; i++ {
-			result[i], err = r.ReadObject()
+			obj, err := r.ReadObject()
 			if err != nil {
 				return nil, err
 			}
+			result = append(result, obj)
 		}
 
 		return result, nil
@@ -87,6 +112,26 @@ func (r *Reader) ReadObject() (any, error) {
 	return nil, ErrInvalidSyntax
 }
 
+// readBulk reads the n bytes of a bulk string.
+func (r *Reader) readBulk(n int) ([]byte, error) {
+	if n <= maxPrealloc {
+		p := make([]byte, n)
+		if _, err := io.ReadFull(r.br, p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	p, err := io.ReadAll(io.LimitReader(r.br, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(p) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return p, nil
+}
+
 // readLine reads a line from the reader.
 func (r *Reader) readLine() ([]byte, error) {
 	// read the line from the stream using ReadSlice to avoid allocations
@@ -114,8 +159,9 @@ func (r *Reader) readLine() ([]byte, error) {
 	return p[:i], nil
 }
 
-// parseLen parses a length from the given protocol data.
-func (r *Reader) parseLen(p []byte) (int, error) {
+// parseLen parses a length from the given protocol data. errTooLarge is
+// returned if the length exceeds max.
+func (r *Reader) parseLen(p []byte, max int, errTooLarge error) (int, error) {
 	if len(p) == 0 {
 		return -1, ErrMalformedLength
 	}
@@ -134,6 +180,9 @@ func (r *Reader) parseLen(p []byte) (int, error) {
 		}
 		len *= 10
 		len += int(b - '0')
+		if len > max {
+			return -1, errTooLarge
+		}
 	}
 
 	return len, nil
@@ -2,7 +2,9 @@ package protocol_test
 
 import (
 	"bytes"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/HotPotatoC/kvstore-rewrite/protocol"
@@ -25,6 +27,14 @@ func TestReader(t *testing.T) {
 		{name: "Array", st: []byte("*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"), exp: []any{[]byte("foo"), []byte("bar")}, err: nil},
 		{name: "Array with nil", st: []byte("*2\r\n$3\r\nfoo\r\n$-1\r\n"), exp: []any{[]byte("foo"), nil}, err: nil},
 		{name: "Array with nil and empty bulk string", st: []byte("*2\r\n$3\r\nfoo\r\n$0\r\n\r\n"), exp: []any{[]byte("foo"), []byte("")}, err: nil},
+		{name: "Large BulkString", st: []byte("$70000\r\n" + strings.Repeat("a", 70000) + "\r\n"), exp: []byte(strings.Repeat("a", 70000)), err: nil},
+		{name: "Max BulkString length", st: []byte("$536870912\r\nfoo"), exp: nil, err: io.ErrUnexpectedEOF},
+		{name: "BulkString too large", st: []byte("$536870913\r\n"), exp: nil, err: protocol.ErrInvalidBulkLength},
+		{name: "BulkString length overflow", st: []byte("$99999999999999999999999\r\n"), exp: nil, err: protocol.ErrInvalidBulkLength},
+		{name: "Truncated BulkString", st: []byte("$3\r\nfo"), exp: nil, err: io.ErrUnexpectedEOF},
+		{name: "Max Array length", st: []byte("*2147483647\r\n$3\r\nfoo\r\n"), exp: nil, err: io.EOF},
+		{name: "Array too large", st: []byte("*2147483648\r\n"), exp: nil, err: protocol.ErrInvalidArrayLength},
+		{name: "Array length overflow", st: []byte("*99999999999999999999999\r\n"), exp: nil, err: protocol.ErrInvalidArrayLength},
 	}
 
 	for _, tt := range tc {
@@ -95,12 +95,28 @@ func MakeNull() []byte {
 	return b
 }
 
-// MakeArray creates an array protocol object.
-func MakeArray(args ...[]byte) []byte {
+// MakeNullArray creates a null array protocol object.
+func MakeNullArray() []byte {
 	var b []byte
 	b = append(b, Array)
-	b = strconv.AppendInt(b, int64(len(args)), 10)
+	b = append(b, []byte("-1")...)
 	b = append(b, CRLF...)
+	return b
+}
+
+// MakeArrayHeader creates the header of an array protocol object of n
+// elements, which are written separately.
+func MakeArrayHeader(n int64) []byte {
+	var b []byte
+	b = append(b, Array)
+	b = strconv.AppendInt(b, n, 10)
+	b = append(b, CRLF...)
+	return b
+}
+
+// MakeArray creates an array protocol object.
+func MakeArray(args ...[]byte) []byte {
+	b := MakeArrayHeader(int64(len(args)))
 	for _, arg := range args {
 		b = append(b, arg...)
 	}
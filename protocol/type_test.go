@@ -272,6 +272,14 @@ func TestWriter_MakeNull(t *testing.T) {
 	}
 }
 
+func TestWriter_MakeNullArray(t *testing.T) {
+	res := protocol.MakeNullArray()
+
+	if !bytes.Equal(res, []byte("*-1\r\n")) {
+		t.Errorf("expected %#v, got %#v", string("*-1\r\n"), string(res))
+	}
+}
+
 func TestWriter_MakeArray(t *testing.T) {
 	tc := []struct {
 		name string
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/disk"
+	"github.com/HotPotatoC/kvstore-rewrite/logger"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+	"github.com/panjf2000/gnet"
+	"github.com/spf13/viper"
+)
+
+// aofConn is the connection used while replaying the append-only file.
+// Every reply written to it is discarded.
+type aofConn struct {
+	gnet.Conn
+}
+
+// AsyncWrite discards the reply.
+func (aofConn) AsyncWrite(buf []byte) error { return nil }
+
+// Close does nothing.
+func (aofConn) Close() error { return nil }
+
+// openAppendOnlyFile opens the append-only file configured in the config.
+func openAppendOnlyFile() (*disk.AOF, error) {
+	policy, err := disk.ParseFsyncPolicy(viper.GetString("appendonly.fsync"))
+	if err != nil {
+		return nil, err
+	}
+
+	return disk.OpenAOF(viper.GetString("appendonly.path"), policy)
+}
+
+// loadAppendOnlyFile replays every command stored in the append-only file.
+func (s *Server) loadAppendOnlyFile() error {
+	c := &client.Client{
+		Flags:      client.FlagDenyBlocking,
+		Conn:       aofConn{},
+		DB:         s.DB,
+		KVSDB:      s.kvsDB,
+		CreateTime: time.Now(),
+	}
+
+	var n int
+	truncated, err := s.aof.Load(s.DB, func(argv [][]byte) error {
+		cmd, err := s.lookupCommand(bytes.ToLower(argv[0]), argv[1:])
+		if err != nil {
+			return fmt.Errorf("failed replaying command #%d from the append only file: %w", n+1, err)
+		}
+
+		if !cmd.CheckArity(len(argv)) {
+			return fmt.Errorf("failed replaying command #%d from the append only file: wrong number of arguments for '%s' command", n+1, argv[0])
+		}
+
+		c.Command = cmd.Name
+		c.Argv = argv[1:]
+		c.Argc = len(argv) - 1
+
+		cmd.Proc(c)
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if truncated > 0 {
+		logger.S().Warnf("append only file ends with an incomplete command or transaction, discarded the last %d bytes", truncated)
+	}
+
+	logger.S().Infof("DB loaded from append only file: %d commands replayed", n)
+	return nil
+}
+
+// feedAppendOnlyFile appends the command executed by the client to the
+// append-only file. Relative expire times are logged as absolute unix
+// timestamps so the keys do not outlive their original expiry once
+// the file is replayed.
+func (s *Server) feedAppendOnlyFile(c *client.Client) {
+	if err := s.appendCommand(c); err != nil {
+		logger.S().Error("failed writing to the append only file: ", err)
+		return
+	}
+
+	s.rewriteAppendOnlyFileIfNeeded()
+}
+
+// appendCommand appends the command executed by the client to the
+// append-only file, see feedAppendOnlyFile.
+func (s *Server) appendCommand(c *client.Client) error {
+	var err error
+
+	switch {
+	case c.Propagate != nil:
+		for _, argv := range c.Propagate {
+			if err = s.aof.Append(argv...); err != nil {
+				break
+			}
+		}
+	case c.Command == "expire", c.Command == "pexpire", c.Command == "expireat", c.Command == "getex":
+		err = s.feedExpireAt(c.Argv[0])
+	case c.Command == "set":
+		err = s.aof.Append([]byte("set"), c.Argv[0], c.Argv[1])
+		if err == nil {
+			err = s.feedExpireAt(c.Argv[0])
+		}
+	default:
+		argv := make([][]byte, 0, c.Argc+1)
+		argv = append(argv, []byte(c.Command))
+		argv = append(argv, c.Argv...)
+		err = s.aof.Append(argv...)
+	}
+
+	return err
+}
+
+// feedExpireAt appends the absolute expire time of the given key. If the key
+// has already expired, a delete is appended instead.
+func (s *Server) feedExpireAt(key []byte) error {
+	item, ok := s.DB.Peek(string(key))
+	if !ok {
+		return s.aof.Append([]byte("del"), key)
+	}
+
+	if !item.HasFlag(datastructure.ItemFlagExpireXX) {
+		return nil
+	}
+
+	return s.aof.Append([]byte("pexpireat"), key, strconv.AppendInt(nil, item.ExpiresAt.UnixMilli(), 10))
+}
+
+// rewriteAppendOnlyFileIfNeeded starts a background rewrite once the file
+// has grown by the configured percentage since the last rewrite.
+func (s *Server) rewriteAppendOnlyFileIfNeeded() {
+	percentage := viper.GetInt64("appendonly.auto_rewrite_percentage")
+	if percentage <= 0 || s.aof.Rewriting() {
+		return
+	}
+
+	size, base := s.aof.Size(), s.aof.BaseSize()
+	if size < viper.GetInt64("appendonly.auto_rewrite_min_size") {
+		return
+	}
+
+	if base == 0 {
+		base = 1
+	}
+
+	growth := (size - base) * 100 / base
+	if growth < percentage {
+		return
+	}
+
+	logger.S().Infof("starting automatic rewriting of the append only file on %d%% growth", growth)
+	if err := s.rewriteAppendOnlyFileBackground(); err != nil {
+		logger.S().Error("failed starting append only file rewrite: ", err)
+	}
+}
+
+// rewriteAppendOnlyFileBackground compacts the append-only file by replacing
+// its content with a snapshot of the current dataset. The snapshot is encoded
+// while the caller holds the server lock, then it is written to disk in the
+// background.
+func (s *Server) rewriteAppendOnlyFileBackground() error {
+	if s.aof.Rewriting() {
+		return disk.ErrRewriteInProgress
+	}
+
+	snapshot, err := disk.EncodeSnapshot(s.DB)
+	if err != nil {
+		return err
+	}
+
+	if err := s.aof.StartRewrite(); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.aof.FinishRewrite(snapshot); err != nil {
+			logger.S().Error("background append only file rewrite failed: ", err)
+			return
+		}
+
+		logger.S().Info("background append only file rewrite finished successfully")
+	}()
+
+	return nil
+}
+
+// bgrewriteaofCommand rewrites the append-only file in the background.
+func bgrewriteaofCommand(c *client.Client) {
+	if server.aof == nil {
+		c.Conn.AsyncWrite(NewGenericError("append only file is disabled"))
+		return
+	}
+
+	if err := server.rewriteAppendOnlyFileBackground(); err != nil {
+		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("Background append only file rewriting started"))
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// maxBitOffset is the greatest bit offset of a string.
+const maxBitOffset = maxStringLength*8 - 1
+
+// lookupStringForUpdate returns the item stored at the key and the bytes of
+// its string value. If the key holds a value of another type, a WRONGTYPE
+// error is sent to the client and ok is false.
+func lookupStringForUpdate(c *client.Client, key string) (item *datastructure.Item, b []byte, found bool, ok bool) {
+	item, found = c.DB.Get(key)
+	if !found {
+		return nil, nil, false, true
+	}
+
+	if b, ok = stringBytes(item.Data); !ok {
+		c.Conn.AsyncWrite(NewWrongTypeError())
+		return nil, nil, true, false
+	}
+
+	return item, b, true, true
+}
+
+// storeString stores the modified bytes of the string value of the key,
+// keeping the expire time of the key if it exists.
+func storeString(c *client.Client, event, key string, item *datastructure.Item, b []byte) {
+	if item != nil {
+		item.Data = b
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, b, 0))
+	}
+
+	server.notifyKeyspaceEvent(notifyString, event, key)
+}
+
+// parseBitOffset parses a bit offset argument. If the offset is out of
+// range, an error is sent to the client and ok is false.
+func parseBitOffset(c *client.Client, arg []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || n < 0 || n > maxBitOffset {
+		c.Conn.AsyncWrite(NewGenericError("bit offset is not an integer or out of range"))
+		return 0, false
+	}
+	return n, true
+}
+
+// parseBitRange parses the optional start, end and unit arguments of
+// BITCOUNT and BITPOS and returns the range in bits within the string of
+// the given length. Negative offsets start from the end of the string.
+// empty is true if the range does not contain any bit.
+func parseBitRange(c *client.Client, args [][]byte, length int) (start, end int64, empty bool, ok bool) {
+	n := int64(length)
+	start, end = 0, n-1
+	bitUnit := false
+
+	if len(args) > 0 {
+		if start, ok = parseInt(c, args[0]); !ok {
+			return 0, 0, false, false
+		}
+	}
+
+	if len(args) > 1 {
+		if end, ok = parseInt(c, args[1]); !ok {
+			return 0, 0, false, false
+		}
+	}
+
+	if len(args) > 2 {
+		switch string(bytes.ToLower(args[2])) {
+		case "byte":
+		case "bit":
+			bitUnit = true
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return 0, 0, false, false
+		}
+	}
+
+	if bitUnit {
+		n *= 8
+	}
+
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+
+	if n == 0 || start > end {
+		return 0, 0, true, true
+	}
+
+	if !bitUnit {
+		start, end = start*8, end*8+7
+	}
+	return start, end, false, true
+}
+
+// setbitCommand sets or clears the bit at the offset of the string stored
+// at the key and returns its previous value.
+func setbitCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	offset, ok := parseBitOffset(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	value := string(c.Argv[2])
+	if value != "0" && value != "1" {
+		c.Conn.AsyncWrite(NewGenericError("bit is not an integer or out of range"))
+		return
+	}
+
+	item, b, _, ok := lookupStringForUpdate(c, key)
+	if !ok {
+		return
+	}
+
+	b, old := datastructure.SetBit(b, offset, int(value[0]-'0'))
+	storeString(c, "setbit", key, item, b)
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(old)))
+}
+
+// getbitCommand returns the bit at the offset of the string stored at the key.
+func getbitCommand(c *client.Client) {
+	offset, ok := parseBitOffset(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	v, _, ok := lookupString(c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(datastructure.GetBit(v, offset))))
+}
+
+// bitcountCommand returns the number of bits set in the string stored at
+// the key, optionally within a range of bytes or bits.
+func bitcountCommand(c *client.Client) {
+	if c.Argc == 2 || c.Argc > 4 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	v, _, ok := lookupString(c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	start, end, empty, ok := parseBitRange(c, c.Argv[1:], len(v))
+	if !ok {
+		return
+	}
+
+	if empty {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(datastructure.BitCount(v, start, end)))
+}
+
+// bitposCommand returns the offset of the first bit set to the given value
+// in the string stored at the key, optionally within a range of bytes or bits.
+func bitposCommand(c *client.Client) {
+	if c.Argc > 5 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	arg := string(c.Argv[1])
+	if arg != "0" && arg != "1" {
+		c.Conn.AsyncWrite(NewGenericError("The bit argument must be 1 or 0."))
+		return
+	}
+	bit := int(arg[0] - '0')
+
+	v, found, ok := lookupString(c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	start, end, empty, ok := parseBitRange(c, c.Argv[2:], len(v))
+	if !ok {
+		return
+	}
+
+	if !found {
+		// A missing key is an empty string, i.e. an infinite run of zeros
+		c.Conn.AsyncWrite(protocol.MakeInteger(-int64(bit)))
+		return
+	}
+
+	if empty {
+		c.Conn.AsyncWrite(protocol.MakeInteger(-1))
+		return
+	}
+
+	pos := datastructure.BitPos(v, bit, start, end)
+
+	// Without an explicit end, the string is considered to be padded with
+	// zeros on the right
+	if pos < 0 && bit == 0 && c.Argc < 4 {
+		pos = end + 1
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(pos))
+}
+
+// bitopCommand stores the result of a bitwise operation between strings in
+// the destination key.
+func bitopCommand(c *client.Client) {
+	var op datastructure.BitOperation
+	switch string(bytes.ToLower(c.Argv[0])) {
+	case "and":
+		op = datastructure.BitAnd
+	case "or":
+		op = datastructure.BitOr
+	case "xor":
+		op = datastructure.BitXor
+	case "not":
+		op = datastructure.BitNot
+		if c.Argc != 3 {
+			c.Conn.AsyncWrite(NewGenericError("BITOP NOT must be called with a single source key."))
+			return
+		}
+	default:
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	dst := string(c.Argv[1])
+
+	srcs := make([][]byte, c.Argc-2)
+	for i, key := range c.Argv[2:] {
+		v, _, ok := lookupString(c, string(key))
+		if !ok {
+			return
+		}
+		srcs[i] = v
+	}
+
+	result := datastructure.BitOp(op, srcs)
+	if len(result) == 0 {
+		c.DB.Delete(dst)
+	} else {
+		c.DB.Store(datastructure.NewItem(dst, result, 0))
+		server.notifyKeyspaceEvent(notifyString, "set", dst)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(result))))
+}
+
+// bitfieldOpKind is the kind of a BITFIELD subcommand.
+type bitfieldOpKind uint8
+
+const (
+	bitfieldGet bitfieldOpKind = iota
+	bitfieldSet
+	bitfieldIncrBy
+)
+
+// bitfieldOp is a subcommand of BITFIELD.
+type bitfieldOp struct {
+	kind     bitfieldOpKind
+	typ      datastructure.BitfieldType
+	offset   int64
+	value    int64
+	overflow datastructure.BitfieldOverflow
+}
+
+// parseBitfieldType parses a bitfield type such as i16 or u8. If the type is
+// not valid, an error is sent to the client and ok is false.
+func parseBitfieldType(c *client.Client, arg []byte) (t datastructure.BitfieldType, ok bool) {
+	if len(arg) > 1 {
+		n, err := strconv.Atoi(string(arg[1:]))
+		switch arg[0] {
+		case 'i', 'I':
+			t, ok = datastructure.BitfieldType{Signed: true, Bits: uint8(n)}, err == nil && n >= 1 && n <= 64
+		case 'u', 'U':
+			t, ok = datastructure.BitfieldType{Bits: uint8(n)}, err == nil && n >= 1 && n <= 63
+		}
+	}
+
+	if !ok {
+		c.Conn.AsyncWrite(NewGenericError("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."))
+	}
+	return t, ok
+}
+
+// parseBitfieldOffset parses the offset of a bitfield, which is multiplied
+// by the width of the type if prefixed by '#'.
+func parseBitfieldOffset(c *client.Client, arg []byte, t datastructure.BitfieldType) (int64, bool) {
+	multiply := len(arg) > 0 && arg[0] == '#'
+	if multiply {
+		arg = arg[1:]
+	}
+
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err == nil && multiply {
+		if n > maxBitOffset {
+			err = strconv.ErrRange
+		}
+		n *= int64(t.Bits)
+	}
+
+	if err != nil || n < 0 || n+int64(t.Bits)-1 > maxBitOffset {
+		c.Conn.AsyncWrite(NewGenericError("bit offset is not an integer or out of range"))
+		return 0, false
+	}
+	return n, true
+}
+
+// bitfieldCommand gets, sets and increments integers of arbitrary width
+// stored in the string at the key.
+func bitfieldCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	var ops []bitfieldOp
+	overflow := datastructure.BitfieldWrap
+	for i := 1; i < c.Argc; i++ {
+		sub := string(bytes.ToLower(c.Argv[i]))
+
+		nargs := 0
+		switch sub {
+		case "get":
+			nargs = 2
+		case "set", "incrby":
+			nargs = 3
+		case "overflow":
+			nargs = 1
+		}
+
+		if nargs == 0 || i+nargs >= c.Argc {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+
+		if sub == "overflow" {
+			switch string(bytes.ToLower(c.Argv[i+1])) {
+			case "wrap":
+				overflow = datastructure.BitfieldWrap
+			case "sat":
+				overflow = datastructure.BitfieldSat
+			case "fail":
+				overflow = datastructure.BitfieldFail
+			default:
+				c.Conn.AsyncWrite(NewGenericError("Invalid OVERFLOW type specified"))
+				return
+			}
+			i++
+			continue
+		}
+
+		op := bitfieldOp{overflow: overflow}
+
+		var ok bool
+		if op.typ, ok = parseBitfieldType(c, c.Argv[i+1]); !ok {
+			return
+		}
+
+		if op.offset, ok = parseBitfieldOffset(c, c.Argv[i+2], op.typ); !ok {
+			return
+		}
+
+		switch sub {
+		case "set":
+			op.kind = bitfieldSet
+		case "incrby":
+			op.kind = bitfieldIncrBy
+		}
+
+		if op.kind != bitfieldGet {
+			if op.value, ok = parseInt(c, c.Argv[i+3]); !ok {
+				return
+			}
+		}
+
+		ops = append(ops, op)
+		i += nargs
+	}
+
+	item, b, _, ok := lookupStringForUpdate(c, key)
+	if !ok {
+		return
+	}
+
+	changed := false
+	items := make([][]byte, len(ops))
+	for i, op := range ops {
+		old := datastructure.GetBitfield(b, op.offset, op.typ)
+
+		var value int64
+		switch op.kind {
+		case bitfieldGet:
+			items[i] = protocol.MakeInteger(old)
+			continue
+		case bitfieldSet:
+			// The value is checked against the type as if it was added to 0
+			value, ok = datastructure.BitfieldAdd(op.typ, 0, op.value, op.overflow)
+		case bitfieldIncrBy:
+			value, ok = datastructure.BitfieldAdd(op.typ, old, op.value, op.overflow)
+		}
+
+		if !ok {
+			items[i] = protocol.MakeNull()
+			continue
+		}
+
+		b = datastructure.SetBitfield(b, op.offset, op.typ, value)
+		changed = true
+
+		if op.kind == bitfieldSet {
+			items[i] = protocol.MakeInteger(old)
+		} else {
+			items[i] = protocol.MakeInteger(value)
+		}
+	}
+
+	if changed {
+		storeString(c, "setbit", key, item, b)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(items...))
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/logger"
+)
+
+// blockedClient is a client waiting for one of its keys to be ready. A blocked
+// client does not hold any goroutine: it is served by the command writing to
+// one of its keys, or by a timer once its timeout expires.
+type blockedClient struct {
+	c    *client.Client
+	keys []string
+	// serve tries to reply to the client after the key has been written to.
+	// It is called with the write lock held and returns false if the client
+	// must keep waiting.
+	serve func(key string) bool
+	// timeoutReply is sent to the client when its timeout expires
+	timeoutReply []byte
+	timer        *time.Timer
+}
+
+// blockingState keeps track of the blocked clients and of the keys they are
+// waiting for.
+type blockingState struct {
+	mu      sync.Mutex
+	clients map[*client.Client]*blockedClient
+	// keys maps every key to the clients waiting for it, in the order they
+	// were blocked
+	keys map[string][]*blockedClient
+	// ready are the keys written to by the current command that have
+	// clients waiting for them
+	ready []string
+	// pending are the frames received while the client is blocked, or while
+	// the frames received before are not handled yet, in the order they were
+	// received
+	pending map[*client.Client][][]byte
+	// resuming are the clients whose pending frames are being handled
+	resuming map[*client.Client]struct{}
+}
+
+func newBlockingState() blockingState {
+	return blockingState{
+		clients:  make(map[*client.Client]*blockedClient),
+		keys:     make(map[string][]*blockedClient),
+		pending:  make(map[*client.Client][][]byte),
+		resuming: make(map[*client.Client]struct{}),
+	}
+}
+
+// numBlocked returns the number of blocked clients.
+func (b *blockingState) numBlocked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// remove stops the client from waiting for its keys. Returns false if the
+// client is not blocked.
+func (b *blockingState) remove(c *client.Client) (*blockedClient, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bc, ok := b.clients[c]
+	if !ok {
+		return nil, false
+	}
+
+	delete(b.clients, c)
+	for _, key := range bc.keys {
+		waiting := b.keys[key]
+		for i, w := range waiting {
+			if w == bc {
+				waiting = append(waiting[:i:i], waiting[i+1:]...)
+				break
+			}
+		}
+
+		if len(waiting) == 0 {
+			delete(b.keys, key)
+		} else {
+			b.keys[key] = waiting
+		}
+	}
+
+	if bc.timer != nil {
+		bc.timer.Stop()
+	}
+
+	c.RemoveFlag(client.FlagBlocked)
+	return bc, true
+}
+
+// startResuming marks the client as resuming. Returns false if the client has
+// no pending frame or if they are already being handled.
+func (b *blockingState) startResuming(c *client.Client) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.resuming[c]; ok || len(b.pending[c]) == 0 {
+		return false
+	}
+
+	b.resuming[c] = struct{}{}
+	return true
+}
+
+// nextPending returns the next frame to handle of a resuming client. Returns
+// false, and the client stops resuming, once there is no frame left or if the
+// client is blocked again.
+func (b *blockingState) nextPending(c *client.Client) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := b.pending[c]
+	if _, ok := b.clients[c]; ok || len(pending) == 0 {
+		delete(b.resuming, c)
+		return nil, false
+	}
+
+	if len(pending) == 1 {
+		delete(b.pending, c)
+	} else {
+		b.pending[c] = pending[1:]
+	}
+	return pending[0], true
+}
+
+// forget drops the pending frames of the client.
+func (b *blockingState) forget(c *client.Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.pending, c)
+	delete(b.resuming, c)
+}
+
+// isBlocked returns true if the client is still waiting.
+func (b *blockingState) isBlocked(bc *blockedClient) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.clients[bc.c] == bc
+}
+
+// canBlock returns true if the client is allowed to wait for its keys.
+func canBlock(c *client.Client) bool {
+	return !c.HasFlag(client.FlagDenyBlocking)
+}
+
+// parseBlockTimeout parses the timeout in seconds of a blocking command. A
+// zero timeout waits forever.
+func parseBlockTimeout(c *client.Client, arg []byte) (time.Duration, bool) {
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) || f > float64(math.MaxInt64/time.Second) {
+		c.Conn.AsyncWrite(NewGenericError("timeout is not a float or out of range"))
+		return 0, false
+	}
+
+	if f < 0 {
+		c.Conn.AsyncWrite(NewGenericError("timeout is negative"))
+		return 0, false
+	}
+
+	timeout := time.Duration(f * float64(time.Second))
+	if timeout == 0 && f > 0 {
+		// Too small to be represented, it must not wait forever
+		timeout = 1
+	}
+	return timeout, true
+}
+
+// blockClient makes the client wait until serve succeeds for one of the keys
+// or until the timeout expires, in which case timeoutReply is sent. A zero
+// timeout waits forever. It must be called while executing a command.
+func (s *Server) blockClient(c *client.Client, keys []string, timeout time.Duration, timeoutReply []byte, serve func(key string) bool) {
+	bc := &blockedClient{c: c, keys: keys, serve: serve, timeoutReply: timeoutReply}
+
+	s.blocking.mu.Lock()
+	s.blocking.clients[c] = bc
+	for _, key := range keys {
+		s.blocking.keys[key] = append(s.blocking.keys[key], bc)
+	}
+	c.AddFlag(client.FlagBlocked)
+	s.blocking.mu.Unlock()
+
+	if timeout > 0 {
+		bc.timer = time.AfterFunc(timeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if _, ok := s.blocking.remove(c); ok {
+				c.Conn.AsyncWrite(bc.timeoutReply)
+				s.resumeClient(c)
+			}
+		})
+	}
+}
+
+// unblockClient stops the client from waiting without replying. It is used
+// when the connection is closed.
+func (s *Server) unblockClient(c *client.Client) {
+	s.blocking.remove(c)
+	s.blocking.forget(c)
+}
+
+// queueIfBlocked keeps the frame to handle it once the client is unblocked.
+// The frames received after the client is unblocked are also queued until
+// the previous ones are handled, so that the replies keep the order of the
+// commands. Returns false if the frame can be handled right away.
+func (s *Server) queueIfBlocked(c *client.Client, frame []byte) bool {
+	s.blocking.mu.Lock()
+	defer s.blocking.mu.Unlock()
+
+	_, blocked := s.blocking.clients[c]
+	if !blocked && len(s.blocking.pending[c]) == 0 {
+		return false
+	}
+
+	s.blocking.pending[c] = append(s.blocking.pending[c], frame)
+	return true
+}
+
+// resumeClient handles, one after the other, the frames received while the
+// client was blocked, until none is left or until the client is blocked
+// again.
+func (s *Server) resumeClient(c *client.Client) {
+	if !s.blocking.startResuming(c) {
+		return
+	}
+
+	err := s.pool.Submit(func() {
+		for {
+			frame, ok := s.blocking.nextPending(c)
+			if !ok {
+				return
+			}
+
+			c.Lock()
+			s.process(c, frame)
+			c.Unlock()
+		}
+	})
+	if err != nil {
+		s.blocking.forget(c)
+		logger.S().Error(err)
+	}
+}
+
+// signalKeyAsReady notifies the clients waiting for the key that it has been
+// written to. The clients are served once the current command completes.
+func (s *Server) signalKeyAsReady(key string) {
+	s.blocking.mu.Lock()
+	defer s.blocking.mu.Unlock()
+
+	if _, ok := s.blocking.keys[key]; ok {
+		s.blocking.ready = append(s.blocking.ready, key)
+	}
+}
+
+// handleClientsBlockedOnKeys serves the clients waiting for the keys signaled
+// as ready, in the order they were blocked. It is called with the write lock
+// held after every write command.
+func (s *Server) handleClientsBlockedOnKeys() {
+	for {
+		s.blocking.mu.Lock()
+		if len(s.blocking.ready) == 0 {
+			s.blocking.mu.Unlock()
+			return
+		}
+
+		key := s.blocking.ready[0]
+		s.blocking.ready = s.blocking.ready[1:]
+		waiting := append([]*blockedClient(nil), s.blocking.keys[key]...)
+		s.blocking.mu.Unlock()
+
+		for _, bc := range waiting {
+			// The client may have been served by a previous key
+			if !s.blocking.isBlocked(bc) {
+				continue
+			}
+
+			bc.c.Propagate = nil
+			dirty := s.DB.Dirty()
+			if !bc.serve(key) {
+				continue
+			}
+
+			s.blocking.remove(bc.c)
+
+			if s.aof != nil && s.DB.Dirty() != dirty && bc.c.Propagate != nil {
+				s.feedAppendOnlyFile(bc.c)
+			}
+
+			s.resumeClient(bc.c)
+		}
+	}
+}
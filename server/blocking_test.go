@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_BlockedClientRepliesInOrder(t *testing.T) {
+	newTestServer()
+	c, conn := newTestClient()
+	other, _ := newTestClient()
+
+	testHandle(c, "blpop", "list", "0")
+	testHandle(c, "incrby", "n", "1")
+	testHandle(c, "incrby", "n", "10")
+
+	if replies := readReplies(t, conn); len(replies) != 0 {
+		t.Fatalf("expected the blocked client to wait, got %v", replies)
+	}
+
+	// The next frame is received before the queued ones are handled
+	c.Lock()
+	testCall(t, other, "rpush", "list", "a")
+	testHandleLocked(c, "incrby", "n", "100")
+	c.Unlock()
+
+	var replies []any
+	deadline := time.Now().Add(time.Second)
+	for len(replies) < 4 && time.Now().Before(deadline) {
+		replies = append(replies, readReplies(t, conn)...)
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(replies) != 4 {
+		t.Fatalf("expected 4 replies, got %v", replies)
+	}
+
+	for i, expected := range []int{1, 11, 111} {
+		if replies[i+1] != expected {
+			t.Errorf("expected reply %d to be %d, got %v", i+1, expected, replies[i+1])
+		}
+	}
+
+	if server.blocking.numBlocked() != 0 || len(server.blocking.pending) != 0 || len(server.blocking.resuming) != 0 {
+		t.Error("expected the client to be resumed")
+	}
+}
+
+func Test_BlockedClientBlocksAgainWhileResuming(t *testing.T) {
+	newTestServer()
+	c, conn := newTestClient()
+	other, _ := newTestClient()
+
+	testHandle(c, "blpop", "list", "0")
+	testHandle(c, "blpop", "list", "0")
+	testHandle(c, "incr", "n")
+
+	testCall(t, other, "rpush", "list", "a")
+
+	deadline := time.Now().Add(time.Second)
+	for server.blocking.numBlocked() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	testHandle(c, "incr", "n")
+	testCall(t, other, "rpush", "list", "b")
+
+	var replies []any
+	for len(replies) < 4 && time.Now().Before(deadline) {
+		replies = append(replies, readReplies(t, conn)...)
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(replies) != 4 {
+		t.Fatalf("expected 4 replies, got %v", replies)
+	}
+
+	for i, expected := range []int{1, 2} {
+		if replies[i+2] != expected {
+			t.Errorf("expected reply %d to be %d, got %v", i+2, expected, replies[i+2])
+		}
+	}
+}
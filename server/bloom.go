@@ -0,0 +1,352 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// Parameters of the filters created by adding items to a missing key
+const (
+	bloomDefaultErrorRate = 0.01
+	bloomDefaultCapacity  = 100
+	bloomDefaultExpansion = 2
+
+	cuckooDefaultCapacity      = 1024
+	cuckooDefaultBucketSize    = 2
+	cuckooDefaultMaxIterations = 20
+	cuckooDefaultExpansion     = 1
+
+	// filterMaxCapacity is the maximum capacity of a reserved filter
+	filterMaxCapacity = 1 << 32
+)
+
+// bfReserveCommand creates an empty Bloom filter at the key with the given
+// error rate and capacity.
+func bfReserveCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	errorRate, ok := parseFloat(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	if errorRate <= 0 || errorRate >= 1 {
+		c.Conn.AsyncWrite(NewGenericError("(0 < error rate range < 1)"))
+		return
+	}
+
+	capacity, ok := parseInt(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	if capacity <= 0 || capacity > filterMaxCapacity {
+		c.Conn.AsyncWrite(NewGenericError("(capacity should be larger than 0)"))
+		return
+	}
+
+	expansion := int64(bloomDefaultExpansion)
+	var expansionSet, nonScaling bool
+	for i := 3; i < c.Argc; i++ {
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "expansion":
+			if i+1 >= c.Argc {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+
+			i++
+			if expansion, ok = parseInt(c, c.Argv[i]); !ok {
+				return
+			}
+
+			if expansion < 1 || expansion > 1<<15 {
+				c.Conn.AsyncWrite(NewGenericError("expansion should be between 1 and 32768"))
+				return
+			}
+			expansionSet = true
+		case "nonscaling":
+			nonScaling = true
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	if nonScaling {
+		if expansionSet {
+			c.Conn.AsyncWrite(NewGenericError("Nonscaling filters cannot expand"))
+			return
+		}
+		expansion = 0
+	}
+
+	if _, found := c.DB.Get(key); found {
+		c.Conn.AsyncWrite(NewGenericError("item exists"))
+		return
+	}
+
+	c.DB.Store(datastructure.NewItem(key, datastructure.NewBloomFilter(errorRate, uint64(capacity), uint32(expansion)), 0))
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// bfAddGenericCommand adds the items to the Bloom filter stored at the key,
+// creating it with the default parameters if it does not exist. Replies
+// with an array of the results when multi is true.
+func bfAddGenericCommand(c *client.Client, multi bool) {
+	key := string(c.Argv[0])
+
+	bloom, found, ok := lookupValue[*datastructure.BloomFilter](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		bloom = datastructure.NewBloomFilter(bloomDefaultErrorRate, bloomDefaultCapacity, bloomDefaultExpansion)
+	}
+
+	var updated bool
+	replies := make([][]byte, 0, c.Argc-1)
+	for _, item := range c.Argv[1:] {
+		added, err := bloom.Add(item)
+		switch {
+		case err != nil:
+			replies = append(replies, NewGenericError("non scaling filter is full"))
+		case added:
+			updated = true
+			replies = append(replies, protocol.MakeInteger(1))
+		default:
+			replies = append(replies, protocol.MakeInteger(0))
+		}
+	}
+
+	if !found {
+		c.DB.Store(datastructure.NewItem(key, bloom, 0))
+	} else if updated {
+		c.DB.Touch(key)
+	}
+
+	if !multi {
+		c.Conn.AsyncWrite(replies[0])
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// bfAddCommand adds the item to the Bloom filter stored at the key. Returns
+// 1 if the item was added, 0 if it may already exist.
+func bfAddCommand(c *client.Client) {
+	bfAddGenericCommand(c, false)
+}
+
+// bfMAddCommand adds the items to the Bloom filter stored at the key.
+// Returns whether each item was added.
+func bfMAddCommand(c *client.Client) {
+	bfAddGenericCommand(c, true)
+}
+
+// bfExistsGenericCommand replies whether the items may exist in the Bloom
+// filter stored at the key.
+func bfExistsGenericCommand(c *client.Client, multi bool) {
+	bloom, found, ok := lookupValue[*datastructure.BloomFilter](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	replies := make([][]byte, 0, c.Argc-1)
+	for _, item := range c.Argv[1:] {
+		if found && bloom.Exists(item) {
+			replies = append(replies, protocol.MakeInteger(1))
+		} else {
+			replies = append(replies, protocol.MakeInteger(0))
+		}
+	}
+
+	if !multi {
+		c.Conn.AsyncWrite(replies[0])
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// bfExistsCommand returns 1 if the item may exist in the Bloom filter stored
+// at the key, 0 otherwise.
+func bfExistsCommand(c *client.Client) {
+	bfExistsGenericCommand(c, false)
+}
+
+// bfMExistsCommand returns whether each item may exist in the Bloom filter
+// stored at the key.
+func bfMExistsCommand(c *client.Client) {
+	bfExistsGenericCommand(c, true)
+}
+
+// parseFilterParam parses a positive integer parameter of a filter no
+// greater than max. If the parameter is invalid, an error is sent to the
+// client and ok is false.
+func parseFilterParam(c *client.Client, arg []byte, name string, min, max int64) (int64, bool) {
+	n, ok := parseInt(c, arg)
+	if !ok {
+		return 0, false
+	}
+
+	if n < min || n > max {
+		c.Conn.AsyncWrite(NewGenericError("Bad " + name))
+		return 0, false
+	}
+	return n, true
+}
+
+// cfReserveCommand creates an empty cuckoo filter at the key with the given
+// capacity.
+func cfReserveCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	capacity, ok := parseFilterParam(c, c.Argv[1], "capacity", 1, filterMaxCapacity)
+	if !ok {
+		return
+	}
+
+	bucketSize := int64(cuckooDefaultBucketSize)
+	maxIterations := int64(cuckooDefaultMaxIterations)
+	expansion := int64(cuckooDefaultExpansion)
+	for i := 2; i < c.Argc; i += 2 {
+		if i+1 >= c.Argc {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "bucketsize":
+			bucketSize, ok = parseFilterParam(c, c.Argv[i+1], "bucket size", 1, 255)
+		case "maxiterations":
+			maxIterations, ok = parseFilterParam(c, c.Argv[i+1], "maxIterations", 1, 65535)
+		case "expansion":
+			expansion, ok = parseFilterParam(c, c.Argv[i+1], "expansion", 0, 32768)
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+
+		if !ok {
+			return
+		}
+	}
+
+	if _, found := c.DB.Get(key); found {
+		c.Conn.AsyncWrite(NewGenericError("item exists"))
+		return
+	}
+
+	cuckoo := datastructure.NewCuckooFilter(uint64(capacity), uint8(bucketSize), uint16(maxIterations), uint16(expansion))
+	c.DB.Store(datastructure.NewItem(key, cuckoo, 0))
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// cfAddGenericCommand adds the item to the cuckoo filter stored at the key,
+// creating it with the default parameters if it does not exist. When nx is
+// true, the item is only added if it does not exist yet.
+func cfAddGenericCommand(c *client.Client, nx bool) {
+	key := string(c.Argv[0])
+
+	cuckoo, found, ok := lookupValue[*datastructure.CuckooFilter](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		cuckoo = datastructure.NewCuckooFilter(cuckooDefaultCapacity, cuckooDefaultBucketSize, cuckooDefaultMaxIterations, cuckooDefaultExpansion)
+	}
+
+	if nx && found && cuckoo.Exists(c.Argv[1]) {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	if err := cuckoo.Add(c.Argv[1]); err != nil {
+		c.Conn.AsyncWrite(NewGenericError("Filter is full"))
+		return
+	}
+
+	if found {
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, cuckoo, 0))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// cfAddCommand adds the item to the cuckoo filter stored at the key, even
+// if it may already exist.
+func cfAddCommand(c *client.Client) {
+	cfAddGenericCommand(c, false)
+}
+
+// cfAddNXCommand adds the item to the cuckoo filter stored at the key if it
+// does not exist. Returns 1 if the item was added, 0 otherwise.
+func cfAddNXCommand(c *client.Client) {
+	cfAddGenericCommand(c, true)
+}
+
+// cfExistsCommand returns 1 if the item may exist in the cuckoo filter
+// stored at the key, 0 otherwise.
+func cfExistsCommand(c *client.Client) {
+	cuckoo, found, ok := lookupValue[*datastructure.CuckooFilter](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if found && cuckoo.Exists(c.Argv[1]) {
+		c.Conn.AsyncWrite(protocol.MakeInteger(1))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(0))
+}
+
+// cfDelCommand deletes one occurrence of the item from the cuckoo filter
+// stored at the key. Returns 1 if the item was deleted, 0 if it was not
+// found.
+func cfDelCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	cuckoo, found, ok := lookupValue[*datastructure.CuckooFilter](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError("Not found"))
+		return
+	}
+
+	if !cuckoo.Delete(c.Argv[1]) {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.DB.Touch(key)
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// cfCountCommand returns the estimated number of times the item was added
+// to the cuckoo filter stored at the key.
+func cfCountCommand(c *client.Client) {
+	cuckoo, found, ok := lookupValue[*datastructure.CuckooFilter](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(cuckoo.CountItem(c.Argv[1]))))
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// sortedCommandNames returns the names of the given commands in alphabetical order.
+func sortedCommandNames(commands map[string]command.Command) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// makeSimpleStringArray creates an array of simple strings.
+func makeSimpleStringArray(ss []string) []byte {
+	items := make([][]byte, len(ss))
+	for i, s := range ss {
+		items[i] = protocol.MakeSimpleString(s)
+	}
+	return protocol.MakeArray(items...)
+}
+
+// makeCommandInfo creates the reply of COMMAND INFO for the given command.
+func makeCommandInfo(name string, cmd command.Command) []byte {
+	var subCommands [][]byte
+	for _, subName := range sortedCommandNames(cmd.SubCommands) {
+		subCommands = append(subCommands,
+			makeCommandInfo(command.FullName(name, subName), cmd.SubCommands[subName]))
+	}
+
+	return protocol.MakeArray(
+		protocol.MakeBulkString(name),
+		protocol.MakeInteger(int64(cmd.Arity)),
+		makeSimpleStringArray(cmd.FlagNames()),
+		protocol.MakeInteger(int64(cmd.FirstKey)),
+		protocol.MakeInteger(int64(cmd.LastKey)),
+		protocol.MakeInteger(int64(cmd.Step)),
+		makeSimpleStringArray(cmd.CategoryNames()),
+		protocol.MakeArray(), // tips
+		protocol.MakeArray(), // key specifications
+		protocol.MakeArray(subCommands...),
+	)
+}
+
+// makeCommandDocs creates the reply of COMMAND DOCS for the given command.
+func makeCommandDocs(name string, cmd command.Command) []byte {
+	docs := [][]byte{
+		protocol.MakeBulkString("summary"),
+		protocol.MakeBulkString(cmd.Description),
+		protocol.MakeBulkString("group"),
+		protocol.MakeBulkString(cmd.Group),
+	}
+
+	if cmd.SubCommands != nil {
+		var subCommands [][]byte
+		for _, subName := range sortedCommandNames(cmd.SubCommands) {
+			fullName := command.FullName(name, subName)
+			subCommands = append(subCommands,
+				protocol.MakeBulkString(fullName),
+				makeCommandDocs(fullName, cmd.SubCommands[subName]))
+		}
+
+		docs = append(docs,
+			protocol.MakeBulkString("subcommands"),
+			protocol.MakeArray(subCommands...))
+	}
+
+	return protocol.MakeArray(docs...)
+}
+
+// commandCommand sends the info of every registered command to the client.
+func commandCommand(c *client.Client) {
+	var infos [][]byte
+	for _, name := range sortedCommandNames(CommandTable) {
+		infos = append(infos, makeCommandInfo(name, CommandTable[name]))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(infos...))
+}
+
+// commandCountSubCommand sends the number of registered commands.
+func commandCountSubCommand(c *client.Client) {
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(CommandTable))))
+}
+
+// commandListSubCommand sends the names of every registered command.
+func commandListSubCommand(c *client.Client) {
+	var names [][]byte
+	for _, name := range sortedCommandNames(CommandTable) {
+		names = append(names, protocol.MakeBulkString(name))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(names...))
+}
+
+// commandInfoSubCommand sends the info of the given commands, or of every
+// command if none are given. A null is sent for every unknown command.
+func commandInfoSubCommand(c *client.Client) {
+	if c.Argc == 1 {
+		commandCommand(c)
+		return
+	}
+
+	var infos [][]byte
+	for _, arg := range c.Argv[1:] {
+		name := string(bytes.ToLower(arg))
+		cmd, ok := CommandTable[name]
+		if !ok {
+			infos = append(infos, protocol.MakeNull())
+			continue
+		}
+
+		infos = append(infos, makeCommandInfo(name, cmd))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(infos...))
+}
+
+// commandDocsSubCommand sends the documentation of the given commands,
+// or of every command if none are given. Unknown commands are skipped.
+func commandDocsSubCommand(c *client.Client) {
+	names := sortedCommandNames(CommandTable)
+	if c.Argc > 1 {
+		names = names[:0]
+		for _, arg := range c.Argv[1:] {
+			names = append(names, string(bytes.ToLower(arg)))
+		}
+	}
+
+	var docs [][]byte
+	for _, name := range names {
+		cmd, ok := CommandTable[name]
+		if !ok {
+			continue
+		}
+
+		docs = append(docs, protocol.MakeBulkString(name), makeCommandDocs(name, cmd))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(docs...))
+}
+
+// commandGetKeysSubCommand sends the keys of the given full command.
+func commandGetKeysSubCommand(c *client.Client) {
+	argv := c.Argv[1:]
+
+	cmd, err := server.lookupCommand(bytes.ToLower(argv[0]), argv[1:])
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError("invalid command specified"))
+		return
+	}
+
+	if !cmd.CheckArity(len(argv)) {
+		c.Conn.AsyncWrite(NewGenericError("invalid number of arguments specified for command"))
+		return
+	}
+
+	keys, err := cmd.GetKeys(argv)
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return
+	}
+
+	if len(keys) == 0 {
+		c.Conn.AsyncWrite(NewGenericError("the command has no key arguments"))
+		return
+	}
+
+	replies := make([][]byte, len(keys))
+	for i, key := range keys {
+		replies[i] = protocol.MakeBulkString(string(key))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
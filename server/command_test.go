@@ -0,0 +1,33 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_CommandGetKeys(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+
+	tc := []struct {
+		name     string
+		args     []string
+		expected any
+	}{
+		{"zunionstore", []string{"zunionstore", "d", "2", "a", "b", "weights", "1", "2"}, []any{[]byte("d"), []byte("a"), []byte("b")}},
+		{"zunionstore numkeys too large", []string{"zunionstore", "d", "5", "a"}, "ERR invalid arguments specified for command"},
+		{"zinterstore numkeys not a number", []string{"zinterstore", "d", "x", "a"}, "ERR invalid arguments specified for command"},
+		{"zinterstore numkeys zero", []string{"zinterstore", "d", "0", "a"}, "ERR invalid arguments specified for command"},
+		{"xread", []string{"xread", "count", "1", "streams", "a", "b", "0", "0"}, []any{[]byte("a"), []byte("b")}},
+		{"xread unbalanced streams", []string{"xread", "streams", "a", "b", "0"}, "ERR invalid arguments specified for command"},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := testCall(t, c, append([]string{"command", "getkeys"}, tt.args...)...)
+			if !reflect.DeepEqual(reply, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,1962 @@
+package server
+
+import (
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+)
+
+// CommandTable is the table of commands that the server supports.
+var CommandTable map[string]command.Command
+
+// The table is populated in init as some commands (e.g. command)
+// read the table themselves.
+func init() {
+	CommandTable = map[string]command.Command{
+		"get": {
+			Name:        "get",
+			Description: "Gets a key's value",
+			Group:       "string",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        getCommand},
+		"set": {
+			Name:        "set",
+			Description: "Sets a new key",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryString,
+			Proc:        setCommand},
+		"append": {
+			Name:        "append",
+			Description: "Appends a value to a key",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        appendCommand},
+		"strlen": {
+			Name:        "strlen",
+			Description: "Returns the length of a key's value",
+			Group:       "string",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        strlenCommand},
+		"getrange": {
+			Name:        "getrange",
+			Description: "Returns a substring of a key's value",
+			Group:       "string",
+			Type:        command.Read,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryString,
+			Proc:        getrangeCommand},
+		"setrange": {
+			Name:        "setrange",
+			Description: "Overwrites part of a key's value starting at an offset",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryString,
+			Proc:        setrangeCommand},
+		"getdel": {
+			Name:        "getdel",
+			Description: "Gets a key's value and deletes the key",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        getdelCommand},
+		"getex": {
+			Name:        "getex",
+			Description: "Gets a key's value and optionally sets its expire time",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        getexCommand},
+		"getset": {
+			Name:        "getset",
+			Description: "Sets a key's value and returns its old value",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        getsetCommand},
+		"mset": {
+			Name:        "mset",
+			Description: "Sets the values of multiple keys",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        2,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryString,
+			Proc:        msetCommand},
+		"msetnx": {
+			Name:        "msetnx",
+			Description: "Sets the values of multiple keys only if none of them exists",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        2,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryString,
+			Proc:        msetnxCommand},
+		"mget": {
+			Name:        "mget",
+			Description: "Gets the values of multiple keys",
+			Group:       "string",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        mgetCommand},
+		"incr": {
+			Name:        "incr",
+			Description: "Increments the integer value of a key by one",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        incrCommand},
+		"decr": {
+			Name:        "decr",
+			Description: "Decrements the integer value of a key by one",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        decrCommand},
+		"incrby": {
+			Name:        "incrby",
+			Description: "Increments the integer value of a key by the given amount",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        incrbyCommand},
+		"decrby": {
+			Name:        "decrby",
+			Description: "Decrements the integer value of a key by the given amount",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        decrbyCommand},
+		"incrbyfloat": {
+			Name:        "incrbyfloat",
+			Description: "Increments the floating point value of a key by the given amount",
+			Group:       "string",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryString,
+			Proc:        incrbyfloatCommand},
+		"del": {
+			Name:        "del",
+			Description: "Deletes a key",
+			Group:       "generic",
+			Type:        command.Write,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryKeyspace,
+			Proc:        delCommand},
+		"keys": {
+			Name:        "keys",
+			Description: "Gets all keys",
+			Group:       "generic",
+			Type:        command.Read,
+			Arity:       2,
+			Categories:  command.CategoryKeyspace | command.CategoryRead | command.CategoryDangerous,
+			Proc:        keysCommand},
+		"info": {
+			Name:        "info",
+			Description: "Gets server info",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       -1,
+			Categories:  command.CategoryDangerous,
+			Proc:        infoCommand},
+		"ping": {
+			Name:        "ping",
+			Description: "Pings the server",
+			Group:       "connection",
+			Type:        command.Read,
+			Arity:       -1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryConnection,
+			Proc:        pingCommand},
+		"flushall": {
+			Name:        "flushall",
+			Description: "Flushes all keys",
+			Group:       "server",
+			Type:        command.Write,
+			Arity:       -1,
+			Categories:  command.CategoryKeyspace | command.CategoryWrite | command.CategoryDangerous,
+			Proc:        flushallCommand},
+		"command": {
+			Name:        "command",
+			Description: "Gets all commands",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       -1,
+			Categories:  command.CategoryConnection,
+			Proc:        commandCommand,
+			SubCommands: commandSubCommands},
+		"expire": {
+			Name:        "expire",
+			Description: "Sets a key's expiration by seconds",
+			Group:       "generic",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        expireCommand},
+		"pexpire": {
+			Name:        "pexpire",
+			Description: "Sets a key's expiration by milliseconds",
+			Group:       "generic",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        pexpireCommand},
+		"ttl": {
+			Name:        "ttl",
+			Description: "Gets a key's expiration in seconds",
+			Group:       "generic",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        ttlCommand},
+		"pttl": {
+			Name:        "pttl",
+			Description: "Gets a key's expiration in milliseconds",
+			Group:       "generic",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        pttlCommand},
+		"expireat": {
+			Name:        "expireat",
+			Description: "Sets a key's expiration to a unix timestamp in seconds",
+			Group:       "generic",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        expireatCommand},
+		"pexpireat": {
+			Name:        "pexpireat",
+			Description: "Sets a key's expiration to a unix timestamp in milliseconds",
+			Group:       "generic",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        pexpireatCommand},
+		"save": {
+			Name:        "save",
+			Description: "Synchronously saves the database on disk",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagAdmin,
+			Proc:        saveCommand},
+		"bgsave": {
+			Name:        "bgsave",
+			Description: "Saves the database on disk in the background",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagAdmin,
+			Proc:        bgsaveCommand},
+		"lastsave": {
+			Name:        "lastsave",
+			Description: "Gets the unix time of the last successful save",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagAdmin | command.FlagFast,
+			Proc:        lastsaveCommand},
+		"bgrewriteaof": {
+			Name:        "bgrewriteaof",
+			Description: "Rewrites the append only file in the background",
+			Group:       "server",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagAdmin,
+			Proc:        bgrewriteaofCommand},
+		"type": {
+			Name:        "type",
+			Description: "Gets the type of the value stored at a key",
+			Group:       "generic",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryKeyspace,
+			Proc:        typeCommand},
+		"lpush": {
+			Name:        "lpush",
+			Description: "Inserts elements at the head of a list",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryList,
+			Proc:        lpushCommand},
+		"rpush": {
+			Name:        "rpush",
+			Description: "Inserts elements at the tail of a list",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryList,
+			Proc:        rpushCommand},
+		"lpop": {
+			Name:        "lpop",
+			Description: "Removes and returns the first elements of a list",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryList,
+			Proc:        lpopCommand},
+		"rpop": {
+			Name:        "rpop",
+			Description: "Removes and returns the last elements of a list",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryList,
+			Proc:        rpopCommand},
+		"blpop": {
+			Name:        "blpop",
+			Description: "Removes and returns the first element of the first non-empty list, blocking until one is available",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -2,
+			Step:        1,
+			Categories:  command.CategoryList | command.CategoryBlocking,
+			Proc:        blpopCommand},
+		"brpop": {
+			Name:        "brpop",
+			Description: "Removes and returns the last element of the first non-empty list, blocking until one is available",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -2,
+			Step:        1,
+			Categories:  command.CategoryList | command.CategoryBlocking,
+			Proc:        brpopCommand},
+		"blmove": {
+			Name:        "blmove",
+			Description: "Moves an element from a list to another and returns it, blocking until one is available",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       6,
+			FirstKey:    1,
+			LastKey:     2,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryList | command.CategoryBlocking,
+			Proc:        blmoveCommand},
+		"llen": {
+			Name:        "llen",
+			Description: "Gets the length of a list",
+			Group:       "list",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryList,
+			Proc:        llenCommand},
+		"lrange": {
+			Name:        "lrange",
+			Description: "Gets a range of elements from a list",
+			Group:       "list",
+			Type:        command.Read,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryList,
+			Proc:        lrangeCommand},
+		"lindex": {
+			Name:        "lindex",
+			Description: "Gets an element from a list by its index",
+			Group:       "list",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryList,
+			Proc:        lindexCommand},
+		"lset": {
+			Name:        "lset",
+			Description: "Sets the value of an element in a list by its index",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryList,
+			Proc:        lsetCommand},
+		"lrem": {
+			Name:        "lrem",
+			Description: "Removes elements from a list",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryList,
+			Proc:        lremCommand},
+		"ltrim": {
+			Name:        "ltrim",
+			Description: "Trims a list to the specified range",
+			Group:       "list",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryList,
+			Proc:        ltrimCommand},
+		"hset": {
+			Name:        "hset",
+			Description: "Sets the given fields of a hash",
+			Group:       "hash",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hsetCommand},
+		"hget": {
+			Name:        "hget",
+			Description: "Returns the value of a field of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hgetCommand},
+		"hmget": {
+			Name:        "hmget",
+			Description: "Returns the values of the given fields of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hmgetCommand},
+		"hdel": {
+			Name:        "hdel",
+			Description: "Deletes the given fields from a hash",
+			Group:       "hash",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hdelCommand},
+		"hgetall": {
+			Name:        "hgetall",
+			Description: "Returns all the fields and values of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryHash,
+			Proc:        hgetallCommand},
+		"hincrby": {
+			Name:        "hincrby",
+			Description: "Increments the integer value of a field of a hash",
+			Group:       "hash",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hincrbyCommand},
+		"hexists": {
+			Name:        "hexists",
+			Description: "Returns whether a field exists in a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hexistsCommand},
+		"hkeys": {
+			Name:        "hkeys",
+			Description: "Returns all the fields of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryHash,
+			Proc:        hkeysCommand},
+		"hvals": {
+			Name:        "hvals",
+			Description: "Returns all the values of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryHash,
+			Proc:        hvalsCommand},
+		"hlen": {
+			Name:        "hlen",
+			Description: "Returns the number of fields in a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryHash,
+			Proc:        hlenCommand},
+		"hscan": {
+			Name:        "hscan",
+			Description: "Incrementally iterates over the fields of a hash",
+			Group:       "hash",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryHash,
+			Proc:        hscanCommand},
+		"memory": {
+			Name:        "memory",
+			Description: "Reports the memory usage of the server",
+			Group:       "server",
+			Arity:       -2,
+			SubCommands: memorySubCommands,
+		},
+		"sadd": {
+			Name:        "sadd",
+			Description: "Adds members to a set",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategorySet,
+			Proc:        saddCommand},
+		"srem": {
+			Name:        "srem",
+			Description: "Removes members from a set",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySet,
+			Proc:        sremCommand},
+		"smembers": {
+			Name:        "smembers",
+			Description: "Returns all the members of a set",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategorySet,
+			Proc:        smembersCommand},
+		"sismember": {
+			Name:        "sismember",
+			Description: "Returns whether a member is in a set",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySet,
+			Proc:        sismemberCommand},
+		"scard": {
+			Name:        "scard",
+			Description: "Returns the number of members in a set",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySet,
+			Proc:        scardCommand},
+		"sinter": {
+			Name:        "sinter",
+			Description: "Returns the intersection of sets",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Categories:  command.CategorySet,
+			Proc:        sinterCommand},
+		"sinterstore": {
+			Name:        "sinterstore",
+			Description: "Stores the intersection of sets in a key",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategorySet,
+			Proc:        sinterstoreCommand},
+		"sunion": {
+			Name:        "sunion",
+			Description: "Returns the union of sets",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Categories:  command.CategorySet,
+			Proc:        sunionCommand},
+		"sunionstore": {
+			Name:        "sunionstore",
+			Description: "Stores the union of sets in a key",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategorySet,
+			Proc:        sunionstoreCommand},
+		"sdiff": {
+			Name:        "sdiff",
+			Description: "Returns the difference between the first set and the others",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Categories:  command.CategorySet,
+			Proc:        sdiffCommand},
+		"sdiffstore": {
+			Name:        "sdiffstore",
+			Description: "Stores the difference between the first set and the others in a key",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategorySet,
+			Proc:        sdiffstoreCommand},
+		"srandmember": {
+			Name:        "srandmember",
+			Description: "Returns random members of a set",
+			Group:       "set",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategorySet,
+			Proc:        srandmemberCommand},
+		"spop": {
+			Name:        "spop",
+			Description: "Removes and returns random members of a set",
+			Group:       "set",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySet,
+			Proc:        spopCommand},
+		"zadd": {
+			Name:        "zadd",
+			Description: "Adds members to a sorted set or updates their score",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zaddCommand},
+		"zincrby": {
+			Name:        "zincrby",
+			Description: "Increments the score of a member of a sorted set",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zincrbyCommand},
+		"zrem": {
+			Name:        "zrem",
+			Description: "Removes members from a sorted set",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zremCommand},
+		"zcard": {
+			Name:        "zcard",
+			Description: "Returns the number of members in a sorted set",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zcardCommand},
+		"zscore": {
+			Name:        "zscore",
+			Description: "Returns the score of a member of a sorted set",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zscoreCommand},
+		"zrank": {
+			Name:        "zrank",
+			Description: "Returns the rank of a member of a sorted set ordered from the lowest score",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zrankCommand},
+		"zrevrank": {
+			Name:        "zrevrank",
+			Description: "Returns the rank of a member of a sorted set ordered from the highest score",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategorySortedSet,
+			Proc:        zrevrankCommand},
+		"zrange": {
+			Name:        "zrange",
+			Description: "Returns members of a sorted set within a range of ranks, scores or members",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategorySortedSet,
+			Proc:        zrangeCommand},
+		"zrangebyscore": {
+			Name:        "zrangebyscore",
+			Description: "Returns members of a sorted set within a range of scores",
+			Group:       "sortedset",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategorySortedSet,
+			Proc:        zrangebyscoreCommand},
+		"zunionstore": {
+			Name:        "zunionstore",
+			Description: "Stores the union of sorted sets in a key",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			KeysFunc:    zunionInterGetKeys,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategorySortedSet,
+			Proc:        zunionstoreCommand},
+		"zinterstore": {
+			Name:        "zinterstore",
+			Description: "Stores the intersection of sorted sets in a key",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			KeysFunc:    zunionInterGetKeys,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategorySortedSet,
+			Proc:        zinterstoreCommand},
+		"bzpopmin": {
+			Name:        "bzpopmin",
+			Description: "Removes and returns the member with the lowest score of the first non-empty sorted set, blocking until one is available",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -2,
+			Step:        1,
+			Categories:  command.CategorySortedSet | command.CategoryBlocking,
+			Proc:        bzpopminCommand},
+		"bzpopmax": {
+			Name:        "bzpopmax",
+			Description: "Removes and returns the member with the highest score of the first non-empty sorted set, blocking until one is available",
+			Group:       "sortedset",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     -2,
+			Step:        1,
+			Categories:  command.CategorySortedSet | command.CategoryBlocking,
+			Proc:        bzpopmaxCommand},
+		"xadd": {
+			Name:        "xadd",
+			Description: "Appends an entry to a stream",
+			Group:       "stream",
+			Type:        command.Write,
+			Arity:       -5,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryStream,
+			Proc:        xaddCommand},
+		"xlen": {
+			Name:        "xlen",
+			Description: "Returns the number of entries in a stream",
+			Group:       "stream",
+			Type:        command.Read,
+			Arity:       2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryStream,
+			Proc:        xlenCommand},
+		"xrange": {
+			Name:        "xrange",
+			Description: "Returns the entries of a stream within a range of IDs",
+			Group:       "stream",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryStream,
+			Proc:        xrangeCommand},
+		"xrevrange": {
+			Name:        "xrevrange",
+			Description: "Returns the entries of a stream within a range of IDs in reverse order",
+			Group:       "stream",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryStream,
+			Proc:        xrevrangeCommand},
+		"xread": {
+			Name:        "xread",
+			Description: "Returns the entries of streams with an ID greater than the given ones, optionally blocking",
+			Group:       "stream",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    0,
+			LastKey:     0,
+			Step:        0,
+			KeysFunc:    xreadGetKeys,
+			Categories:  command.CategoryStream | command.CategoryBlocking,
+			Proc:        xreadCommand},
+		"xreadgroup": {
+			Name:        "xreadgroup",
+			Description: "Delivers the entries of streams to a consumer of a consumer group, optionally blocking",
+			Group:       "stream",
+			Type:        command.Write,
+			Arity:       -7,
+			FirstKey:    0,
+			LastKey:     0,
+			Step:        0,
+			KeysFunc:    xreadGetKeys,
+			Categories:  command.CategoryStream | command.CategoryBlocking,
+			Proc:        xreadgroupCommand},
+		"xack": {
+			Name:        "xack",
+			Description: "Acknowledges entries delivered to a consumer group",
+			Group:       "stream",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryStream,
+			Proc:        xackCommand},
+		"xpending": {
+			Name:        "xpending",
+			Description: "Returns the pending entries of a consumer group",
+			Group:       "stream",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryStream,
+			Proc:        xpendingCommand},
+		"xclaim": {
+			Name:        "xclaim",
+			Description: "Transfers pending entries of a consumer group to another consumer",
+			Group:       "stream",
+			Type:        command.Write,
+			Arity:       -6,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryStream,
+			Proc:        xclaimCommand},
+		"xgroup": {
+			Name:        "xgroup",
+			Description: "Manages the consumer groups of a stream",
+			Group:       "stream",
+			Arity:       -2,
+			SubCommands: xgroupSubCommands,
+		},
+		"setbit": {
+			Name:        "setbit",
+			Description: "Sets or clears the bit at an offset of a key's value",
+			Group:       "bitmap",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryBitmap,
+			Proc:        setbitCommand},
+		"getbit": {
+			Name:        "getbit",
+			Description: "Returns the bit at an offset of a key's value",
+			Group:       "bitmap",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryBitmap,
+			Proc:        getbitCommand},
+		"bitcount": {
+			Name:        "bitcount",
+			Description: "Counts the bits set in a key's value",
+			Group:       "bitmap",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryBitmap,
+			Proc:        bitcountCommand},
+		"bitpos": {
+			Name:        "bitpos",
+			Description: "Returns the offset of the first bit set or cleared in a key's value",
+			Group:       "bitmap",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryBitmap,
+			Proc:        bitposCommand},
+		"bitop": {
+			Name:        "bitop",
+			Description: "Stores the result of a bitwise operation between keys in a key",
+			Group:       "bitmap",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    2,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryBitmap,
+			Proc:        bitopCommand},
+		"bitfield": {
+			Name:        "bitfield",
+			Description: "Gets, sets and increments integers of arbitrary width in a key's value",
+			Group:       "bitmap",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryBitmap,
+			Proc:        bitfieldCommand},
+		"pfadd": {
+			Name:        "pfadd",
+			Description: "Adds elements to a HyperLogLog key, creating it if it does not exist",
+			Group:       "hyperloglog",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryHyperLogLog,
+			Proc:        pfaddCommand},
+		"pfcount": {
+			Name:        "pfcount",
+			Description: "Returns the estimated cardinality of the union of HyperLogLog keys",
+			Group:       "hyperloglog",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Categories:  command.CategoryHyperLogLog,
+			Proc:        pfcountCommand},
+		"pfmerge": {
+			Name:        "pfmerge",
+			Description: "Merges HyperLogLog keys into a HyperLogLog key",
+			Group:       "hyperloglog",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryHyperLogLog,
+			Proc:        pfmergeCommand},
+		"geoadd": {
+			Name:        "geoadd",
+			Description: "Adds locations to a geospatial index, creating it if it does not exist",
+			Group:       "geo",
+			Type:        command.Write,
+			Arity:       -5,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryGeo,
+			Proc:        geoaddCommand},
+		"geodist": {
+			Name:        "geodist",
+			Description: "Returns the distance between two members of a geospatial index",
+			Group:       "geo",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryGeo,
+			Proc:        geodistCommand},
+		"geopos": {
+			Name:        "geopos",
+			Description: "Returns the longitude and latitude of members of a geospatial index",
+			Group:       "geo",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryGeo,
+			Proc:        geoposCommand},
+		"geohash": {
+			Name:        "geohash",
+			Description: "Returns the geohash strings of members of a geospatial index",
+			Group:       "geo",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryGeo,
+			Proc:        geohashCommand},
+		"geosearch": {
+			Name:        "geosearch",
+			Description: "Returns the members of a geospatial index within a radius or a box",
+			Group:       "geo",
+			Type:        command.Read,
+			Arity:       -7,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryGeo,
+			Proc:        geosearchCommand},
+		"geosearchstore": {
+			Name:        "geosearchstore",
+			Description: "Stores the members of a geospatial index within a radius or a box in a key",
+			Group:       "geo",
+			Type:        command.Write,
+			Arity:       -8,
+			FirstKey:    1,
+			LastKey:     2,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryGeo,
+			Proc:        geosearchstoreCommand},
+		"json.set": {
+			Name:        "json.set",
+			Description: "Sets the JSON value at a path of a JSON document",
+			Group:       "json",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonSetCommand},
+		"json.get": {
+			Name:        "json.get",
+			Description: "Returns the JSON values at paths of a JSON document",
+			Group:       "json",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonGetCommand},
+		"json.del": {
+			Name:        "json.del",
+			Description: "Deletes the JSON values at a path of a JSON document",
+			Group:       "json",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonDelCommand},
+		"json.numincrby": {
+			Name:        "json.numincrby",
+			Description: "Increments the numbers at a path of a JSON document",
+			Group:       "json",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonNumIncrByCommand},
+		"json.arrappend": {
+			Name:        "json.arrappend",
+			Description: "Appends JSON values to the arrays at a path of a JSON document",
+			Group:       "json",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonArrAppendCommand},
+		"json.merge": {
+			Name:        "json.merge",
+			Description: "Merges a JSON value into the values at a path of a JSON document",
+			Group:       "json",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryJSON,
+			Proc:        jsonMergeCommand},
+		"bf.reserve": {
+			Name:        "bf.reserve",
+			Description: "Creates an empty Bloom filter with the given error rate and capacity",
+			Group:       "bloom",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryBloom,
+			Proc:        bfReserveCommand},
+		"bf.add": {
+			Name:        "bf.add",
+			Description: "Adds an item to a Bloom filter, creating it if it does not exist",
+			Group:       "bloom",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryBloom,
+			Proc:        bfAddCommand},
+		"bf.madd": {
+			Name:        "bf.madd",
+			Description: "Adds items to a Bloom filter, creating it if it does not exist",
+			Group:       "bloom",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryBloom,
+			Proc:        bfMAddCommand},
+		"bf.exists": {
+			Name:        "bf.exists",
+			Description: "Checks whether an item may exist in a Bloom filter",
+			Group:       "bloom",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryBloom,
+			Proc:        bfExistsCommand},
+		"bf.mexists": {
+			Name:        "bf.mexists",
+			Description: "Checks whether items may exist in a Bloom filter",
+			Group:       "bloom",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryBloom,
+			Proc:        bfMExistsCommand},
+		"cf.reserve": {
+			Name:        "cf.reserve",
+			Description: "Creates an empty cuckoo filter with the given capacity",
+			Group:       "cuckoo",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfReserveCommand},
+		"cf.add": {
+			Name:        "cf.add",
+			Description: "Adds an item to a cuckoo filter, creating it if it does not exist",
+			Group:       "cuckoo",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfAddCommand},
+		"cf.addnx": {
+			Name:        "cf.addnx",
+			Description: "Adds an item to a cuckoo filter if it does not exist in the filter",
+			Group:       "cuckoo",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM | command.FlagFast,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfAddNXCommand},
+		"cf.exists": {
+			Name:        "cf.exists",
+			Description: "Checks whether an item may exist in a cuckoo filter",
+			Group:       "cuckoo",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfExistsCommand},
+		"cf.del": {
+			Name:        "cf.del",
+			Description: "Deletes an item from a cuckoo filter",
+			Group:       "cuckoo",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfDelCommand},
+		"cf.count": {
+			Name:        "cf.count",
+			Description: "Returns the estimated number of times an item was added to a cuckoo filter",
+			Group:       "cuckoo",
+			Type:        command.Read,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryCuckoo,
+			Proc:        cfCountCommand},
+		"cms.initbydim": {
+			Name:        "cms.initbydim",
+			Description: "Creates an empty count-min sketch with the given dimensions",
+			Group:       "cms",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryCMS,
+			Proc:        cmsInitByDimCommand},
+		"cms.initbyprob": {
+			Name:        "cms.initbyprob",
+			Description: "Creates an empty count-min sketch with the given error rate and probability",
+			Group:       "cms",
+			Type:        command.Write,
+			Arity:       4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryCMS,
+			Proc:        cmsInitByProbCommand},
+		"cms.incrby": {
+			Name:        "cms.incrby",
+			Description: "Increments the counts of items in a count-min sketch",
+			Group:       "cms",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryCMS,
+			Proc:        cmsIncrByCommand},
+		"cms.query": {
+			Name:        "cms.query",
+			Description: "Returns the estimated counts of items in a count-min sketch",
+			Group:       "cms",
+			Type:        command.Read,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryCMS,
+			Proc:        cmsQueryCommand},
+		"cms.merge": {
+			Name:        "cms.merge",
+			Description: "Merges count-min sketches into a count-min sketch",
+			Group:       "cms",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			KeysFunc:    zunionInterGetKeys,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryCMS,
+			Proc:        cmsMergeCommand},
+		"topk.reserve": {
+			Name:        "topk.reserve",
+			Description: "Creates an empty top-k sketch tracking the k most frequent items",
+			Group:       "topk",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryTopK,
+			Proc:        topkReserveCommand},
+		"topk.add": {
+			Name:        "topk.add",
+			Description: "Adds items to a top-k sketch",
+			Group:       "topk",
+			Type:        command.Write,
+			Arity:       -3,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryTopK,
+			Proc:        topkAddCommand},
+		"topk.list": {
+			Name:        "topk.list",
+			Description: "Returns the most frequent items of a top-k sketch",
+			Group:       "topk",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryTopK,
+			Proc:        topkListCommand},
+		"ts.create": {
+			Name:        "ts.create",
+			Description: "Creates an empty time series",
+			Group:       "timeseries",
+			Type:        command.Write,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsCreateCommand},
+		"ts.add": {
+			Name:        "ts.add",
+			Description: "Adds a sample to a time series, creating it if it does not exist",
+			Group:       "timeseries",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsAddCommand},
+		"ts.madd": {
+			Name:        "ts.madd",
+			Description: "Adds samples to time series",
+			Group:       "timeseries",
+			Type:        command.Write,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        3,
+			Flags:       command.FlagDenyOOM,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsMAddCommand},
+		"ts.range": {
+			Name:        "ts.range",
+			Description: "Returns the samples of a time series within a range, optionally aggregated",
+			Group:       "timeseries",
+			Type:        command.Read,
+			Arity:       -4,
+			FirstKey:    1,
+			LastKey:     1,
+			Step:        1,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsRangeCommand},
+		"ts.mrange": {
+			Name:        "ts.mrange",
+			Description: "Returns the samples within a range of the time series matching label filters",
+			Group:       "timeseries",
+			Type:        command.Read,
+			Arity:       -5,
+			Categories:  command.CategoryTimeSeries | command.CategoryRead,
+			Proc:        tsMRangeCommand},
+		"ts.createrule": {
+			Name:        "ts.createrule",
+			Description: "Creates a compaction rule downsampling a time series into another",
+			Group:       "timeseries",
+			Type:        command.Write,
+			Arity:       6,
+			FirstKey:    1,
+			LastKey:     2,
+			Step:        1,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsCreateRuleCommand},
+		"ts.deleterule": {
+			Name:        "ts.deleterule",
+			Description: "Deletes a compaction rule",
+			Group:       "timeseries",
+			Type:        command.Write,
+			Arity:       3,
+			FirstKey:    1,
+			LastKey:     2,
+			Step:        1,
+			Categories:  command.CategoryTimeSeries,
+			Proc:        tsDeleteRuleCommand},
+		"multi": {
+			Name:        "multi",
+			Description: "Marks the start of a transaction",
+			Group:       "transactions",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryTransaction,
+			Proc:        multiCommand},
+		"exec": {
+			Name:        "exec",
+			Description: "Executes the commands queued in a transaction",
+			Group:       "transactions",
+			Type:        command.Write,
+			Arity:       1,
+			Categories:  command.CategoryTransaction,
+			Proc:        execCommand},
+		"discard": {
+			Name:        "discard",
+			Description: "Discards the commands queued in a transaction",
+			Group:       "transactions",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryTransaction,
+			Proc:        discardCommand},
+		"watch": {
+			Name:        "watch",
+			Description: "Watches keys to abort the next transaction if they are modified",
+			Group:       "transactions",
+			Type:        command.Read,
+			Arity:       -2,
+			FirstKey:    1,
+			LastKey:     -1,
+			Step:        1,
+			Flags:       command.FlagNoMulti | command.FlagFast,
+			Categories:  command.CategoryTransaction,
+			Proc:        watchCommand},
+		"unwatch": {
+			Name:        "unwatch",
+			Description: "Forgets the keys watched by the connection",
+			Group:       "transactions",
+			Type:        command.Read,
+			Arity:       1,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryTransaction,
+			Proc:        unwatchCommand},
+		"subscribe": {
+			Name:        "subscribe",
+			Description: "Subscribes to channels",
+			Group:       "pubsub",
+			Type:        command.Read,
+			Arity:       -2,
+			Flags:       command.FlagNoMulti,
+			Categories:  command.CategoryPubSub,
+			Proc:        subscribeCommand},
+		"unsubscribe": {
+			Name:        "unsubscribe",
+			Description: "Unsubscribes from channels",
+			Group:       "pubsub",
+			Type:        command.Read,
+			Arity:       -1,
+			Flags:       command.FlagNoMulti,
+			Categories:  command.CategoryPubSub,
+			Proc:        unsubscribeCommand},
+		"psubscribe": {
+			Name:        "psubscribe",
+			Description: "Subscribes to channels matching patterns",
+			Group:       "pubsub",
+			Type:        command.Read,
+			Arity:       -2,
+			Flags:       command.FlagNoMulti,
+			Categories:  command.CategoryPubSub,
+			Proc:        psubscribeCommand},
+		"punsubscribe": {
+			Name:        "punsubscribe",
+			Description: "Unsubscribes from patterns",
+			Group:       "pubsub",
+			Type:        command.Read,
+			Arity:       -1,
+			Flags:       command.FlagNoMulti,
+			Categories:  command.CategoryPubSub,
+			Proc:        punsubscribeCommand},
+		"publish": {
+			Name:        "publish",
+			Description: "Posts a message to a channel",
+			Group:       "pubsub",
+			Type:        command.Read,
+			Arity:       3,
+			Flags:       command.FlagFast,
+			Categories:  command.CategoryPubSub,
+			Proc:        publishCommand},
+		"pubsub": {
+			Name:        "pubsub",
+			Description: "Inspects the state of the publish/subscribe subsystem",
+			Group:       "pubsub",
+			Arity:       -2,
+			Categories:  command.CategoryPubSub,
+			SubCommands: pubsubSubCommands,
+		},
+		"client": {
+			Name:        "client",
+			Description: "Manages client connections",
+			Group:       "connection",
+			Arity:       -2,
+			Categories:  command.CategoryConnection,
+			SubCommands: clientSubCommands,
+		},
+	}
+}
+
+var clientSubCommands = map[string]command.Command{
+	"id": {
+		Name:        "id",
+		Description: "Returns the id of the current connection",
+		Group:       "connection",
+		Type:        command.Read,
+		Arity:       2,
+		Flags:       command.FlagFast,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+	"info": {
+		Name:        "info",
+		Description: "Returns the info of the current connection",
+		Group:       "connection",
+		Type:        command.Read,
+		Arity:       2,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+	"list": {
+		Name:        "list",
+		Description: "Lists all connected clients",
+		Group:       "connection",
+		Type:        command.Read,
+		Arity:       2,
+		Flags:       command.FlagAdmin,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+	"kill": {
+		Name:        "kill",
+		Description: "Closes a given connection",
+		Group:       "connection",
+		Type:        command.Write,
+		Arity:       4,
+		Flags:       command.FlagAdmin | command.FlagNoMulti,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+	"setname": {
+		Name:        "setname",
+		Description: "Sets the name of the current connection",
+		Group:       "connection",
+		Type:        command.Write,
+		Arity:       3,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+	"getname": {
+		Name:        "getname",
+		Description: "Gets the name of the current connection",
+		Group:       "connection",
+		Type:        command.Read,
+		Arity:       2,
+		Categories:  command.CategoryConnection,
+		Proc:        clientCommand,
+	},
+}
+
+var memorySubCommands = map[string]command.Command{
+	"usage": {
+		Name:        "usage",
+		Description: "Returns the estimated amount of bytes used by a key",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       3,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Categories:  command.CategoryKeyspace,
+		Proc:        memoryUsageSubCommand,
+	},
+}
+
+var commandSubCommands = map[string]command.Command{
+	"count": {
+		Name:        "count",
+		Description: "Returns the number of commands",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       2,
+		Categories:  command.CategoryConnection,
+		Proc:        commandCountSubCommand,
+	},
+	"info": {
+		Name:        "info",
+		Description: "Returns information about the given commands",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       -2,
+		Categories:  command.CategoryConnection,
+		Proc:        commandInfoSubCommand,
+	},
+	"docs": {
+		Name:        "docs",
+		Description: "Returns the documentation of the given commands",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       -2,
+		Categories:  command.CategoryConnection,
+		Proc:        commandDocsSubCommand,
+	},
+	"getkeys": {
+		Name:        "getkeys",
+		Description: "Extracts the keys from a full command",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       -3,
+		Categories:  command.CategoryConnection,
+		Proc:        commandGetKeysSubCommand,
+	},
+	"list": {
+		Name:        "list",
+		Description: "Returns the names of every command",
+		Group:       "server",
+		Type:        command.Read,
+		Arity:       2,
+		Categories:  command.CategoryConnection,
+		Proc:        commandListSubCommand,
+	},
+}
+
+var xgroupSubCommands = map[string]command.Command{
+	"create": {
+		Name:        "create",
+		Description: "Creates a consumer group",
+		Group:       "stream",
+		Type:        command.Write,
+		Arity:       -5,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Flags:       command.FlagDenyOOM,
+		Categories:  command.CategoryStream,
+		Proc:        xgroupCreateSubCommand,
+	},
+	"setid": {
+		Name:        "setid",
+		Description: "Sets the last delivered ID of a consumer group",
+		Group:       "stream",
+		Type:        command.Write,
+		Arity:       -5,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Categories:  command.CategoryStream,
+		Proc:        xgroupSetIDSubCommand,
+	},
+	"destroy": {
+		Name:        "destroy",
+		Description: "Deletes a consumer group",
+		Group:       "stream",
+		Type:        command.Write,
+		Arity:       4,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Categories:  command.CategoryStream,
+		Proc:        xgroupDestroySubCommand,
+	},
+	"createconsumer": {
+		Name:        "createconsumer",
+		Description: "Creates a consumer in a consumer group",
+		Group:       "stream",
+		Type:        command.Write,
+		Arity:       5,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Flags:       command.FlagDenyOOM,
+		Categories:  command.CategoryStream,
+		Proc:        xgroupCreateConsumerSubCommand,
+	},
+	"delconsumer": {
+		Name:        "delconsumer",
+		Description: "Deletes a consumer from a consumer group",
+		Group:       "stream",
+		Type:        command.Write,
+		Arity:       5,
+		FirstKey:    2,
+		LastKey:     2,
+		Step:        1,
+		Categories:  command.CategoryStream,
+		Proc:        xgroupDelConsumerSubCommand,
+	},
+}
+
+var pubsubSubCommands = map[string]command.Command{
+	"channels": {
+		Name:        "channels",
+		Description: "Returns the active channels",
+		Group:       "pubsub",
+		Type:        command.Read,
+		Arity:       -2,
+		Categories:  command.CategoryPubSub,
+		Proc:        pubsubChannelsSubCommand,
+	},
+	"numsub": {
+		Name:        "numsub",
+		Description: "Returns the number of subscribers of channels",
+		Group:       "pubsub",
+		Type:        command.Read,
+		Arity:       -2,
+		Categories:  command.CategoryPubSub,
+		Proc:        pubsubNumSubSubCommand,
+	},
+	"numpat": {
+		Name:        "numpat",
+		Description: "Returns the number of unique pattern subscriptions",
+		Group:       "pubsub",
+		Type:        command.Read,
+		Arity:       2,
+		Categories:  command.CategoryPubSub,
+		Proc:        pubsubNumPatSubCommand,
+	},
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// lookupValue returns the value of type T stored at the given key.
+// found is false if the key does not exist. If the key holds a value of
+// another type, a WRONGTYPE error is sent to the client and ok is false.
+func lookupValue[T any](c *client.Client, key string) (value T, found bool, ok bool) {
+	item, found := c.DB.Get(key)
+	if !found {
+		return value, false, true
+	}
+
+	value, ok = item.Data.(T)
+	if !ok {
+		c.Conn.AsyncWrite(NewWrongTypeError())
+		return value, true, false
+	}
+
+	return value, true, true
+}
+
+// typeName returns the name of the type of the given value.
+func typeName(v any) string {
+	switch v.(type) {
+	case string, []byte, int64:
+		return "string"
+	case *datastructure.List:
+		return "list"
+	case *datastructure.Hash:
+		return "hash"
+	case *datastructure.Set:
+		return "set"
+	case *datastructure.ZSet:
+		return "zset"
+	case *datastructure.Stream:
+		return "stream"
+	case *datastructure.HyperLogLog:
+		return "hyperloglog"
+	case *datastructure.JSON:
+		return "json"
+	case *datastructure.BloomFilter:
+		return "bloomfilter"
+	case *datastructure.CuckooFilter:
+		return "cuckoofilter"
+	case *datastructure.CountMinSketch:
+		return "countminsketch"
+	case *datastructure.TopK:
+		return "topk"
+	case *datastructure.TimeSeries:
+		return "timeseries"
+	}
+	return "none"
+}
+
+// parseInt parses an integer argument. If the argument is not a valid
+// integer, an error is sent to the client and ok is false.
+func parseInt(c *client.Client, arg []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		c.Conn.AsyncWrite(NewNotIntegerError())
+		return 0, false
+	}
+	return n, true
+}
+
+// parseFloat parses a floating point argument. If the argument is not a
+// valid float or is NaN, an error is sent to the client and ok is false.
+func parseFloat(c *client.Client, arg []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) {
+		c.Conn.AsyncWrite(NewGenericError("value is not a valid float"))
+		return 0, false
+	}
+	return f, true
+}
+
+// formatFloat returns the shortest representation of the float. Integral
+// values are formatted without an exponent as long as they are exact.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1<<53:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// memoryUsageSubCommand returns the estimated amount of bytes used by the key.
+func memoryUsageSubCommand(c *client.Client) {
+	item, found := c.DB.Peek(string(c.Argv[1]))
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(item.MemoryUsage())))
+}
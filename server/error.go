@@ -7,9 +7,39 @@ import (
 const (
 	// GenericErrorPrefix is the prefix for all generic errors
 	GenericErrorPrefix = "ERR"
+	// WrongTypeErrorPrefix is the prefix for errors caused by running a
+	// command against a key holding the wrong kind of value
+	WrongTypeErrorPrefix = "WRONGTYPE"
+	// NoGroupErrorPrefix is the prefix for errors caused by a missing
+	// stream consumer group
+	NoGroupErrorPrefix = "NOGROUP"
+	// BusyGroupErrorPrefix is the prefix for errors caused by creating a
+	// stream consumer group that already exists
+	BusyGroupErrorPrefix = "BUSYGROUP"
 )
 
 // NewGenericError returns a new generic error
 func NewGenericError(msg string) []byte {
 	return protocol.MakeError(GenericErrorPrefix + " " + msg)
 }
+
+// NewWrongTypeError returns a new wrong type error
+func NewWrongTypeError() []byte {
+	return protocol.MakeError(WrongTypeErrorPrefix + " Operation against a key holding the wrong kind of value")
+}
+
+// NewNotIntegerError returns the error sent when an argument is not a valid integer
+func NewNotIntegerError() []byte {
+	return NewGenericError("value is not an integer or out of range")
+}
+
+// NewNoGroupError returns a new missing consumer group error
+func NewNoGroupError(msg string) []byte {
+	return protocol.MakeError(NoGroupErrorPrefix + " " + msg)
+}
+
+// NewBusyGroupError returns the error sent when creating a consumer group
+// that already exists
+func NewBusyGroupError() []byte {
+	return protocol.MakeError(BusyGroupErrorPrefix + " Consumer Group name already exists")
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"math"
 	"time"
 
 	"github.com/HotPotatoC/kvstore-rewrite/client"
@@ -16,12 +17,43 @@ const (
 	unitMilliseconds
 )
 
-func expireGenericCommand(c *client.Client, u unit) {
-	if c.Argc < 2 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + c.Command + "' command"))
-		return
+// parseExpireTime parses the expire time given with the EX, PX, EXAT or
+// PXAT option of SET and GETEX and returns the time left to live, which is
+// not positive if the absolute time is already in the past. If the time is
+// not a positive integer, an error is sent to the client and ok is false.
+func parseExpireTime(c *client.Client, option string, arg []byte, cmd string) (ttl time.Duration, ok bool) {
+	n, ok := parseInt(c, arg)
+	if !ok {
+		return 0, false
+	}
+
+	u := time.Second
+	if option == "px" || option == "pxat" {
+		u = time.Millisecond
+	}
+
+	// Relative times must fit in a time.Duration, absolute ones in unix
+	// milliseconds
+	limit := math.MaxInt64 / int64(u)
+	if option == "exat" || option == "pxat" {
+		limit = math.MaxInt64 / int64(u/time.Millisecond)
+	}
+
+	if n <= 0 || n > limit {
+		c.Conn.AsyncWrite(NewGenericError("invalid expire time in '" + cmd + "' command"))
+		return 0, false
+	}
+
+	switch option {
+	case "exat":
+		return time.Until(time.Unix(n, 0)), true
+	case "pxat":
+		return time.Until(time.UnixMilli(n)), true
 	}
+	return time.Duration(n) * u, true
+}
 
+func expireGenericCommand(c *client.Client, u unit) {
 	key := string(c.Argv[0])
 	n, err := common.ByteToInt(c.Argv[1])
 	if err != nil {
@@ -40,6 +72,33 @@ func expireGenericCommand(c *client.Client, u unit) {
 	if res == 0 {
 		c.Conn.AsyncWrite(protocol.MakeInteger(0))
 	} else {
+		server.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+		c.Conn.AsyncWrite(protocol.MakeInteger(1))
+	}
+}
+
+func expireatGenericCommand(c *client.Client, u unit) {
+	key := string(c.Argv[0])
+	n, err := common.ByteToInt(c.Argv[1])
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError("invalid expire time"))
+		return
+	}
+
+	var at time.Time
+	if u == unitSeconds {
+		at = time.Unix(n, 0)
+	}
+	if u == unitMilliseconds {
+		at = time.UnixMilli(n)
+	}
+
+	res := c.DB.Expire(key, time.Until(at))
+
+	if res == 0 {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+	} else {
+		server.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 		c.Conn.AsyncWrite(protocol.MakeInteger(1))
 	}
 }
@@ -52,12 +111,15 @@ func pexpireCommand(c *client.Client) {
 	expireGenericCommand(c, unitMilliseconds)
 }
 
-func ttlGenericCommand(c *client.Client, u unit) {
-	if c.Argc != 1 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'ttl' command"))
-		return
-	}
+func expireatCommand(c *client.Client) {
+	expireatGenericCommand(c, unitSeconds)
+}
 
+func pexpireatCommand(c *client.Client) {
+	expireatGenericCommand(c, unitMilliseconds)
+}
+
+func ttlGenericCommand(c *client.Client, u unit) {
 	key := string(c.Argv[0])
 
 	item, ok := c.DB.Get(key)
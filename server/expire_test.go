@@ -0,0 +1,69 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_ParseExpireTime(t *testing.T) {
+	tc := []struct {
+		option string
+		arg    string
+		ok     bool
+	}{
+		{"ex", "1", true},
+		{"ex", strconv.FormatInt(math.MaxInt64/int64(time.Second), 10), true},
+		{"ex", strconv.FormatInt(math.MaxInt64/int64(time.Second)+1, 10), false},
+		{"px", strconv.FormatInt(math.MaxInt64/int64(time.Millisecond), 10), true},
+		{"px", strconv.FormatInt(math.MaxInt64/int64(time.Millisecond)+1, 10), false},
+		{"exat", strconv.FormatInt(math.MaxInt64/1000, 10), true},
+		{"exat", strconv.FormatInt(math.MaxInt64/1000+1, 10), false},
+		{"pxat", strconv.FormatInt(math.MaxInt64, 10), true},
+		{"pxat", "9223372036854775808", false},
+		{"ex", "0", false},
+		{"pxat", "0", false},
+		{"px", "-1", false},
+		{"ex", "1.5", false},
+		{"ex", "", false},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.option+" "+tt.arg, func(t *testing.T) {
+			newTestServer()
+			c, conn := newTestClient()
+
+			ttl, ok := parseExpireTime(c, tt.option, []byte(tt.arg), "getex")
+			if ok != tt.ok {
+				t.Fatalf("expected ok: %v, got: %v", tt.ok, ok)
+			}
+
+			replies := readReplies(t, conn)
+			if ok {
+				if len(replies) != 0 {
+					t.Errorf("expected no reply, got %v", replies)
+				}
+				if ttl <= 0 {
+					t.Errorf("expected a positive ttl, got %v", ttl)
+				}
+				return
+			}
+
+			if len(replies) != 1 {
+				t.Fatalf("expected an error reply, got %v", replies)
+			}
+		})
+	}
+
+	newTestServer()
+	c, conn := newTestClient()
+	if ttl, ok := parseExpireTime(c, "exat", []byte("1"), "getex"); !ok || ttl > 0 {
+		t.Errorf("expected a past time to give a negative ttl, got %v", ttl)
+	}
+
+	parseExpireTime(c, "ex", []byte("0"), "getex")
+	if replies := readReplies(t, conn); len(replies) != 1 || replies[0] != "ERR invalid expire time in 'getex' command" {
+		t.Errorf("expected the error to name the command, got %v", replies)
+	}
+}
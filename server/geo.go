@@ -0,0 +1,526 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// geoUnits are the distance units and their length in meters.
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+// parseGeoUnit parses a distance unit argument. If the unit is unknown, an
+// error is sent to the client and ok is false.
+func parseGeoUnit(c *client.Client, arg []byte) (float64, bool) {
+	unit, ok := geoUnits[strings.ToLower(string(arg))]
+	if !ok {
+		c.Conn.AsyncWrite(NewGenericError("unsupported unit provided. please use M, KM, FT, MI"))
+		return 0, false
+	}
+	return unit, true
+}
+
+// parseGeoCoordinates parses a longitude and latitude pair. If the location
+// cannot be indexed, an error is sent to the client and ok is false.
+func parseGeoCoordinates(c *client.Client, lonArg, latArg []byte) (lon, lat float64, ok bool) {
+	if lon, ok = parseFloat(c, lonArg); !ok {
+		return 0, 0, false
+	}
+	if lat, ok = parseFloat(c, latArg); !ok {
+		return 0, 0, false
+	}
+
+	if !datastructure.ValidGeoCoordinates(lon, lat) {
+		c.Conn.AsyncWrite(NewGenericError(fmt.Sprintf("invalid longitude,latitude pair %f,%f", lon, lat)))
+		return 0, 0, false
+	}
+	return lon, lat, true
+}
+
+// geoMemberPosition returns the location of the member of the sorted set.
+func geoMemberPosition(zset *datastructure.ZSet, member string) (lon, lat float64, ok bool) {
+	if zset == nil {
+		return 0, 0, false
+	}
+
+	score, ok := zset.Score(member)
+	if !ok {
+		return 0, 0, false
+	}
+
+	lon, lat = datastructure.GeoDecode(uint64(score))
+	return lon, lat, true
+}
+
+// formatGeoDistance formats a distance in meters in the given unit.
+func formatGeoDistance(distance, unit float64) string {
+	return strconv.FormatFloat(distance/unit, 'f', 4, 64)
+}
+
+// geoaddCommand adds the locations to the sorted set stored at the key,
+// their score being their geohash.
+func geoaddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	var flags zaddFlags
+	i := 1
+options:
+	for ; i < c.Argc; i++ {
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "nx":
+			flags |= zaddNX
+		case "xx":
+			flags |= zaddXX
+		case "ch":
+			flags |= zaddCH
+		default:
+			break options
+		}
+	}
+
+	if flags&zaddNX != 0 && flags&zaddXX != 0 {
+		c.Conn.AsyncWrite(NewGenericError("XX and NX options at the same time are not compatible"))
+		return
+	}
+
+	args := c.Argv[i:]
+	if len(args) == 0 || len(args)%3 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	// Every location is validated before adding any of them
+	scores := make([]float64, len(args)/3)
+	for j := range scores {
+		lon, lat, ok := parseGeoCoordinates(c, args[j*3], args[j*3+1])
+		if !ok {
+			return
+		}
+		scores[j] = float64(datastructure.GeoEncode(lon, lat))
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		zset = datastructure.NewZSet()
+	}
+
+	var added, updated int64
+	for j, score := range scores {
+		member := string(args[j*3+2])
+
+		old, exists := zset.Score(member)
+		if (exists && flags&zaddNX != 0) || (!exists && flags&zaddXX != 0) {
+			continue
+		}
+
+		if !exists {
+			added++
+		} else if old != score {
+			updated++
+		}
+		zset.Add(member, score)
+	}
+
+	if found {
+		if added+updated > 0 {
+			c.DB.Touch(key)
+		}
+	} else if zset.Len() > 0 {
+		c.DB.Store(datastructure.NewItem(key, zset, 0))
+	}
+
+	if flags&zaddCH != 0 {
+		added += updated
+	}
+	c.Conn.AsyncWrite(protocol.MakeInteger(added))
+}
+
+// geodistCommand returns the distance between two members of the sorted set
+// stored at the key.
+func geodistCommand(c *client.Client) {
+	if c.Argc > 4 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	unit := 1.0
+	if c.Argc == 4 {
+		var ok bool
+		if unit, ok = parseGeoUnit(c, c.Argv[3]); !ok {
+			return
+		}
+	}
+
+	zset, _, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	lon1, lat1, ok1 := geoMemberPosition(zset, string(c.Argv[1]))
+	lon2, lat2, ok2 := geoMemberPosition(zset, string(c.Argv[2]))
+	if !ok1 || !ok2 {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	distance := datastructure.GeoDistance(lon1, lat1, lon2, lat2)
+	c.Conn.AsyncWrite(protocol.MakeBulkString(formatGeoDistance(distance, unit)))
+}
+
+// geoposCommand returns the longitude and latitude of the members of the
+// sorted set stored at the key.
+func geoposCommand(c *client.Client) {
+	zset, _, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	positions := make([][]byte, c.Argc-1)
+	for i, member := range c.Argv[1:] {
+		lon, lat, ok := geoMemberPosition(zset, string(member))
+		if !ok {
+			positions[i] = protocol.MakeNullArray()
+			continue
+		}
+
+		positions[i] = makeStringArray([]string{formatFloat(lon), formatFloat(lat)})
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(positions...))
+}
+
+// geohashCommand returns the standard geohash strings of the members of the
+// sorted set stored at the key.
+func geohashCommand(c *client.Client) {
+	zset, _, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	hashes := make([][]byte, c.Argc-1)
+	for i, member := range c.Argv[1:] {
+		lon, lat, ok := geoMemberPosition(zset, string(member))
+		if !ok {
+			hashes[i] = protocol.MakeNull()
+			continue
+		}
+
+		hashes[i] = protocol.MakeBulkString(datastructure.GeoHashString(lon, lat))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(hashes...))
+}
+
+// geoSort is the order of the results of a geospatial search.
+type geoSort uint8
+
+const (
+	geoSortNone geoSort = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchOptions are the options of GEOSEARCH and GEOSEARCHSTORE.
+type geoSearchOptions struct {
+	fromMember          []byte
+	fromLonLat          bool
+	byRadius, byBox     bool
+	shape               datastructure.GeoShape
+	unit                float64
+	sort                geoSort
+	count               int
+	any                 bool
+	withDist, withCoord bool
+	withHash, storeDist bool
+}
+
+// geoResult is a member found by a geospatial search.
+type geoResult struct {
+	member   string
+	score    float64
+	distance float64
+	lon, lat float64
+}
+
+// parseGeoSearchOptions parses the options of GEOSEARCH, or GEOSEARCHSTORE if
+// store is true. If the options are invalid, an error is sent to the client
+// and ok is false.
+func parseGeoSearchOptions(c *client.Client, args [][]byte, store bool) (opts geoSearchOptions, ok bool) {
+	syntaxError := func() (geoSearchOptions, bool) {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return opts, false
+	}
+
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+
+		switch strings.ToLower(string(args[i])) {
+		case "frommember":
+			if remaining < 1 || opts.fromMember != nil {
+				return syntaxError()
+			}
+			opts.fromMember = args[i+1]
+			i++
+		case "fromlonlat":
+			if remaining < 2 || opts.fromLonLat {
+				return syntaxError()
+			}
+			if opts.shape.Lon, opts.shape.Lat, ok = parseGeoCoordinates(c, args[i+1], args[i+2]); !ok {
+				return opts, false
+			}
+			opts.fromLonLat = true
+			i += 2
+		case "byradius":
+			if remaining < 2 || opts.byRadius {
+				return syntaxError()
+			}
+			if opts.shape.Radius, ok = parseFloat(c, args[i+1]); !ok {
+				return opts, false
+			}
+			if opts.shape.Radius < 0 {
+				c.Conn.AsyncWrite(NewGenericError("radius cannot be negative"))
+				return opts, false
+			}
+			if opts.unit, ok = parseGeoUnit(c, args[i+2]); !ok {
+				return opts, false
+			}
+			opts.byRadius = true
+			i += 2
+		case "bybox":
+			if remaining < 3 || opts.byBox {
+				return syntaxError()
+			}
+			if opts.shape.Width, ok = parseFloat(c, args[i+1]); !ok {
+				return opts, false
+			}
+			if opts.shape.Height, ok = parseFloat(c, args[i+2]); !ok {
+				return opts, false
+			}
+			if opts.shape.Width < 0 || opts.shape.Height < 0 {
+				c.Conn.AsyncWrite(NewGenericError("height or width cannot be negative"))
+				return opts, false
+			}
+			if opts.unit, ok = parseGeoUnit(c, args[i+3]); !ok {
+				return opts, false
+			}
+			opts.byBox = true
+			i += 3
+		case "asc":
+			opts.sort = geoSortAsc
+		case "desc":
+			opts.sort = geoSortDesc
+		case "count":
+			if remaining < 1 {
+				return syntaxError()
+			}
+			count, ok := parseInt(c, args[i+1])
+			if !ok {
+				return opts, false
+			}
+			if count <= 0 {
+				c.Conn.AsyncWrite(NewGenericError("COUNT must be > 0"))
+				return opts, false
+			}
+			opts.count = int(count)
+			i++
+
+			if remaining > 1 && strings.ToLower(string(args[i+1])) == "any" {
+				opts.any = true
+				i++
+			}
+		case "withdist":
+			if store {
+				return syntaxError()
+			}
+			opts.withDist = true
+		case "withcoord":
+			if store {
+				return syntaxError()
+			}
+			opts.withCoord = true
+		case "withhash":
+			if store {
+				return syntaxError()
+			}
+			opts.withHash = true
+		case "storedist":
+			if !store {
+				return syntaxError()
+			}
+			opts.storeDist = true
+		default:
+			return syntaxError()
+		}
+	}
+
+	if (opts.fromMember != nil) == opts.fromLonLat {
+		c.Conn.AsyncWrite(NewGenericError("exactly one of FROMMEMBER or FROMLONLAT can be specified for " + c.Command))
+		return opts, false
+	}
+
+	if opts.byRadius == opts.byBox {
+		c.Conn.AsyncWrite(NewGenericError("exactly one of BYRADIUS and BYBOX can be specified for " + c.Command))
+		return opts, false
+	}
+
+	if opts.any && opts.count == 0 {
+		c.Conn.AsyncWrite(NewGenericError("the ANY argument requires COUNT argument"))
+		return opts, false
+	}
+
+	opts.shape.Box = opts.byBox
+	opts.shape.Radius *= opts.unit
+	opts.shape.Width *= opts.unit
+	opts.shape.Height *= opts.unit
+	return opts, true
+}
+
+// geoSearch returns the members of the sorted set within the shape of the
+// options, sorted and limited according to the options.
+func geoSearch(zset *datastructure.ZSet, opts *geoSearchOptions) []geoResult {
+	var results []geoResult
+
+search:
+	for _, r := range opts.shape.SearchRanges() {
+		entries := zset.RangeByScore(datastructure.ScoreRange{Min: r.Min, Max: r.Max, MaxExclusive: true}, false, 0, -1)
+		for _, e := range entries {
+			lon, lat := datastructure.GeoDecode(uint64(e.Score))
+			distance, ok := opts.shape.Contains(lon, lat)
+			if !ok {
+				continue
+			}
+
+			results = append(results, geoResult{e.Member, e.Score, distance, lon, lat})
+			if opts.any && len(results) == opts.count {
+				break search
+			}
+		}
+	}
+
+	// The nearest members are returned unless ANY is given
+	if opts.sort == geoSortNone && opts.count > 0 && !opts.any {
+		opts.sort = geoSortAsc
+	}
+
+	switch opts.sort {
+	case geoSortAsc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance < results[j].distance })
+	case geoSortDesc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance > results[j].distance })
+	}
+
+	if opts.count > 0 && len(results) > opts.count {
+		results = results[:opts.count]
+	}
+
+	return results
+}
+
+// geoSearchGenericCommand implements GEOSEARCH and GEOSEARCHSTORE.
+func geoSearchGenericCommand(c *client.Client, store bool) {
+	var dst string
+	argv := c.Argv
+	if store {
+		dst, argv = string(argv[0]), argv[1:]
+	}
+
+	opts, ok := parseGeoSearchOptions(c, argv[1:], store)
+	if !ok {
+		return
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, string(argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		if store {
+			c.DB.Delete(dst)
+			c.Conn.AsyncWrite(protocol.MakeInteger(0))
+			return
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	if opts.fromMember != nil {
+		lon, lat, ok := geoMemberPosition(zset, string(opts.fromMember))
+		if !ok {
+			c.Conn.AsyncWrite(NewGenericError("could not decode requested zset member"))
+			return
+		}
+		opts.shape.Lon, opts.shape.Lat = lon, lat
+	}
+
+	results := geoSearch(zset, &opts)
+
+	if store {
+		result := datastructure.NewZSet()
+		for _, r := range results {
+			score := r.score
+			if opts.storeDist {
+				score = r.distance / opts.unit
+			}
+			result.Add(r.member, score)
+		}
+
+		if result.Len() == 0 {
+			c.DB.Delete(dst)
+		} else {
+			c.DB.Store(datastructure.NewItem(dst, result, 0))
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeInteger(int64(result.Len())))
+		return
+	}
+
+	replies := make([][]byte, len(results))
+	for i, r := range results {
+		if !opts.withDist && !opts.withHash && !opts.withCoord {
+			replies[i] = protocol.MakeBulkString(r.member)
+			continue
+		}
+
+		fields := [][]byte{protocol.MakeBulkString(r.member)}
+		if opts.withDist {
+			fields = append(fields, protocol.MakeBulkString(formatGeoDistance(r.distance, opts.unit)))
+		}
+		if opts.withHash {
+			fields = append(fields, protocol.MakeInteger(int64(r.score)))
+		}
+		if opts.withCoord {
+			fields = append(fields, makeStringArray([]string{formatFloat(r.lon), formatFloat(r.lat)}))
+		}
+		replies[i] = protocol.MakeArray(fields...)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// geosearchCommand returns the members of the sorted set stored at the key
+// within a radius or a box around a member or a location.
+func geosearchCommand(c *client.Client) {
+	geoSearchGenericCommand(c, false)
+}
+
+// geosearchstoreCommand stores the result of GEOSEARCH in the destination
+// key, with their geohash or their distance as score.
+func geosearchstoreCommand(c *client.Client) {
+	geoSearchGenericCommand(c, true)
+}
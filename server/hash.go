@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// hashModified marks the hash as modified, publishes the event and deletes
+// the hash once it is empty.
+func hashModified(c *client.Client, event, key string, hash *datastructure.Hash) {
+	server.notifyKeyspaceEvent(notifyHash, event, key)
+
+	if hash.Len() == 0 {
+		c.DB.Delete(key)
+		return
+	}
+
+	c.DB.Touch(key)
+}
+
+// hashLookupOrCreate returns the hash stored at key, creating it if it does
+// not exist yet.
+func hashLookupOrCreate(c *client.Client, key string) (*datastructure.Hash, bool) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, key)
+	if !ok {
+		return nil, false
+	}
+
+	if !found {
+		hash = datastructure.NewHash()
+		c.DB.Store(datastructure.NewItem(key, hash, 0))
+	}
+
+	return hash, true
+}
+
+// hsetCommand sets the given fields of the hash.
+func hsetCommand(c *client.Client) {
+	if (c.Argc-1)%2 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'hset' command"))
+		return
+	}
+
+	key := string(c.Argv[0])
+
+	hash, ok := hashLookupOrCreate(c, key)
+	if !ok {
+		return
+	}
+
+	var created int64
+	for i := 1; i < c.Argc; i += 2 {
+		if hash.Set(string(c.Argv[i]), c.Argv[i+1]) {
+			created++
+		}
+	}
+
+	c.DB.Touch(key)
+	server.notifyKeyspaceEvent(notifyHash, "hset", key)
+	c.Conn.AsyncWrite(protocol.MakeInteger(created))
+}
+
+// hgetCommand returns the value of the field of the hash.
+func hgetCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	v, ok := hash.Get(string(c.Argv[1]))
+	if !ok {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+}
+
+// hmgetCommand returns the values of the given fields of the hash.
+func hmgetCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	values := make([][]byte, 0, c.Argc-1)
+	for _, field := range c.Argv[1:] {
+		if !found {
+			values = append(values, protocol.MakeNull())
+			continue
+		}
+
+		v, ok := hash.Get(string(field))
+		if !ok {
+			values = append(values, protocol.MakeNull())
+			continue
+		}
+
+		values = append(values, protocol.MakeBulkString(string(v)))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(values...))
+}
+
+// hdelCommand deletes the given fields from the hash.
+func hdelCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	hash, found, ok := lookupValue[*datastructure.Hash](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	var deleted int64
+	for _, field := range c.Argv[1:] {
+		if hash.Delete(string(field)) {
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		hashModified(c, "hdel", key, hash)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(deleted))
+}
+
+// hgetallCommand returns all the fields and values of the hash.
+func hgetallCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	items := make([][]byte, 0, hash.Len()*2)
+	hash.Range(func(field string, value []byte) bool {
+		items = append(items, protocol.MakeBulkString(field), protocol.MakeBulkString(string(value)))
+		return true
+	})
+
+	c.Conn.AsyncWrite(protocol.MakeArray(items...))
+}
+
+// hincrbyCommand increments the integer value of the field of the hash.
+func hincrbyCommand(c *client.Client) {
+	key := string(c.Argv[0])
+	field := string(c.Argv[1])
+
+	incr, ok := parseInt(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	hash, ok := hashLookupOrCreate(c, key)
+	if !ok {
+		return
+	}
+
+	var value int64
+	if v, exists := hash.Get(field); exists {
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			c.Conn.AsyncWrite(NewGenericError("hash value is not an integer"))
+			return
+		}
+		value = n
+	}
+
+	if (incr > 0 && value > math.MaxInt64-incr) || (incr < 0 && value < math.MinInt64-incr) {
+		c.Conn.AsyncWrite(NewGenericError("increment or decrement would overflow"))
+		return
+	}
+
+	value += incr
+	hash.Set(field, []byte(strconv.FormatInt(value, 10)))
+
+	c.DB.Touch(key)
+	server.notifyKeyspaceEvent(notifyHash, "hincrby", key)
+	c.Conn.AsyncWrite(protocol.MakeInteger(value))
+}
+
+// hexistsCommand returns whether the field exists in the hash.
+func hexistsCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBool(found && hash.Exists(string(c.Argv[1]))))
+}
+
+// hkeysCommand returns all the fields of the hash.
+func hkeysCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeStringArray(hash.Keys()))
+}
+
+// hvalsCommand returns all the values of the hash.
+func hvalsCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeBulkStringArray(hash.Values()))
+}
+
+// hlenCommand returns the number of fields in the hash.
+func hlenCommand(c *client.Client) {
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(hash.Len())))
+}
+
+// hscanCommand incrementally iterates over the fields of the hash.
+func hscanCommand(c *client.Client) {
+	cursor, err := strconv.ParseUint(string(c.Argv[1]), 10, 64)
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError("invalid cursor"))
+		return
+	}
+
+	pattern, count, ok := parseScanOptions(c, c.Argv[2:])
+	if !ok {
+		return
+	}
+
+	hash, found, ok := lookupValue[*datastructure.Hash](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	var items [][]byte
+	var next uint64
+	if found {
+		var fields []string
+		fields, next = hash.Scan(cursor, count, pattern)
+		for _, field := range fields {
+			v, _ := hash.Get(field)
+			items = append(items, protocol.MakeBulkString(field), protocol.MakeBulkString(string(v)))
+		}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(
+		protocol.MakeBulkString(strconv.FormatUint(next, 10)),
+		protocol.MakeArray(items...),
+	))
+}
+
+// parseScanOptions parses the MATCH and COUNT options of the SCAN family.
+func parseScanOptions(c *client.Client, args [][]byte) (pattern string, count int, ok bool) {
+	count = 10
+	for i := 0; i < len(args); i++ {
+		switch opt := bytes.ToLower(args[i]); {
+		case bytes.Equal(opt, []byte("match")) && i+1 < len(args):
+			pattern = string(args[i+1])
+			i++
+		case bytes.Equal(opt, []byte("count")) && i+1 < len(args):
+			n, ok := parseInt(c, args[i+1])
+			if !ok {
+				return "", 0, false
+			}
+
+			if n < 1 {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return "", 0, false
+			}
+
+			count = int(n)
+			i++
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return "", 0, false
+		}
+	}
+
+	return pattern, count, true
+}
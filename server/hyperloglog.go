@@ -0,0 +1,105 @@
+package server
+
+import (
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// pfaddCommand adds the elements to the HyperLogLog stored at the key,
+// creating it if it does not exist. Returns 1 if the estimated cardinality
+// may have changed, 0 otherwise.
+func pfaddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	hll, found, ok := lookupValue[*datastructure.HyperLogLog](c, key)
+	if !ok {
+		return
+	}
+
+	var updated bool
+	if !found {
+		hll = datastructure.NewHyperLogLog()
+		updated = true
+	}
+
+	for _, element := range c.Argv[1:] {
+		if hll.Add(element) {
+			updated = true
+		}
+	}
+
+	if !updated {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	if found {
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, hll, 0))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// pfcountCommand returns the estimated cardinality of the HyperLogLog stored
+// at the key, or of the union of the HyperLogLogs stored at the keys.
+func pfcountCommand(c *client.Client) {
+	if c.Argc == 1 {
+		hll, found, ok := lookupValue[*datastructure.HyperLogLog](c, string(c.Argv[0]))
+		if !ok {
+			return
+		}
+
+		if !found {
+			c.Conn.AsyncWrite(protocol.MakeInteger(0))
+			return
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeInteger(hll.Count()))
+		return
+	}
+
+	union := datastructure.NewHyperLogLog()
+	for _, key := range c.Argv {
+		hll, found, ok := lookupValue[*datastructure.HyperLogLog](c, string(key))
+		if !ok {
+			return
+		}
+
+		if found {
+			union.Merge(hll)
+		}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(union.Count()))
+}
+
+// pfmergeCommand stores the union of the HyperLogLogs stored at the source
+// keys and at the destination key in the destination key.
+func pfmergeCommand(c *client.Client) {
+	dst := string(c.Argv[0])
+
+	union := datastructure.NewHyperLogLog()
+	for _, key := range c.Argv {
+		hll, found, ok := lookupValue[*datastructure.HyperLogLog](c, string(key))
+		if !ok {
+			return
+		}
+
+		if found {
+			union.Merge(hll)
+		}
+	}
+
+	// The destination keeps its expire time
+	if item, found := c.DB.Get(dst); found {
+		item.Data = union
+		c.DB.Touch(dst)
+	} else {
+		c.DB.Store(datastructure.NewItem(dst, union, 0))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
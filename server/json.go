@@ -0,0 +1,473 @@
+package server
+
+import (
+	"math"
+	"strings"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/common"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// parseJSONPathArg parses a JSONPath argument. If the path is invalid, an
+// error is sent to the client and ok is false.
+func parseJSONPathArg(c *client.Client, arg []byte) (*datastructure.JSONPath, bool) {
+	p, err := datastructure.ParseJSONPath(string(arg))
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError("invalid JSONPath '" + string(arg) + "'"))
+		return nil, false
+	}
+	return p, true
+}
+
+// parseJSONArg parses a JSON value argument. If the value is not valid
+// JSON, an error is sent to the client and ok is false.
+func parseJSONArg(c *client.Client, arg []byte) (any, bool) {
+	v, err := datastructure.ParseJSON(arg)
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return nil, false
+	}
+	return v, true
+}
+
+// newJSONPathNotFoundError returns the error of a legacy path selecting
+// nothing.
+func newJSONPathNotFoundError(path []byte) []byte {
+	return NewGenericError("Path '" + string(path) + "' does not exist")
+}
+
+// newJSONWrongTypeError returns the error of a legacy path selecting a value
+// of an unexpected type.
+func newJSONWrongTypeError(expected string, v any) []byte {
+	return NewGenericError("wrong type of path value - expected " + expected + " but found " + datastructure.JSONTypeName(v))
+}
+
+// lookupJSONForUpdate returns the document stored at the key. If the key
+// does not exist or holds a value of another type, an error is sent to the
+// client and ok is false.
+func lookupJSONForUpdate(c *client.Client, key string) (*datastructure.JSON, bool) {
+	doc, found, ok := lookupValue[*datastructure.JSON](c, key)
+	if !ok {
+		return nil, false
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError("could not perform this operation on a key that doesn't exist"))
+		return nil, false
+	}
+	return doc, true
+}
+
+// jsonSetCommand sets the JSON value at the path of the document stored at
+// the key. A new document can only be created at the root.
+func jsonSetCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	var nx, xx bool
+	if c.Argc > 4 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+	if c.Argc == 4 {
+		switch strings.ToLower(string(c.Argv[3])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	p, ok := parseJSONPathArg(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	value, ok := parseJSONArg(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	doc, found, ok := lookupValue[*datastructure.JSON](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		if !p.IsRoot() {
+			c.Conn.AsyncWrite(NewGenericError("new objects must be created at the root"))
+			return
+		}
+
+		if xx {
+			c.Conn.AsyncWrite(protocol.MakeNull())
+			return
+		}
+
+		c.DB.Store(datastructure.NewItem(key, datastructure.NewJSON(value), 0))
+		c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+		return
+	}
+
+	exists := len(doc.Find(p)) > 0
+	if (nx && exists) || (xx && !exists) {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	if doc.Set(p, value) == 0 {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.DB.Touch(key)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// jsonGetCommand returns the JSON values at the paths of the document
+// stored at the key. A single legacy path returns its value, a single
+// JSONPath the array of its matches and multiple paths an object of the
+// results of every path.
+func jsonGetCommand(c *client.Client) {
+	var format datastructure.JSONFormat
+	var paths [][]byte
+
+	for i := 1; i < c.Argc; i++ {
+		option := strings.ToLower(string(c.Argv[i]))
+		if i+1 < c.Argc && (option == "indent" || option == "newline" || option == "space") {
+			switch option {
+			case "indent":
+				format.Indent = string(c.Argv[i+1])
+			case "newline":
+				format.Newline = string(c.Argv[i+1])
+			case "space":
+				format.Space = string(c.Argv[i+1])
+			}
+			i++
+			continue
+		}
+
+		paths = append(paths, c.Argv[i])
+	}
+
+	if len(paths) == 0 {
+		paths = [][]byte{[]byte(".")}
+	}
+
+	parsed := make([]*datastructure.JSONPath, len(paths))
+	legacy := true
+	for i, path := range paths {
+		p, ok := parseJSONPathArg(c, path)
+		if !ok {
+			return
+		}
+		parsed[i] = p
+		legacy = legacy && p.Legacy()
+	}
+
+	doc, found, ok := lookupValue[*datastructure.JSON](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	// Legacy paths return their value unless they are mixed with JSONPaths
+	results := make([]any, len(parsed))
+	for i, p := range parsed {
+		matches := doc.Find(p)
+		if legacy {
+			if len(matches) == 0 {
+				c.Conn.AsyncWrite(newJSONPathNotFoundError(paths[i]))
+				return
+			}
+			results[i] = matches[0].Value
+			continue
+		}
+
+		values := &datastructure.JSONArray{Values: make([]any, len(matches))}
+		for j, m := range matches {
+			values.Values[j] = m.Value
+		}
+		results[i] = values
+	}
+
+	if len(results) == 1 {
+		c.Conn.AsyncWrite(protocol.MakeBulkString(string(datastructure.MarshalJSON(results[0], format))))
+		return
+	}
+
+	obj := datastructure.NewJSONObject()
+	for i, path := range paths {
+		obj.Set(string(path), results[i])
+	}
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(datastructure.MarshalJSON(obj, format))))
+}
+
+// jsonDelCommand deletes the JSON values at the path of the document stored
+// at the key, or the key itself if the path is the root.
+func jsonDelCommand(c *client.Client) {
+	if c.Argc > 2 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	key := string(c.Argv[0])
+
+	path := []byte("$")
+	if c.Argc == 2 {
+		path = c.Argv[1]
+	}
+
+	p, ok := parseJSONPathArg(c, path)
+	if !ok {
+		return
+	}
+
+	doc, found, ok := lookupValue[*datastructure.JSON](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	if p.IsRoot() {
+		c.DB.Delete(key)
+		c.Conn.AsyncWrite(protocol.MakeInteger(1))
+		return
+	}
+
+	n := doc.Delete(p)
+	if n > 0 {
+		c.DB.Touch(key)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(n)))
+}
+
+// addJSONNumbers returns the sum of the JSON numbers, an integer if both are
+// integers and the sum does not overflow.
+func addJSONNumbers(a, b any) (any, bool) {
+	toFloat := func(v any) (float64, bool) {
+		switch v := v.(type) {
+		case int64:
+			return float64(v), true
+		case float64:
+			return v, true
+		}
+		return 0, false
+	}
+
+	x, xInt := a.(int64)
+	y, yInt := b.(int64)
+	if xInt && yInt {
+		if sum, err := common.AddInt(x, y); err == nil {
+			return sum, true
+		}
+	}
+
+	fa, ok := toFloat(a)
+	if !ok {
+		return nil, false
+	}
+	fb, _ := toFloat(b)
+	return fa + fb, true
+}
+
+// jsonNumIncrByCommand increments the numbers at the path of the document
+// stored at the key.
+func jsonNumIncrByCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	p, ok := parseJSONPathArg(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	incr, ok := parseJSONArg(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	if _, ok := addJSONNumbers(incr, int64(0)); !ok {
+		c.Conn.AsyncWrite(NewGenericError("expected a number but found " + datastructure.JSONTypeName(incr)))
+		return
+	}
+
+	doc, ok := lookupJSONForUpdate(c, key)
+	if !ok {
+		return
+	}
+
+	matches := doc.Find(p)
+	if p.Legacy() && len(matches) == 0 {
+		c.Conn.AsyncWrite(newJSONPathNotFoundError(c.Argv[1]))
+		return
+	}
+
+	// Every sum is computed before updating any number
+	results := &datastructure.JSONArray{Values: make([]any, len(matches))}
+	for i, m := range matches {
+		sum, ok := addJSONNumbers(m.Value, incr)
+		if !ok {
+			if p.Legacy() {
+				c.Conn.AsyncWrite(newJSONWrongTypeError("a number", m.Value))
+				return
+			}
+			continue
+		}
+
+		if f, ok := sum.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			c.Conn.AsyncWrite(NewGenericError("result is an infinite number"))
+			return
+		}
+		results.Values[i] = sum
+	}
+
+	var updated bool
+	for i, m := range matches {
+		if results.Values[i] != nil {
+			doc.Replace(m, results.Values[i])
+			updated = true
+		}
+	}
+
+	if updated {
+		c.DB.Touch(key)
+	}
+
+	if p.Legacy() {
+		c.Conn.AsyncWrite(protocol.MakeBulkString(string(datastructure.MarshalJSON(results.Values[0], datastructure.JSONFormat{}))))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(datastructure.MarshalJSON(results, datastructure.JSONFormat{}))))
+}
+
+// jsonArrAppendCommand appends the JSON values to the arrays at the path of
+// the document stored at the key. Returns the new length of every array.
+func jsonArrAppendCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	p, ok := parseJSONPathArg(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	values := make([]any, c.Argc-2)
+	for i, arg := range c.Argv[2:] {
+		if values[i], ok = parseJSONArg(c, arg); !ok {
+			return
+		}
+	}
+
+	doc, ok := lookupJSONForUpdate(c, key)
+	if !ok {
+		return
+	}
+
+	matches := doc.Find(p)
+	if p.Legacy() {
+		if len(matches) == 0 {
+			c.Conn.AsyncWrite(newJSONPathNotFoundError(c.Argv[1]))
+			return
+		}
+
+		if _, ok := matches[0].Value.(*datastructure.JSONArray); !ok {
+			c.Conn.AsyncWrite(newJSONWrongTypeError("array", matches[0].Value))
+			return
+		}
+	}
+
+	lengths := make([][]byte, len(matches))
+	for i, m := range matches {
+		arr, ok := m.Value.(*datastructure.JSONArray)
+		if !ok {
+			lengths[i] = protocol.MakeNull()
+			continue
+		}
+
+		for _, v := range values {
+			arr.Values = append(arr.Values, datastructure.CopyJSON(v))
+		}
+		lengths[i] = protocol.MakeInteger(int64(len(arr.Values)))
+	}
+
+	if len(matches) > 0 {
+		c.DB.Touch(key)
+	}
+
+	if p.Legacy() {
+		c.Conn.AsyncWrite(lengths[0])
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(lengths...))
+}
+
+// jsonMergeCommand merges the JSON value into the values at the path of the
+// document stored at the key, as described by RFC 7386.
+func jsonMergeCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	p, ok := parseJSONPathArg(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	patch, ok := parseJSONArg(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	doc, found, ok := lookupValue[*datastructure.JSON](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		if !p.IsRoot() {
+			c.Conn.AsyncWrite(NewGenericError("new objects must be created at the root"))
+			return
+		}
+
+		if patch != nil {
+			c.DB.Store(datastructure.NewItem(key, datastructure.NewJSON(datastructure.MergeJSON(nil, patch)), 0))
+		}
+		c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+		return
+	}
+
+	// A null patch deletes the values
+	if patch == nil {
+		if p.IsRoot() {
+			c.DB.Delete(key)
+		} else if doc.Delete(p) > 0 {
+			c.DB.Touch(key)
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+		return
+	}
+
+	matches := doc.Find(p)
+	for _, m := range matches {
+		doc.Replace(m, datastructure.MergeJSON(m.Value, patch))
+	}
+
+	if len(matches) > 0 || doc.Set(p, datastructure.MergeJSON(nil, patch)) > 0 {
+		c.DB.Touch(key)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
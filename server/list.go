@@ -0,0 +1,477 @@
+package server
+
+import (
+	"bytes"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+type listEnd uint8
+
+const (
+	listHead listEnd = iota
+	listTail
+)
+
+// makeBulkStringArray creates an array of bulk strings.
+func makeBulkStringArray(values [][]byte) []byte {
+	items := make([][]byte, len(values))
+	for i, v := range values {
+		items[i] = protocol.MakeBulkString(string(v))
+	}
+	return protocol.MakeArray(items...)
+}
+
+func pushGenericCommand(c *client.Client, end listEnd) {
+	key := string(c.Argv[0])
+
+	list, found, ok := lookupValue[*datastructure.List](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		list = datastructure.NewList()
+		c.DB.Store(datastructure.NewItem(key, list, 0))
+	}
+
+	push, event := list.PushFront, "lpush"
+	if end == listTail {
+		push, event = list.PushBack, "rpush"
+	}
+
+	for _, v := range c.Argv[1:] {
+		push(v)
+	}
+
+	c.DB.Touch(key)
+	server.signalKeyAsReady(key)
+	server.notifyKeyspaceEvent(notifyList, event, key)
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(list.Len())))
+}
+
+// lpushCommand inserts the given elements at the head of the list.
+func lpushCommand(c *client.Client) {
+	pushGenericCommand(c, listHead)
+}
+
+// rpushCommand inserts the given elements at the tail of the list.
+func rpushCommand(c *client.Client) {
+	pushGenericCommand(c, listTail)
+}
+
+func popGenericCommand(c *client.Client, end listEnd) {
+	if c.Argc > 2 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	key := string(c.Argv[0])
+
+	count := int64(-1)
+	if c.Argc == 2 {
+		n, ok := parseInt(c, c.Argv[1])
+		if !ok {
+			return
+		}
+
+		if n < 0 {
+			c.Conn.AsyncWrite(NewGenericError("value is out of range, must be positive"))
+			return
+		}
+
+		count = n
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	pop, event := list.PopFront, "lpop"
+	if end == listTail {
+		pop, event = list.PopBack, "rpop"
+	}
+
+	// Without a count, a single element is sent instead of an array
+	if count == -1 {
+		v, _ := pop()
+		listModified(c, event, key, list)
+		c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+		return
+	}
+
+	var values [][]byte
+	for i := int64(0); i < count; i++ {
+		v, ok := pop()
+		if !ok {
+			break
+		}
+		values = append(values, v)
+	}
+
+	if len(values) > 0 {
+		listModified(c, event, key, list)
+	}
+	c.Conn.AsyncWrite(makeBulkStringArray(values))
+}
+
+// listModified marks the list as modified, publishes the event and deletes
+// the list once it is empty.
+func listModified(c *client.Client, event, key string, list *datastructure.List) {
+	server.notifyKeyspaceEvent(notifyList, event, key)
+
+	if list.Len() == 0 {
+		c.DB.Delete(key)
+		return
+	}
+
+	c.DB.Touch(key)
+}
+
+// lpopCommand removes and returns the first elements of the list.
+func lpopCommand(c *client.Client) {
+	popGenericCommand(c, listHead)
+}
+
+// rpopCommand removes and returns the last elements of the list.
+func rpopCommand(c *client.Client) {
+	popGenericCommand(c, listTail)
+}
+
+// parseListEnd parses the LEFT or RIGHT argument of BLMOVE.
+func parseListEnd(c *client.Client, arg []byte) (listEnd, bool) {
+	switch string(bytes.ToLower(arg)) {
+	case "left":
+		return listHead, true
+	case "right":
+		return listTail, true
+	}
+
+	c.Conn.AsyncWrite(NewGenericError("syntax error"))
+	return 0, false
+}
+
+// listPop removes an element from the given end of the list. The pop is
+// logged as LPOP or RPOP as the blocking commands must not block when
+// replayed.
+func listPop(c *client.Client, key string, list *datastructure.List, end listEnd) []byte {
+	pop, name := list.PopFront, "lpop"
+	if end == listTail {
+		pop, name = list.PopBack, "rpop"
+	}
+
+	v, _ := pop()
+	listModified(c, name, key, list)
+	c.Propagate = append(c.Propagate, [][]byte{[]byte(name), []byte(key)})
+	return v
+}
+
+// listPush inserts the element at the given end of the list, creating the
+// list if needed. The push is logged as LPUSH or RPUSH.
+func listPush(c *client.Client, key string, v []byte, end listEnd) {
+	var list *datastructure.List
+	if item, found := c.DB.Peek(key); found {
+		list = item.Data.(*datastructure.List)
+	} else {
+		list = datastructure.NewList()
+		c.DB.Store(datastructure.NewItem(key, list, 0))
+	}
+
+	name := "lpush"
+	if end == listHead {
+		list.PushFront(v)
+	} else {
+		list.PushBack(v)
+		name = "rpush"
+	}
+
+	c.DB.Touch(key)
+	server.signalKeyAsReady(key)
+	server.notifyKeyspaceEvent(notifyList, name, key)
+	c.Propagate = append(c.Propagate, [][]byte{[]byte(name), []byte(key), v})
+}
+
+// blockingPopGenericCommand pops an element from the first non-empty list,
+// or waits until one of the lists receives an element.
+func blockingPopGenericCommand(c *client.Client, end listEnd) {
+	timeout, ok := parseBlockTimeout(c, c.Argv[c.Argc-1])
+	if !ok {
+		return
+	}
+
+	keys := make([]string, c.Argc-1)
+	for i, arg := range c.Argv[:c.Argc-1] {
+		keys[i] = string(arg)
+	}
+
+	for _, key := range keys {
+		list, found, ok := lookupValue[*datastructure.List](c, key)
+		if !ok {
+			return
+		}
+
+		if found {
+			v := listPop(c, key, list, end)
+			c.Conn.AsyncWrite(makeBulkStringArray([][]byte{[]byte(key), v}))
+			return
+		}
+	}
+
+	if !canBlock(c) {
+		c.Conn.AsyncWrite(protocol.MakeNullArray())
+		return
+	}
+
+	server.blockClient(c, keys, timeout, protocol.MakeNullArray(), func(key string) bool {
+		item, found := c.DB.Peek(key)
+		if !found {
+			return false
+		}
+
+		list, isList := item.Data.(*datastructure.List)
+		if !isList {
+			return false
+		}
+
+		v := listPop(c, key, list, end)
+		c.Conn.AsyncWrite(makeBulkStringArray([][]byte{[]byte(key), v}))
+		return true
+	})
+}
+
+// blpopCommand removes and returns the first element of the first non-empty
+// list, blocking until an element is pushed or the timeout expires.
+func blpopCommand(c *client.Client) {
+	blockingPopGenericCommand(c, listHead)
+}
+
+// brpopCommand removes and returns the last element of the first non-empty
+// list, blocking until an element is pushed or the timeout expires.
+func brpopCommand(c *client.Client) {
+	blockingPopGenericCommand(c, listTail)
+}
+
+// blmoveCommand moves an element from the source list to the destination
+// list and returns it, blocking until the source list receives an element
+// or the timeout expires.
+func blmoveCommand(c *client.Client) {
+	src, dst := string(c.Argv[0]), string(c.Argv[1])
+
+	from, ok := parseListEnd(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	to, ok := parseListEnd(c, c.Argv[3])
+	if !ok {
+		return
+	}
+
+	timeout, ok := parseBlockTimeout(c, c.Argv[4])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, src)
+	if !ok {
+		return
+	}
+
+	if _, _, ok := lookupValue[*datastructure.List](c, dst); !ok {
+		return
+	}
+
+	if found {
+		v := listPop(c, src, list, from)
+		listPush(c, dst, v, to)
+		c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+		return
+	}
+
+	if !canBlock(c) {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	server.blockClient(c, []string{src}, timeout, protocol.MakeNull(), func(key string) bool {
+		item, found := c.DB.Peek(src)
+		if !found {
+			return false
+		}
+
+		list, isList := item.Data.(*datastructure.List)
+		if !isList {
+			return false
+		}
+
+		// The destination may have been replaced in the meantime
+		if item, found := c.DB.Peek(dst); found {
+			if _, isList := item.Data.(*datastructure.List); !isList {
+				c.Conn.AsyncWrite(NewWrongTypeError())
+				return true
+			}
+		}
+
+		v := listPop(c, src, list, from)
+		listPush(c, dst, v, to)
+		c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+		return true
+	})
+}
+
+// llenCommand returns the length of the list.
+func llenCommand(c *client.Client) {
+	list, found, ok := lookupValue[*datastructure.List](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(list.Len())))
+}
+
+// lrangeCommand returns the elements of the list between start and stop.
+func lrangeCommand(c *client.Client) {
+	start, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	stop, ok := parseInt(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeBulkStringArray(list.Range(int(start), int(stop))))
+}
+
+// lindexCommand returns the element at the given index of the list.
+func lindexCommand(c *client.Client) {
+	index, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	v, ok := list.Index(int(index))
+	if !ok {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+}
+
+// lsetCommand sets the element at the given index of the list.
+func lsetCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	index, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError("no such key"))
+		return
+	}
+
+	if !list.Set(int(index), c.Argv[2]) {
+		c.Conn.AsyncWrite(NewGenericError("index out of range"))
+		return
+	}
+
+	c.DB.Touch(key)
+	server.notifyKeyspaceEvent(notifyList, "lset", key)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// lremCommand removes the first count occurrences of the element from the list.
+func lremCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	count, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	n := list.Remove(int(count), c.Argv[2])
+	if n > 0 {
+		listModified(c, "lrem", key, list)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(n)))
+}
+
+// ltrimCommand trims the list to the elements between start and stop.
+func ltrimCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	start, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	stop, ok := parseInt(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	list, found, ok := lookupValue[*datastructure.List](c, key)
+	if !ok {
+		return
+	}
+
+	if found {
+		list.Trim(int(start), int(stop))
+		listModified(c, "ltrim", key, list)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
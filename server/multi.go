@@ -0,0 +1,307 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/logger"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+	"github.com/panjf2000/gnet"
+)
+
+// execConn is the connection used while executing a transaction. The
+// replies written to it are kept to be sent as a single array.
+type execConn struct {
+	gnet.Conn
+	buf []byte
+}
+
+// AsyncWrite keeps the reply.
+func (c *execConn) AsyncWrite(buf []byte) error {
+	c.buf = append(c.buf, buf...)
+	return nil
+}
+
+// watchState keeps track of the keys watched by the clients. The versions of
+// the items tell when a watched key was modified, but not when a key that
+// did not exist when it was watched was created and removed in the
+// meantime, so the removals mark the clients watching the key as dirty.
+type watchState struct {
+	mu sync.Mutex
+	// keys maps every watched key to the clients watching it
+	keys map[string]map[*client.Client]struct{}
+	// clients maps every client to the keys it watches
+	clients map[*client.Client][]string
+	// dirty are the clients watching a key that has been removed
+	dirty map[*client.Client]struct{}
+}
+
+func newWatchState() watchState {
+	return watchState{
+		keys:    make(map[string]map[*client.Client]struct{}),
+		clients: make(map[*client.Client][]string),
+		dirty:   make(map[*client.Client]struct{}),
+	}
+}
+
+// watch adds the client to the clients watching the key.
+func (w *watchState) watch(c *client.Client, key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.keys[key] == nil {
+		w.keys[key] = make(map[*client.Client]struct{})
+	}
+	w.keys[key][c] = struct{}{}
+	w.clients[c] = append(w.clients[c], key)
+}
+
+// unwatch forgets every key watched by the client.
+func (w *watchState) unwatch(c *client.Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, key := range w.clients[c] {
+		delete(w.keys[key], c)
+		if len(w.keys[key]) == 0 {
+			delete(w.keys, key)
+		}
+	}
+
+	delete(w.clients, c)
+	delete(w.dirty, c)
+}
+
+// touch marks the clients watching the key as dirty.
+func (w *watchState) touch(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for c := range w.keys[key] {
+		w.dirty[c] = struct{}{}
+	}
+}
+
+// touchAll marks every client watching a key as dirty.
+func (w *watchState) touchAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for c := range w.clients {
+		w.dirty[c] = struct{}{}
+	}
+}
+
+// isDirty returns true if a key watched by the client has been removed.
+func (w *watchState) isDirty(c *client.Client) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, dirty := w.dirty[c]
+	return dirty
+}
+
+// isTransactionCommand returns true if the command controls the transaction
+// and is executed instead of being queued.
+func isTransactionCommand(cmd command.Command) bool {
+	switch cmd.Name {
+	case "multi", "exec", "discard":
+		return true
+	}
+	return false
+}
+
+// queueCommand queues the command of a client in MULTI state.
+func queueCommand(c *client.Client, cmd command.Command, recvCmd []byte, recvArgv [][]byte) {
+	if cmd.Flags&command.FlagNoMulti != 0 {
+		flagTransaction(c)
+		c.Conn.AsyncWrite(NewGenericError("Command not allowed inside a transaction"))
+		return
+	}
+
+	c.Queued = append(c.Queued, client.QueuedCommand{Name: recvCmd, Argv: recvArgv})
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("QUEUED"))
+}
+
+// flagTransaction makes EXEC abort the transaction of the client, if any,
+// after a command could not be queued.
+func flagTransaction(c *client.Client) {
+	if c.HasFlag(client.FlagMulti) {
+		c.AddFlag(client.FlagDirtyExec)
+	}
+}
+
+// discardTransaction leaves the MULTI state and drops the queued commands.
+func discardTransaction(c *client.Client) {
+	c.Queued = nil
+	c.RemoveFlag(client.FlagMulti | client.FlagDirtyExec)
+}
+
+// multiCommand starts a transaction: the next commands are queued until
+// EXEC or DISCARD.
+func multiCommand(c *client.Client) {
+	if c.HasFlag(client.FlagMulti) {
+		c.Conn.AsyncWrite(NewGenericError("MULTI calls can not be nested"))
+		return
+	}
+
+	c.AddFlag(client.FlagMulti)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// discardCommand drops the queued commands of the transaction.
+func discardCommand(c *client.Client) {
+	if !c.HasFlag(client.FlagMulti) {
+		c.Conn.AsyncWrite(NewGenericError("DISCARD without MULTI"))
+		return
+	}
+
+	discardTransaction(c)
+	unwatchAllKeys(c)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// execCommand executes the queued commands of the transaction and replies
+// with an array of their replies. As EXEC is a write command, no other
+// command is executed until the transaction completes. The transaction is
+// aborted if a command could not be queued, or with a null reply if a
+// watched key was modified.
+func execCommand(c *client.Client) {
+	if !c.HasFlag(client.FlagMulti) {
+		c.Conn.AsyncWrite(NewGenericError("EXEC without MULTI"))
+		return
+	}
+
+	if c.HasFlag(client.FlagDirtyExec) {
+		discardTransaction(c)
+		unwatchAllKeys(c)
+		c.Conn.AsyncWrite(protocol.MakeError("EXECABORT Transaction discarded because of previous errors."))
+		return
+	}
+
+	queued, modified := c.Queued, isWatchedKeyModified(c)
+	discardTransaction(c)
+	unwatchAllKeys(c)
+
+	if modified {
+		c.Conn.AsyncWrite(protocol.MakeNullArray())
+		return
+	}
+
+	conn := &execConn{Conn: c.Conn}
+	c.Conn = conn
+
+	// A blocking command would wait while holding the lock
+	denyBlocking := c.HasFlag(client.FlagDenyBlocking)
+	c.AddFlag(client.FlagDenyBlocking)
+
+	defer func() {
+		c.Conn = conn.Conn
+		if !denyBlocking {
+			c.RemoveFlag(client.FlagDenyBlocking)
+		}
+	}()
+
+	// The commands are logged between MULTI and EXEC so that they are
+	// replayed all together or not at all. Nothing is logged after a failed
+	// write, the incomplete transaction is discarded when the file is loaded
+	var logged bool
+	var err error
+
+	replies := make([][]byte, len(queued))
+	for i, q := range queued {
+		cmd, lookupErr := server.lookupCommand(q.Name, q.Argv)
+		if lookupErr != nil {
+			replies[i] = NewGenericError(lookupErr.Error())
+			continue
+		}
+
+		c.Command = cmd.Name
+		c.Argv = q.Argv
+		c.Argc = len(q.Argv)
+		c.Propagate = nil
+
+		dirty := c.DB.Dirty()
+		cmd.Proc(c)
+
+		if server.aof != nil && c.DB.Dirty() != dirty && err == nil {
+			if !logged {
+				err = server.aof.Append([]byte("multi"))
+				logged = true
+			}
+
+			if err == nil {
+				err = server.appendCommand(c)
+			}
+		}
+
+		replies[i], conn.buf = conn.buf, nil
+	}
+
+	if logged && err == nil {
+		err = server.aof.Append([]byte("exec"))
+	}
+
+	if err != nil {
+		logger.S().Error("failed writing to the append only file: ", err)
+	} else if logged {
+		server.rewriteAppendOnlyFileIfNeeded()
+	}
+
+	// The commands were logged as they were executed, EXEC itself is not
+	c.Command, c.Argv, c.Argc = "exec", nil, 0
+	c.Propagate = [][][]byte{}
+
+	conn.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// isWatchedKeyModified returns true if a key watched by the client was
+// modified, deleted or has expired since it was watched.
+func isWatchedKeyModified(c *client.Client) bool {
+	if server.watching.isDirty(c) {
+		return true
+	}
+
+	for _, w := range c.Watched {
+		if c.DB.Version(w.Key) != w.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// watchCommand watches the keys so that the next transaction of the client
+// is aborted if any of them is modified before EXEC.
+func watchCommand(c *client.Client) {
+	for _, arg := range c.Argv {
+		key := string(arg)
+
+		var watched bool
+		for _, w := range c.Watched {
+			if w.Key == key {
+				watched = true
+				break
+			}
+		}
+
+		if !watched {
+			c.Watched = append(c.Watched, client.WatchedKey{Key: key, Version: c.DB.Version(key)})
+			server.watching.watch(c, key)
+		}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// unwatchAllKeys forgets the keys watched by the client.
+func unwatchAllKeys(c *client.Client) {
+	c.Watched = nil
+	server.watching.unwatch(c)
+}
+
+// unwatchCommand forgets the keys watched by the client.
+func unwatchCommand(c *client.Client) {
+	unwatchAllKeys(c)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/disk"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+func Test_WatchAbortsExec(t *testing.T) {
+	tc := []struct {
+		name   string
+		modify [][]string
+		abort  bool
+	}{
+		{"not modified", nil, false},
+		{"other key modified", [][]string{{"set", "other", "v"}}, false},
+		{"set", [][]string{{"set", "key", "v"}}, true},
+		{"set and del", [][]string{{"set", "key", "v"}, {"del", "key"}}, true},
+		{"set with expire", [][]string{{"set", "key", "v", "px", "1"}}, true},
+		{"flushall", [][]string{{"set", "other", "v"}, {"flushall"}}, true},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer()
+			c, _ := newTestClient()
+			other, _ := newTestClient()
+
+			var err error
+			if other.KVSDB, err = disk.OpenKVSDB(filepath.Join(t.TempDir(), "dump.kvsdb")); err != nil {
+				t.Fatal(err)
+			}
+
+			testCall(t, c, "watch", "key")
+			for _, args := range tt.modify {
+				testCall(t, other, args...)
+			}
+			time.Sleep(2 * time.Millisecond)
+
+			testCall(t, c, "multi")
+			testCall(t, c, "get", "key")
+			reply := testCall(t, c, "exec")
+			if aborted := reply == nil; aborted != tt.abort {
+				t.Errorf("expected abort %v, got %v", tt.abort, reply)
+			}
+
+			// The keys are no longer watched after EXEC
+			testCall(t, other, "set", "key", "v2")
+			testCall(t, c, "multi")
+			if reply := testCall(t, c, "exec"); reply == nil {
+				t.Errorf("expected the transaction to run after EXEC")
+			}
+		})
+	}
+}
+
+func Test_WatchExistingKeyExpired(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+
+	testCall(t, c, "set", "key", "v", "px", "1")
+	testCall(t, c, "watch", "key")
+	time.Sleep(2 * time.Millisecond)
+
+	testCall(t, c, "multi")
+	if reply := testCall(t, c, "exec"); reply != nil {
+		t.Errorf("expected the transaction to abort, got %v", reply)
+	}
+}
+
+func Test_UnwatchForgetsKeys(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+	other, _ := newTestClient()
+
+	testCall(t, c, "watch", "key")
+	testCall(t, other, "set", "key", "v")
+	testCall(t, other, "del", "key")
+	testCall(t, c, "unwatch")
+
+	testCall(t, c, "multi")
+	if reply := testCall(t, c, "exec"); reply == nil {
+		t.Errorf("expected the transaction to run after UNWATCH")
+	}
+}
+
+func Test_MultiQueuesCommands(t *testing.T) {
+	tc := []struct {
+		name     string
+		commands [][]string
+		expected any
+	}{
+		{"exec", [][]string{{"set", "key", "1"}, {"incr", "key"}, {"get", "key"}}, []any{"OK", 2, []byte("2")}},
+		{"empty", nil, []any{}},
+		{"unknown command", [][]string{{"set", "key", "1"}, {"unknown"}}, "EXECABORT Transaction discarded because of previous errors."},
+		{"wrong arity", [][]string{{"set", "key"}}, "EXECABORT Transaction discarded because of previous errors."},
+		{"runtime error", [][]string{{"set", "key", "a"}, {"incr", "key"}}, []any{"OK", "ERR value is not an integer or out of range"}},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestServer()
+			c, conn := newTestClient()
+
+			testHandle(c, "multi")
+			for _, args := range tt.commands {
+				testHandle(c, args...)
+			}
+			testHandle(c, "exec")
+
+			replies := readReplies(t, conn)
+			if len(replies) != len(tt.commands)+2 {
+				t.Fatalf("expected %d replies, got %v", len(tt.commands)+2, replies)
+			}
+
+			if reply := replies[len(replies)-1]; !reflect.DeepEqual(reply, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, reply)
+			}
+		})
+	}
+
+	// Nothing is executed before EXEC
+	newTestServer()
+	c, _ := newTestClient()
+	testHandle(c, "multi")
+	testHandle(c, "set", "key", "1")
+	if _, found := server.DB.Get("key"); found {
+		t.Error("expected the queued command not to be executed")
+	}
+}
+
+func Test_ExecStopsLoggingAfterAppendFailure(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := disk.OpenAOF(path, disk.FsyncNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+
+	broken, err := disk.OpenAOF(filepath.Join(t.TempDir(), "broken.aof"), disk.FsyncNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.Close()
+
+	// switchaof makes the append of its own call fail, then succeed on the
+	// next call
+	CommandTable["switchaof"] = command.Command{
+		Name:  "switchaof",
+		Type:  command.Write,
+		Arity: 1,
+		Proc: func(c *client.Client) {
+			if server.aof == aof {
+				server.aof = broken
+			} else {
+				server.aof = aof
+			}
+			c.DB.Touch("key")
+			c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+		},
+	}
+	defer delete(CommandTable, "switchaof")
+
+	server.aof = aof
+	testCall(t, c, "set", "key", "0")
+
+	testHandle(c, "multi")
+	testHandle(c, "set", "key", "1")
+	testHandle(c, "switchaof")
+	testHandle(c, "switchaof")
+	testHandle(c, "set", "key", "2")
+	testHandle(c, "exec")
+
+	if err := aof.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := string(disk.EncodeCommand([]byte("set"), []byte("key"), []byte("0"))) +
+		string(disk.EncodeCommand([]byte("multi"))) +
+		string(disk.EncodeCommand([]byte("set"), []byte("key"), []byte("1")))
+	if string(b) != expected {
+		t.Errorf("expected the log to stop at the failed append, got %q", b)
+	}
+}
+
+func Test_WatchDeleteAll(t *testing.T) {
+	newTestServer()
+	server.notifyKeyspaceEvents = notifyKeyspace | notifyGeneric
+
+	c, _ := newTestClient()
+	other, _ := newTestClient()
+	subscriber, conn := newTestClient()
+	server.pubsub.subscribe(subscriber, "__keyspace@0__:key", false)
+
+	testCall(t, other, "set", "key", "v")
+	testCall(t, c, "watch", "key")
+	testCall(t, other, "del", "*")
+
+	testCall(t, c, "multi")
+	if reply := testCall(t, c, "exec"); reply != nil {
+		t.Errorf("expected the transaction to abort, got %v", reply)
+	}
+
+	messages := readReplies(t, conn)
+	if len(messages) != 1 || string(messages[0].([]any)[2].([]byte)) != "del" {
+		t.Errorf("expected the del event, got %v", messages)
+	}
+}
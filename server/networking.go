@@ -42,6 +42,7 @@ func (s *Server) killClient(c *client.Client, kct KillClientType, target any) {
 						// If the client is not busy, kill it immediately
 						targetClient.Conn.Close()
 						s.clients.Delete(key)
+						s.freeClient(targetClient)
 						nKilled++
 					}
 					return false
@@ -56,6 +57,7 @@ func (s *Server) killClient(c *client.Client, kct KillClientType, target any) {
 			if ok {
 				targetClient.(*client.Client).Conn.Close()
 				s.clients.Delete(target)
+				s.freeClient(targetClient.(*client.Client))
 				nKilled++
 				c.Conn.AsyncWrite(protocol.MakeBool(true))
 				return
@@ -68,6 +70,7 @@ func (s *Server) killClient(c *client.Client, kct KillClientType, target any) {
 				if targetClient.Name == target {
 					targetClient.Conn.Close()
 					s.clients.Delete(key)
+					s.freeClient(targetClient)
 					nKilled++
 					return false
 				}
@@ -79,6 +82,14 @@ func (s *Server) killClient(c *client.Client, kct KillClientType, target any) {
 	})
 }
 
+// freeClient releases what the client holds on the server once its
+// connection is closed.
+func (s *Server) freeClient(c *client.Client) {
+	s.unblockClient(c)
+	s.pubsub.remove(c)
+	s.watching.unwatch(c)
+}
+
 // afterCommand is called after a command is executed.
 // It reads the client flags and returns the client to the free state.
 // It also checks if the client is in the closing state and if so, it closes the connection.
@@ -148,7 +159,7 @@ func clientInfoSubCommand(c *client.Client) {
 	s += " addr=" + c.Conn.RemoteAddr().String()
 	s += " name=" + c.Name
 	s += " age=" + strconv.FormatInt(time.Now().Unix()-c.CreateTime.Unix(), 10)
-	s += " flags=" + c.Flags.String()
+	s += " flags=" + c.GetFlags().String()
 
 	c.Conn.AsyncWrite(protocol.MakeBulkString(s))
 }
@@ -164,7 +175,7 @@ func clientListSubCommand(c *client.Client) {
 		ss += " addr=" + client.Conn.RemoteAddr().String()
 		ss += " name=" + client.Name
 		ss += " age=" + strconv.FormatInt(time.Now().Unix()-client.CreateTime.Unix(), 10)
-		ss += " flags=" + client.Flags.String()
+		ss += " flags=" + client.GetFlags().String()
 		ss += string(protocol.CRLF)
 
 		clientss = append(clientss, ss)
@@ -176,12 +187,6 @@ func clientListSubCommand(c *client.Client) {
 
 // clientKillSubCommand Kills the connection of a client.
 func clientKillSubCommand(c *client.Client) {
-
-	if c.Argc < 2 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'kill' subcommand for 'client' command"))
-		return
-	}
-
 	filter := bytes.ToLower(c.Argv[1])
 
 	// Kill by the client ID
@@ -198,16 +203,18 @@ func clientKillSubCommand(c *client.Client) {
 		}
 
 		server.killClient(c, KillClientByID, id)
+		return
 	}
 
 	// Kill by the client remote address (addr:port)
-	if bytes.Equal(filter, []byte("address")) {
+	if bytes.Equal(filter, []byte("addr")) || bytes.Equal(filter, []byte("address")) {
 		if bytes.Equal(c.Argv[2], []byte(c.Conn.RemoteAddr().String())) {
 			c.Conn.AsyncWrite(protocol.MakeBool(false))
 			return
 		}
 
 		server.killClient(c, KillClientByAddr, string(c.Argv[2]))
+		return
 	}
 
 	// Kill by the client name
@@ -218,16 +225,14 @@ func clientKillSubCommand(c *client.Client) {
 		}
 
 		server.killClient(c, KillClientByName, string(c.Argv[2]))
+		return
 	}
+
+	c.Conn.AsyncWrite(NewGenericError("syntax error"))
 }
 
 // clientSetNameSubCommand Sets the name of the client.
 func clientSetNameSubCommand(c *client.Client) {
-	if c.Argc < 2 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'setname' subcommand for 'client' command"))
-		return
-	}
-
 	c.Name = string(c.Argv[1])
 	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
 }
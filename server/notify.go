@@ -0,0 +1,111 @@
+package server
+
+import "errors"
+
+// notifyFlags is a bitmask of the keyspace events published to the
+// subscribers, set with the notify_keyspace_events option.
+type notifyFlags uint16
+
+const (
+	// notifyKeyspace publishes the events to __keyspace@0__:<key>
+	notifyKeyspace notifyFlags = 1 << iota
+	// notifyKeyevent publishes the events to __keyevent@0__:<event>
+	notifyKeyevent
+	// notifyGeneric are the del, expire and persist events
+	notifyGeneric
+	// notifyString are the events of the string commands, bitmaps included
+	notifyString
+	// notifyList are the events of the list commands
+	notifyList
+	// notifySet are the events of the set commands
+	notifySet
+	// notifyHash are the events of the hash commands
+	notifyHash
+	// notifyZSet are the events of the sorted set commands
+	notifyZSet
+	// notifyExpired is the expired event
+	notifyExpired
+	// notifyEvicted is the evicted event. Keys are never evicted as there is
+	// no memory limit, so it is accepted but never published.
+	notifyEvicted
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZSet | notifyExpired | notifyEvicted
+)
+
+// parseNotifyKeyspaceEvents parses the characters of the notify_keyspace_events
+// option:
+//
+//	K  keyspace events
+//	E  keyevent events
+//	g  del, expire and persist
+//	$  string commands
+//	l  list commands
+//	s  set commands
+//	h  hash commands
+//	z  sorted set commands
+//	x  expired
+//	e  evicted, never published as keys are never evicted
+//	A  alias for "g$lshzxe"
+//
+// The other types only publish the generic and expired events.
+func parseNotifyKeyspaceEvents(s string) (notifyFlags, error) {
+	var flags notifyFlags
+	for _, ch := range s {
+		switch ch {
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 'A':
+			flags |= notifyAll
+		default:
+			return 0, errors.New("invalid character '" + string(ch) + "' in notify_keyspace_events")
+		}
+	}
+	return flags, nil
+}
+
+// notifyKeyspaceEvent publishes the event of the given class that happened
+// to the key, if the class is enabled.
+func (s *Server) notifyKeyspaceEvent(class notifyFlags, event, key string) {
+	if s.notifyKeyspaceEvents&class == 0 {
+		return
+	}
+
+	if s.notifyKeyspaceEvents&notifyKeyspace != 0 {
+		s.pubsub.publish("__keyspace@0__:"+key, event)
+	}
+
+	if s.notifyKeyspaceEvents&notifyKeyevent != 0 {
+		s.pubsub.publish("__keyevent@0__:"+event, key)
+	}
+}
+
+// keyRemoved is the remove hook of the database, it aborts the transactions
+// watching the key and publishes the del and expired events.
+func (s *Server) keyRemoved(key string, expired bool) {
+	s.watching.touch(key)
+
+	if expired {
+		s.notifyKeyspaceEvent(notifyExpired, "expired", key)
+		return
+	}
+
+	s.notifyKeyspaceEvent(notifyGeneric, "del", key)
+}
@@ -0,0 +1,99 @@
+package server
+
+import "testing"
+
+func Test_ParseNotifyKeyspaceEvents(t *testing.T) {
+	tc := []struct {
+		s        string
+		expected notifyFlags
+		err      bool
+	}{
+		{"", 0, false},
+		{"K", notifyKeyspace, false},
+		{"E", notifyKeyevent, false},
+		{"Kg", notifyKeyspace | notifyGeneric, false},
+		{"E$", notifyKeyevent | notifyString, false},
+		{"Kx", notifyKeyspace | notifyExpired, false},
+		{"Elshz", notifyKeyevent | notifyList | notifySet | notifyHash | notifyZSet, false},
+		{"KEA", notifyKeyspace | notifyKeyevent | notifyAll, false},
+		{"Ag$lshzxe", notifyAll, false},
+		{"Ke", notifyKeyspace | notifyEvicted, false},
+		{"gg", notifyGeneric, false},
+		{"k", 0, true},
+		{"K E", 0, true},
+		{"KEA!", 0, true},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.s, func(t *testing.T) {
+			flags, err := parseNotifyKeyspaceEvents(tt.s)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error: %v, got: %v", tt.err, err)
+			}
+			if flags != tt.expected {
+				t.Errorf("expected: %b, got: %b", tt.expected, flags)
+			}
+		})
+	}
+}
+
+func Test_WriteCommandsNotify(t *testing.T) {
+	newTestServer()
+	server.notifyKeyspaceEvents = notifyKeyevent | notifyAll
+
+	c, _ := newTestClient()
+	subscriber, conn := newTestClient()
+	server.pubsub.subscribe(subscriber, "__keyevent@0__:*", true)
+
+	tc := []struct {
+		args  []string
+		event string
+	}{
+		{[]string{"set", "str", "1"}, "set"},
+		{[]string{"incr", "str"}, "incrby"},
+		{[]string{"append", "str", "0"}, "append"},
+		{[]string{"setbit", "bits", "1", "1"}, "setbit"},
+		{[]string{"rpush", "list", "a", "b"}, "rpush"},
+		{[]string{"lpop", "list"}, "lpop"},
+		{[]string{"ltrim", "list", "0", "0"}, "ltrim"},
+		{[]string{"sadd", "set", "a", "b"}, "sadd"},
+		{[]string{"srem", "set", "a"}, "srem"},
+		{[]string{"sunionstore", "set2", "set"}, "sunionstore"},
+		{[]string{"hset", "hash", "f", "1"}, "hset"},
+		{[]string{"hincrby", "hash", "f", "1"}, "hincrby"},
+		{[]string{"zadd", "zset", "1", "a", "2", "b"}, "zadd"},
+		{[]string{"zincrby", "zset", "1", "a"}, "zincr"},
+		{[]string{"zrem", "zset", "a"}, "zrem"},
+		{[]string{"bzpopmin", "zset", "0"}, "zpopmin"},
+		{[]string{"hdel", "hash", "f"}, "hdel"},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.args[0], func(t *testing.T) {
+			testCall(t, c, tt.args...)
+
+			messages := readReplies(t, conn)
+			if len(messages) == 0 {
+				t.Fatalf("expected the %s event, got none", tt.event)
+			}
+
+			message := messages[0].([]any)
+			if channel := string(message[2].([]byte)); channel != "__keyevent@0__:"+tt.event {
+				t.Errorf("expected the %s event, got %s", tt.event, channel)
+			}
+		})
+	}
+
+	// Emptying a key publishes the event of the command, then del
+	testCall(t, c, "rpush", "tmp", "a")
+	readReplies(t, conn)
+	testCall(t, c, "rpop", "tmp")
+
+	var events []string
+	for _, message := range readReplies(t, conn) {
+		events = append(events, string(message.([]any)[2].([]byte)))
+	}
+	if len(events) != 2 || events[0] != "__keyevent@0__:rpop" || events[1] != "__keyevent@0__:del" {
+		t.Errorf("expected the rpop and del events, got %v", events)
+	}
+}
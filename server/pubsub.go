@@ -0,0 +1,333 @@
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/common"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// subscriptions are the channels and the patterns a client is subscribed to,
+// in the order they were subscribed.
+type subscriptions struct {
+	channels []string
+	patterns []string
+}
+
+// count returns the number of channels and patterns.
+func (s *subscriptions) count() int64 {
+	return int64(len(s.channels) + len(s.patterns))
+}
+
+// pubsubState keeps track of the subscribed clients.
+type pubsubState struct {
+	mu sync.RWMutex
+	// channels maps every channel to its subscribers
+	channels map[string]map[*client.Client]struct{}
+	// patterns maps every pattern to its subscribers
+	patterns map[string]map[*client.Client]struct{}
+	// clients maps every subscribed client to its subscriptions
+	clients map[*client.Client]*subscriptions
+}
+
+func newPubSubState() pubsubState {
+	return pubsubState{
+		channels: make(map[string]map[*client.Client]struct{}),
+		patterns: make(map[string]map[*client.Client]struct{}),
+		clients:  make(map[*client.Client]*subscriptions),
+	}
+}
+
+// numChannels returns the number of channels with at least one subscriber.
+func (p *pubsubState) numChannels() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.channels)
+}
+
+// numPatterns returns the number of patterns with at least one subscriber.
+func (p *pubsubState) numPatterns() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.patterns)
+}
+
+// subscribe adds the client to the subscribers of the channel, or of the
+// pattern if pattern is true. Returns the number of subscriptions of the
+// client.
+func (p *pubsubState) subscribe(c *client.Client, name string, pattern bool) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	subs, ok := p.clients[c]
+	if !ok {
+		subs = &subscriptions{}
+		p.clients[c] = subs
+	}
+
+	subscribers, list := p.channels, &subs.channels
+	if pattern {
+		subscribers, list = p.patterns, &subs.patterns
+	}
+
+	if _, ok := subscribers[name][c]; !ok {
+		if subscribers[name] == nil {
+			subscribers[name] = make(map[*client.Client]struct{})
+		}
+		subscribers[name][c] = struct{}{}
+		*list = append(*list, name)
+	}
+
+	return subs.count()
+}
+
+// unsubscribe removes the client from the subscribers of the channel, or of
+// the pattern if pattern is true. Returns the number of subscriptions left
+// to the client.
+func (p *pubsubState) unsubscribe(c *client.Client, name string, pattern bool) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	subs, ok := p.clients[c]
+	if !ok {
+		return 0
+	}
+
+	subscribers, list := p.channels, &subs.channels
+	if pattern {
+		subscribers, list = p.patterns, &subs.patterns
+	}
+
+	if _, ok := subscribers[name][c]; ok {
+		delete(subscribers[name], c)
+		if len(subscribers[name]) == 0 {
+			delete(subscribers, name)
+		}
+
+		for i, s := range *list {
+			if s == name {
+				*list = append((*list)[:i:i], (*list)[i+1:]...)
+				break
+			}
+		}
+	}
+
+	n := subs.count()
+	if n == 0 {
+		delete(p.clients, c)
+	}
+	return n
+}
+
+// subscribed returns the channels, or the patterns if pattern is true, the
+// client is subscribed to.
+func (p *pubsubState) subscribed(c *client.Client, pattern bool) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	subs, ok := p.clients[c]
+	if !ok {
+		return nil
+	}
+
+	if pattern {
+		return append([]string(nil), subs.patterns...)
+	}
+	return append([]string(nil), subs.channels...)
+}
+
+// remove unsubscribes the client from every channel and pattern. It is used
+// when the connection is closed.
+func (p *pubsubState) remove(c *client.Client) {
+	for _, channel := range p.subscribed(c, false) {
+		p.unsubscribe(c, channel, false)
+	}
+	for _, pattern := range p.subscribed(c, true) {
+		p.unsubscribe(c, pattern, true)
+	}
+}
+
+// publish sends the message to the subscribers of the channel and to the
+// subscribers of the patterns matching the channel. Returns the number of
+// clients that received the message.
+func (p *pubsubState) publish(channel, message string) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var n int64
+
+	if subscribers, ok := p.channels[channel]; ok {
+		reply := protocol.MakeArray(
+			protocol.MakeBulkString("message"),
+			protocol.MakeBulkString(channel),
+			protocol.MakeBulkString(message))
+
+		for c := range subscribers {
+			c.Conn.AsyncWrite(reply)
+			n++
+		}
+	}
+
+	for pattern, subscribers := range p.patterns {
+		if !common.StringMatch(pattern, channel) {
+			continue
+		}
+
+		reply := protocol.MakeArray(
+			protocol.MakeBulkString("pmessage"),
+			protocol.MakeBulkString(pattern),
+			protocol.MakeBulkString(channel),
+			protocol.MakeBulkString(message))
+
+		for c := range subscribers {
+			c.Conn.AsyncWrite(reply)
+			n++
+		}
+	}
+
+	return n
+}
+
+// isSubscribeCommand returns true if the command is allowed while the client
+// is subscribed to a channel or a pattern.
+func isSubscribeCommand(cmd command.Command) bool {
+	switch cmd.Name {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping":
+		return true
+	}
+	return false
+}
+
+// makeSubscriptionReply returns the reply confirming a subscription change.
+// A null name is sent when the client had no subscription to remove.
+func makeSubscriptionReply(kind string, name []byte, n int64) []byte {
+	reply := protocol.MakeNull()
+	if name != nil {
+		reply = protocol.MakeBulkString(string(name))
+	}
+
+	return protocol.MakeArray(protocol.MakeBulkString(kind), reply, protocol.MakeInteger(n))
+}
+
+// subscribeClient subscribes the client to the channels or patterns given as
+// arguments. The client enters the subscribed mode, where only the subscribe
+// commands are allowed.
+func subscribeClient(c *client.Client, pattern bool) {
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+
+	for _, name := range c.Argv {
+		n := server.pubsub.subscribe(c, string(name), pattern)
+		c.Conn.AsyncWrite(makeSubscriptionReply(kind, name, n))
+	}
+
+	c.AddFlag(client.FlagPubSub)
+}
+
+// unsubscribeClient unsubscribes the client from the channels or patterns
+// given as arguments, or from all of them without arguments. The client
+// leaves the subscribed mode once it has no subscription left.
+func unsubscribeClient(c *client.Client, pattern bool) {
+	kind := "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+
+	names := c.Argv
+	if len(names) == 0 {
+		for _, name := range server.pubsub.subscribed(c, pattern) {
+			names = append(names, []byte(name))
+		}
+	}
+
+	var n int64
+	if len(names) == 0 {
+		n = server.pubsub.unsubscribe(c, "", pattern)
+		c.Conn.AsyncWrite(makeSubscriptionReply(kind, nil, n))
+	}
+
+	for _, name := range names {
+		n = server.pubsub.unsubscribe(c, string(name), pattern)
+		c.Conn.AsyncWrite(makeSubscriptionReply(kind, name, n))
+	}
+
+	if n == 0 {
+		c.RemoveFlag(client.FlagPubSub)
+	}
+}
+
+// subscribeCommand subscribes the client to the given channels.
+func subscribeCommand(c *client.Client) {
+	subscribeClient(c, false)
+}
+
+// unsubscribeCommand unsubscribes the client from the given channels, or
+// from every channel.
+func unsubscribeCommand(c *client.Client) {
+	unsubscribeClient(c, false)
+}
+
+// psubscribeCommand subscribes the client to the given glob-style patterns.
+func psubscribeCommand(c *client.Client) {
+	subscribeClient(c, true)
+}
+
+// punsubscribeCommand unsubscribes the client from the given patterns, or
+// from every pattern.
+func punsubscribeCommand(c *client.Client) {
+	unsubscribeClient(c, true)
+}
+
+// publishCommand sends a message to a channel and replies with the number of
+// clients that received it.
+func publishCommand(c *client.Client) {
+	n := server.pubsub.publish(string(c.Argv[0]), string(c.Argv[1]))
+	c.Conn.AsyncWrite(protocol.MakeInteger(n))
+}
+
+// pubsubChannelsSubCommand returns the channels with at least one
+// subscriber, optionally matching a pattern.
+func pubsubChannelsSubCommand(c *client.Client) {
+	pattern := "*"
+	if c.Argc > 1 {
+		pattern = string(c.Argv[1])
+	}
+
+	server.pubsub.mu.RLock()
+	channels := make([]string, 0)
+	for channel := range server.pubsub.channels {
+		if common.StringMatch(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	server.pubsub.mu.RUnlock()
+
+	sort.Strings(channels)
+	c.Conn.AsyncWrite(makeStringArray(channels))
+}
+
+// pubsubNumSubSubCommand returns the number of subscribers of each channel.
+func pubsubNumSubSubCommand(c *client.Client) {
+	server.pubsub.mu.RLock()
+	defer server.pubsub.mu.RUnlock()
+
+	replies := make([][]byte, 0, 2*(c.Argc-1))
+	for _, channel := range c.Argv[1:] {
+		replies = append(replies,
+			protocol.MakeBulkString(string(channel)),
+			protocol.MakeInteger(int64(len(server.pubsub.channels[string(channel)]))))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// pubsubNumPatSubCommand returns the number of patterns with at least one
+// subscriber.
+func pubsubNumPatSubCommand(c *client.Client) {
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(server.pubsub.numPatterns())))
+}
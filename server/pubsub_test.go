@@ -0,0 +1,36 @@
+package server
+
+import "testing"
+
+func Test_PublishMatchesPatterns(t *testing.T) {
+	newTestServer()
+	subscriber, _ := newTestClient()
+	publisher, _ := newTestClient()
+
+	server.pubsub.subscribe(subscriber, "news/*", true)
+	server.pubsub.subscribe(subscriber, "news/[^s]*", true)
+	server.pubsub.subscribe(subscriber, "news/sport/football", false)
+
+	tc := []struct {
+		channel  string
+		expected int
+	}{
+		{"news/sport/football", 2},
+		{"news/tech", 2},
+		{"news", 0},
+		{"weather/news/tech", 0},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.channel, func(t *testing.T) {
+			if n := testCall(t, publisher, "publish", tt.channel, "hello"); n != tt.expected {
+				t.Errorf("expected %d receivers, got %v", tt.expected, n)
+			}
+		})
+	}
+
+	reply, ok := testCall(t, publisher, "pubsub", "channels", "news/*").([]any)
+	if !ok || len(reply) != 1 || string(reply[0].([]byte)) != "news/sport/football" {
+		t.Errorf("expected the subscribed channel, got %v", reply)
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/logger"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrBgsaveInProgress is returned when a save is requested while a
+	// background save is still running.
+	ErrBgsaveInProgress = errors.New("background save already in progress")
+	// ErrInvalidSaveParam is returned when a save rule in the config is malformed.
+	ErrInvalidSaveParam = errors.New("invalid save parameters")
+)
+
+// saveRetryDelay is the time waited before retrying a save triggered by the
+// save rules after it failed.
+const saveRetryDelay = 5 * time.Second
+
+// saveParam is a rule that triggers a background save once the given
+// number of changes happened within the given amount of time.
+type saveParam struct {
+	seconds time.Duration
+	changes int64
+}
+
+// parseSaveParams parses save rules in the "<seconds> <changes>" format.
+func parseSaveParams(rules []string) ([]saveParam, error) {
+	var params []saveParam
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if len(fields) != 2 {
+			return nil, ErrInvalidSaveParam
+		}
+
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || seconds < 1 {
+			return nil, ErrInvalidSaveParam
+		}
+
+		changes, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, ErrInvalidSaveParam
+		}
+
+		params = append(params, saveParam{
+			seconds: time.Duration(seconds) * time.Second,
+			changes: changes,
+		})
+	}
+
+	return params, nil
+}
+
+// saveState keeps track of the saves done by the server.
+type saveState struct {
+	mu sync.Mutex
+	// params are the rules that trigger a background save.
+	params []saveParam
+	// lastSave is the time of the last successful save.
+	lastSave time.Time
+	// lastSaveErr is the error returned by the last save attempt.
+	lastSaveErr error
+	// lastSaveTry is the time of the last save attempt.
+	lastSaveTry time.Time
+	// dirtyAtLastSave is the dirty counter of the map at the last successful save.
+	dirtyAtLastSave int64
+	// bgsaveInProgress is set to 1 while a background save is running.
+	bgsaveInProgress int32
+	// bgsave waits for the running background save. It is only added to
+	// with the server lock held.
+	bgsave sync.WaitGroup
+}
+
+// save saves the database on disk. The caller must hold the server lock.
+func (s *Server) save() error {
+	if atomic.LoadInt32(&s.saveState.bgsaveInProgress) == 1 {
+		return ErrBgsaveInProgress
+	}
+
+	dirty := s.DB.Dirty()
+	err := s.kvsDB.Write(s.DB)
+	s.saveDone(dirty, err)
+
+	return err
+}
+
+// backgroundSave saves the database on disk in the background. The data is
+// encoded while the caller holds the server lock, so the snapshot is
+// consistent, then it is written to disk without blocking other commands.
+func (s *Server) backgroundSave() error {
+	if !atomic.CompareAndSwapInt32(&s.saveState.bgsaveInProgress, 0, 1) {
+		return ErrBgsaveInProgress
+	}
+
+	dirty := s.DB.Dirty()
+	b, err := s.kvsDB.Encode(s.DB)
+	if err != nil {
+		atomic.StoreInt32(&s.saveState.bgsaveInProgress, 0)
+		s.saveDone(dirty, err)
+		return err
+	}
+
+	s.saveState.bgsave.Add(1)
+	go func() {
+		defer s.saveState.bgsave.Done()
+		defer atomic.StoreInt32(&s.saveState.bgsaveInProgress, 0)
+
+		err := s.kvsDB.WriteEncoded(b)
+		s.saveDone(dirty, err)
+		if err != nil {
+			logger.S().Error("background saving failed: ", err)
+			return
+		}
+
+		logger.S().Info("background saving terminated with success")
+	}()
+
+	return nil
+}
+
+// waitBackgroundSave waits until the running background save, if any, has
+// written the file. The caller must hold the write lock so that no other
+// background save starts in the meantime.
+func (s *Server) waitBackgroundSave() {
+	s.saveState.bgsave.Wait()
+}
+
+// saveDone records the result of a save.
+func (s *Server) saveDone(dirty int64, err error) {
+	s.saveState.mu.Lock()
+	defer s.saveState.mu.Unlock()
+
+	s.saveState.lastSaveErr = err
+	s.saveState.lastSaveTry = time.Now()
+	if err == nil {
+		s.saveState.lastSave = time.Now()
+		s.saveState.dirtyAtLastSave = dirty
+	}
+}
+
+// ruleMet returns the first save rule met given the current dirty counter,
+// along with the number of changes since the last successful save. After a
+// failed save, the rules are ignored until saveRetryDelay has elapsed.
+func (st *saveState) ruleMet(dirty int64, now time.Time) (saveParam, int64, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.lastSaveErr != nil && now.Sub(st.lastSaveTry) < saveRetryDelay {
+		return saveParam{}, 0, false
+	}
+
+	changes := dirty - st.dirtyAtLastSave
+	elapsed := now.Sub(st.lastSave)
+	for _, p := range st.params {
+		if changes >= p.changes && elapsed >= p.seconds && changes > 0 {
+			return p, changes, true
+		}
+	}
+
+	return saveParam{}, 0, false
+}
+
+// saveCron starts a background save whenever one of the save rules is met.
+func (s *Server) saveCron() {
+	for {
+		time.Sleep(100 * time.Millisecond)
+
+		p, changes, ok := s.saveState.ruleMet(s.DB.Dirty(), time.Now())
+		if !ok {
+			continue
+		}
+
+		logger.S().Infof("%d changes in %d seconds. Saving...", changes, int(p.seconds.Seconds()))
+
+		s.mu.RLock()
+		err := s.backgroundSave()
+		s.mu.RUnlock()
+		if err != nil && err != ErrBgsaveInProgress {
+			logger.S().Error("failed starting background save: ", err)
+		}
+	}
+}
+
+// initSaveState initializes the save rules from the config.
+func (s *Server) initSaveState() error {
+	params, err := parseSaveParams(viper.GetStringSlice("database.save"))
+	if err != nil {
+		return err
+	}
+
+	s.saveState.params = params
+	s.saveState.lastSave = time.Now()
+	s.saveState.dirtyAtLastSave = s.DB.Dirty()
+	return nil
+}
+
+// saveCommand saves the database on disk synchronously.
+func saveCommand(c *client.Client) {
+	if err := server.save(); err != nil {
+		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// bgsaveCommand saves the database on disk in the background.
+func bgsaveCommand(c *client.Client) {
+	if err := server.backgroundSave(); err != nil {
+		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("Background saving started"))
+}
+
+// lastsaveCommand returns the unix time of the last successful save.
+func lastsaveCommand(c *client.Client) {
+	server.saveState.mu.Lock()
+	lastSave := server.saveState.lastSave
+	server.saveState.mu.Unlock()
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(lastSave.Unix()))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/disk"
+)
+
+func Test_ParseSaveParams(t *testing.T) {
+	tc := []struct {
+		name     string
+		rules    []string
+		expected []saveParam
+		err      error
+	}{
+		{"none", nil, nil, nil},
+		{"single", []string{"900 1"}, []saveParam{{900 * time.Second, 1}}, nil},
+		{"multiple", []string{"900 1", "300 10", "60 10000"}, []saveParam{
+			{900 * time.Second, 1},
+			{300 * time.Second, 10},
+			{60 * time.Second, 10000},
+		}, nil},
+		{"extra spaces", []string{"  60   5 "}, []saveParam{{60 * time.Second, 5}}, nil},
+		{"zero changes", []string{"60 0"}, []saveParam{{60 * time.Second, 0}}, nil},
+		{"missing changes", []string{"60"}, nil, ErrInvalidSaveParam},
+		{"too many fields", []string{"60 1 1"}, nil, ErrInvalidSaveParam},
+		{"empty rule", []string{""}, nil, ErrInvalidSaveParam},
+		{"zero seconds", []string{"0 1"}, nil, ErrInvalidSaveParam},
+		{"negative seconds", []string{"-1 1"}, nil, ErrInvalidSaveParam},
+		{"negative changes", []string{"60 -1"}, nil, ErrInvalidSaveParam},
+		{"not a number", []string{"60 a"}, nil, ErrInvalidSaveParam},
+		{"overflow", []string{"60 9223372036854775808"}, nil, ErrInvalidSaveParam},
+		{"one invalid rule", []string{"900 1", "x 1"}, nil, ErrInvalidSaveParam},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parseSaveParams(tt.rules)
+			if err != tt.err {
+				t.Fatalf("expected error: %v, got: %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(params, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, params)
+			}
+		})
+	}
+}
+
+func Test_SaveRuleMet(t *testing.T) {
+	now := time.Now()
+	errSave := errors.New("disk full")
+
+	tc := []struct {
+		name        string
+		lastSave    time.Time
+		lastSaveErr error
+		lastSaveTry time.Time
+		dirty       int64
+		expected    bool
+	}{
+		{"no changes", now.Add(-time.Hour), nil, time.Time{}, 0, false},
+		{"not enough changes", now.Add(-90 * time.Second), nil, time.Time{}, 5, false},
+		{"not enough time", now.Add(-30 * time.Second), nil, time.Time{}, 100, false},
+		{"rule met", now.Add(-90 * time.Second), nil, time.Time{}, 10, true},
+		{"failed just now", now.Add(-90 * time.Second), errSave, now.Add(-time.Second), 10, false},
+		{"failed before the retry delay", now.Add(-90 * time.Second), errSave, now.Add(-saveRetryDelay), 10, true},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			st := saveState{
+				params:      []saveParam{{60 * time.Second, 10}},
+				lastSave:    tt.lastSave,
+				lastSaveErr: tt.lastSaveErr,
+				lastSaveTry: tt.lastSaveTry,
+			}
+
+			p, changes, ok := st.ruleMet(tt.dirty, now)
+			if ok != tt.expected {
+				t.Fatalf("expected: %v, got: %v", tt.expected, ok)
+			}
+			if ok && (p != st.params[0] || changes != tt.dirty) {
+				t.Errorf("expected the rule with %d changes, got %v with %d changes", tt.dirty, p, changes)
+			}
+		})
+	}
+}
+
+func Test_FlushallWaitsForBackgroundSave(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+
+	kvsDB, err := disk.OpenKVSDB(filepath.Join(t.TempDir(), "dump.kvsdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.kvsDB, c.KVSDB = kvsDB, kvsDB
+
+	for i := 0; i < 1000; i++ {
+		testCall(t, c, "set", strconv.Itoa(i), "value")
+	}
+
+	if err := server.backgroundSave(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testCall(t, c, "flushall"); n != 1000 {
+		t.Errorf("expected 1000 keys flushed, got %v", n)
+	}
+
+	if atomic.LoadInt32(&server.saveState.bgsaveInProgress) != 0 {
+		t.Fatal("expected the background save to be done")
+	}
+
+	data, err := kvsDB.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Len() != 0 {
+		t.Errorf("expected the file to stay empty, got %d keys", data.Len())
+	}
+}
+
+func Test_FlushallClearError(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+
+	dir := t.TempDir()
+	kvsDB, err := disk.OpenKVSDB(filepath.Join(dir, "dump.kvsdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.KVSDB = kvsDB
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// testCall fails if there is more than one reply
+	if reply, _ := testCall(t, c, "flushall").(string); !strings.HasPrefix(reply, "ERR ") {
+		t.Errorf("expected an error, got %v", reply)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
@@ -39,6 +40,14 @@ type Server struct {
 	Stats
 	// kvsDB is the file used to persist the data structure.
 	kvsDB *disk.KVSDB
+	// aof is the append-only file that logs every write command.
+	// It is nil when the append-only file is disabled.
+	aof *disk.AOF
+	// saveState keeps track of the saves done by the server.
+	saveState saveState
+	// mu serializes write commands against every other command, so that
+	// the commands are applied and logged in the same order.
+	mu sync.RWMutex
 	// clients is a map of all the clients connected to the server.
 	clients sync.Map
 	// pool is the pool of goroutines that the server uses to handle incoming
@@ -46,6 +55,15 @@ type Server struct {
 	pool *goroutine.Pool
 	// nextClientID is the next monotonically increasing client ID.
 	nextClientID int64
+	// blocking keeps track of the clients waiting for keys to be ready.
+	blocking blockingState
+	// pubsub keeps track of the clients subscribed to channels and patterns.
+	pubsub pubsubState
+	// watching keeps track of the keys watched by the clients.
+	watching watchState
+	// notifyKeyspaceEvents are the keyspace events published to the
+	// subscribers.
+	notifyKeyspaceEvents notifyFlags
 
 	*gnet.EventServer
 	wg sync.WaitGroup
@@ -54,133 +72,77 @@ type Server struct {
 // server is the global server variable.
 var server *Server
 
-// CommandTable is the table of commands that the server supports.
-var CommandTable = map[string]command.Command{
-	"get": {
-		Name:        "get",
-		Description: "Gets a key's value",
-		Type:        command.Read,
-		Proc:        getCommand},
-	"set": {
-		Name:        "set",
-		Description: "Sets a new key",
-		Type:        command.Write,
-		Proc:        setCommand},
-	"del": {
-		Name:        "del",
-		Description: "Gets a key's value",
-		Type:        command.Write,
-		Proc:        delCommand},
-	"keys": {
-		Name:        "keys",
-		Description: "Gets all keys",
-		Type:        command.Read,
-		Proc:        keysCommand},
-	"info": {
-		Name:        "info",
-		Description: "Gets server info",
-		Type:        command.Read,
-		Proc:        infoCommand},
-	"ping": {
-		Name:        "ping",
-		Description: "Pings the server",
-		Type:        command.Read,
-		Proc:        pingCommand},
-	"flushall": {
-		Name:        "flushall",
-		Description: "Flushes all keys",
-		Type:        command.Write,
-		Proc:        flushallCommand},
-	"command": {
-		Name:        "command",
-		Description: "Gets all commands",
-		Type:        command.Read,
-		Proc:        commandCommand},
-	"expire": {
-		Name:        "expire",
-		Description: "Sets a key's expiration by seconds",
-		Type:        command.Write,
-		Proc:        expireCommand},
-	"pexpire": {
-		Name:        "pexpire",
-		Description: "Sets a key's expiration by milliseconds",
-		Type:        command.Write,
-		Proc:        pexpireCommand},
-	"ttl": {
-		Name:        "ttl",
-		Description: "Gets a key's expiration in seconds",
-		Type:        command.Read,
-		Proc:        ttlCommand},
-	"pttl": {
-		Name:        "pttl",
-		Description: "Gets a key's expiration in milliseconds",
-		Type:        command.Read,
-		Proc:        pttlCommand},
-	"client": {
-		Name:        "client",
-		SubCommands: clientSubCommands,
-	},
-}
-
-var clientSubCommands = map[string]command.Command{
-	"id": {
-		Name:        "id",
-		Description: "Returns the id of the current connection",
-		Type:        command.Read,
-		Proc:        clientCommand,
-	},
-	"info": {
-		Name:        "info",
-		Description: "Returns the info of the current connection",
-		Type:        command.Read,
-		Proc:        clientCommand,
-	},
-	"list": {
-		Name:        "list",
-		Description: "Lists all connected clients",
-		Type:        command.Read,
-		Proc:        clientCommand,
-	},
-	"kill": {
-		Name:        "kill",
-		Description: "Closes a given connection",
-		Type:        command.Write,
-		Proc:        clientCommand,
-	},
-	"setname": {
-		Name:        "setname",
-		Description: "Sets the name of the current connection",
-		Type:        command.Write,
-		Proc:        clientCommand,
-	},
-	"getname": {
-		Name:        "getname",
-		Description: "Gets the name of the current connection",
-		Type:        command.Read,
-		Proc:        clientCommand,
-	},
-}
-
 // New creates a new server.
 func New() (*Server, error) {
+	notifyKeyspaceEvents, err := parseNotifyKeyspaceEvents(viper.GetString("server.notify_keyspace_events"))
+	if err != nil {
+		return nil, err
+	}
+
 	kvsDB, err := disk.OpenKVSDB(viper.GetString("database.path"))
 	if err != nil {
 		return nil, err
 	}
 
+	server = &Server{
+		PID:      os.Getpid(),
+		Stats:    Stats{StartTime: time.Now()},
+		kvsDB:    kvsDB,
+		pool:     goroutine.Default(),
+		blocking: newBlockingState(),
+		pubsub:   newPubSubState(),
+		watching: newWatchState(),
+
+		notifyKeyspaceEvents: notifyKeyspaceEvents,
+	}
+
+	if viper.GetBool("appendonly.enabled") {
+		aof, err := openAppendOnlyFile()
+		if err != nil {
+			return nil, err
+		}
+
+		server.aof = aof
+	}
+
+	// The append-only file always has the most recent data, prefer it over
+	// the snapshot when it is available.
+	if server.aof != nil && server.aof.Size() > 0 {
+		server.DB = datastructure.NewMap()
+		if err := server.loadAppendOnlyFile(); err != nil {
+			return nil, err
+		}
+
+		server.DB.SetRemoveHook(server.keyRemoved)
+
+		return server, server.initSaveState()
+	}
+
 	db, err := kvsDB.Read()
 	if err != nil {
 		return nil, err
 	}
 
-	server = &Server{
-		PID:   os.Getpid(),
-		DB:    db,
-		kvsDB: kvsDB,
-		pool:  goroutine.Default(),
+	server.DB = db
+	server.DB.SetRemoveHook(server.keyRemoved)
+
+	if server.aof != nil {
+		// Seed the new append-only file with the data loaded from the snapshot
+		snapshot, err := disk.EncodeSnapshot(db)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := server.aof.StartRewrite(); err != nil {
+			return nil, err
+		}
+
+		if err := server.aof.FinishRewrite(snapshot); err != nil {
+			return nil, err
+		}
 	}
 
-	return server, nil
+	return server, server.initSaveState()
 }
 
 // Run starts the server.
@@ -190,6 +152,8 @@ func (s *Server) Run() error {
 		s.bindToAddress(addr)
 	}
 
+	go s.saveCron()
+
 	s.wg.Wait()
 	return nil
 }
@@ -241,6 +205,8 @@ func (s *Server) OnInitComplete(svr gnet.Server) (action gnet.Action) {
 func (s *Server) OnOpened(conn gnet.Conn) (out []byte, action gnet.Action) {
 	logger.S().Debugf("a new connection to the server has been opened [%s]", conn.RemoteAddr().String())
 
+	atomic.AddInt64(&s.NumConnections, 1)
+
 	s.clients.Store(conn.RemoteAddr().String(), &client.Client{
 		ID:         atomic.AddInt64(&s.nextClientID, 1),
 		Flags:      client.FlagNone,
@@ -257,18 +223,30 @@ func (s *Server) OnOpened(conn gnet.Conn) (out []byte, action gnet.Action) {
 func (s *Server) OnClosed(conn gnet.Conn, err error) (action gnet.Action) {
 	logger.S().Debugf("client closed the connection [%s]", conn.RemoteAddr().String())
 
-	s.clients.Delete(conn.RemoteAddr().String())
+	if v, ok := s.clients.LoadAndDelete(conn.RemoteAddr().String()); ok {
+		s.freeClient(v.(*client.Client))
+	}
 	return
 }
 
 // OnShutdown (see gnet docs: https://pkg.go.dev/github.com/panjf2000/gnet#EventServer.OnShutdown)
 func (s *Server) OnShutdown(svr gnet.Server) {
-	if err := s.kvsDB.Write(s.DB); err != nil {
+	// Wait for the running background save so it does not
+	// replace the final snapshot with an older one.
+	for atomic.LoadInt32(&s.saveState.bgsaveInProgress) == 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.mu.Lock()
+	if err := s.save(); err != nil {
 		logger.S().Warn("failed saving db: ", err)
 	}
+	s.mu.Unlock()
 
-	if err := s.kvsDB.Close(); err != nil {
-		logger.S().Warn("failed closing db: ", err)
+	if s.aof != nil {
+		if err := s.aof.Close(); err != nil {
+			logger.S().Warn("failed closing append only file: ", err)
+		}
 	}
 
 	logger.S().Info("DB saved on disk")
@@ -290,92 +268,204 @@ func (s *Server) bindToAddress(addr string) {
 
 // handle handles client requests.
 func (s *Server) handle(data []byte, conn gnet.Conn) {
-	recvCmd, recvArgv := s.parseObject(data)
-
-	cmd, ok := CommandTable[string(recvCmd)]
+	v, ok := s.clients.Load(conn.RemoteAddr().String())
 	if !ok {
-		conn.AsyncWrite(NewGenericError("unknown command '" + string(recvCmd) + "'"))
+		// The client was killed in the meantime
 		return
 	}
 
-	if cmd.SubCommands != nil {
-		if len(recvArgv) == 0 {
-			conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + string(recvCmd) + "' command"))
-			return
-		}
+	// The reply is sent before the command completes (e.g. before it is
+	// logged to the append-only file), so the next command of the client
+	// must wait for the current one
+	c := v.(*client.Client)
+	c.Lock()
+	defer c.Unlock()
 
-		subCmd, ok := cmd.SubCommands[string(recvArgv[0])]
-		if !ok {
-			conn.AsyncWrite(NewGenericError("unknown subcommand '" + string(recvArgv[0]) + "' for '" + string(recvCmd) + "' command"))
-			return
+	// A blocked client handles its next commands once it is unblocked
+	if s.queueIfBlocked(c, data) {
+		return
+	}
+
+	s.process(c, data)
+}
+
+// process executes the command of the frame. It is called with the client
+// lock held.
+func (s *Server) process(c *client.Client, data []byte) {
+	conn := c.Conn
+
+	// A bug in a command must never bring the whole server down
+	defer func() {
+		if r := recover(); r != nil {
+			logger.S().Errorf("recovered from panic while handling a command: %v", r)
+			conn.AsyncWrite(NewGenericError("internal error while handling the command"))
 		}
+	}()
 
-		cmd = subCmd
+	recvCmd, recvArgv, err := s.parseObject(data)
+	if err != nil {
+		conn.AsyncWrite(NewGenericError("Protocol error: " + err.Error()))
+		return
 	}
 
-	v, _ := s.clients.Load(conn.RemoteAddr().String())
+	cmd, err := s.lookupCommand(recvCmd, recvArgv)
+	if err != nil {
+		flagTransaction(c)
+		conn.AsyncWrite(NewGenericError(err.Error()))
+		return
+	}
+
+	if !cmd.CheckArity(len(recvArgv) + 1) {
+		flagTransaction(c)
+		conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + commandFullName(recvCmd, recvArgv, cmd) + "' command"))
+		return
+	}
+
+	// A subscribed client only waits for messages
+	if c.HasFlag(client.FlagPubSub) && !isSubscribeCommand(cmd) {
+		flagTransaction(c)
+		conn.AsyncWrite(NewGenericError("Can't execute '" + commandFullName(recvCmd, recvArgv, cmd) + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context"))
+		return
+	}
+
+	// The commands of a transaction are executed by EXEC
+	if c.HasFlag(client.FlagMulti) && !isTransactionCommand(cmd) {
+		queueCommand(c, cmd, recvCmd, recvArgv)
+		return
+	}
+
+	atomic.AddInt64(&s.NumCommands, 1)
 
-	c := v.(*client.Client)
 	c.Command = cmd.Name
 	c.Argv = recvArgv
 	c.Argc = len(recvArgv)
+	c.Propagate = nil
 
 	// mark the client as busy
 	c.RemoveFlag(client.FlagNone)
 	c.AddFlag(client.FlagBusy)
 
-	cmd.Proc(c)
+	s.call(c, cmd)
 	s.afterCommand(c)
 }
 
+// call executes the command. Write commands are executed exclusively and
+// are logged to the append-only file if they changed the dataset.
+func (s *Server) call(c *client.Client, cmd command.Command) {
+	if cmd.Type&command.Write == 0 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		cmd.Proc(c)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirty := s.DB.Dirty()
+	cmd.Proc(c)
+
+	if s.aof != nil && s.DB.Dirty() != dirty {
+		s.feedAppendOnlyFile(c)
+	}
+
+	s.handleClientsBlockedOnKeys()
+}
+
+// lookupCommand returns the command (or the sub-command) with the given name.
+func (s *Server) lookupCommand(recvCmd []byte, recvArgv [][]byte) (command.Command, error) {
+	cmd, ok := CommandTable[string(recvCmd)]
+	if !ok {
+		return command.Command{}, errors.New("unknown command '" + string(recvCmd) + "'")
+	}
+
+	// Commands like 'command' can also be called without a sub-command
+	if cmd.SubCommands != nil && (len(recvArgv) > 0 || cmd.Proc == nil) {
+		if len(recvArgv) == 0 {
+			return command.Command{}, errors.New("wrong number of arguments for '" + string(recvCmd) + "' command")
+		}
+
+		subCmd, ok := cmd.SubCommands[string(bytes.ToLower(recvArgv[0]))]
+		if !ok {
+			return command.Command{}, errors.New("unknown subcommand '" + string(recvArgv[0]) + "' for '" + string(recvCmd) + "' command")
+		}
+
+		cmd = subCmd
+	}
+
+	return cmd, nil
+}
+
+// commandFullName returns the name of the command as sent by the client,
+// including the sub-command name if any (e.g. "client|kill").
+func commandFullName(recvCmd []byte, recvArgv [][]byte, cmd command.Command) string {
+	if len(recvArgv) > 0 && cmd.Name != string(recvCmd) {
+		return command.FullName(string(recvCmd), cmd.Name)
+	}
+	return string(recvCmd)
+}
+
 // parseObject parses the resp3 object sent by the client.
 // returns the command and the arguments.
-func (s *Server) parseObject(data []byte) ([]byte, [][]byte) {
+func (s *Server) parseObject(data []byte) ([]byte, [][]byte, error) {
 	reader := protocol.NewReader(bytes.NewReader(data))
 	// TODO: Once generics are released, we should use it here.
 	obj, err := reader.ReadObject()
 	if err != nil {
-		logger.S().Error(err)
-		return nil, nil
+		return nil, nil, err
 	}
 
-	recv := obj.([]any)
-
-	recvCmd, rawRecvArgv := bytes.ToLower(recv[0].([]byte)), recv[1:]
+	recv, ok := obj.([]any)
+	if !ok || len(recv) == 0 {
+		return nil, nil, errors.New("expected a non-empty array of bulk strings")
+	}
 
-	var recvArgv [][]byte
-	for _, v := range rawRecvArgv {
-		recvArgv = append(recvArgv, v.([]byte))
+	var recvArgs [][]byte
+	for _, v := range recv {
+		arg, ok := v.([]byte)
+		if !ok {
+			return nil, nil, errors.New("expected a non-empty array of bulk strings")
+		}
+		recvArgs = append(recvArgs, arg)
 	}
 
+	recvCmd, recvArgv := bytes.ToLower(recvArgs[0]), recvArgs[1:]
+
 	// Wrap args if it starts with a quote
-	if len(recvArgv) > 0 && recvArgv[0][0] == '"' {
+	if len(recvArgv) > 0 && len(recvArgv[0]) > 0 && recvArgv[0][0] == '"' {
 		recvArgv = command.WrapArgsFromQuotes(recvArgv)
 	}
 
-	return recvCmd, recvArgv
+	return recvCmd, recvArgv, nil
 }
 
-// pingCommand handles ping command.
+// pingCommand handles ping command. A subscribed client receives the pong
+// as a message.
 func pingCommand(c *client.Client) {
+	if c.HasFlag(client.FlagPubSub) {
+		c.Conn.AsyncWrite(protocol.MakeArray(protocol.MakeBulkString("pong"), protocol.MakeBulkString("")))
+		return
+	}
+
 	c.Conn.AsyncWrite(protocol.MakeSimpleString("PONG"))
 }
 
 // flushallCommand clears all keys and values from the database.
 // Also, it clears the database from disk.
 func flushallCommand(c *client.Client) {
+	// A background save would write the data encoded before the flush
+	// after the file is cleared
+	server.waitBackgroundSave()
+
 	n := c.DB.Clear()
+	server.watching.touchAll()
 	if err := c.KVSDB.Clear(); err != nil {
 		c.Conn.AsyncWrite(NewGenericError(err.Error()))
+		return
 	}
 
 	logger.S().Info("DB saved on disk")
 
 	c.Conn.AsyncWrite(protocol.MakeInteger(n))
 }
-
-// commandCommand sends all registered commands to the client.
-// TODO: implement this.
-func commandCommand(c *client.Client) {
-	c.Conn.AsyncWrite(protocol.MakeError("NOT_IMPLEMENTED"))
-}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+	"github.com/panjf2000/gnet"
+	"github.com/panjf2000/gnet/pool/goroutine"
+)
+
+// testConn is a connection keeping the replies written to it.
+type testConn struct {
+	gnet.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// AsyncWrite keeps the reply.
+func (c *testConn) AsyncWrite(buf []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf.Write(buf)
+	return nil
+}
+
+// newTestServer replaces the global server with an empty one.
+func newTestServer() *Server {
+	server = &Server{
+		DB:       datastructure.NewMap(),
+		blocking: newBlockingState(),
+		pubsub:   newPubSubState(),
+		watching: newWatchState(),
+		pool:     goroutine.Default(),
+	}
+	server.DB.SetRemoveHook(server.keyRemoved)
+	return server
+}
+
+// newTestClient returns a client of the global server.
+func newTestClient() (*client.Client, *testConn) {
+	conn := &testConn{}
+	return &client.Client{
+		Conn:       conn,
+		DB:         server.DB,
+		CreateTime: time.Now(),
+	}, conn
+}
+
+// readReplies parses every reply written to the connection.
+func readReplies(t *testing.T, conn *testConn) []any {
+	t.Helper()
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	var replies []any
+	r := protocol.NewReader(&conn.buf)
+	for {
+		reply, err := r.ReadObject()
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatalf("failed reading the reply: %v", err)
+		}
+		replies = append(replies, reply)
+	}
+}
+
+// testHandle handles the command as if it was received from the connection
+// of the client.
+func testHandle(c *client.Client, args ...string) {
+	c.Lock()
+	defer c.Unlock()
+	testHandleLocked(c, args...)
+}
+
+// testHandleLocked is testHandle for a client whose lock is already held.
+func testHandleLocked(c *client.Client, args ...string) {
+	argv := make([][]byte, len(args))
+	for i, arg := range args {
+		argv[i] = protocol.MakeBulkString(arg)
+	}
+	frame := protocol.MakeArray(argv...)
+
+	if !server.queueIfBlocked(c, frame) {
+		server.process(c, frame)
+	}
+}
+
+// testCall executes the command and returns its reply.
+func testCall(t *testing.T, c *client.Client, args ...string) any {
+	t.Helper()
+
+	argv := make([][]byte, len(args)-1)
+	for i, arg := range args[1:] {
+		argv[i] = []byte(arg)
+	}
+
+	cmd, err := server.lookupCommand([]byte(args[0]), argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Command, c.Argv, c.Argc, c.Propagate = cmd.Name, argv, len(argv), nil
+	server.call(c, cmd)
+
+	replies := readReplies(t, c.Conn.(*testConn))
+	if len(replies) != 1 {
+		t.Fatalf("expected a single reply to %v, got %v", args, replies)
+	}
+	return replies[0]
+}
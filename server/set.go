@@ -0,0 +1,345 @@
+package server
+
+import (
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+const (
+	// srandmemberMaxCount is the maximum number of members returned by
+	// SRANDMEMBER with a negative count
+	srandmemberMaxCount = 1 << 20
+	// srandmemberBatchSize is the number of members written at once by
+	// SRANDMEMBER with a negative count
+	srandmemberBatchSize = 1024
+)
+
+// makeStringArray creates an array of bulk strings.
+func makeStringArray(ss []string) []byte {
+	items := make([][]byte, len(ss))
+	for i, s := range ss {
+		items[i] = protocol.MakeBulkString(s)
+	}
+	return protocol.MakeArray(items...)
+}
+
+// setModified marks the set as modified, publishes the event and deletes the
+// set once it is empty.
+func setModified(c *client.Client, event, key string, set *datastructure.Set) {
+	server.notifyKeyspaceEvent(notifySet, event, key)
+
+	if set.Len() == 0 {
+		c.DB.Delete(key)
+		return
+	}
+
+	c.DB.Touch(key)
+}
+
+// lookupSets returns the sets stored at the given keys. Missing keys are
+// treated as empty sets.
+func lookupSets(c *client.Client, keys [][]byte) ([]*datastructure.Set, bool) {
+	sets := make([]*datastructure.Set, len(keys))
+	for i, key := range keys {
+		set, found, ok := lookupValue[*datastructure.Set](c, string(key))
+		if !ok {
+			return nil, false
+		}
+
+		if !found {
+			set = datastructure.NewSet()
+		}
+
+		sets[i] = set
+	}
+
+	return sets, true
+}
+
+// saddCommand adds the given members to the set.
+func saddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	set, found, ok := lookupValue[*datastructure.Set](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		set = datastructure.NewSet()
+		c.DB.Store(datastructure.NewItem(key, set, 0))
+	}
+
+	var added int64
+	for _, member := range c.Argv[1:] {
+		if set.Add(string(member)) {
+			added++
+		}
+	}
+
+	c.DB.Touch(key)
+	if added > 0 {
+		server.notifyKeyspaceEvent(notifySet, "sadd", key)
+	}
+	c.Conn.AsyncWrite(protocol.MakeInteger(added))
+}
+
+// sremCommand removes the given members from the set.
+func sremCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	set, found, ok := lookupValue[*datastructure.Set](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	var removed int64
+	for _, member := range c.Argv[1:] {
+		if set.Remove(string(member)) {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		setModified(c, "srem", key, set)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(removed))
+}
+
+// smembersCommand returns all the members of the set.
+func smembersCommand(c *client.Client) {
+	set, found, ok := lookupValue[*datastructure.Set](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeStringArray(set.Members()))
+}
+
+// sismemberCommand returns whether the member is in the set.
+func sismemberCommand(c *client.Client) {
+	set, found, ok := lookupValue[*datastructure.Set](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBool(found && set.Has(string(c.Argv[1]))))
+}
+
+// scardCommand returns the number of members in the set.
+func scardCommand(c *client.Client) {
+	set, found, ok := lookupValue[*datastructure.Set](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(set.Len())))
+}
+
+func setOperationGenericCommand(c *client.Client, op func(...*datastructure.Set) *datastructure.Set) {
+	sets, ok := lookupSets(c, c.Argv)
+	if !ok {
+		return
+	}
+
+	c.Conn.AsyncWrite(makeStringArray(op(sets...).Members()))
+}
+
+func setOperationStoreGenericCommand(c *client.Client, op func(...*datastructure.Set) *datastructure.Set) {
+	dst := string(c.Argv[0])
+
+	sets, ok := lookupSets(c, c.Argv[1:])
+	if !ok {
+		return
+	}
+
+	result := op(sets...)
+	if result.Len() == 0 {
+		c.DB.Delete(dst)
+	} else {
+		c.DB.Store(datastructure.NewItem(dst, result, 0))
+		server.notifyKeyspaceEvent(notifySet, c.Command, dst)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(result.Len())))
+}
+
+// sinterCommand returns the intersection of the given sets.
+func sinterCommand(c *client.Client) {
+	setOperationGenericCommand(c, datastructure.SetInter)
+}
+
+// sinterstoreCommand stores the intersection of the given sets in destination.
+func sinterstoreCommand(c *client.Client) {
+	setOperationStoreGenericCommand(c, datastructure.SetInter)
+}
+
+// sunionCommand returns the union of the given sets.
+func sunionCommand(c *client.Client) {
+	setOperationGenericCommand(c, datastructure.SetUnion)
+}
+
+// sunionstoreCommand stores the union of the given sets in destination.
+func sunionstoreCommand(c *client.Client) {
+	setOperationStoreGenericCommand(c, datastructure.SetUnion)
+}
+
+// sdiffCommand returns the difference between the first set and the others.
+func sdiffCommand(c *client.Client) {
+	setOperationGenericCommand(c, datastructure.SetDiff)
+}
+
+// sdiffstoreCommand stores the difference between the first set and the
+// others in destination.
+func sdiffstoreCommand(c *client.Client) {
+	setOperationStoreGenericCommand(c, datastructure.SetDiff)
+}
+
+// srandmemberCommand returns random members of the set.
+func srandmemberCommand(c *client.Client) {
+	if c.Argc > 2 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	count := int64(1)
+	if c.Argc == 2 {
+		n, ok := parseInt(c, c.Argv[1])
+		if !ok {
+			return
+		}
+
+		if n < -srandmemberMaxCount {
+			c.Conn.AsyncWrite(NewGenericError("value is out of range"))
+			return
+		}
+		count = n
+	}
+
+	set, found, ok := lookupValue[*datastructure.Set](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	// Without a count, a single member is sent instead of an array
+	if c.Argc == 1 {
+		if !found {
+			c.Conn.AsyncWrite(protocol.MakeNull())
+			return
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeBulkString(set.Random(1)[0]))
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	if count >= 0 {
+		c.Conn.AsyncWrite(makeStringArray(set.Random(int(count))))
+		return
+	}
+
+	// The same member may be returned many times, the reply is written in
+	// batches instead of being built at once
+	c.Conn.AsyncWrite(protocol.MakeArrayHeader(-count))
+	for left := -count; left > 0; left -= srandmemberBatchSize {
+		n := left
+		if n > srandmemberBatchSize {
+			n = srandmemberBatchSize
+		}
+
+		var b []byte
+		for _, m := range set.Random(-int(n)) {
+			b = append(b, protocol.MakeBulkString(m)...)
+		}
+		c.Conn.AsyncWrite(b)
+	}
+}
+
+// propagateSrem logs the members popped from the set as a SREM, as popping
+// random members cannot be replayed.
+func propagateSrem(c *client.Client, key string, members []string) {
+	argv := make([][]byte, 0, len(members)+2)
+	argv = append(argv, []byte("srem"), []byte(key))
+	for _, m := range members {
+		argv = append(argv, []byte(m))
+	}
+	c.Propagate = [][][]byte{argv}
+}
+
+// spopCommand removes and returns random members of the set.
+func spopCommand(c *client.Client) {
+	if c.Argc > 2 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	key := string(c.Argv[0])
+
+	count := int64(1)
+	if c.Argc == 2 {
+		n, ok := parseInt(c, c.Argv[1])
+		if !ok {
+			return
+		}
+
+		if n < 0 {
+			c.Conn.AsyncWrite(NewGenericError("value is out of range, must be positive"))
+			return
+		}
+
+		count = n
+	}
+
+	set, found, ok := lookupValue[*datastructure.Set](c, key)
+	if !ok {
+		return
+	}
+
+	// Without a count, a single member is sent instead of an array
+	if c.Argc == 1 {
+		if !found {
+			c.Conn.AsyncWrite(protocol.MakeNull())
+			return
+		}
+
+		member := set.Pop(1)[0]
+		setModified(c, "spop", key, set)
+		propagateSrem(c, key, []string{member})
+		c.Conn.AsyncWrite(protocol.MakeBulkString(member))
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	members := set.Pop(int(count))
+	if len(members) > 0 {
+		setModified(c, "spop", key, set)
+		propagateSrem(c, key, members)
+	}
+
+	c.Conn.AsyncWrite(makeStringArray(members))
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+)
+
+func Test_SrandmemberCount(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+	testCall(t, c, "sadd", "s", "a", "b", "c")
+
+	tc := []struct {
+		name     string
+		count    int64
+		expected int
+	}{
+		{"positive", 2, 2},
+		{"more than the set", 1 << 62, 3},
+		{"negative", -5, 5},
+		{"negative in batches", -(srandmemberBatchSize*2 + 1), srandmemberBatchSize*2 + 1},
+		{"negative limit", -srandmemberMaxCount, srandmemberMaxCount},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, ok := testCall(t, c, "srandmember", "s", strconv.FormatInt(tt.count, 10)).([]any)
+			if !ok || len(reply) != tt.expected {
+				t.Fatalf("expected %d members, got %d", tt.expected, len(reply))
+			}
+		})
+	}
+
+	for _, count := range []string{"-9223372036854775808", strconv.Itoa(-srandmemberMaxCount - 1)} {
+		if reply := testCall(t, c, "srandmember", "s", count); reply != "ERR value is out of range" {
+			t.Errorf("expected an out of range error for %s, got %v", count, reply)
+		}
+	}
+}
+
+func Test_SpopCount(t *testing.T) {
+	newTestServer()
+	c, _ := newTestClient()
+	testCall(t, c, "sadd", "s", "a", "b", "c")
+
+	if reply := testCall(t, c, "spop", "s", "-9223372036854775808"); reply != "ERR value is out of range, must be positive" {
+		t.Errorf("expected an out of range error, got %v", reply)
+	}
+
+	if reply, ok := testCall(t, c, "spop", "s", "9223372036854775807").([]any); !ok || len(reply) != 3 {
+		t.Errorf("expected the 3 members, got %v", reply)
+	}
+}
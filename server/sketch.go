@@ -0,0 +1,308 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// Parameters of the top-k sketches reserved without dimensions
+const (
+	topkDefaultWidth = 8
+	topkDefaultDepth = 7
+	topkDefaultDecay = 0.9
+
+	// sketchMaxCounters is the maximum number of counters of a sketch
+	sketchMaxCounters = 1 << 28
+)
+
+// lookupSketch returns the sketch stored at the key. If the key does not
+// exist or holds a value of another type, an error prefixed with the name
+// of the sketch is sent to the client and ok is false.
+func lookupSketch[T any](c *client.Client, key, prefix string) (T, bool) {
+	sketch, found, ok := lookupValue[T](c, key)
+	if !ok {
+		return sketch, false
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError(prefix + ": key does not exist"))
+		return sketch, false
+	}
+	return sketch, true
+}
+
+// parseSketchDimension parses a positive dimension of a sketch. If the
+// dimension is invalid, an error is sent to the client and ok is false.
+func parseSketchDimension(c *client.Client, arg []byte, prefix, name string) (uint32, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || n < 1 || n > math.MaxUint32 {
+		c.Conn.AsyncWrite(NewGenericError(prefix + ": invalid " + name))
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// makeCountReply returns the integer reply of an estimated count, which
+// saturates at the largest integer reply.
+func makeCountReply(n uint64) []byte {
+	if n > math.MaxInt64 {
+		n = math.MaxInt64
+	}
+	return protocol.MakeInteger(int64(n))
+}
+
+// reserveSketch stores the sketch at the key unless it already exists.
+func reserveSketch(c *client.Client, key, prefix string, sketch any) {
+	if _, found := c.DB.Get(key); found {
+		c.Conn.AsyncWrite(NewGenericError(prefix + ": key already exists"))
+		return
+	}
+
+	c.DB.Store(datastructure.NewItem(key, sketch, 0))
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// cmsInitByDimCommand creates an empty count-min sketch at the key with the
+// given width and depth.
+func cmsInitByDimCommand(c *client.Client) {
+	width, ok := parseSketchDimension(c, c.Argv[1], "CMS", "width")
+	if !ok {
+		return
+	}
+
+	depth, ok := parseSketchDimension(c, c.Argv[2], "CMS", "depth")
+	if !ok {
+		return
+	}
+
+	if uint64(width)*uint64(depth) > sketchMaxCounters {
+		c.Conn.AsyncWrite(NewGenericError("CMS: invalid width/depth"))
+		return
+	}
+
+	reserveSketch(c, string(c.Argv[0]), "CMS", datastructure.NewCountMinSketch(width, depth))
+}
+
+// cmsInitByProbCommand creates an empty count-min sketch at the key whose
+// estimates exceed the counts by at most the error rate times the total
+// count with the given probability of failure.
+func cmsInitByProbCommand(c *client.Client) {
+	errorRate, err := strconv.ParseFloat(string(c.Argv[1]), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		c.Conn.AsyncWrite(NewGenericError("CMS: invalid overestimation value"))
+		return
+	}
+
+	probability, err := strconv.ParseFloat(string(c.Argv[2]), 64)
+	if err != nil || probability <= 0 || probability >= 1 {
+		c.Conn.AsyncWrite(NewGenericError("CMS: invalid prob value"))
+		return
+	}
+
+	if math.Ceil(2/errorRate)*math.Ceil(math.Log10(probability)/math.Log10(0.5)) > sketchMaxCounters {
+		c.Conn.AsyncWrite(NewGenericError("CMS: invalid overestimation value"))
+		return
+	}
+
+	reserveSketch(c, string(c.Argv[0]), "CMS", datastructure.NewCountMinSketchByProb(errorRate, probability))
+}
+
+// cmsIncrByCommand increments the counts of the items in the count-min
+// sketch stored at the key. Returns the new estimated count of each item.
+func cmsIncrByCommand(c *client.Client) {
+	if c.Argc%2 == 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + c.Command + "' command"))
+		return
+	}
+
+	key := string(c.Argv[0])
+
+	cms, ok := lookupSketch[*datastructure.CountMinSketch](c, key, "CMS")
+	if !ok {
+		return
+	}
+
+	increments := make([]uint64, 0, c.Argc/2)
+	for i := 2; i < c.Argc; i += 2 {
+		incr, err := strconv.ParseUint(string(c.Argv[i]), 10, 64)
+		if err != nil {
+			c.Conn.AsyncWrite(NewGenericError("CMS: Cannot parse number"))
+			return
+		}
+		increments = append(increments, incr)
+	}
+
+	counts := make([][]byte, len(increments))
+	for i, incr := range increments {
+		counts[i] = makeCountReply(cms.IncrBy(c.Argv[1+2*i], incr))
+	}
+
+	c.DB.Touch(key)
+	c.Conn.AsyncWrite(protocol.MakeArray(counts...))
+}
+
+// cmsQueryCommand returns the estimated count of each item in the count-min
+// sketch stored at the key.
+func cmsQueryCommand(c *client.Client) {
+	cms, ok := lookupSketch[*datastructure.CountMinSketch](c, string(c.Argv[0]), "CMS")
+	if !ok {
+		return
+	}
+
+	counts := make([][]byte, c.Argc-1)
+	for i, item := range c.Argv[1:] {
+		counts[i] = makeCountReply(cms.Query(item))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(counts...))
+}
+
+// cmsMergeCommand stores the weighted sum of the count-min sketches stored
+// at the source keys in the count-min sketch stored at the destination key.
+func cmsMergeCommand(c *client.Client) {
+	dst := string(c.Argv[0])
+
+	numKeys, err := strconv.ParseInt(string(c.Argv[1]), 10, 64)
+	if err != nil || numKeys < 1 {
+		c.Conn.AsyncWrite(NewGenericError("CMS: invalid numkeys"))
+		return
+	}
+
+	if int64(c.Argc) < 2+numKeys {
+		c.Conn.AsyncWrite(NewGenericError("CMS: wrong number of keys"))
+		return
+	}
+
+	weights := make([]uint64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	if rest := c.Argv[2+numKeys:]; len(rest) > 0 {
+		if !strings.EqualFold(string(rest[0]), "weights") || int64(len(rest)-1) != numKeys {
+			c.Conn.AsyncWrite(NewGenericError("CMS: wrong number of keys/weights"))
+			return
+		}
+
+		for i, arg := range rest[1:] {
+			if weights[i], err = strconv.ParseUint(string(arg), 10, 64); err != nil {
+				c.Conn.AsyncWrite(NewGenericError("CMS: invalid weight value"))
+				return
+			}
+		}
+	}
+
+	cms, ok := lookupSketch[*datastructure.CountMinSketch](c, dst, "CMS")
+	if !ok {
+		return
+	}
+
+	srcs := make([]*datastructure.CountMinSketch, numKeys)
+	for i, key := range c.Argv[2 : 2+numKeys] {
+		if srcs[i], ok = lookupSketch[*datastructure.CountMinSketch](c, string(key), "CMS"); !ok {
+			return
+		}
+	}
+
+	if err := cms.Merge(srcs, weights); err != nil {
+		c.Conn.AsyncWrite(NewGenericError("CMS: width/depth is not equal"))
+		return
+	}
+
+	c.DB.Touch(dst)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// topkReserveCommand creates an empty top-k sketch at the key tracking the
+// k most frequent items.
+func topkReserveCommand(c *client.Client) {
+	if c.Argc != 2 && c.Argc != 5 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + c.Command + "' command"))
+		return
+	}
+
+	k, ok := parseSketchDimension(c, c.Argv[1], "TopK", "k")
+	if !ok {
+		return
+	}
+
+	width, depth, decay := uint32(topkDefaultWidth), uint32(topkDefaultDepth), topkDefaultDecay
+	if c.Argc == 5 {
+		if width, ok = parseSketchDimension(c, c.Argv[2], "TopK", "width"); !ok {
+			return
+		}
+
+		if depth, ok = parseSketchDimension(c, c.Argv[3], "TopK", "depth"); !ok {
+			return
+		}
+
+		var err error
+		decay, err = strconv.ParseFloat(string(c.Argv[4]), 64)
+		if err != nil || decay <= 0 || decay > 1 {
+			c.Conn.AsyncWrite(NewGenericError("TopK: invalid decay value. must be '<= 1' & '> 0'"))
+			return
+		}
+	}
+
+	if uint64(width)*uint64(depth) > sketchMaxCounters || k > sketchMaxCounters {
+		c.Conn.AsyncWrite(NewGenericError("TopK: invalid width/depth"))
+		return
+	}
+
+	reserveSketch(c, string(c.Argv[0]), "TopK", datastructure.NewTopK(k, width, depth, decay))
+}
+
+// topkAddCommand adds the items to the top-k sketch stored at the key.
+// Returns for each item the item it expelled from the top items, or nil.
+func topkAddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	topk, ok := lookupSketch[*datastructure.TopK](c, key, "TopK")
+	if !ok {
+		return
+	}
+
+	replies := make([][]byte, c.Argc-1)
+	for i, item := range c.Argv[1:] {
+		if expelled, ok := topk.Add(item); ok {
+			replies[i] = protocol.MakeBulkString(expelled)
+		} else {
+			replies[i] = protocol.MakeNull()
+		}
+	}
+
+	c.DB.Touch(key)
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// topkListCommand returns the top items of the top-k sketch stored at the
+// key from the most to the least frequent, optionally with their counts.
+func topkListCommand(c *client.Client) {
+	var withCount bool
+	if c.Argc > 2 || (c.Argc == 2 && !strings.EqualFold(string(c.Argv[1]), "withcount")) {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	} else if c.Argc == 2 {
+		withCount = true
+	}
+
+	topk, ok := lookupSketch[*datastructure.TopK](c, string(c.Argv[0]), "TopK")
+	if !ok {
+		return
+	}
+
+	var replies [][]byte
+	for _, item := range topk.List() {
+		replies = append(replies, protocol.MakeBulkString(item.Item))
+		if withCount {
+			replies = append(replies, makeCountReply(item.Count))
+		}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
@@ -1,10 +1,18 @@
 package server
 
 import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
+	"github.com/HotPotatoC/kvstore-rewrite/build"
 	"github.com/HotPotatoC/kvstore-rewrite/client"
 	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+	"github.com/spf13/viper"
 )
 
 // Stats is the stats for the server
@@ -17,8 +25,170 @@ type Stats struct {
 	NumConnections int64 `json:"num_connections"`
 }
 
+// infoSection writes a section of the info command.
+type infoSection func(s *Server, b *bytes.Buffer)
+
+// infoSections are the sections of the info command, in the order they
+// are reported.
+var infoSections = []struct {
+	name  string
+	title string
+	fn    infoSection
+}{
+	{"server", "Server", infoServer},
+	{"clients", "Clients", infoClients},
+	{"memory", "Memory", infoMemory},
+	{"persistence", "Persistence", infoPersistence},
+	{"stats", "Stats", infoStats},
+	{"keyspace", "Keyspace", infoKeyspace},
+}
+
+func infoField(b *bytes.Buffer, name string, value any) {
+	fmt.Fprintf(b, "%s:%v\r\n", name, value)
+}
+
+func infoServer(s *Server, b *bytes.Buffer) {
+	uptime := time.Since(s.StartTime)
+
+	infoField(b, "kvstore_version", build.Version)
+	infoField(b, "kvstore_build", build.Build)
+	infoField(b, "os", runtime.GOOS+" "+runtime.GOARCH)
+	infoField(b, "arch_bits", 8*int(unsafe.Sizeof(int(0))))
+	infoField(b, "go_version", runtime.Version())
+	infoField(b, "process_id", s.PID)
+	infoField(b, "tcp_port", viper.GetInt("server.port"))
+	infoField(b, "uptime_in_seconds", int64(uptime/time.Second))
+	infoField(b, "uptime_in_days", int64(uptime/(24*time.Hour)))
+	infoField(b, "config_file", viper.ConfigFileUsed())
+}
+
+func infoClients(s *Server, b *bytes.Buffer) {
+	var connected int64
+	s.clients.Range(func(key, value any) bool {
+		connected++
+		return true
+	})
+
+	infoField(b, "connected_clients", connected)
+	infoField(b, "blocked_clients", s.blocking.numBlocked())
+}
+
+func infoMemory(s *Server, b *bytes.Buffer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	infoField(b, "used_memory", m.HeapAlloc)
+	infoField(b, "used_memory_human", bytesToHuman(m.HeapAlloc))
+	infoField(b, "used_memory_sys", m.Sys)
+	infoField(b, "used_memory_sys_human", bytesToHuman(m.Sys))
+	infoField(b, "heap_objects", m.HeapObjects)
+	infoField(b, "num_gc", m.NumGC)
+}
+
+func infoPersistence(s *Server, b *bytes.Buffer) {
+	s.saveState.mu.Lock()
+	lastSave := s.saveState.lastSave
+	lastSaveErr := s.saveState.lastSaveErr
+	dirtyAtLastSave := s.saveState.dirtyAtLastSave
+	s.saveState.mu.Unlock()
+
+	lastSaveStatus := "ok"
+	if lastSaveErr != nil {
+		lastSaveStatus = "err"
+	}
+
+	infoField(b, "kvsdb_changes_since_last_save", s.DB.Dirty()-dirtyAtLastSave)
+	infoField(b, "kvsdb_bgsave_in_progress", atomic.LoadInt32(&s.saveState.bgsaveInProgress))
+	infoField(b, "kvsdb_last_save_time", lastSave.Unix())
+	infoField(b, "kvsdb_last_bgsave_status", lastSaveStatus)
+
+	if s.aof == nil {
+		infoField(b, "aof_enabled", 0)
+		return
+	}
+
+	rewriting := 0
+	if s.aof.Rewriting() {
+		rewriting = 1
+	}
+
+	infoField(b, "aof_enabled", 1)
+	infoField(b, "aof_rewrite_in_progress", rewriting)
+	infoField(b, "aof_current_size", s.aof.Size())
+	infoField(b, "aof_base_size", s.aof.BaseSize())
+}
+
+func infoStats(s *Server, b *bytes.Buffer) {
+	dbStats := s.DB.Stats()
+
+	infoField(b, "total_connections_received", atomic.LoadInt64(&s.NumConnections))
+	infoField(b, "total_commands_processed", atomic.LoadInt64(&s.NumCommands))
+	infoField(b, "expired_keys", dbStats.Expired)
+	// Keys are never evicted as there is no memory limit
+	infoField(b, "evicted_keys", 0)
+	infoField(b, "keyspace_hits", dbStats.Hits)
+	infoField(b, "keyspace_misses", dbStats.Misses)
+	infoField(b, "pubsub_channels", s.pubsub.numChannels())
+	infoField(b, "pubsub_patterns", s.pubsub.numPatterns())
+}
+
+func infoKeyspace(s *Server, b *bytes.Buffer) {
+	if n := s.DB.Len(); n > 0 {
+		fmt.Fprintf(b, "db0:keys=%d,expires=%d\r\n", n, s.DB.Expires())
+	}
+}
+
+// bytesToHuman converts the given amount of bytes into a human readable string.
+func bytesToHuman(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.2f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// genInfoString generates the info string of the given section.
+// If section is empty or "all", every section is returned.
+func (s *Server) genInfoString(section string) string {
+	section = strings.ToLower(section)
+	all := section == "" || section == "all" || section == "default" || section == "everything"
+
+	var b bytes.Buffer
+	for _, sec := range infoSections {
+		if !all && section != sec.name {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.Write(protocol.CRLF)
+		}
+
+		b.WriteString("# " + sec.title)
+		b.Write(protocol.CRLF)
+		sec.fn(s, &b)
+	}
+
+	return b.String()
+}
+
 // infoCommand is the command to get server info
-// TODO: implement
 func infoCommand(c *client.Client) {
-	c.Conn.AsyncWrite(protocol.MakeError("NOT_IMPLEMENTED"))
+	if c.Argc > 1 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	var section string
+	if c.Argc == 1 {
+		section = string(c.Argv[0])
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(server.genInfoString(section)))
 }
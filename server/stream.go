@@ -0,0 +1,1128 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+const (
+	errInvalidStreamID   = "Invalid stream ID specified as stream command argument"
+	errXGroupKeyRequired = "The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+)
+
+// parseStreamID parses a stream ID argument. If the ID is not valid, an
+// error is sent to the client and ok is false.
+func parseStreamID(c *client.Client, arg []byte, defaultSeq uint64) (datastructure.StreamID, bool) {
+	id, err := datastructure.ParseStreamID(string(arg), defaultSeq)
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError(errInvalidStreamID))
+		return id, false
+	}
+	return id, true
+}
+
+// parseStreamRangeID parses an interval bound of XRANGE, XREVRANGE and
+// XPENDING. "-" and "+" are the smallest and greatest IDs, and an ID prefixed
+// by "(" is exclusive.
+func parseStreamRangeID(c *client.Client, arg []byte, start bool) (datastructure.StreamID, bool) {
+	switch string(arg) {
+	case "-":
+		return datastructure.MinStreamID, true
+	case "+":
+		return datastructure.MaxStreamID, true
+	}
+
+	defaultSeq := uint64(0)
+	if !start {
+		defaultSeq = datastructure.MaxStreamID.Seq
+	}
+
+	if len(arg) == 0 || arg[0] != '(' {
+		return parseStreamID(c, arg, defaultSeq)
+	}
+
+	id, ok := parseStreamID(c, arg[1:], defaultSeq)
+	if !ok {
+		return id, false
+	}
+
+	if start {
+		id, ok = id.Next()
+	} else {
+		id, ok = id.Prev()
+	}
+
+	if !ok {
+		bound := "end"
+		if start {
+			bound = "start"
+		}
+		c.Conn.AsyncWrite(NewGenericError("invalid " + bound + " ID for the interval"))
+	}
+	return id, ok
+}
+
+// makeStreamEntry creates an array of the entry ID followed by its fields.
+func makeStreamEntry(e datastructure.StreamEntry) []byte {
+	return protocol.MakeArray(protocol.MakeBulkString(e.ID.String()), makeBulkStringArray(e.Fields))
+}
+
+// makeStreamEntries creates an array of the entries.
+func makeStreamEntries(entries []datastructure.StreamEntry) []byte {
+	items := make([][]byte, len(entries))
+	for i, e := range entries {
+		items[i] = makeStreamEntry(e)
+	}
+	return protocol.MakeArray(items...)
+}
+
+// xaddCommand appends an entry to the stream.
+func xaddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	noMkStream := false
+	maxLen := int64(-1)
+	var minID *datastructure.StreamID
+	i := 1
+options:
+	for ; i < c.Argc; i++ {
+		opt := strings.ToLower(string(c.Argv[i]))
+		switch opt {
+		case "nomkstream":
+			noMkStream = true
+		case "maxlen", "minid":
+			// Trimming is always exact, "~" is accepted for compatibility
+			if i+1 < c.Argc && (string(c.Argv[i+1]) == "=" || string(c.Argv[i+1]) == "~") {
+				i++
+			}
+
+			if i+1 >= c.Argc {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+			i++
+
+			if opt == "minid" {
+				id, ok := parseStreamID(c, c.Argv[i], 0)
+				if !ok {
+					return
+				}
+				minID = &id
+				continue
+			}
+
+			n, ok := parseInt(c, c.Argv[i])
+			if !ok {
+				return
+			}
+
+			if n < 0 {
+				c.Conn.AsyncWrite(NewGenericError("The MAXLEN argument must be >= 0."))
+				return
+			}
+			maxLen = n
+		default:
+			break options
+		}
+	}
+
+	if maxLen >= 0 && minID != nil {
+		c.Conn.AsyncWrite(NewGenericError("syntax error, MAXLEN and MINID options at the same time are not compatible"))
+		return
+	}
+
+	if i >= c.Argc || (c.Argc-i-1) == 0 || (c.Argc-i-1)%2 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'xadd' command"))
+		return
+	}
+
+	idArg := string(c.Argv[i])
+	fields := c.Argv[i+1:]
+
+	stream, found, ok := lookupValue[*datastructure.Stream](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		if noMkStream {
+			c.Conn.AsyncWrite(protocol.MakeNull())
+			return
+		}
+		stream = datastructure.NewStream()
+	}
+
+	var id datastructure.StreamID
+	var err error
+	switch msPart, seqPart, _ := strings.Cut(idArg, "-"); {
+	case idArg == "*":
+		id, err = stream.NextID(uint64(time.Now().UnixMilli()))
+	case seqPart == "*":
+		ms, perr := strconv.ParseUint(msPart, 10, 64)
+		if perr != nil {
+			c.Conn.AsyncWrite(NewGenericError(errInvalidStreamID))
+			return
+		}
+
+		id = datastructure.StreamID{Ms: ms}
+		if last := stream.LastID(); ms == last.Ms {
+			var next bool
+			if id, next = last.Next(); !next || id.Ms != ms {
+				err = datastructure.ErrStreamIDTooSmall
+			}
+		} else if ms < last.Ms {
+			err = datastructure.ErrStreamIDTooSmall
+		}
+	default:
+		if id, ok = parseStreamID(c, c.Argv[i], 0); !ok {
+			return
+		}
+
+		if id == datastructure.MinStreamID {
+			c.Conn.AsyncWrite(NewGenericError("The ID specified in XADD must be greater than 0-0"))
+			return
+		}
+	}
+
+	// The values are copied since the arguments are backed by the read buffer
+	entry := make([][]byte, len(fields))
+	for j, f := range fields {
+		entry[j] = append([]byte(nil), f...)
+	}
+
+	if err == nil {
+		err = stream.Add(id, entry)
+	}
+
+	if err != nil {
+		c.Conn.AsyncWrite(NewGenericError("The ID specified in XADD is equal or smaller than the target stream top item"))
+		return
+	}
+
+	if maxLen >= 0 {
+		stream.TrimMaxLen(int(maxLen))
+	} else if minID != nil {
+		stream.TrimMinID(*minID)
+	}
+
+	if found {
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, stream, 0))
+	}
+
+	// The resolved ID is logged so that replaying the command adds the
+	// same entry
+	argv := make([][]byte, 0, c.Argc+1)
+	argv = append(argv, []byte("xadd"))
+	argv = append(argv, c.Argv[:i]...)
+	argv = append(argv, []byte(id.String()))
+	argv = append(argv, fields...)
+	c.Propagate = [][][]byte{argv}
+
+	server.signalKeyAsReady(key)
+	c.Conn.AsyncWrite(protocol.MakeBulkString(id.String()))
+}
+
+// xlenCommand returns the number of entries in the stream.
+func xlenCommand(c *client.Client) {
+	stream, found, ok := lookupValue[*datastructure.Stream](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(stream.Len())))
+}
+
+func xrangeGenericCommand(c *client.Client, reverse bool) {
+	startArg, endArg := c.Argv[1], c.Argv[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+
+	start, ok := parseStreamRangeID(c, startArg, true)
+	if !ok {
+		return
+	}
+
+	end, ok := parseStreamRangeID(c, endArg, false)
+	if !ok {
+		return
+	}
+
+	count := int64(-1)
+	if c.Argc > 3 {
+		if c.Argc != 5 || strings.ToLower(string(c.Argv[3])) != "count" {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+
+		if count, ok = parseInt(c, c.Argv[4]); !ok {
+			return
+		}
+
+		if count < 0 {
+			count = 0
+		}
+	}
+
+	stream, found, ok := lookupValue[*datastructure.Stream](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeStreamEntries(stream.Range(start, end, int(count), reverse)))
+}
+
+// xrangeCommand returns the entries of the stream with an ID in the given
+// interval.
+func xrangeCommand(c *client.Client) {
+	xrangeGenericCommand(c, false)
+}
+
+// xrevrangeCommand returns the entries of the stream with an ID in the given
+// interval, from the newest to the oldest.
+func xrevrangeCommand(c *client.Client) {
+	xrangeGenericCommand(c, true)
+}
+
+// xreadStreamsIndex returns the index of the STREAMS option of XREAD and
+// XREADGROUP, or -1 if it is missing.
+func xreadStreamsIndex(argv [][]byte) int {
+	for i, arg := range argv {
+		if strings.ToLower(string(arg)) == "streams" {
+			return i
+		}
+	}
+	return -1
+}
+
+// xreadGetKeys returns the stream keys of XREAD and XREADGROUP, which are
+// the first half of the arguments following STREAMS.
+func xreadGetKeys(argv [][]byte) ([][]byte, error) {
+	i := xreadStreamsIndex(argv)
+	if i < 0 {
+		return nil, command.ErrInvalidKeyArguments
+	}
+
+	streams := argv[i+1:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return nil, command.ErrInvalidKeyArguments
+	}
+	return streams[:len(streams)/2], nil
+}
+
+// xreadTarget is a stream read by XREAD or XREADGROUP.
+type xreadTarget struct {
+	key string
+	// id is the ID after which the entries are read
+	id datastructure.StreamID
+	// new is true if XREADGROUP reads the entries never delivered to the
+	// group, i.e. the ">" ID
+	new bool
+}
+
+// xreadRequest holds the options of XREAD and XREADGROUP.
+type xreadRequest struct {
+	group, consumer string
+	count           int
+	noAck           bool
+	targets         []xreadTarget
+}
+
+// propagateStreamClaim logs the delivery of an entry to a consumer as a
+// XCLAIM so that the pending entries are restored when the append-only file
+// is replayed.
+func propagateStreamClaim(c *client.Client, key string, group *datastructure.ConsumerGroup, p *datastructure.PendingEntry) {
+	c.Propagate = append(c.Propagate, [][]byte{
+		[]byte("xclaim"), []byte(key), []byte(group.Name), []byte(p.Consumer.Name), []byte("0"), []byte(p.ID.String()),
+		[]byte("TIME"), []byte(strconv.FormatInt(p.DeliveryTime.UnixMilli(), 10)),
+		[]byte("RETRYCOUNT"), []byte(strconv.FormatInt(p.DeliveryCount, 10)),
+		[]byte("FORCE"), []byte("JUSTID"),
+		[]byte("LASTID"), []byte(group.LastID.String()),
+	})
+}
+
+// propagateStreamCreateConsumer logs the creation of a consumer.
+func propagateStreamCreateConsumer(c *client.Client, key string, group *datastructure.ConsumerGroup, consumer *datastructure.Consumer) {
+	c.Propagate = append(c.Propagate, [][]byte{
+		[]byte("xgroup"), []byte("createconsumer"), []byte(key), []byte(group.Name), []byte(consumer.Name),
+	})
+}
+
+// propagateStreamSetID logs the last delivered ID of the group.
+func propagateStreamSetID(c *client.Client, key string, group *datastructure.ConsumerGroup) {
+	c.Propagate = append(c.Propagate, [][]byte{
+		[]byte("xgroup"), []byte("setid"), []byte(key), []byte(group.Name), []byte(group.LastID.String()),
+	})
+}
+
+// read reads the target stream. Returns the reply for the stream, or nil if
+// there is nothing to reply for it.
+func (r *xreadRequest) read(c *client.Client, stream *datastructure.Stream, t xreadTarget) []byte {
+	if r.group == "" {
+		entries := stream.After(t.id, r.count)
+		if len(entries) == 0 {
+			return nil
+		}
+		return protocol.MakeArray(protocol.MakeBulkString(t.key), makeStreamEntries(entries))
+	}
+
+	group, ok := stream.Group(r.group)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	consumer, created := group.CreateConsumer(r.consumer, now)
+	consumer.SeenTime = now
+	if created {
+		propagateStreamCreateConsumer(c, t.key, group, consumer)
+	}
+
+	if !t.new {
+		// The history of the consumer: the entries delivered to it but not
+		// acknowledged yet. The entries deleted from the stream are returned
+		// without fields.
+		pending := consumer.Pending(t.id, r.count)
+		items := make([][]byte, len(pending))
+		for i, p := range pending {
+			entry, exists := stream.Get(p.ID)
+			if !exists {
+				items[i] = protocol.MakeArray(protocol.MakeBulkString(p.ID.String()), protocol.MakeNullArray())
+				continue
+			}
+
+			p = group.Deliver(p.ID, consumer, now)
+			propagateStreamClaim(c, t.key, group, p)
+			items[i] = makeStreamEntry(entry)
+		}
+
+		if created || len(pending) > 0 {
+			c.DB.Touch(t.key)
+		}
+		return protocol.MakeArray(protocol.MakeBulkString(t.key), protocol.MakeArray(items...))
+	}
+
+	entries := stream.After(group.LastID, r.count)
+	if created || len(entries) > 0 {
+		c.DB.Touch(t.key)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for _, e := range entries {
+		group.LastID = e.ID
+		if !r.noAck {
+			propagateStreamClaim(c, t.key, group, group.Deliver(e.ID, consumer, now))
+		}
+	}
+
+	if r.noAck {
+		propagateStreamSetID(c, t.key, group)
+	}
+
+	return protocol.MakeArray(protocol.MakeBulkString(t.key), makeStreamEntries(entries))
+}
+
+func xreadGenericCommand(c *client.Client, group bool) {
+	name := "xread"
+	if group {
+		name = "xreadgroup"
+	}
+
+	r := &xreadRequest{count: -1}
+	block := int64(-1)
+	i := 0
+options:
+	for ; i < c.Argc; i++ {
+		opt := strings.ToLower(string(c.Argv[i]))
+		switch {
+		case opt == "streams":
+			break options
+		case opt == "count" && i+1 < c.Argc:
+			n, ok := parseInt(c, c.Argv[i+1])
+			if !ok {
+				return
+			}
+
+			if n > 0 {
+				r.count = int(n)
+			}
+			i++
+		case opt == "block" && i+1 < c.Argc:
+			n, ok := parseInt(c, c.Argv[i+1])
+			if !ok {
+				return
+			}
+
+			if n < 0 {
+				c.Conn.AsyncWrite(NewGenericError("timeout is negative"))
+				return
+			}
+			block = n
+			i++
+		case opt == "group" && i+2 < c.Argc:
+			if !group {
+				c.Conn.AsyncWrite(NewGenericError("The GROUP option is only supported by XREADGROUP. You called XREAD instead."))
+				return
+			}
+
+			r.group = string(c.Argv[i+1])
+			r.consumer = string(c.Argv[i+2])
+			i += 2
+		case opt == "noack" && group:
+			r.noAck = true
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	if group && r.group == "" {
+		c.Conn.AsyncWrite(NewGenericError("Missing GROUP option for XREADGROUP"))
+		return
+	}
+
+	var streams [][]byte
+	if i < c.Argc {
+		streams = c.Argv[i+1:]
+	}
+
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		special := "$"
+		if group {
+			special = ">"
+		}
+		c.Conn.AsyncWrite(NewGenericError("Unbalanced '" + name + "' list of streams: for each stream key an ID or '" + special + "' must be specified."))
+		return
+	}
+
+	keys, ids := streams[:len(streams)/2], streams[len(streams)/2:]
+	r.targets = make([]xreadTarget, len(keys))
+	allNew := true
+	for j, key := range keys {
+		t := xreadTarget{key: string(key)}
+
+		stream, found, ok := lookupValue[*datastructure.Stream](c, t.key)
+		if !ok {
+			return
+		}
+
+		if group {
+			if found {
+				_, found = stream.Group(r.group)
+			}
+
+			if !found {
+				c.Conn.AsyncWrite(NewNoGroupError("No such key '" + t.key + "' or consumer group '" + r.group + "' in XREADGROUP with GROUP option"))
+				return
+			}
+		}
+
+		switch string(ids[j]) {
+		case "$":
+			if group {
+				c.Conn.AsyncWrite(NewGenericError("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."))
+				return
+			}
+
+			if found {
+				t.id = stream.LastID()
+			}
+		case ">":
+			if !group {
+				c.Conn.AsyncWrite(NewGenericError("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option."))
+				return
+			}
+			t.new = true
+		default:
+			if t.id, ok = parseStreamID(c, ids[j], 0); !ok {
+				return
+			}
+			allNew = false
+		}
+
+		r.targets[j] = t
+	}
+
+	var items [][]byte
+	for _, t := range r.targets {
+		stream, found, _ := lookupValue[*datastructure.Stream](c, t.key)
+		if !found {
+			continue
+		}
+
+		if reply := r.read(c, stream, t); reply != nil {
+			items = append(items, reply)
+		}
+	}
+
+	if len(items) > 0 {
+		c.Conn.AsyncWrite(protocol.MakeArray(items...))
+		return
+	}
+
+	// Reading the history of a consumer never blocks
+	if block < 0 || (group && !allNew) || !canBlock(c) {
+		c.Conn.AsyncWrite(protocol.MakeNullArray())
+		return
+	}
+
+	blockKeys := make([]string, len(r.targets))
+	for j, t := range r.targets {
+		blockKeys[j] = t.key
+	}
+
+	server.blockClient(c, blockKeys, time.Duration(block)*time.Millisecond, protocol.MakeNullArray(), func(key string) bool {
+		item, found := c.DB.Peek(key)
+		if !found {
+			return false
+		}
+
+		stream, isStream := item.Data.(*datastructure.Stream)
+		if !isStream {
+			return false
+		}
+
+		for _, t := range r.targets {
+			if t.key != key {
+				continue
+			}
+
+			if group {
+				if _, exists := stream.Group(r.group); !exists {
+					c.Conn.AsyncWrite(NewNoGroupError("the consumer group this client was blocked on no longer exists"))
+					return true
+				}
+			}
+
+			reply := r.read(c, stream, t)
+			if reply == nil {
+				return false
+			}
+
+			c.Conn.AsyncWrite(protocol.MakeArray(reply))
+			return true
+		}
+		return false
+	})
+}
+
+// xreadCommand returns the entries of the streams with an ID greater than
+// the given ones, waiting for new entries if BLOCK is given.
+func xreadCommand(c *client.Client) {
+	xreadGenericCommand(c, false)
+}
+
+// xreadgroupCommand delivers the entries of the streams to a consumer of a
+// consumer group.
+func xreadgroupCommand(c *client.Client) {
+	xreadGenericCommand(c, true)
+}
+
+// lookupStreamGroup returns the stream stored at the key and its consumer
+// group. If either is missing, a NOGROUP error is sent to the client.
+func lookupStreamGroup(c *client.Client, key, name string) (*datastructure.Stream, *datastructure.ConsumerGroup, bool) {
+	stream, found, ok := lookupValue[*datastructure.Stream](c, key)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if found {
+		if group, exists := stream.Group(name); exists {
+			return stream, group, true
+		}
+	}
+
+	c.Conn.AsyncWrite(NewNoGroupError("No such key '" + key + "' or consumer group '" + name + "'"))
+	return nil, nil, false
+}
+
+// xackCommand acknowledges entries delivered to a consumer group.
+func xackCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	ids := make([]datastructure.StreamID, c.Argc-2)
+	for i, arg := range c.Argv[2:] {
+		id, ok := parseStreamID(c, arg, 0)
+		if !ok {
+			return
+		}
+		ids[i] = id
+	}
+
+	stream, found, ok := lookupValue[*datastructure.Stream](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	group, exists := stream.Group(string(c.Argv[1]))
+	if !exists {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	var acked int64
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+
+	if acked > 0 {
+		c.DB.Touch(key)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(acked))
+}
+
+// xpendingCommand returns the entries delivered to a consumer group but not
+// acknowledged yet.
+func xpendingCommand(c *client.Client) {
+	key, name := string(c.Argv[0]), string(c.Argv[1])
+
+	var minIdle int64
+	var consumerName string
+	var start, end datastructure.StreamID
+	count := int64(-1)
+	extended := c.Argc > 2
+	if extended {
+		args := c.Argv[2:]
+		if strings.ToLower(string(args[0])) == "idle" {
+			if len(args) < 2 {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+
+			var ok bool
+			if minIdle, ok = parseInt(c, args[1]); !ok {
+				return
+			}
+			args = args[2:]
+		}
+
+		if len(args) < 3 || len(args) > 4 {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+
+		var ok bool
+		if start, ok = parseStreamRangeID(c, args[0], true); !ok {
+			return
+		}
+
+		if end, ok = parseStreamRangeID(c, args[1], false); !ok {
+			return
+		}
+
+		if count, ok = parseInt(c, args[2]); !ok {
+			return
+		}
+
+		if count < 0 {
+			count = 0
+		}
+
+		if len(args) == 4 {
+			consumerName = string(args[3])
+		}
+	}
+
+	_, group, ok := lookupStreamGroup(c, key, name)
+	if !ok {
+		return
+	}
+
+	if !extended {
+		if group.PendingLen() == 0 {
+			c.Conn.AsyncWrite(protocol.MakeArray(protocol.MakeInteger(0), protocol.MakeNull(), protocol.MakeNull(), protocol.MakeNullArray()))
+			return
+		}
+
+		pending := group.Pending(datastructure.MinStreamID, datastructure.MaxStreamID, -1)
+		var consumers [][]byte
+		for _, consumer := range group.Consumers() {
+			if consumer.PendingLen() > 0 {
+				consumers = append(consumers, protocol.MakeArray(
+					protocol.MakeBulkString(consumer.Name),
+					protocol.MakeBulkString(strconv.Itoa(consumer.PendingLen())),
+				))
+			}
+		}
+
+		c.Conn.AsyncWrite(protocol.MakeArray(
+			protocol.MakeInteger(int64(len(pending))),
+			protocol.MakeBulkString(pending[0].ID.String()),
+			protocol.MakeBulkString(pending[len(pending)-1].ID.String()),
+			protocol.MakeArray(consumers...),
+		))
+		return
+	}
+
+	now := time.Now()
+	var items [][]byte
+	for _, p := range group.Pending(start, end, -1) {
+		if int64(len(items)) == count {
+			break
+		}
+
+		idle := now.Sub(p.DeliveryTime).Milliseconds()
+		if (consumerName != "" && p.Consumer.Name != consumerName) || idle < minIdle {
+			continue
+		}
+
+		items = append(items, protocol.MakeArray(
+			protocol.MakeBulkString(p.ID.String()),
+			protocol.MakeBulkString(p.Consumer.Name),
+			protocol.MakeInteger(idle),
+			protocol.MakeInteger(p.DeliveryCount),
+		))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(items...))
+}
+
+// xclaimCommand transfers pending entries to another consumer.
+func xclaimCommand(c *client.Client) {
+	key, name := string(c.Argv[0]), string(c.Argv[1])
+
+	minIdle, ok := parseInt(c, c.Argv[3])
+	if !ok {
+		return
+	}
+
+	// The IDs are followed by the options
+	var ids []datastructure.StreamID
+	i := 4
+	for ; i < c.Argc; i++ {
+		id, err := datastructure.ParseStreamID(string(c.Argv[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	deliveryTime := now
+	retryCount := int64(-1)
+	var force, justID bool
+	var lastID *datastructure.StreamID
+	for ; i < c.Argc; i++ {
+		opt := strings.ToLower(string(c.Argv[i]))
+		switch {
+		case opt == "force":
+			force = true
+		case opt == "justid":
+			justID = true
+		case (opt == "idle" || opt == "time" || opt == "retrycount") && i+1 < c.Argc:
+			n, ok := parseInt(c, c.Argv[i+1])
+			if !ok {
+				return
+			}
+
+			switch opt {
+			case "idle":
+				deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+			case "time":
+				deliveryTime = time.UnixMilli(n)
+			default:
+				retryCount = n
+			}
+			i++
+		case opt == "lastid" && i+1 < c.Argc:
+			id, ok := parseStreamID(c, c.Argv[i+1], 0)
+			if !ok {
+				return
+			}
+			lastID = &id
+			i++
+		default:
+			c.Conn.AsyncWrite(NewGenericError("Unrecognized XCLAIM option '" + string(c.Argv[i]) + "'"))
+			return
+		}
+	}
+
+	if deliveryTime.After(now) {
+		deliveryTime = now
+	}
+
+	stream, group, ok := lookupStreamGroup(c, key, name)
+	if !ok {
+		return
+	}
+
+	changed := false
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+		changed = true
+	}
+
+	consumer, created := group.CreateConsumer(string(c.Argv[2]), now)
+	consumer.SeenTime = now
+	if created {
+		propagateStreamCreateConsumer(c, key, group, consumer)
+		changed = true
+	}
+
+	var items [][]byte
+	claimed := false
+	for _, id := range ids {
+		p, pending := group.PendingEntry(id)
+		entry, exists := stream.Get(id)
+
+		if !exists {
+			// The entry was deleted from the stream, it can no longer be
+			// delivered
+			if pending {
+				group.Ack(id)
+				c.Propagate = append(c.Propagate, [][]byte{[]byte("xack"), []byte(key), []byte(name), []byte(id.String())})
+				changed = true
+			}
+			continue
+		}
+
+		if !pending && !force {
+			continue
+		}
+
+		if pending && minIdle > 0 && now.Sub(p.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+
+		count := retryCount
+		if count < 0 {
+			count = 0
+			if pending {
+				count = p.DeliveryCount
+			}
+
+			if !justID {
+				count++
+			}
+		}
+
+		p = group.Claim(id, consumer, deliveryTime, count)
+		propagateStreamClaim(c, key, group, p)
+		claimed = true
+		changed = true
+
+		if justID {
+			items = append(items, protocol.MakeBulkString(id.String()))
+		} else {
+			items = append(items, makeStreamEntry(entry))
+		}
+	}
+
+	if lastID != nil && !claimed {
+		propagateStreamSetID(c, key, group)
+	}
+
+	if changed {
+		c.DB.Touch(key)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(items...))
+}
+
+// xgroupLastID parses the last delivered ID of XGROUP CREATE and SETID, "$"
+// being the last ID of the stream.
+func xgroupLastID(c *client.Client, stream *datastructure.Stream, arg []byte) (datastructure.StreamID, bool) {
+	if string(arg) == "$" {
+		return stream.LastID(), true
+	}
+	return parseStreamID(c, arg, 0)
+}
+
+// xgroupCreateSubCommand creates a consumer group.
+func xgroupCreateSubCommand(c *client.Client) {
+	key, name := string(c.Argv[1]), string(c.Argv[2])
+
+	mkStream := false
+	for _, arg := range c.Argv[4:] {
+		if strings.ToLower(string(arg)) != "mkstream" {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+		mkStream = true
+	}
+
+	stream, found, ok := lookupValue[*datastructure.Stream](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		if !mkStream {
+			c.Conn.AsyncWrite(NewGenericError(errXGroupKeyRequired))
+			return
+		}
+		stream = datastructure.NewStream()
+	}
+
+	lastID, ok := xgroupLastID(c, stream, c.Argv[3])
+	if !ok {
+		return
+	}
+
+	if _, created := stream.CreateGroup(name, lastID); !created {
+		c.Conn.AsyncWrite(NewBusyGroupError())
+		return
+	}
+
+	if found {
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, stream, 0))
+	}
+
+	c.Propagate = [][][]byte{{[]byte("xgroup"), []byte("create"), []byte(key), []byte(name), []byte(lastID.String()), []byte("MKSTREAM")}}
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// lookupXGroupStream returns the stream of the XGROUP subcommands other than
+// CREATE, which require the key to exist.
+func lookupXGroupStream(c *client.Client, key string) (*datastructure.Stream, bool) {
+	stream, found, ok := lookupValue[*datastructure.Stream](c, key)
+	if !ok {
+		return nil, false
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError(errXGroupKeyRequired))
+		return nil, false
+	}
+	return stream, true
+}
+
+// lookupXGroup returns the consumer group of the XGROUP subcommands. If the
+// group is missing, a NOGROUP error is sent to the client.
+func lookupXGroup(c *client.Client, stream *datastructure.Stream, key, name string) (*datastructure.ConsumerGroup, bool) {
+	group, exists := stream.Group(name)
+	if !exists {
+		c.Conn.AsyncWrite(NewNoGroupError("No such consumer group '" + name + "' for key name '" + key + "'"))
+		return nil, false
+	}
+	return group, true
+}
+
+// xgroupSetIDSubCommand sets the last delivered ID of a consumer group.
+func xgroupSetIDSubCommand(c *client.Client) {
+	key, name := string(c.Argv[1]), string(c.Argv[2])
+
+	if c.Argc > 4 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	stream, ok := lookupXGroupStream(c, key)
+	if !ok {
+		return
+	}
+
+	group, ok := lookupXGroup(c, stream, key, name)
+	if !ok {
+		return
+	}
+
+	lastID, ok := xgroupLastID(c, stream, c.Argv[3])
+	if !ok {
+		return
+	}
+
+	group.LastID = lastID
+	c.DB.Touch(key)
+
+	propagateStreamSetID(c, key, group)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// xgroupDestroySubCommand deletes a consumer group.
+func xgroupDestroySubCommand(c *client.Client) {
+	key, name := string(c.Argv[1]), string(c.Argv[2])
+
+	stream, ok := lookupXGroupStream(c, key)
+	if !ok {
+		return
+	}
+
+	if !stream.DestroyGroup(name) {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.DB.Touch(key)
+	c.Propagate = [][][]byte{{[]byte("xgroup"), []byte("destroy"), []byte(key), []byte(name)}}
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// xgroupCreateConsumerSubCommand creates a consumer in a consumer group.
+func xgroupCreateConsumerSubCommand(c *client.Client) {
+	key, name, consumer := string(c.Argv[1]), string(c.Argv[2]), string(c.Argv[3])
+
+	stream, ok := lookupXGroupStream(c, key)
+	if !ok {
+		return
+	}
+
+	group, ok := lookupXGroup(c, stream, key, name)
+	if !ok {
+		return
+	}
+
+	if _, created := group.CreateConsumer(consumer, time.Now()); !created {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.DB.Touch(key)
+	c.Propagate = [][][]byte{{[]byte("xgroup"), []byte("createconsumer"), []byte(key), []byte(name), []byte(consumer)}}
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// xgroupDelConsumerSubCommand deletes a consumer from a consumer group and
+// returns the number of entries that were pending for it.
+func xgroupDelConsumerSubCommand(c *client.Client) {
+	key, name, consumer := string(c.Argv[1]), string(c.Argv[2]), string(c.Argv[3])
+
+	stream, ok := lookupXGroupStream(c, key)
+	if !ok {
+		return
+	}
+
+	group, ok := lookupXGroup(c, stream, key, name)
+	if !ok {
+		return
+	}
+
+	pending, deleted := group.DeleteConsumer(consumer)
+	if deleted {
+		c.DB.Touch(key)
+		c.Propagate = [][][]byte{{[]byte("xgroup"), []byte("delconsumer"), []byte(key), []byte(name), []byte(consumer)}}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(pending)))
+}
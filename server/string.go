@@ -2,6 +2,9 @@ package server
 
 import (
 	"bytes"
+	"errors"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/HotPotatoC/kvstore-rewrite/client"
@@ -10,91 +13,160 @@ import (
 	"github.com/HotPotatoC/kvstore-rewrite/protocol"
 )
 
-// getCommand gets the value of a key in the database
-func getCommand(c *client.Client) {
-	if c.Argc != 1 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'get' command"))
-		return
+// maxStringLength is the maximum length of a string value.
+const maxStringLength = 512 * 1024 * 1024
+
+// stringValue returns the value stored for a string, integers being stored
+// in their int64 form so that counters are not parsed on every update. The
+// value is copied since the arguments are backed by the read buffer.
+func stringValue(value []byte) any {
+	if n, err := common.ParseInt(value); err == nil {
+		return n
+	}
+	return append([]byte(nil), value...)
+}
+
+// stringBytes returns the bytes of a string value, whatever its encoding.
+// ok is false if the value is not a string.
+func stringBytes(data any) (b []byte, ok bool) {
+	switch v := data.(type) {
+	case []byte:
+		return v, true
+	case int64:
+		return strconv.AppendInt(nil, v, 10), true
+	case string:
+		// Values loaded from legacy snapshots
+		return []byte(v), true
+	}
+	return nil, false
+}
+
+// lookupString returns the string stored at the given key, whatever its
+// encoding. If the key holds a value of another type, a WRONGTYPE error is
+// sent to the client and ok is false.
+func lookupString(c *client.Client, key string) (value []byte, found bool, ok bool) {
+	item, found := c.DB.Get(key)
+	if !found {
+		return nil, false, true
+	}
+
+	if value, ok = stringBytes(item.Data); !ok {
+		c.Conn.AsyncWrite(NewWrongTypeError())
+		return nil, true, false
 	}
 
+	return value, true, true
+}
+
+// getCommand gets the value of a key in the database
+func getCommand(c *client.Client) {
 	key := string(c.Argv[0])
 
-	v, ok := c.DB.Get(key)
+	v, found, ok := lookupString(c, key)
 	if !ok {
+		return
+	}
+
+	if !found {
 		c.Conn.AsyncWrite(protocol.MakeNull())
 		return
 	}
 
-	c.Conn.AsyncWrite(protocol.MakeBulkString(v.Data.(string)))
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
 }
 
+// setFlags are the options of SET.
+type setFlags uint8
+
+const (
+	setNX setFlags = 1 << iota
+	setXX
+	setGet
+	setKeepTTL
+	setExpire
+)
+
 // setCommand sets the value of a key in the database
 func setCommand(c *client.Client) {
-	if c.Argc < 2 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'set' command"))
-		return
-	}
+	key, value := string(c.Argv[0]), c.Argv[1]
 
-	key, value := string(c.Argv[0]), string(c.Argv[1])
-
-	expiry := time.Duration(0)
-	if c.Argc > 2 {
-		option := string(bytes.ToLower(c.Argv[2]))
+	var flags setFlags
+	var ttl time.Duration
+	for i := 2; i < c.Argc; i++ {
+		option := string(bytes.ToLower(c.Argv[i]))
 		switch {
-		case (option == "ex" || option == "px"): // set expire time
-			if c.Argc != 4 {
-				c.Conn.AsyncWrite(NewGenericError("syntax error"))
-				return
-			}
-
-			n, err := common.ByteToInt(c.Argv[3])
-			if err != nil {
-				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		case option == "nx" && flags&setXX == 0: // set only if key does not exist
+			flags |= setNX
+		case option == "xx" && flags&setNX == 0: // set only if key exists
+			flags |= setXX
+		case option == "get": // reply with the old value
+			flags |= setGet
+		case option == "keepttl" && flags&setExpire == 0: // keep the expire time
+			flags |= setKeepTTL
+		case (option == "ex" || option == "px" || option == "exat" || option == "pxat") &&
+			flags&(setExpire|setKeepTTL) == 0 && i+1 < c.Argc: // set expire time
+			var ok bool
+			if ttl, ok = parseExpireTime(c, option, c.Argv[i+1], "set"); !ok {
 				return
 			}
+			flags |= setExpire
+			i++
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
 
-			if option == "ex" { // set expire time in seconds
-				expiry = time.Duration(n) * time.Second
-			}
+	item, found := c.DB.Get(key)
 
-			if option == "px" { // set expire time in milliseconds
-				expiry = time.Duration(n) * time.Millisecond
-			}
-		case option == "nx": // set only if key does not exist
-			if c.Argc != 3 {
-				c.Conn.AsyncWrite(NewGenericError("syntax error"))
-				return
-			}
+	var old []byte
+	if found && flags&setGet != 0 {
+		var ok bool
+		if old, ok = stringBytes(item.Data); !ok {
+			c.Conn.AsyncWrite(NewWrongTypeError())
+			return
+		}
+	}
 
-			if c.DB.Exists(key) {
-				c.Conn.AsyncWrite(protocol.MakeNull())
-				return
-			}
-		case option == "xx": // set only if key exists
-			if c.Argc != 3 {
-				c.Conn.AsyncWrite(NewGenericError("syntax error"))
-				return
-			}
+	reply := protocol.MakeSimpleString("OK")
+	if flags&setGet != 0 {
+		reply = protocol.MakeNull()
+		if found {
+			reply = protocol.MakeBulkString(string(old))
+		}
+	}
 
-			if !c.DB.Exists(key) {
-				c.Conn.AsyncWrite(protocol.MakeNull())
-				return
-			}
+	if (flags&setNX != 0 && found) || (flags&setXX != 0 && !found) {
+		if flags&setGet == 0 {
+			reply = protocol.MakeNull()
 		}
+		c.Conn.AsyncWrite(reply)
+		return
 	}
 
-	c.DB.Store(datastructure.NewItem(key, value, expiry))
+	switch {
+	case flags&setKeepTTL != 0 && found:
+		item.Data = stringValue(value)
+		c.DB.Touch(key)
+		server.notifyKeyspaceEvent(notifyString, "set", key)
+	case flags&setExpire != 0 && ttl <= 0:
+		// The absolute expire time is already in the past
+		c.DB.Store(datastructure.NewItem(key, stringValue(value), 0))
+		server.notifyKeyspaceEvent(notifyString, "set", key)
+		c.DB.Delete(key)
+	default:
+		c.DB.Store(datastructure.NewItem(key, stringValue(value), ttl))
+		server.notifyKeyspaceEvent(notifyString, "set", key)
+		if flags&setExpire != 0 {
+			server.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+		}
+	}
 
-	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+	c.Conn.AsyncWrite(reply)
 }
 
 // delCommand deletes a key from the database
 func delCommand(c *client.Client) {
-	if c.Argc != 1 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'del' command"))
-		return
-	}
-
 	key := string(c.Argv[0])
 
 	n := c.DB.Delete(key)
@@ -102,13 +174,19 @@ func delCommand(c *client.Client) {
 	c.Conn.AsyncWrite(protocol.MakeInteger(n))
 }
 
-// keysCommand returns all keys in the database
-func keysCommand(c *client.Client) {
-	if c.Argc != 1 {
-		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'keys' command"))
+// typeCommand returns the type of the value stored at key
+func typeCommand(c *client.Client) {
+	v, ok := c.DB.Get(string(c.Argv[0]))
+	if !ok {
+		c.Conn.AsyncWrite(protocol.MakeSimpleString("none"))
 		return
 	}
 
+	c.Conn.AsyncWrite(protocol.MakeSimpleString(typeName(v.Data)))
+}
+
+// keysCommand returns all keys in the database
+func keysCommand(c *client.Client) {
 	var dbKeys []string
 
 	pattern := string(c.Argv[0])
@@ -127,3 +205,410 @@ func keysCommand(c *client.Client) {
 
 	c.Conn.AsyncWrite(protocol.MakeArray(keys...))
 }
+
+// incrDecrGenericCommand adds the increment to the integer stored at the key.
+// The command is a write command so the read-modify-write is never
+// interleaved with another client updating the same key.
+func incrDecrGenericCommand(c *client.Client, incr int64) {
+	key := string(c.Argv[0])
+
+	item, found := c.DB.Get(key)
+	if !found {
+		c.DB.Store(datastructure.NewItem(key, incr, 0))
+		server.notifyKeyspaceEvent(notifyString, "incrby", key)
+		c.Conn.AsyncWrite(protocol.MakeInteger(incr))
+		return
+	}
+
+	n, isInt := item.Data.(int64)
+	if !isInt {
+		b, ok := stringBytes(item.Data)
+		if !ok {
+			c.Conn.AsyncWrite(NewWrongTypeError())
+			return
+		}
+
+		var err error
+		if n, err = common.ParseInt(b); err != nil {
+			c.Conn.AsyncWrite(NewNotIntegerError())
+			return
+		}
+	}
+
+	n, err := common.AddInt(n, incr)
+	if errors.Is(err, common.ErrOverflow) {
+		c.Conn.AsyncWrite(NewGenericError("increment or decrement would overflow"))
+		return
+	}
+
+	// The value is updated in place to keep the expire time of the key
+	item.Data = n
+	c.DB.Touch(key)
+	server.notifyKeyspaceEvent(notifyString, "incrby", key)
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(n))
+}
+
+// incrCommand increments the integer stored at the key by one.
+func incrCommand(c *client.Client) {
+	incrDecrGenericCommand(c, 1)
+}
+
+// decrCommand decrements the integer stored at the key by one.
+func decrCommand(c *client.Client) {
+	incrDecrGenericCommand(c, -1)
+}
+
+// incrbyCommand increments the integer stored at the key by the given amount.
+func incrbyCommand(c *client.Client) {
+	incr, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	incrDecrGenericCommand(c, incr)
+}
+
+// decrbyCommand decrements the integer stored at the key by the given amount.
+func decrbyCommand(c *client.Client) {
+	decr, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	if decr == math.MinInt64 {
+		c.Conn.AsyncWrite(NewGenericError("decrement would overflow"))
+		return
+	}
+
+	incrDecrGenericCommand(c, -decr)
+}
+
+// incrbyfloatCommand increments the number stored at the key by the given
+// floating point amount.
+func incrbyfloatCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	incr, ok := parseFloat(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	var f float64
+	item, found := c.DB.Get(key)
+	if found {
+		b, ok := stringBytes(item.Data)
+		if !ok {
+			c.Conn.AsyncWrite(NewWrongTypeError())
+			return
+		}
+
+		var err error
+		if f, err = strconv.ParseFloat(string(b), 64); err != nil || math.IsNaN(f) {
+			c.Conn.AsyncWrite(NewGenericError("value is not a valid float"))
+			return
+		}
+	}
+
+	f += incr
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		c.Conn.AsyncWrite(NewGenericError("increment would produce NaN or Infinity"))
+		return
+	}
+
+	// The result is stored without an exponent so it can be incremented
+	// again by INCR if it is integral
+	value := strconv.AppendFloat(nil, f, 'f', -1, 64)
+	if found {
+		item.Data = stringValue(value)
+		c.DB.Touch(key)
+	} else {
+		c.DB.Store(datastructure.NewItem(key, stringValue(value), 0))
+	}
+	server.notifyKeyspaceEvent(notifyString, "incrbyfloat", key)
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(value)))
+}
+
+// appendCommand appends the value to the string stored at the key.
+func appendCommand(c *client.Client) {
+	key, value := string(c.Argv[0]), c.Argv[1]
+
+	item, found := c.DB.Get(key)
+	if !found {
+		c.DB.Store(datastructure.NewItem(key, append([]byte(nil), value...), 0))
+		server.notifyKeyspaceEvent(notifyString, "append", key)
+		c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(value))))
+		return
+	}
+
+	b, ok := stringBytes(item.Data)
+	if !ok {
+		c.Conn.AsyncWrite(NewWrongTypeError())
+		return
+	}
+
+	if len(b)+len(value) > maxStringLength {
+		c.Conn.AsyncWrite(NewGenericError("string exceeds maximum allowed size (proto-max-bulk-len)"))
+		return
+	}
+
+	b = append(b, value...)
+	item.Data = b
+	c.DB.Touch(key)
+	server.notifyKeyspaceEvent(notifyString, "append", key)
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(b))))
+}
+
+// strlenCommand returns the length of the string stored at the key.
+func strlenCommand(c *client.Client) {
+	v, _, ok := lookupString(c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(v))))
+}
+
+// getrangeCommand returns the substring of the string stored at the key
+// between the start and end offsets (both inclusive). Negative offsets start
+// from the end of the string.
+func getrangeCommand(c *client.Client) {
+	start, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	end, ok := parseInt(c, c.Argv[2])
+	if !ok {
+		return
+	}
+
+	v, _, ok := lookupString(c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	n := int64(len(v))
+	if start < 0 && end < 0 && start > end {
+		c.Conn.AsyncWrite(protocol.MakeBulkString(""))
+		return
+	}
+
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+
+	if n == 0 || start > end {
+		c.Conn.AsyncWrite(protocol.MakeBulkString(""))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v[start : end+1])))
+}
+
+// setrangeCommand overwrites the string stored at the key starting at the
+// given offset, padding the string with zero bytes if needed.
+func setrangeCommand(c *client.Client) {
+	key, value := string(c.Argv[0]), c.Argv[2]
+
+	offset, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	if offset < 0 {
+		c.Conn.AsyncWrite(NewGenericError("offset is out of range"))
+		return
+	}
+
+	item, b, _, ok := lookupStringForUpdate(c, key)
+	if !ok {
+		return
+	}
+
+	// An empty value does not modify the string, nor create the key
+	if len(value) == 0 {
+		c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(b))))
+		return
+	}
+
+	if offset+int64(len(value)) > maxStringLength {
+		c.Conn.AsyncWrite(NewGenericError("string exceeds maximum allowed size (proto-max-bulk-len)"))
+		return
+	}
+
+	if size := int(offset) + len(value); size > len(b) {
+		b = append(b, make([]byte, size-len(b))...)
+	}
+	copy(b[offset:], value)
+	storeString(c, "setrange", key, item, b)
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(len(b))))
+}
+
+// getdelCommand returns the string stored at the key and deletes the key.
+func getdelCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	v, found, ok := lookupString(c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.DB.Delete(key)
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+}
+
+// getexCommand returns the string stored at the key and optionally sets or
+// removes its expire time.
+func getexCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	var ttl time.Duration
+	var expire, persist bool
+	if c.Argc > 1 {
+		option := string(bytes.ToLower(c.Argv[1]))
+		switch {
+		case option == "persist" && c.Argc == 2:
+			persist = true
+		case (option == "ex" || option == "px" || option == "exat" || option == "pxat") && c.Argc == 3:
+			var ok bool
+			if ttl, ok = parseExpireTime(c, option, c.Argv[2], "getex"); !ok {
+				return
+			}
+			expire = true
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	v, found, ok := lookupString(c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	reply := protocol.MakeBulkString(string(v))
+
+	switch {
+	case expire && ttl <= 0:
+		c.DB.Delete(key)
+	case expire:
+		c.DB.Expire(key, ttl)
+		server.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+	case persist:
+		if c.DB.Persist(key) {
+			// Setting the value again is the simplest way to replay the
+			// removal of the expire time
+			c.Propagate = [][][]byte{{[]byte("set"), c.Argv[0], v}}
+			server.notifyKeyspaceEvent(notifyGeneric, "persist", key)
+		}
+	}
+
+	c.Conn.AsyncWrite(reply)
+}
+
+// getsetCommand sets the string value of the key and returns its old value.
+func getsetCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	v, found, ok := lookupString(c, key)
+	if !ok {
+		return
+	}
+
+	c.DB.Store(datastructure.NewItem(key, stringValue(c.Argv[1]), 0))
+	server.notifyKeyspaceEvent(notifyString, "set", key)
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(string(v)))
+}
+
+// msetCommand sets the values of multiple keys.
+func msetCommand(c *client.Client) {
+	if c.Argc%2 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'mset' command"))
+		return
+	}
+
+	for i := 0; i < c.Argc; i += 2 {
+		c.DB.Store(datastructure.NewItem(string(c.Argv[i]), stringValue(c.Argv[i+1]), 0))
+		server.notifyKeyspaceEvent(notifyString, "set", string(c.Argv[i]))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// msetnxCommand sets the values of multiple keys, only if none of them
+// exists.
+func msetnxCommand(c *client.Client) {
+	if c.Argc%2 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for 'msetnx' command"))
+		return
+	}
+
+	for i := 0; i < c.Argc; i += 2 {
+		if _, exists := c.DB.Peek(string(c.Argv[i])); exists {
+			c.Conn.AsyncWrite(protocol.MakeInteger(0))
+			return
+		}
+	}
+
+	for i := 0; i < c.Argc; i += 2 {
+		c.DB.Store(datastructure.NewItem(string(c.Argv[i]), stringValue(c.Argv[i+1]), 0))
+		server.notifyKeyspaceEvent(notifyString, "set", string(c.Argv[i]))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(1))
+}
+
+// mgetCommand returns the values of multiple keys. Keys that do not exist or
+// do not hold a string are returned as null.
+func mgetCommand(c *client.Client) {
+	items := make([][]byte, c.Argc)
+	for i, key := range c.Argv {
+		item, found := c.DB.Get(string(key))
+		if !found {
+			items[i] = protocol.MakeNull()
+			continue
+		}
+
+		v, ok := stringBytes(item.Data)
+		if !ok {
+			items[i] = protocol.MakeNull()
+			continue
+		}
+
+		items[i] = protocol.MakeBulkString(string(v))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(items...))
+}
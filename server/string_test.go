@@ -0,0 +1,103 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_SetOptions(t *testing.T) {
+	const (
+		syntaxError  = "ERR syntax error"
+		invalidTime  = "ERR invalid expire time in 'set' command"
+		notAnInteger = "ERR value is not an integer or out of range"
+	)
+
+	tc := []struct {
+		args     string
+		exists   bool
+		expected any
+	}{
+		{"set k v", false, "OK"},
+		{"set k v nx", false, "OK"},
+		{"set k v NX", true, nil},
+		{"set k v xx", false, nil},
+		{"set k v xx", true, "OK"},
+		{"set k v nx nx", false, "OK"},
+		{"set k v nx xx", false, syntaxError},
+		{"set k v xx nx", true, syntaxError},
+		{"set k v get", false, nil},
+		{"set k v get", true, []byte("old")},
+		{"set k v nx get", true, []byte("old")},
+		{"set k v xx get", false, nil},
+		{"set k v keepttl", true, "OK"},
+		{"set k v keepttl keepttl", true, "OK"},
+		{"set k v ex 10", false, "OK"},
+		{"set k v ex", false, syntaxError},
+		{"set k v ex 10 px 10", false, syntaxError},
+		{"set k v ex 10 ex 10", false, syntaxError},
+		{"set k v exat 10 pxat 10", false, syntaxError},
+		{"set k v ex 10 keepttl", false, syntaxError},
+		{"set k v keepttl px 10", false, syntaxError},
+		{"set k v ex 10 unknown", false, syntaxError},
+		{"set k v ex 0", false, invalidTime},
+		{"set k v px -1", false, invalidTime},
+		{"set k v ex ten", false, notAnInteger},
+		{"set k v ex 9223372036", false, "OK"},
+		{"set k v ex 9223372037", false, invalidTime},
+		{"set k v px 9223372036854", false, "OK"},
+		{"set k v px 9223372036855", false, invalidTime},
+		{"set k v exat 9223372036854775", false, "OK"},
+		{"set k v exat 9223372036854776", false, invalidTime},
+		{"set k v pxat 9223372036854775807", false, "OK"},
+		{"set k v pxat 9223372036854775808", false, notAnInteger},
+		{"set k v exat 1", true, "OK"},
+	}
+
+	for _, tt := range tc {
+		name := tt.args
+		if tt.exists {
+			name += " (exists)"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			newTestServer()
+			c, _ := newTestClient()
+			if tt.exists {
+				testCall(t, c, "set", "k", "old")
+			}
+
+			if reply := testCall(t, c, strings.Fields(tt.args)...); !reflect.DeepEqual(reply, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, reply)
+			}
+		})
+	}
+}
+
+func Test_SetExpireTime(t *testing.T) {
+	tc := []struct {
+		args     string
+		expected int
+	}{
+		{"set k v", -1},
+		{"set k v ex 100", 100000},
+		{"set k v px 100500", 100500},
+		{"set k v exat 1", -2},
+		{"set k v pxat 1", -2},
+		{"set k v keepttl", 50000},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.args, func(t *testing.T) {
+			newTestServer()
+			c, _ := newTestClient()
+			testCall(t, c, "set", "k", "old", "ex", "50")
+
+			testCall(t, c, strings.Fields(tt.args)...)
+			ttl, _ := testCall(t, c, "pttl", "k").(int)
+			if ttl > tt.expected || (tt.expected > 0 && ttl < tt.expected-1000) || (tt.expected < 0 && ttl != tt.expected) {
+				t.Errorf("expected a ttl of %d ms, got %d ms", tt.expected, ttl)
+			}
+		})
+	}
+}
@@ -0,0 +1,643 @@
+package server
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// tsCreateOptions are the options of a new time series.
+type tsCreateOptions struct {
+	retention       int64
+	duplicatePolicy datastructure.TimeSeriesDuplicatePolicy
+	labels          []datastructure.TimeSeriesLabel
+	// onDuplicate overrides the duplicate policy of the time series when
+	// adding a sample
+	onDuplicate    datastructure.TimeSeriesDuplicatePolicy
+	hasOnDuplicate bool
+}
+
+// newTimeSeries returns a new time series with the options.
+func (o tsCreateOptions) newTimeSeries() *datastructure.TimeSeries {
+	series := datastructure.NewTimeSeries()
+	series.Retention = o.retention
+	series.DuplicatePolicy = o.duplicatePolicy
+	series.Labels = o.labels
+	return series
+}
+
+// parseTSCreateOptions parses the options of a new time series, and
+// ON_DUPLICATE when onDuplicate is true. If an option is invalid, an error
+// is sent to the client and ok is false.
+func parseTSCreateOptions(c *client.Client, args [][]byte, onDuplicate bool) (tsCreateOptions, bool) {
+	var opts tsCreateOptions
+	for i := 0; i < len(args); i++ {
+		name := strings.ToLower(string(args[i]))
+		if name == "labels" {
+			if (len(args)-i-1)%2 != 0 {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: wrong label-value pairs"))
+				return opts, false
+			}
+
+			for i++; i < len(args); i += 2 {
+				opts.labels = append(opts.labels, datastructure.TimeSeriesLabel{Name: string(args[i]), Value: string(args[i+1])})
+			}
+			break
+		}
+
+		if i+1 >= len(args) {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return opts, false
+		}
+		i++
+
+		switch name {
+		case "retention":
+			retention, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || retention < 0 {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: Couldn't parse RETENTION"))
+				return opts, false
+			}
+			opts.retention = retention
+		case "duplicate_policy", "on_duplicate":
+			policy, ok := datastructure.ParseTimeSeriesDuplicatePolicy(string(args[i]))
+			if !ok {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: Unknown DUPLICATE_POLICY"))
+				return opts, false
+			}
+
+			if name == "duplicate_policy" {
+				opts.duplicatePolicy = policy
+			} else if onDuplicate {
+				opts.onDuplicate, opts.hasOnDuplicate = policy, true
+			} else {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return opts, false
+			}
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return opts, false
+		}
+	}
+	return opts, true
+}
+
+// parseTSSample parses the timestamp and value of a sample, the timestamp *
+// being the current time. If either is invalid, an error is sent to the
+// client and ok is false.
+func parseTSSample(c *client.Client, timestamp, value []byte) (datastructure.TimeSeriesSample, bool) {
+	var sample datastructure.TimeSeriesSample
+
+	if string(timestamp) == "*" {
+		sample.Timestamp = time.Now().UnixMilli()
+	} else {
+		t, err := strconv.ParseInt(string(timestamp), 10, 64)
+		if err != nil || t < 0 {
+			c.Conn.AsyncWrite(NewGenericError("TSDB: invalid timestamp, must be a nonnegative integer"))
+			return sample, false
+		}
+		sample.Timestamp = t
+	}
+
+	v, err := strconv.ParseFloat(string(value), 64)
+	if err != nil || math.IsNaN(v) {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: invalid value"))
+		return sample, false
+	}
+	sample.Value = v
+
+	return sample, true
+}
+
+// newTSAddError returns the error of a sample that could not be added.
+func newTSAddError(err error) []byte {
+	if err == datastructure.ErrSampleTooOld {
+		return NewGenericError("TSDB: Timestamp is older than retention")
+	}
+	return NewGenericError("TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+}
+
+// addTimeSeriesSample adds the sample to the time series stored at the key
+// and the resulting compactions to the destinations of its rules.
+func addTimeSeriesSample(c *client.Client, key string, series *datastructure.TimeSeries, sample datastructure.TimeSeriesSample, policy datastructure.TimeSeriesDuplicatePolicy) error {
+	if err := series.Add(sample, policy); err != nil {
+		return err
+	}
+	c.DB.Touch(key)
+
+	for _, compaction := range series.Compact(sample.Timestamp) {
+		item, found := c.DB.Get(compaction.DestKey)
+		if !found {
+			continue
+		}
+
+		// Destinations replaced by another type are skipped
+		if dst, ok := item.Data.(*datastructure.TimeSeries); ok {
+			addTimeSeriesSample(c, compaction.DestKey, dst, compaction.Sample, datastructure.TimeSeriesDuplicateLast)
+		}
+	}
+	return nil
+}
+
+// tsCreateCommand creates an empty time series at the key.
+func tsCreateCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	opts, ok := parseTSCreateOptions(c, c.Argv[1:], false)
+	if !ok {
+		return
+	}
+
+	if _, found := c.DB.Get(key); found {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: key already exists"))
+		return
+	}
+
+	c.DB.Store(datastructure.NewItem(key, opts.newTimeSeries(), 0))
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// tsAddCommand adds a sample to the time series stored at the key, creating
+// it with the given options if it does not exist. Returns the timestamp of
+// the sample.
+func tsAddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	sample, ok := parseTSSample(c, c.Argv[1], c.Argv[2])
+	if !ok {
+		return
+	}
+
+	opts, ok := parseTSCreateOptions(c, c.Argv[3:], true)
+	if !ok {
+		return
+	}
+
+	series, found, ok := lookupValue[*datastructure.TimeSeries](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		series = opts.newTimeSeries()
+		c.DB.Store(datastructure.NewItem(key, series, 0))
+	}
+
+	policy := series.DuplicatePolicy
+	if opts.hasOnDuplicate {
+		policy = opts.onDuplicate
+	}
+
+	if err := addTimeSeriesSample(c, key, series, sample, policy); err != nil {
+		c.Conn.AsyncWrite(newTSAddError(err))
+		return
+	}
+
+	// The resolved timestamp is logged so that replaying the command adds
+	// the same sample
+	timestamp := strconv.FormatInt(sample.Timestamp, 10)
+	argv := append([][]byte{[]byte("ts.add"), c.Argv[0], []byte(timestamp)}, c.Argv[2:]...)
+	c.Propagate = [][][]byte{argv}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(sample.Timestamp))
+}
+
+// tsMAddCommand adds samples to the time series stored at the keys. Returns
+// the timestamp of each sample, or the error of the samples that could not
+// be added.
+func tsMAddCommand(c *client.Client) {
+	if c.Argc%3 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("wrong number of arguments for '" + c.Command + "' command"))
+		return
+	}
+
+	samples := make([]datastructure.TimeSeriesSample, c.Argc/3)
+	for i := range samples {
+		sample, ok := parseTSSample(c, c.Argv[3*i+1], c.Argv[3*i+2])
+		if !ok {
+			return
+		}
+		samples[i] = sample
+	}
+
+	replies := make([][]byte, len(samples))
+	argv := [][]byte{[]byte("ts.madd")}
+	for i, sample := range samples {
+		key := string(c.Argv[3*i])
+
+		item, found := c.DB.Get(key)
+		if !found {
+			replies[i] = NewGenericError("TSDB: the key does not exist")
+			continue
+		}
+
+		series, ok := item.Data.(*datastructure.TimeSeries)
+		if !ok {
+			replies[i] = NewWrongTypeError()
+			continue
+		}
+
+		if err := addTimeSeriesSample(c, key, series, sample, series.DuplicatePolicy); err != nil {
+			replies[i] = newTSAddError(err)
+			continue
+		}
+
+		replies[i] = protocol.MakeInteger(sample.Timestamp)
+		argv = append(argv, c.Argv[3*i], []byte(strconv.FormatInt(sample.Timestamp, 10)), c.Argv[3*i+2])
+	}
+
+	if len(argv) > 1 {
+		c.Propagate = [][][]byte{argv}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// tsRangeOptions are the options of TS.RANGE and TS.MRANGE.
+type tsRangeOptions struct {
+	from, to       int64
+	count          int
+	aggregation    datastructure.TimeSeriesAggregation
+	bucketDuration int64
+	withLabels     bool
+	filters        []tsFilter
+}
+
+// tsFilter matches the time series whose label is one of the values, or
+// has none of the values when negated. Without values, it matches the time
+// series without the label, or with it when negated.
+type tsFilter struct {
+	label   string
+	values  []string
+	negated bool
+}
+
+func (f tsFilter) match(series *datastructure.TimeSeries) bool {
+	value, ok := series.Label(f.label)
+	if len(f.values) == 0 {
+		return ok == f.negated
+	}
+
+	for _, v := range f.values {
+		if ok && v == value {
+			return !f.negated
+		}
+	}
+	return f.negated
+}
+
+// parseTSFilter parses a filter expression: label=value, label!=value,
+// label=(value,...), label!=(value,...), label= or label!=.
+func parseTSFilter(expr string) (tsFilter, bool) {
+	i := strings.IndexByte(expr, '=')
+	if i < 1 {
+		return tsFilter{}, false
+	}
+
+	f := tsFilter{label: expr[:i]}
+	if expr[i-1] == '!' {
+		f.label, f.negated = expr[:i-1], true
+	}
+
+	value := expr[i+1:]
+	switch {
+	case strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"):
+		f.values = strings.Split(value[1:len(value)-1], ",")
+	case value != "":
+		f.values = []string{value}
+	}
+
+	return f, f.label != ""
+}
+
+// parseTSTimestamp parses the bound of a range, - and + being the lowest
+// and highest timestamps.
+func parseTSTimestamp(arg []byte) (int64, bool) {
+	switch string(arg) {
+	case "-":
+		return 0, true
+	case "+":
+		return math.MaxInt64, true
+	}
+
+	t, err := strconv.ParseInt(string(arg), 10, 64)
+	return t, err == nil && t >= 0
+}
+
+// parseTSRangeOptions parses the arguments of TS.RANGE, or of TS.MRANGE
+// when multi is true. If an argument is invalid, an error is sent to the
+// client and ok is false.
+func parseTSRangeOptions(c *client.Client, args [][]byte, multi bool) (tsRangeOptions, bool) {
+	var opts tsRangeOptions
+
+	var ok bool
+	if opts.from, ok = parseTSTimestamp(args[0]); !ok {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: invalid fromTimestamp"))
+		return opts, false
+	}
+
+	if opts.to, ok = parseTSTimestamp(args[1]); !ok {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: invalid toTimestamp"))
+		return opts, false
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "count":
+			if i+1 >= len(args) {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return opts, false
+			}
+
+			i++
+			count, err := strconv.Atoi(string(args[i]))
+			if err != nil || count < 1 {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: Couldn't parse COUNT"))
+				return opts, false
+			}
+			opts.count = count
+		case "aggregation":
+			if i+2 >= len(args) {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return opts, false
+			}
+
+			aggregation, ok := datastructure.ParseTimeSeriesAggregation(string(args[i+1]))
+			if !ok {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: Unknown aggregation type"))
+				return opts, false
+			}
+
+			bucketDuration, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil || bucketDuration < 1 {
+				c.Conn.AsyncWrite(NewGenericError("TSDB: bucketDuration must be greater than zero"))
+				return opts, false
+			}
+
+			opts.aggregation, opts.bucketDuration = aggregation, bucketDuration
+			i += 2
+		case "withlabels":
+			if !multi {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return opts, false
+			}
+			opts.withLabels = true
+		case "filter":
+			if !multi {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return opts, false
+			}
+
+			for _, arg := range args[i+1:] {
+				f, ok := parseTSFilter(string(arg))
+				if !ok {
+					c.Conn.AsyncWrite(NewGenericError("TSDB: failed parsing labels"))
+					return opts, false
+				}
+				opts.filters = append(opts.filters, f)
+			}
+			i = len(args)
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return opts, false
+		}
+	}
+
+	if !multi {
+		return opts, true
+	}
+
+	// At least one filter must select time series by the value of a label
+	for _, f := range opts.filters {
+		if !f.negated && len(f.values) > 0 {
+			return opts, true
+		}
+	}
+
+	c.Conn.AsyncWrite(NewGenericError("TSDB: please provide at least one matcher"))
+	return opts, false
+}
+
+// makeTSRangeReply returns the samples of the time series within the range
+// as an array of timestamp and value pairs.
+func makeTSRangeReply(series *datastructure.TimeSeries, opts tsRangeOptions) []byte {
+	var samples []datastructure.TimeSeriesSample
+	if opts.bucketDuration == 0 {
+		samples = series.Range(opts.from, opts.to, opts.count)
+	} else {
+		samples = datastructure.AggregateTimeSeries(series.Range(opts.from, opts.to, 0), opts.aggregation, opts.bucketDuration)
+		if opts.count > 0 && len(samples) > opts.count {
+			samples = samples[:opts.count]
+		}
+	}
+
+	replies := make([][]byte, len(samples))
+	for i, s := range samples {
+		replies[i] = protocol.MakeArray(
+			protocol.MakeInteger(s.Timestamp),
+			protocol.MakeBulkString(formatFloat(s.Value)),
+		)
+	}
+	return protocol.MakeArray(replies...)
+}
+
+// tsRangeCommand returns the samples of the time series stored at the key
+// within the range, optionally aggregated over time buckets.
+func tsRangeCommand(c *client.Client) {
+	series, found, ok := lookupValue[*datastructure.TimeSeries](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	opts, ok := parseTSRangeOptions(c, c.Argv[1:], false)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: the key does not exist"))
+		return
+	}
+
+	c.Conn.AsyncWrite(makeTSRangeReply(series, opts))
+}
+
+// tsMRangeCommand returns the samples within the range of every time series
+// matching the filters, ordered by key.
+func tsMRangeCommand(c *client.Client) {
+	opts, ok := parseTSRangeOptions(c, c.Argv, true)
+	if !ok {
+		return
+	}
+
+	keys := c.DB.Keys()
+	sort.Strings(keys)
+
+	var replies [][]byte
+	for _, key := range keys {
+		item, found := c.DB.Get(key)
+		if !found {
+			continue
+		}
+
+		series, ok := item.Data.(*datastructure.TimeSeries)
+		if !ok {
+			continue
+		}
+
+		matched := true
+		for _, f := range opts.filters {
+			if !f.match(series) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var labels [][]byte
+		if opts.withLabels {
+			for _, l := range series.Labels {
+				labels = append(labels, makeStringArray([]string{l.Name, l.Value}))
+			}
+		}
+
+		replies = append(replies, protocol.MakeArray(
+			protocol.MakeBulkString(key),
+			protocol.MakeArray(labels...),
+			makeTSRangeReply(series, opts),
+		))
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeArray(replies...))
+}
+
+// lookupTimeSeriesForRule returns the time series stored at the key. If the
+// key does not exist or holds a value of another type, an error is sent to
+// the client and ok is false.
+func lookupTimeSeriesForRule(c *client.Client, key string) (*datastructure.TimeSeries, bool) {
+	series, found, ok := lookupValue[*datastructure.TimeSeries](c, key)
+	if !ok {
+		return nil, false
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: the key does not exist"))
+		return nil, false
+	}
+	return series, true
+}
+
+// hasTimeSeriesSource returns true if the time series is the destination of
+// a compaction rule of an existing time series.
+func hasTimeSeriesSource(c *client.Client, series *datastructure.TimeSeries, key string) bool {
+	if series.SourceKey == "" {
+		return false
+	}
+
+	item, found := c.DB.Get(series.SourceKey)
+	if !found {
+		return false
+	}
+
+	src, ok := item.Data.(*datastructure.TimeSeries)
+	if !ok {
+		return false
+	}
+
+	_, ok = src.Rule(key)
+	return ok
+}
+
+// tsCreateRuleCommand creates a compaction rule downsampling the source time
+// series into the destination time series.
+func tsCreateRuleCommand(c *client.Client) {
+	srcKey, dstKey := string(c.Argv[0]), string(c.Argv[1])
+
+	if c.Argc != 5 || !strings.EqualFold(string(c.Argv[2]), "aggregation") {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	aggregation, ok := datastructure.ParseTimeSeriesAggregation(string(c.Argv[3]))
+	if !ok {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: Unknown aggregation type"))
+		return
+	}
+
+	bucketDuration, err := strconv.ParseInt(string(c.Argv[4]), 10, 64)
+	if err != nil || bucketDuration < 1 {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: bucketDuration must be greater than zero"))
+		return
+	}
+
+	if srcKey == dstKey {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: the source key and destination key should be different"))
+		return
+	}
+
+	src, ok := lookupTimeSeriesForRule(c, srcKey)
+	if !ok {
+		return
+	}
+
+	dst, ok := lookupTimeSeriesForRule(c, dstKey)
+	if !ok {
+		return
+	}
+
+	if hasTimeSeriesSource(c, dst, dstKey) {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: the destination key already has a src rule"))
+		return
+	}
+
+	// Destinations without rules cannot form a cycle
+	if len(dst.Rules) > 0 {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: the destination key already has a dst rule"))
+		return
+	}
+
+	src.Rules = append(src.Rules, &datastructure.TimeSeriesRule{
+		DestKey:        dstKey,
+		Aggregation:    aggregation,
+		BucketDuration: bucketDuration,
+	})
+	dst.SourceKey = srcKey
+
+	c.DB.Touch(srcKey)
+	c.DB.Touch(dstKey)
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
+
+// tsDeleteRuleCommand deletes the compaction rule from the source time
+// series into the destination time series.
+func tsDeleteRuleCommand(c *client.Client) {
+	srcKey, dstKey := string(c.Argv[0]), string(c.Argv[1])
+
+	src, ok := lookupTimeSeriesForRule(c, srcKey)
+	if !ok {
+		return
+	}
+
+	if !src.DeleteRule(dstKey) {
+		c.Conn.AsyncWrite(NewGenericError("TSDB: compaction rule does not exist"))
+		return
+	}
+	c.DB.Touch(srcKey)
+
+	if item, found := c.DB.Get(dstKey); found {
+		if dst, ok := item.Data.(*datastructure.TimeSeries); ok && dst.SourceKey == srcKey {
+			dst.SourceKey = ""
+			c.DB.Touch(dstKey)
+		}
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeSimpleString("OK"))
+}
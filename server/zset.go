@@ -0,0 +1,806 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/HotPotatoC/kvstore-rewrite/client"
+	"github.com/HotPotatoC/kvstore-rewrite/command"
+	"github.com/HotPotatoC/kvstore-rewrite/datastructure"
+	"github.com/HotPotatoC/kvstore-rewrite/protocol"
+)
+
+// zaddFlags are the options of ZADD.
+type zaddFlags uint8
+
+const (
+	zaddNX zaddFlags = 1 << iota
+	zaddXX
+	zaddGT
+	zaddLT
+	zaddCH
+	zaddIncr
+)
+
+// zsetModified marks the sorted set as modified, publishes the event and
+// deletes the sorted set once it is empty.
+func zsetModified(c *client.Client, event, key string, zset *datastructure.ZSet) {
+	server.notifyKeyspaceEvent(notifyZSet, event, key)
+
+	if zset.Len() == 0 {
+		c.DB.Delete(key)
+		return
+	}
+
+	c.DB.Touch(key)
+}
+
+// makeZSetArray creates an array of the members, followed by their
+// score if withScores is true.
+func makeZSetArray(entries []datastructure.ZSetEntry, withScores bool) []byte {
+	items := make([][]byte, 0, len(entries)*2)
+	for _, e := range entries {
+		items = append(items, protocol.MakeBulkString(e.Member))
+		if withScores {
+			items = append(items, protocol.MakeBulkString(formatFloat(e.Score)))
+		}
+	}
+	return protocol.MakeArray(items...)
+}
+
+// zaddCommand adds members to the sorted set or updates their score.
+func zaddCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	var flags zaddFlags
+	i := 1
+options:
+	for ; i < c.Argc; i++ {
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "nx":
+			flags |= zaddNX
+		case "xx":
+			flags |= zaddXX
+		case "gt":
+			flags |= zaddGT
+		case "lt":
+			flags |= zaddLT
+		case "ch":
+			flags |= zaddCH
+		case "incr":
+			flags |= zaddIncr
+		default:
+			break options
+		}
+	}
+
+	elements := c.Argv[i:]
+	if len(elements) == 0 || len(elements)%2 != 0 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	if flags&zaddNX != 0 && flags&zaddXX != 0 {
+		c.Conn.AsyncWrite(NewGenericError("XX and NX options at the same time are not compatible"))
+		return
+	}
+
+	if (flags&zaddGT != 0 && flags&(zaddLT|zaddNX) != 0) || (flags&zaddLT != 0 && flags&zaddNX != 0) {
+		c.Conn.AsyncWrite(NewGenericError("GT, LT, and/or NX options at the same time are not compatible"))
+		return
+	}
+
+	if flags&zaddIncr != 0 && len(elements) > 2 {
+		c.Conn.AsyncWrite(NewGenericError("INCR option supports a single increment-element pair"))
+		return
+	}
+
+	// Parse every score before modifying the set so a bad score
+	// leaves it untouched
+	scores := make([]float64, len(elements)/2)
+	for j := range scores {
+		score, ok := parseFloat(c, elements[j*2])
+		if !ok {
+			return
+		}
+		scores[j] = score
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		zset = datastructure.NewZSet()
+	}
+
+	var added, updated int64
+	var score float64
+	skipped := false
+	for j, s := range scores {
+		member := string(elements[j*2+1])
+		score = s
+
+		cur, exists := zset.Score(member)
+		if exists {
+			if flags&zaddNX != 0 {
+				skipped = true
+				continue
+			}
+
+			if flags&zaddIncr != 0 {
+				score = cur + s
+				if math.IsNaN(score) {
+					c.Conn.AsyncWrite(NewGenericError("resulting score is not a number (NaN)"))
+					return
+				}
+			}
+
+			if (flags&zaddGT != 0 && score <= cur) || (flags&zaddLT != 0 && score >= cur) {
+				skipped = true
+				continue
+			}
+
+			if score != cur {
+				zset.Add(member, score)
+				updated++
+			}
+			continue
+		}
+
+		if flags&zaddXX != 0 {
+			skipped = true
+			continue
+		}
+
+		zset.Add(member, score)
+		added++
+	}
+
+	if added+updated > 0 {
+		if !found {
+			c.DB.Store(datastructure.NewItem(key, zset, 0))
+		}
+		c.DB.Touch(key)
+		server.signalKeyAsReady(key)
+
+		event := "zadd"
+		if flags&zaddIncr != 0 {
+			event = "zincr"
+		}
+		server.notifyKeyspaceEvent(notifyZSet, event, key)
+	}
+
+	switch {
+	case flags&zaddIncr != 0 && skipped:
+		c.Conn.AsyncWrite(protocol.MakeNull())
+	case flags&zaddIncr != 0:
+		c.Conn.AsyncWrite(protocol.MakeBulkString(formatFloat(score)))
+	case flags&zaddCH != 0:
+		c.Conn.AsyncWrite(protocol.MakeInteger(added + updated))
+	default:
+		c.Conn.AsyncWrite(protocol.MakeInteger(added))
+	}
+}
+
+// zincrbyCommand increments the score of the member of the sorted set.
+func zincrbyCommand(c *client.Client) {
+	key := string(c.Argv[0])
+	member := string(c.Argv[2])
+
+	incr, ok := parseFloat(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		zset = datastructure.NewZSet()
+	}
+
+	score, _ := zset.Score(member)
+	score += incr
+	if math.IsNaN(score) {
+		c.Conn.AsyncWrite(NewGenericError("resulting score is not a number (NaN)"))
+		return
+	}
+
+	zset.Add(member, score)
+	if !found {
+		c.DB.Store(datastructure.NewItem(key, zset, 0))
+	}
+
+	c.DB.Touch(key)
+	server.signalKeyAsReady(key)
+	server.notifyKeyspaceEvent(notifyZSet, "zincr", key)
+	c.Conn.AsyncWrite(protocol.MakeBulkString(formatFloat(score)))
+}
+
+// zremCommand removes the given members from the sorted set.
+func zremCommand(c *client.Client) {
+	key := string(c.Argv[0])
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, key)
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	var removed int64
+	for _, member := range c.Argv[1:] {
+		if zset.Remove(string(member)) {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		zsetModified(c, "zrem", key, zset)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(removed))
+}
+
+// zcardCommand returns the number of members in the sorted set.
+func zcardCommand(c *client.Client) {
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeInteger(0))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(zset.Len())))
+}
+
+// zscoreCommand returns the score of the member of the sorted set.
+func zscoreCommand(c *client.Client) {
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	score, exists := zset.Score(string(c.Argv[1]))
+	if !exists {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeBulkString(formatFloat(score)))
+}
+
+func zrankGenericCommand(c *client.Client, reverse bool) {
+	withScore := false
+	if c.Argc == 3 {
+		if !bytes.EqualFold(c.Argv[2], []byte("withscore")) {
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+		withScore = true
+	} else if c.Argc > 3 {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	member := string(c.Argv[1])
+	rank, exists := zset.Rank(member, reverse)
+	if !exists {
+		c.Conn.AsyncWrite(protocol.MakeNull())
+		return
+	}
+
+	if withScore {
+		score, _ := zset.Score(member)
+		c.Conn.AsyncWrite(protocol.MakeArray(
+			protocol.MakeInteger(int64(rank)),
+			protocol.MakeBulkString(formatFloat(score)),
+		))
+		return
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(rank)))
+}
+
+// zrankCommand returns the rank of the member, ordered from the lowest score.
+func zrankCommand(c *client.Client) {
+	zrankGenericCommand(c, false)
+}
+
+// zrevrankCommand returns the rank of the member, ordered from the highest score.
+func zrevrankCommand(c *client.Client) {
+	zrankGenericCommand(c, true)
+}
+
+// parseScoreBound parses a score range bound such as "1.5", "(1.5" or "-inf".
+func parseScoreBound(arg []byte) (float64, bool, bool) {
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false, false
+	}
+
+	return f, exclusive, true
+}
+
+// parseLexBound parses a lexicographical range bound such as "[a", "(a",
+// "-" or "+".
+func parseLexBound(arg []byte) (datastructure.LexBound, bool) {
+	switch {
+	case len(arg) == 1 && arg[0] == '-':
+		return datastructure.LexBound{Infinite: -1}, true
+	case len(arg) == 1 && arg[0] == '+':
+		return datastructure.LexBound{Infinite: 1}, true
+	case len(arg) > 0 && arg[0] == '(':
+		return datastructure.LexBound{Value: string(arg[1:]), Exclusive: true}, true
+	case len(arg) > 0 && arg[0] == '[':
+		return datastructure.LexBound{Value: string(arg[1:])}, true
+	}
+	return datastructure.LexBound{}, false
+}
+
+type zrangeType uint8
+
+const (
+	zrangeRank zrangeType = iota
+	zrangeScore
+	zrangeLex
+)
+
+// zrangeGenericCommand implements ZRANGE and its variants. The arguments
+// following the key, start and stop are parsed as options.
+func zrangeGenericCommand(c *client.Client, rangeType zrangeType, reverse bool) {
+	start, stop := c.Argv[1], c.Argv[2]
+
+	withScores := false
+	limit := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < c.Argc; i++ {
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "withscores":
+			withScores = true
+		case "byscore":
+			rangeType = zrangeScore
+		case "bylex":
+			rangeType = zrangeLex
+		case "rev":
+			reverse = true
+		case "limit":
+			if i+2 >= c.Argc {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+
+			var ok bool
+			if offset, ok = parseInt(c, c.Argv[i+1]); !ok {
+				return
+			}
+			if count, ok = parseInt(c, c.Argv[i+2]); !ok {
+				return
+			}
+
+			limit = true
+			i += 2
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	if limit && rangeType == zrangeRank {
+		c.Conn.AsyncWrite(NewGenericError("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"))
+		return
+	}
+
+	if withScores && rangeType == zrangeLex {
+		c.Conn.AsyncWrite(NewGenericError("syntax error, WITHSCORES not supported in combination with BYLEX"))
+		return
+	}
+
+	// With REV, score and lex ranges are given from max to min
+	if reverse && rangeType != zrangeRank {
+		start, stop = stop, start
+	}
+
+	var fetch func(*datastructure.ZSet) []datastructure.ZSetEntry
+	switch rangeType {
+	case zrangeRank:
+		startRank, ok := parseInt(c, start)
+		if !ok {
+			return
+		}
+
+		stopRank, ok := parseInt(c, stop)
+		if !ok {
+			return
+		}
+
+		fetch = func(zset *datastructure.ZSet) []datastructure.ZSetEntry {
+			return zset.Range(int(startRank), int(stopRank), reverse)
+		}
+	case zrangeScore:
+		var r datastructure.ScoreRange
+		var ok1, ok2 bool
+		r.Min, r.MinExclusive, ok1 = parseScoreBound(start)
+		r.Max, r.MaxExclusive, ok2 = parseScoreBound(stop)
+		if !ok1 || !ok2 {
+			c.Conn.AsyncWrite(NewGenericError("min or max is not a float"))
+			return
+		}
+
+		fetch = func(zset *datastructure.ZSet) []datastructure.ZSetEntry {
+			return zset.RangeByScore(r, reverse, int(offset), int(count))
+		}
+	case zrangeLex:
+		var r datastructure.LexRange
+		var ok1, ok2 bool
+		r.Min, ok1 = parseLexBound(start)
+		r.Max, ok2 = parseLexBound(stop)
+		if !ok1 || !ok2 {
+			c.Conn.AsyncWrite(NewGenericError("min or max not valid string range item"))
+			return
+		}
+
+		fetch = func(zset *datastructure.ZSet) []datastructure.ZSetEntry {
+			return zset.RangeByLex(r, reverse, int(offset), int(count))
+		}
+	}
+
+	zset, found, ok := lookupValue[*datastructure.ZSet](c, string(c.Argv[0]))
+	if !ok {
+		return
+	}
+
+	if !found || offset < 0 {
+		c.Conn.AsyncWrite(protocol.MakeArray())
+		return
+	}
+
+	c.Conn.AsyncWrite(makeZSetArray(fetch(zset), withScores))
+}
+
+// zrangeCommand returns the members of the sorted set within a range of
+// ranks, scores or members.
+func zrangeCommand(c *client.Client) {
+	zrangeGenericCommand(c, zrangeRank, false)
+}
+
+// zrangebyscoreCommand returns the members of the sorted set within a range
+// of scores.
+func zrangebyscoreCommand(c *client.Client) {
+	zrangeGenericCommand(c, zrangeScore, false)
+}
+
+// zsetAggregate is the function used to combine the scores of a member
+// present in multiple sets.
+type zsetAggregate func(a, b float64) float64
+
+func zsetAggregateSum(a, b float64) float64 {
+	// inf + -inf is NaN, which is never a valid score
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// zsetSource is a sorted set or a set used as the input of ZUNIONSTORE and
+// ZINTERSTORE. The members of a set all have a score of 1.
+type zsetSource struct {
+	zset *datastructure.ZSet
+	set  *datastructure.Set
+}
+
+func (s zsetSource) len() int {
+	switch {
+	case s.zset != nil:
+		return s.zset.Len()
+	case s.set != nil:
+		return s.set.Len()
+	}
+	return 0
+}
+
+func (s zsetSource) entries() []datastructure.ZSetEntry {
+	switch {
+	case s.zset != nil:
+		return s.zset.Entries()
+	case s.set != nil:
+		members := s.set.Members()
+		entries := make([]datastructure.ZSetEntry, len(members))
+		for i, m := range members {
+			entries[i] = datastructure.ZSetEntry{Member: m, Score: 1}
+		}
+		return entries
+	}
+	return nil
+}
+
+func (s zsetSource) score(member string) (float64, bool) {
+	switch {
+	case s.zset != nil:
+		return s.zset.Score(member)
+	case s.set != nil:
+		return 1, s.set.Has(member)
+	}
+	return 0, false
+}
+
+// zunionInterGetKeys returns the keys of ZUNIONSTORE and ZINTERSTORE: the
+// destination followed by numkeys source keys.
+func zunionInterGetKeys(argv [][]byte) ([][]byte, error) {
+	if len(argv) < 3 {
+		return nil, command.ErrInvalidKeyArguments
+	}
+
+	numKeys, err := strconv.Atoi(string(argv[2]))
+	if err != nil || numKeys < 1 || numKeys > len(argv)-3 {
+		return nil, command.ErrInvalidKeyArguments
+	}
+
+	keys := [][]byte{argv[1]}
+	return append(keys, argv[3:3+numKeys]...), nil
+}
+
+func zunionInterGenericCommand(c *client.Client, union bool) {
+	dst := string(c.Argv[0])
+
+	numKeys, ok := parseInt(c, c.Argv[1])
+	if !ok {
+		return
+	}
+
+	if numKeys < 1 {
+		c.Conn.AsyncWrite(NewGenericError("at least 1 input key is needed for '" + c.Command + "' command"))
+		return
+	}
+
+	if numKeys > int64(c.Argc-2) {
+		c.Conn.AsyncWrite(NewGenericError("syntax error"))
+		return
+	}
+
+	keys := c.Argv[2 : 2+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	aggregate := zsetAggregate(zsetAggregateSum)
+	for i := 2 + int(numKeys); i < c.Argc; i++ {
+		switch strings.ToLower(string(c.Argv[i])) {
+		case "weights":
+			if i+int(numKeys) >= c.Argc {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+
+			for j := range weights {
+				w, err := strconv.ParseFloat(string(c.Argv[i+1+j]), 64)
+				if err != nil || math.IsNaN(w) {
+					c.Conn.AsyncWrite(NewGenericError("weight value is not a float"))
+					return
+				}
+				weights[j] = w
+			}
+			i += int(numKeys)
+		case "aggregate":
+			if i+1 >= c.Argc {
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+
+			switch strings.ToLower(string(c.Argv[i+1])) {
+			case "sum":
+				aggregate = zsetAggregateSum
+			case "min":
+				aggregate = math.Min
+			case "max":
+				aggregate = math.Max
+			default:
+				c.Conn.AsyncWrite(NewGenericError("syntax error"))
+				return
+			}
+			i++
+		default:
+			c.Conn.AsyncWrite(NewGenericError("syntax error"))
+			return
+		}
+	}
+
+	sources := make([]zsetSource, len(keys))
+	for i, key := range keys {
+		item, found := c.DB.Get(string(key))
+		if !found {
+			continue
+		}
+
+		switch v := item.Data.(type) {
+		case *datastructure.ZSet:
+			sources[i].zset = v
+		case *datastructure.Set:
+			sources[i].set = v
+		default:
+			c.Conn.AsyncWrite(NewWrongTypeError())
+			return
+		}
+	}
+
+	result := datastructure.NewZSet()
+	weighted := func(score, weight float64) float64 {
+		// 0 * inf is NaN, which is never a valid score
+		if s := score * weight; !math.IsNaN(s) {
+			return s
+		}
+		return 0
+	}
+
+	if union {
+		for i, src := range sources {
+			for _, e := range src.entries() {
+				score := weighted(e.Score, weights[i])
+				if cur, exists := result.Score(e.Member); exists {
+					score = aggregate(cur, score)
+				}
+				result.Add(e.Member, score)
+			}
+		}
+	} else {
+		// Iterate over the smallest set to test as few members as possible
+		smallest := 0
+		for i, src := range sources {
+			if src.len() < sources[smallest].len() {
+				smallest = i
+			}
+		}
+
+	next:
+		for _, e := range sources[smallest].entries() {
+			var score float64
+			for i, src := range sources {
+				s, exists := src.score(e.Member)
+				if !exists {
+					continue next
+				}
+
+				s = weighted(s, weights[i])
+				if i == 0 {
+					score = s
+				} else {
+					score = aggregate(score, s)
+				}
+			}
+			result.Add(e.Member, score)
+		}
+	}
+
+	if result.Len() == 0 {
+		c.DB.Delete(dst)
+	} else {
+		c.DB.Store(datastructure.NewItem(dst, result, 0))
+		server.signalKeyAsReady(dst)
+		server.notifyKeyspaceEvent(notifyZSet, c.Command, dst)
+	}
+
+	c.Conn.AsyncWrite(protocol.MakeInteger(int64(result.Len())))
+}
+
+// zunionstoreCommand stores the union of the given sorted sets in destination.
+func zunionstoreCommand(c *client.Client) {
+	zunionInterGenericCommand(c, true)
+}
+
+// zinterstoreCommand stores the intersection of the given sorted sets
+// in destination.
+func zinterstoreCommand(c *client.Client) {
+	zunionInterGenericCommand(c, false)
+}
+
+// zsetPop removes the member with the lowest or the highest score from the
+// sorted set and returns the reply of BZPOPMIN and BZPOPMAX. The pop is
+// logged as ZREM as the blocking commands must not block when replayed.
+func zsetPop(c *client.Client, key string, zset *datastructure.ZSet, max bool) []byte {
+	e, _ := zset.Pop(max)
+
+	event := "zpopmin"
+	if max {
+		event = "zpopmax"
+	}
+	zsetModified(c, event, key, zset)
+	c.Propagate = [][][]byte{{[]byte("zrem"), []byte(key), []byte(e.Member)}}
+
+	return protocol.MakeArray(
+		protocol.MakeBulkString(key),
+		protocol.MakeBulkString(e.Member),
+		protocol.MakeBulkString(formatFloat(e.Score)))
+}
+
+// bzpopGenericCommand pops a member from the first non-empty sorted set, or
+// waits until one of the sorted sets receives a member.
+func bzpopGenericCommand(c *client.Client, max bool) {
+	timeout, ok := parseBlockTimeout(c, c.Argv[c.Argc-1])
+	if !ok {
+		return
+	}
+
+	keys := make([]string, c.Argc-1)
+	for i, arg := range c.Argv[:c.Argc-1] {
+		keys[i] = string(arg)
+	}
+
+	for _, key := range keys {
+		zset, found, ok := lookupValue[*datastructure.ZSet](c, key)
+		if !ok {
+			return
+		}
+
+		if found {
+			c.Conn.AsyncWrite(zsetPop(c, key, zset, max))
+			return
+		}
+	}
+
+	if !canBlock(c) {
+		c.Conn.AsyncWrite(protocol.MakeNullArray())
+		return
+	}
+
+	server.blockClient(c, keys, timeout, protocol.MakeNullArray(), func(key string) bool {
+		item, found := c.DB.Peek(key)
+		if !found {
+			return false
+		}
+
+		zset, isZSet := item.Data.(*datastructure.ZSet)
+		if !isZSet {
+			return false
+		}
+
+		c.Conn.AsyncWrite(zsetPop(c, key, zset, max))
+		return true
+	})
+}
+
+// bzpopminCommand removes and returns the member with the lowest score of
+// the first non-empty sorted set, blocking until a member is added or the
+// timeout expires.
+func bzpopminCommand(c *client.Client) {
+	bzpopGenericCommand(c, false)
+}
+
+// bzpopmaxCommand removes and returns the member with the highest score of
+// the first non-empty sorted set, blocking until a member is added or the
+// timeout expires.
+func bzpopmaxCommand(c *client.Client) {
+	bzpopGenericCommand(c, true)
+}